@@ -0,0 +1,268 @@
+// Package client is a Go client of the API of elasticsearch-bblfsh serve
+// and daemon -addr: the REST API described by /openapi.json, and the
+// StreamDiff call of its gRPC service for the diffs between versions.
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Version is a version of the settings the API has.
+type Version struct {
+	Version      string    `json:"version"`
+	SourceCommit string    `json:"source_commit,omitempty"`
+	ExtractedAt  time.Time `json:"extracted_at"`
+	Settings     int       `json:"settings"`
+}
+
+// NormalizedValue is a default or a bound as a number in a fixed unit:
+// ratio, bytes, duration_ms, number or boolean.
+type NormalizedValue struct {
+	Value   float64 `json:"value"`
+	Unit    string  `json:"unit"`
+	Display string  `json:"display"`
+}
+
+// Blame is the last commit to change the declaration of a setting.
+type Blame struct {
+	Commit string    `json:"commit"`
+	Author string    `json:"author"`
+	Date   time.Time `json:"date"`
+}
+
+// Setting is a setting of a version, as described by settings.schema.json.
+type Setting struct {
+	Name                   string           `json:"name"`
+	RawName                string           `json:"raw_name"`
+	JavaType               string           `json:"java_type"`
+	Properties             []string         `json:"properties"`
+	DefaultArg             string           `json:"default_arg"`
+	CodeLine               uint32           `json:"code_line"`
+	CodeFile               string           `json:"code_file"`
+	FirstSeenVersion       string           `json:"first_seen_version,omitempty"`
+	RemovedInVersion       string           `json:"removed_in_version,omitempty"`
+	MinIndexCreatedVersion string           `json:"min_index_created_version,omitempty"`
+	NormalizedDefault      *NormalizedValue `json:"normalized_default,omitempty"`
+	MinArg                 string           `json:"min_arg,omitempty"`
+	MaxArg                 string           `json:"max_arg,omitempty"`
+	NormalizedMin          *NormalizedValue `json:"normalized_min,omitempty"`
+	NormalizedMax          *NormalizedValue `json:"normalized_max,omitempty"`
+	Parser                 string           `json:"parser,omitempty"`
+	Blame                  *Blame           `json:"blame,omitempty"`
+	Owners                 []string         `json:"owners,omitempty"`
+	Metrics                []string         `json:"metrics,omitempty"`
+	Tags                   []string         `json:"tags,omitempty"`
+	ExampleKeys            []string         `json:"example_keys,omitempty"`
+}
+
+// SettingsQuery is what Settings are filtered, sorted and paged by. Q is
+// searched for in the names and defaults, Namespace covers whole segments
+// of the names, the others have to match exactly. Dynamic and Deprecated
+// aren't filtered by when nil.
+type SettingsQuery struct {
+	// Version is the newest one when empty
+	Version    string
+	Q          string
+	Scope      string
+	Property   string
+	Module     string
+	Namespace  string
+	Dynamic    *bool
+	Deprecated *bool
+	// Sort is name, version or file, prefixed with - to sort descending
+	Sort string
+	// Limit is the size of the pages, every matching setting is on the
+	// first one when 0
+	Limit int
+	// Cursor is the NextCursor of the previous page
+	Cursor string
+}
+
+func (q SettingsQuery) values() url.Values {
+	params := url.Values{}
+	for name, value := range map[string]string{
+		"version": q.Version, "q": q.Q, "scope": q.Scope, "property": q.Property,
+		"module": q.Module, "namespace": q.Namespace, "sort": q.Sort, "cursor": q.Cursor,
+	} {
+		if value != "" {
+			params.Set(name, value)
+		}
+	}
+	if q.Dynamic != nil {
+		params.Set("dynamic", strconv.FormatBool(*q.Dynamic))
+	}
+	if q.Deprecated != nil {
+		params.Set("deprecated", strconv.FormatBool(*q.Deprecated))
+	}
+	if q.Limit > 0 {
+		params.Set("limit", strconv.Itoa(q.Limit))
+	}
+	return params
+}
+
+// SettingsPage is a page of the settings matching a query.
+type SettingsPage struct {
+	Version  string    `json:"version"`
+	Total    int       `json:"total"`
+	Settings []Setting `json:"settings"`
+	// NextCursor is the Cursor of the next page, empty on the last one
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Error is an error answered by the API.
+type Error struct {
+	// StatusCode is the HTTP status of a REST call
+	StatusCode int
+	// Code is the gRPC status of a gRPC call
+	Code    int
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Code != 0 {
+		return fmt.Sprintf("gRPC status %d: %s", e.Code, e.Message)
+	}
+	return fmt.Sprintf("%d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+// IsNotFound tells whether an error is of a version or a setting the API
+// doesn't have.
+func IsNotFound(err error) bool {
+	var e *Error
+	return errors.As(err, &e) && (e.StatusCode == http.StatusNotFound || e.Code == grpcNotFound)
+}
+
+// Client calls the API at a URL, i.e. http://localhost:8080.
+type Client struct {
+	url string
+
+	// HTTPClient makes the calls, http.DefaultClient for the REST API and
+	// one speaking HTTP/2 without TLS too for gRPC when nil. One given
+	// has to speak HTTP/2 for StreamDiff
+	HTTPClient *http.Client
+	// APIKey is sent as an ApiKey authorization, for servers started
+	// with -api-keys-file
+	APIKey string
+	// User and Password are sent as a basic authorization, for servers
+	// started with -user
+	User, Password string
+}
+
+// New returns a client of the API at a URL.
+func New(apiURL string) *Client {
+	return &Client{url: strings.TrimRight(apiURL, "/")}
+}
+
+func (c *Client) authorize(req *http.Request) {
+	switch {
+	case c.APIKey != "":
+		req.Header.Set("Authorization", "ApiKey "+c.APIKey)
+	case c.User != "":
+		req.SetBasicAuth(c.User, c.Password)
+	}
+}
+
+// httpError returns the error of a response, with the message of its JSON
+// body.
+func httpError(res *http.Response) error {
+	var body struct {
+		Error string `json:"error"`
+	}
+	b, _ := ioutil.ReadAll(io.LimitReader(res.Body, 64*1024))
+	if json.Unmarshal(b, &body) != nil || body.Error == "" {
+		body.Error = strings.TrimSpace(string(b))
+	}
+	return &Error{StatusCode: res.StatusCode, Message: body.Error}
+}
+
+// get decodes the JSON answered to a GET of a path of the REST API.
+func (c *Client) get(ctx context.Context, path string, params url.Values, v interface{}) error {
+	u := c.url + path
+	if len(params) > 0 {
+		u += "?" + params.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	c.authorize(req)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return httpError(res)
+	}
+	if err := json.NewDecoder(res.Body).Decode(v); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	return nil
+}
+
+// Versions returns the versions of the settings, the oldest first.
+func (c *Client) Versions(ctx context.Context) ([]Version, error) {
+	var res struct {
+		Versions []Version `json:"versions"`
+	}
+	err := c.get(ctx, "/api/versions", nil, &res)
+	return res.Versions, err
+}
+
+// Setting returns a setting of a version, the newest one when empty, or
+// the affix setting a key is one of, and the version it's of. The error is
+// IsNotFound when there is no such version or setting.
+func (c *Client) Setting(ctx context.Context, name, version string) (Setting, string, error) {
+	params := url.Values{}
+	if version != "" {
+		params.Set("version", version)
+	}
+	var res struct {
+		Version string  `json:"version"`
+		Setting Setting `json:"setting"`
+	}
+	err := c.get(ctx, "/api/settings/"+url.PathEscape(name), params, &res)
+	return res.Setting, res.Version, err
+}
+
+// Settings returns a page of the settings matching a query.
+func (c *Client) Settings(ctx context.Context, query SettingsQuery) (SettingsPage, error) {
+	var page SettingsPage
+	err := c.get(ctx, "/api/settings", query.values(), &page)
+	return page, err
+}
+
+// EachSetting calls fn for every setting matching a query, from its Cursor
+// on, a page of Limit settings at a time, until fn returns an error.
+func (c *Client) EachSetting(ctx context.Context, query SettingsQuery, fn func(Setting) error) error {
+	for {
+		page, err := c.Settings(ctx, query)
+		if err != nil {
+			return err
+		}
+		for _, s := range page.Settings {
+			if err := fn(s); err != nil {
+				return err
+			}
+		}
+		if page.NextCursor == "" {
+			return nil
+		}
+		query.Cursor = page.NextCursor
+	}
+}
@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// pagedServer answers /api/settings with the pages of names, two settings
+// a page, the cursor of a page being the name of its first setting.
+func pagedServer(t *testing.T, names ...string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/settings" || r.URL.Query().Get("limit") != "2" {
+			t.Errorf("unexpected request %s", r.URL)
+		}
+		start := 0
+		for i, name := range names {
+			if name == r.URL.Query().Get("cursor") {
+				start = i
+			}
+		}
+		page := SettingsPage{Version: "8.11", Total: len(names)}
+		for _, name := range names[start:] {
+			if len(page.Settings) == 2 {
+				page.NextCursor = name
+				break
+			}
+			page.Settings = append(page.Settings, Setting{Name: name})
+		}
+		json.NewEncoder(w).Encode(page)
+	}))
+}
+
+func TestSettingsQueryValues(t *testing.T) {
+	yes, no := true, false
+	for _, tc := range []struct {
+		query SettingsQuery
+		want  string
+	}{
+		{SettingsQuery{}, ""},
+		{SettingsQuery{Version: "8.11", Q: "port", Sort: "-version", Limit: 10}, "limit=10&q=port&sort=-version&version=8.11"},
+		{SettingsQuery{Namespace: "cluster.routing", Dynamic: &yes, Deprecated: &no, Cursor: "abc"}, "cursor=abc&deprecated=false&dynamic=true&namespace=cluster.routing"},
+		{SettingsQuery{Scope: "index", Property: "Final", Module: "server"}, "module=server&property=Final&scope=index"},
+	} {
+		if got := tc.query.values().Encode(); got != tc.want {
+			t.Errorf("%+v: got %s, want %s", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestEachSetting(t *testing.T) {
+	server := pagedServer(t, "a", "b", "c", "d", "e")
+	defer server.Close()
+	c := New(server.URL + "/")
+
+	var names []string
+	err := c.EachSetting(context.Background(), SettingsQuery{Limit: 2}, func(s Setting) error {
+		names = append(names, s.Name)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"a", "b", "c", "d", "e"}) {
+		t.Errorf("got %v, %v", names, err)
+	}
+
+	names = nil
+	err = c.EachSetting(context.Background(), SettingsQuery{Limit: 2, Cursor: "c"}, func(s Setting) error {
+		names = append(names, s.Name)
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(names, []string{"c", "d", "e"}) {
+		t.Errorf("from cursor c: got %v, %v", names, err)
+	}
+
+	stop := errors.New("stop")
+	names = nil
+	err = c.EachSetting(context.Background(), SettingsQuery{Limit: 2}, func(s Setting) error {
+		names = append(names, s.Name)
+		if s.Name == "c" {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || !reflect.DeepEqual(names, []string{"a", "b", "c"}) {
+		t.Errorf("stopped at c: got %v, %v", names, err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/settings/transport.nope":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":"no such setting"}`))
+		case "/api/settings":
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error":"limit has to be a positive number"}`))
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			w.Write([]byte("bad gateway\n"))
+		}
+	}))
+	defer server.Close()
+	c := New(server.URL)
+
+	_, _, err := c.Setting(context.Background(), "transport.nope", "")
+	if !IsNotFound(err) || err.Error() != "404 Not Found: no such setting" {
+		t.Errorf("unknown setting: %v", err)
+	}
+	_, err = c.Settings(context.Background(), SettingsQuery{})
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusBadRequest || e.Message != "limit has to be a positive number" || IsNotFound(err) {
+		t.Errorf("bad request: %v", err)
+	}
+	_, err = c.Versions(context.Background())
+	if e, ok := err.(*Error); !ok || e.StatusCode != http.StatusBadGateway || e.Message != "bad gateway" {
+		t.Errorf("not JSON: %v", err)
+	}
+}
+
+func TestClientAuthorization(t *testing.T) {
+	var got string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Get("Authorization")
+		w.Write([]byte(`{"versions":[{"version":"8.11","settings":3}]}`))
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		client *Client
+		want   string
+	}{
+		{&Client{url: server.URL}, ""},
+		{&Client{url: server.URL, APIKey: "key"}, "ApiKey key"},
+		{&Client{url: server.URL, User: "elastic", Password: "changeme"}, "Basic ZWxhc3RpYzpjaGFuZ2VtZQ=="},
+	} {
+		versions, err := tc.client.Versions(context.Background())
+		if err != nil || len(versions) != 1 || versions[0].Settings != 3 {
+			t.Errorf("got %v, %v", versions, err)
+		}
+		if got != tc.want {
+			t.Errorf("Authorization %q, want %q", got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,290 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// StreamDiff is called over the HTTP/2 of net/http, like the server answers
+// it, with the messages of settings_service.proto encoded by hand.
+
+// grpcNotFound is the gRPC status of a version that isn't there.
+const grpcNotFound = 5
+
+// grpcMaxMessage is the largest message read, the default of gRPC clients.
+const grpcMaxMessage = 4 << 20
+
+// grpcHTTPClient calls StreamDiff when the Client has no HTTPClient.
+var grpcHTTPClient = &http.Client{Transport: grpcTransport()}
+
+// DiffEvent is an entry of the diff between two versions: a setting added,
+// removed, renamed or changed.
+type DiffEvent struct {
+	// Event is added, removed, renamed or changed
+	Event    string   `json:"event"`
+	Name     string   `json:"name"`
+	Breaking bool     `json:"breaking"`
+	Fields   []string `json:"fields,omitempty"`
+	Old      *Setting `json:"old,omitempty"`
+	New      *Setting `json:"new,omitempty"`
+	From     string   `json:"from"`
+	To       string   `json:"to"`
+}
+
+// Diff returns the events of the diff between two versions, to the newest
+// one when to is empty.
+func (c *Client) Diff(ctx context.Context, from, to string) ([]DiffEvent, error) {
+	var events []DiffEvent
+	err := c.StreamDiff(ctx, from, to, false, func(e DiffEvent) error {
+		events = append(events, e)
+		return nil
+	})
+	return events, err
+}
+
+// StreamDiff calls fn for every event of the diff between two versions, to
+// the newest one when to is empty, as they are streamed. With follow, it
+// goes on with the events between the last version diffed and the newest
+// one whenever the server gets a new version, which keeps a copy of the
+// settings in sync, until ctx is done or fn returns an error.
+func (c *Client) StreamDiff(ctx context.Context, from, to string, follow bool, fn func(DiffEvent) error) error {
+	var request []byte
+	request = appendString(request, 1, from)
+	request = appendString(request, 2, to)
+	if follow {
+		request = append(request, 3<<3, 1)
+	}
+	frame := make([]byte, 5, 5+len(request))
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(request)))
+	frame = append(frame, request...)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.url+"/elasticsearch_bblfsh.Settings/StreamDiff", bytes.NewReader(frame))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("TE", "trailers")
+	c.authorize(req)
+	httpClient := c.HTTPClient
+	if httpClient == nil {
+		httpClient = grpcHTTPClient
+	}
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return httpError(res)
+	}
+
+	for {
+		message, err := readGRPCMessage(res.Body)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			return err
+		}
+		var e DiffEvent
+		if err := decodeDiffEvent(message, &e); err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return grpcStatus(res)
+}
+
+// readGRPCMessage reads a message of a response, io.EOF after the last one.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, errors.New("truncated gRPC message")
+		}
+		return nil, err
+	}
+	if prefix[0] != 0 {
+		return nil, errors.New("compressed gRPC messages aren't supported")
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > grpcMaxMessage {
+		return nil, fmt.Errorf("gRPC message of %d bytes, larger than 4MB", length)
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, errors.New("truncated gRPC message")
+	}
+	return message, nil
+}
+
+// grpcStatus returns the error of the status a call ended with, in its
+// trailers, or its headers when it failed before answering anything.
+func grpcStatus(res *http.Response) error {
+	status, message := res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message")
+	if status == "" {
+		status, message = res.Header.Get("Grpc-Status"), res.Header.Get("Grpc-Message")
+	}
+	if status == "" {
+		return errors.New("the gRPC call ended without a status")
+	}
+	code, err := strconv.Atoi(status)
+	if err != nil {
+		return fmt.Errorf("invalid gRPC status %q", status)
+	}
+	if code == 0 {
+		return nil
+	}
+	if unescaped, err := url.PathUnescape(message); err == nil {
+		message = unescaped
+	}
+	return &Error{Code: code, Message: message}
+}
+
+// appendString appends a string field to a message, leaving out an empty
+// one like proto3 does.
+func appendString(b []byte, field int, s string) []byte {
+	if s == "" {
+		return b
+	}
+	b = binary.AppendUvarint(b, uint64(field)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(s)))
+	return append(b, s...)
+}
+
+// decodeProto calls field for every field of a message, with the value of
+// varints and fixed size fields and the content of length delimited ones.
+func decodeProto(b []byte, field func(number int, v uint64, data []byte) error) error {
+	invalid := errors.New("invalid gRPC message")
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return invalid
+		}
+		b = b[n:]
+		var v uint64
+		var data []byte
+		switch key & 7 {
+		case 0:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return invalid
+			}
+			b = b[n:]
+		case 1:
+			if len(b) < 8 {
+				return invalid
+			}
+			v, b = binary.LittleEndian.Uint64(b), b[8:]
+		case 5:
+			if len(b) < 4 {
+				return invalid
+			}
+			v, b = uint64(binary.LittleEndian.Uint32(b)), b[4:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return invalid
+			}
+			data, b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			return invalid
+		}
+		if err := field(int(key>>3), v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func decodeDiffEvent(b []byte, e *DiffEvent) error {
+	return decodeProto(b, func(number int, v uint64, data []byte) error {
+		switch number {
+		case 1:
+			e.Event = string(data)
+		case 2:
+			e.Name = string(data)
+		case 3:
+			e.Breaking = v != 0
+		case 4:
+			e.Fields = append(e.Fields, string(data))
+		case 5:
+			e.Old = new(Setting)
+			return decodeSetting(data, e.Old)
+		case 6:
+			e.New = new(Setting)
+			return decodeSetting(data, e.New)
+		case 7:
+			e.From = string(data)
+		case 8:
+			e.To = string(data)
+		}
+		return nil
+	})
+}
+
+// decodeSetting decodes an ElasticsearchSetting of settings.proto.
+func decodeSetting(b []byte, s *Setting) error {
+	texts := map[int]*string{
+		1: &s.Name, 2: &s.RawName, 3: &s.JavaType, 5: &s.DefaultArg, 7: &s.CodeFile,
+		8: &s.FirstSeenVersion, 9: &s.RemovedInVersion, 13: &s.MinIndexCreatedVersion,
+		16: &s.Parser, 18: &s.MinArg, 19: &s.MaxArg,
+	}
+	lists := map[int]*[]string{4: &s.Properties, 11: &s.Owners, 12: &s.Metrics, 15: &s.Tags, 17: &s.ExampleKeys}
+	normalized := map[int]**NormalizedValue{14: &s.NormalizedDefault, 20: &s.NormalizedMin, 21: &s.NormalizedMax}
+	return decodeProto(b, func(number int, v uint64, data []byte) error {
+		switch {
+		case texts[number] != nil:
+			*texts[number] = string(data)
+		case lists[number] != nil:
+			*lists[number] = append(*lists[number], string(data))
+		case normalized[number] != nil:
+			n := new(NormalizedValue)
+			*normalized[number] = n
+			return decodeProto(data, func(number int, v uint64, data []byte) error {
+				switch number {
+				case 1:
+					n.Value = math.Float64frombits(v)
+				case 2:
+					n.Unit = string(data)
+				case 3:
+					n.Display = string(data)
+				}
+				return nil
+			})
+		case number == 6:
+			s.CodeLine = uint32(v)
+		case number == 10:
+			s.Blame = new(Blame)
+			return decodeProto(data, func(number int, v uint64, data []byte) error {
+				switch number {
+				case 1:
+					s.Blame.Commit = string(data)
+				case 2:
+					s.Blame.Author = string(data)
+				case 3:
+					date, err := time.Parse(time.RFC3339, string(data))
+					if err != nil {
+						return fmt.Errorf("blame date: %v", err)
+					}
+					s.Blame.Date = date
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
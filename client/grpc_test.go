@@ -0,0 +1,199 @@
+package client
+
+import (
+	"context"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func appendVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendDouble(b []byte, field int, v float64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|1)
+	return binary.LittleEndian.AppendUint64(b, math.Float64bits(v))
+}
+
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5)
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+func TestDecodeSetting(t *testing.T) {
+	var normalized, blame, b []byte
+	normalized = appendDouble(normalized, 1, 30000)
+	normalized = appendString(normalized, 2, "duration_ms")
+	normalized = appendString(normalized, 3, "30s")
+	blame = appendString(blame, 1, "abc123")
+	blame = appendString(blame, 2, "someone")
+	blame = appendString(blame, 3, "2023-11-02T10:00:00Z")
+	b = appendString(b, 1, "cluster.info.update.interval")
+	b = appendString(b, 3, "TimeValue")
+	b = appendString(b, 4, "NodeScope")
+	b = appendString(b, 4, "Dynamic")
+	b = appendString(b, 5, "30s")
+	b = appendVarint(b, 6, 42)
+	b = appendString(b, 10, string(blame))
+	b = appendString(b, 14, string(normalized))
+	b = appendString(b, 18, "10s")
+	// A fixed32 field of a later version of settings.proto is skipped
+	b = append(binary.AppendUvarint(b, 99<<3|5), 1, 2, 3, 4)
+
+	var s Setting
+	if err := decodeSetting(b, &s); err != nil {
+		t.Fatal(err)
+	}
+	want := Setting{
+		Name:              "cluster.info.update.interval",
+		JavaType:          "TimeValue",
+		Properties:        []string{"NodeScope", "Dynamic"},
+		DefaultArg:        "30s",
+		CodeLine:          42,
+		Blame:             &Blame{Commit: "abc123", Author: "someone", Date: time.Date(2023, 11, 2, 10, 0, 0, 0, time.UTC)},
+		NormalizedDefault: &NormalizedValue{Value: 30000, Unit: "duration_ms", Display: "30s"},
+		MinArg:            "10s",
+	}
+	if !reflect.DeepEqual(s, want) {
+		t.Errorf("got %+v\nwant %+v", s, want)
+	}
+
+	for _, invalid := range [][]byte{{0x0a, 5, 'a'}, {0x09, 1, 2}, {0x0b}, {0x80}} {
+		if err := decodeSetting(invalid, &Setting{}); err == nil {
+			t.Errorf("%x: no error", invalid)
+		}
+	}
+}
+
+func TestReadGRPCMessage(t *testing.T) {
+	for _, tc := range []struct {
+		frame []byte
+		want  string
+		err   string
+	}{
+		{grpcFrame([]byte("hello")), "hello", ""},
+		{grpcFrame(nil), "", ""},
+		{nil, "", "EOF"},
+		{[]byte{0, 0, 0}, "", "truncated gRPC message"},
+		{grpcFrame([]byte("hello"))[:7], "", "truncated gRPC message"},
+		{append([]byte{1}, grpcFrame([]byte("hello"))[1:]...), "", "compressed gRPC messages aren't supported"},
+		{[]byte{0, 0, 0x40, 0, 1}, "", "gRPC message of 4194305 bytes, larger than 4MB"},
+	} {
+		message, err := readGRPCMessage(strings.NewReader(string(tc.frame)))
+		if (err == nil && tc.err != "") || (err != nil && err.Error() != tc.err) || string(message) != tc.want {
+			t.Errorf("%x: got %q, %v, want %q, %s", tc.frame, message, err, tc.want, tc.err)
+		}
+	}
+}
+
+// diffServer answers StreamDiff with an event per name, then the status.
+// With follow it waits for the call to be cancelled after the first one.
+func diffServer(t *testing.T, status, message string, names ...string) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 || r.URL.Path != "/elasticsearch_bblfsh.Settings/StreamDiff" || r.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("unexpected %s %s %s", r.Proto, r.URL, r.Header.Get("Content-Type"))
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		var from, to string
+		follow := false
+		if err := decodeProto(b[5:], func(number int, v uint64, data []byte) error {
+			switch number {
+			case 1:
+				from = string(data)
+			case 2:
+				to = string(data)
+			case 3:
+				follow = v != 0
+			}
+			return nil
+		}); err != nil {
+			t.Error(err)
+		}
+
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status, Grpc-Message")
+		for _, name := range names {
+			var setting, event []byte
+			setting = appendString(setting, 1, name)
+			event = appendString(event, 1, "added")
+			event = appendString(event, 2, name)
+			event = appendString(event, 6, string(setting))
+			event = appendString(event, 7, from)
+			event = appendString(event, 8, to)
+			w.Write(grpcFrame(event))
+			w.(http.Flusher).Flush()
+			if follow {
+				<-r.Context().Done()
+				return
+			}
+		}
+		w.Header().Set("Grpc-Status", status)
+		w.Header().Set("Grpc-Message", message)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	return server
+}
+
+func TestStreamDiff(t *testing.T) {
+	server := diffServer(t, "0", "", "a", "b")
+	defer server.Close()
+	c := New(server.URL)
+	c.HTTPClient = server.Client()
+
+	events, err := c.Diff(context.Background(), "7.17", "8.11")
+	want := []DiffEvent{
+		{Event: "added", Name: "a", New: &Setting{Name: "a"}, From: "7.17", To: "8.11"},
+		{Event: "added", Name: "b", New: &Setting{Name: "b"}, From: "7.17", To: "8.11"},
+	}
+	if err != nil || !reflect.DeepEqual(events, want) {
+		t.Errorf("got %+v, %v", events, err)
+	}
+}
+
+func TestStreamDiffStatus(t *testing.T) {
+	server := diffServer(t, "5", "no such version 6.8%25", "a")
+	defer server.Close()
+	c := New(server.URL)
+	c.HTTPClient = server.Client()
+
+	events, err := c.Diff(context.Background(), "6.8", "")
+	if len(events) != 1 || !IsNotFound(err) || err.Error() != "gRPC status 5: no such version 6.8%" {
+		t.Errorf("got %v, %v", events, err)
+	}
+
+	server = diffServer(t, "", "", "a")
+	defer server.Close()
+	c = New(server.URL)
+	c.HTTPClient = server.Client()
+	if _, err := c.Diff(context.Background(), "7.17", ""); err == nil || err.Error() != "the gRPC call ended without a status" {
+		t.Errorf("no status: %v", err)
+	}
+}
+
+func TestStreamDiffFollow(t *testing.T) {
+	server := diffServer(t, "0", "", "a")
+	defer server.Close()
+	c := New(server.URL)
+	c.HTTPClient = server.Client()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var names []string
+	err := c.StreamDiff(ctx, "7.17", "", true, func(e DiffEvent) error {
+		names = append(names, e.Name)
+		cancel()
+		return nil
+	})
+	if err != context.Canceled || !reflect.DeepEqual(names, []string{"a"}) {
+		t.Errorf("got %v, %v", names, err)
+	}
+}
@@ -0,0 +1,15 @@
+//go:build go1.24
+
+package client
+
+import "net/http"
+
+// grpcTransport speaks HTTP/2 over TLS, and with prior knowledge without
+// it, which is how servers without -tls-cert answer gRPC calls.
+func grpcTransport() http.RoundTripper {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Protocols = new(http.Protocols)
+	transport.Protocols.SetHTTP2(true)
+	transport.Protocols.SetUnencryptedHTTP2(true)
+	return transport
+}
@@ -0,0 +1,12 @@
+//go:build !go1.24
+
+package client
+
+import "net/http"
+
+// grpcTransport only speaks HTTP/2 over TLS before Go 1.24, which added
+// HTTP/2 without TLS to net/http. StreamDiff then needs a server started
+// with -tls-cert.
+func grpcTransport() http.RoundTripper {
+	return http.DefaultTransport
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// affixExamples is set by -affix-examples to look for keys of the affix
+// settings in the tests and docs of the checkout.
+var affixExamples bool
+
+// maxExampleKeys is how many example keys an affix setting gets, the most
+// used first.
+const maxExampleKeys = 3
+
+// maxExampleFileSize skips files too large to be tests or docs worth
+// reading, i.e. test fixtures.
+const maxExampleFileSize = 1 << 20
+
+// exampleKeyPattern matches setting keys as they're written in tests and
+// docs. Placeholders like <cluster_alias> aren't examples and don't match.
+var exampleKeyPattern = regexp.MustCompile(`[a-z][a-z0-9_]*(?:\.[A-Za-z0-9_-]+)+`)
+
+// exampleDirs are the source sets of tests, keys are also looked for under
+// docs.
+var exampleDirs = []string{"/src/test/", "/src/internalClusterTest/", "/src/javaRestTest/", "/src/yamlRestTest/"}
+
+var exampleExtensions = map[string]bool{".java": true, ".yml": true, ".yaml": true, ".json": true, ".asciidoc": true, ".md": true}
+
+func isExampleSource(rel string) bool {
+	if !exampleExtensions[filepath.Ext(rel)] {
+		return false
+	}
+	if strings.HasPrefix(rel, "docs/") {
+		return true
+	}
+	for _, dir := range exampleDirs {
+		if strings.Contains("/"+rel, dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// affixPattern is the prefix and suffix around the namespace of an affix
+// setting.
+type affixPattern struct {
+	setting        int
+	prefix, suffix string
+}
+
+// namespace returns the namespace of key when it's a key of the affix
+// setting. Namespaces of affix keys are a single segment, prefix settings
+// take anything after the prefix.
+func (p affixPattern) namespace(key string) (string, bool) {
+	if len(key) <= len(p.prefix)+len(p.suffix) || !strings.HasPrefix(key, p.prefix) || !strings.HasSuffix(key, p.suffix) {
+		return "", false
+	}
+	namespace := key[len(p.prefix) : len(key)-len(p.suffix)]
+	if p.suffix != "" && strings.Contains(namespace, ".") {
+		return "", false
+	}
+	return namespace, true
+}
+
+// affixSettingOf returns the affix setting a key is one of, i.e.
+// cluster.remote.*.seeds for cluster.remote.cluster_one.seeds.
+func affixSettingOf(settings []ElasticsearchSetting, key string) (ElasticsearchSetting, bool) {
+	for i, s := range settings {
+		star := strings.Index(s.Name, "*")
+		if star < 0 {
+			continue
+		}
+		if _, ok := (affixPattern{setting: i, prefix: s.Name[:star], suffix: s.Name[star+1:]}).namespace(key); ok {
+			return s, true
+		}
+	}
+	return ElasticsearchSetting{}, false
+}
+
+// findAffixExamples sets the ExampleKeys of the affix settings, with the
+// keys of theirs most written in the tests and docs under root.
+func findAffixExamples(root string, settings []ElasticsearchSetting) error {
+	// Patterns by the first segment of their prefix, so each key found is
+	// only compared with a handful of them
+	patterns := map[string][]affixPattern{}
+	for i, s := range settings {
+		star := strings.Index(s.Name, "*")
+		if star < 0 {
+			continue
+		}
+		p := affixPattern{setting: i, prefix: s.Name[:star], suffix: s.Name[star+1:]}
+		first := strings.SplitN(p.prefix, ".", 2)[0]
+		patterns[first] = append(patterns[first], p)
+	}
+	if len(patterns) == 0 {
+		return nil
+	}
+
+	counts := make([]map[string]int, len(settings))
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if name := info.Name(); filePath != root && (strings.HasPrefix(name, ".") || name == "build" || name == "node_modules") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil || info.Size() > maxExampleFileSize || !isExampleSource(filepath.ToSlash(rel)) {
+			return nil
+		}
+
+		content, err := ioutil.ReadFile(filePath)
+		if err != nil {
+			logger.Warn("couldn't read a file for affix examples", "file", rel, "error", err)
+			return nil
+		}
+		for _, key := range exampleKeyPattern.FindAllString(string(content), -1) {
+			first := key[:strings.IndexByte(key, '.')]
+			for _, p := range patterns[first] {
+				if _, ok := p.namespace(key); !ok {
+					continue
+				}
+				if counts[p.setting] == nil {
+					counts[p.setting] = map[string]int{}
+				}
+				counts[p.setting][key]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, keys := range counts {
+		if len(keys) == 0 {
+			continue
+		}
+		examples := make([]string, 0, len(keys))
+		for key := range keys {
+			examples = append(examples, key)
+		}
+		sort.Slice(examples, func(a, b int) bool {
+			if keys[examples[a]] != keys[examples[b]] {
+				return keys[examples[a]] > keys[examples[b]]
+			}
+			return examples[a] < examples[b]
+		})
+		if len(examples) > maxExampleKeys {
+			examples = examples[:maxExampleKeys]
+		}
+		settings[i].ExampleKeys = examples
+	}
+	return nil
+}
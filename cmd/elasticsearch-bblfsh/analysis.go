@@ -0,0 +1,140 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// AnalysisComponent is an analyzer, tokenizer, token filter, char filter or
+// normalizer registered with AnalysisModule or by an analysis plugin.
+type AnalysisComponent struct {
+	Kind       string   `json:"kind"`
+	Name       string   `json:"name"`
+	Provider   string   `json:"provider"`
+	Parameters []string `json:"parameters,omitempty"`
+
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// AnalysisDocument is the output of the analysis components extraction.
+type AnalysisDocument struct {
+	BuildInfo
+	Components []AnalysisComponent `json:"components"`
+}
+
+// analysisRegistrationMethods maps the methods components are registered in
+// to the kind of component. AnalysisModule uses the setup* methods, plugins
+// implementing AnalysisPlugin the get* ones.
+var analysisRegistrationMethods = map[string]string{
+	"setupAnalyzers":    "analyzer",
+	"getAnalyzers":      "analyzer",
+	"setupTokenizers":   "tokenizer",
+	"getTokenizers":     "tokenizer",
+	"setupTokenFilters": "token_filter",
+	"getTokenFilters":   "token_filter",
+	"setupCharFilters":  "char_filter",
+	"getCharFilters":    "char_filter",
+	"setupNormalizers":  "normalizer",
+}
+
+var analysisComponents []AnalysisComponent
+
+// analysisParameters maps class names to the settings they read, which are
+// the parameters of the component the class provides.
+var analysisParameters = map[string][]string{}
+
+func getAnalysisComponents(rootNode *uast.Node, fileName string) []AnalysisComponent {
+	var components []AnalysisComponent
+
+	for method, kind := range analysisRegistrationMethods {
+		// i.e. tokenFilters.register("stop", StopTokenFilterFactory::new);
+		// or filters.put("asciifolding", ASCIIFoldingTokenFilterFactory::new);
+		query := "//MethodDeclaration/SimpleName[@internalRole='name'][@token='" + method + "']/.." +
+			"//MethodInvocation[SimpleName[@internalRole='name'][@token='register' or @token='put']]"
+		nodes, _ := tools.Filter(rootNode, query)
+
+		for _, n := range nodes {
+			arguments := argumentsOf(n)
+			if len(arguments) < 2 || arguments[0].InternalType != "StringLiteral" {
+				continue
+			}
+			components = append(components, AnalysisComponent{
+				Kind:     kind,
+				Name:     strings.Trim(arguments[0].Token, "\""),
+				Provider: getProviderClass(arguments[1]),
+				CodeLine: n.StartPosition.Line,
+				CodeFile: relativePath(fileName),
+			})
+		}
+	}
+
+	return components
+}
+
+// getProviderClass finds the class providing a component, which is usually
+// registered as a constructor reference but is sometimes wrapped, i.e.
+// requiresAnalysisSettings(WordDelimiterTokenFilterFactory::new)
+func getProviderClass(node *uast.Node) string {
+	for _, query := range []string{
+		"//CreationReference//SimpleName",
+		"//ExpressionMethodReference/SimpleName[@internalRole='expression']",
+		"//SimpleType/SimpleName",
+	} {
+		names, _ := tools.Filter(node, query)
+		if len(names) > 0 {
+			return names[0].Token
+		}
+	}
+	return ""
+}
+
+// getAnalysisParameters records the settings read by each class declared in
+// the file, i.e. settings.getAsBoolean("ignore_case", false)
+func getAnalysisParameters(rootNode *uast.Node) {
+	classes, _ := tools.Filter(rootNode, "//TypeDeclaration")
+
+	for _, class := range classes {
+		className := nameOf(class)
+		if className == "" {
+			continue
+		}
+
+		query := "//MethodInvocation[SimpleName[@internalRole='expression'][@token='settings']]"
+		nodes, _ := tools.Filter(class, query)
+		for _, n := range nodes {
+			arguments := argumentsOf(n)
+			if len(arguments) == 0 || arguments[0].InternalType != "StringLiteral" {
+				continue
+			}
+			analysisParameters[className] = append(analysisParameters[className], strings.Trim(arguments[0].Token, "\""))
+		}
+	}
+}
+
+// resolveAnalysisParameters fills in the parameters of every component from
+// the settings read by its provider class.
+func resolveAnalysisParameters(components []AnalysisComponent) {
+	for i, c := range components {
+		seen := map[string]bool{}
+		var parameters []string
+		for _, p := range analysisParameters[c.Provider] {
+			if !seen[p] {
+				seen[p] = true
+				parameters = append(parameters, p)
+			}
+		}
+		sort.Strings(parameters)
+		components[i].Parameters = parameters
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		if components[i].Kind != components[j].Kind {
+			return components[i].Kind < components[j].Kind
+		}
+		return components[i].Name < components[j].Name
+	})
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// The protobuf and Avro outputs are encoded by hand, the wire formats are
+// simple and their schemas small enough that generated code isn't worth
+// the dependencies.
+
+//go:embed settings.proto
+var settingsProto []byte
+
+//go:embed settings.avsc
+var settingsAvroSchema []byte
+
+type protoBuffer struct {
+	bytes.Buffer
+}
+
+func (b *protoBuffer) varint(v uint64) {
+	var tmp [binary.MaxVarintLen64]byte
+	n := binary.PutUvarint(tmp[:], v)
+	b.Write(tmp[:n])
+}
+
+func (b *protoBuffer) tag(field, wireType int) {
+	b.varint(uint64(field<<3 | wireType))
+}
+
+func (b *protoBuffer) bytesField(field int, v []byte) {
+	b.tag(field, 2)
+	b.varint(uint64(len(v)))
+	b.Write(v)
+}
+
+// stringField writes a string, leaving out empty ones like proto3 does.
+func (b *protoBuffer) stringField(field int, v string) {
+	if v != "" {
+		b.bytesField(field, []byte(v))
+	}
+}
+
+func (b *protoBuffer) repeatedStringField(field int, values []string) {
+	for _, v := range values {
+		b.bytesField(field, []byte(v))
+	}
+}
+
+// doubleField writes a double, leaving out zero like proto3 does.
+func (b *protoBuffer) doubleField(field int, v float64) {
+	if v != 0 {
+		b.tag(field, 1)
+		binary.Write(b, binary.LittleEndian, math.Float64bits(v))
+	}
+}
+
+func (b *protoBuffer) uintField(field int, v uint64) {
+	if v != 0 {
+		b.tag(field, 0)
+		b.varint(v)
+	}
+}
+
+func marshalSettingProto(s ElasticsearchSetting) []byte {
+	var b protoBuffer
+	b.stringField(1, s.Name)
+	b.stringField(2, s.RawName)
+	b.stringField(3, s.JavaType)
+	b.repeatedStringField(4, s.Properties)
+	b.stringField(5, s.DefaultArg)
+	b.uintField(6, uint64(s.CodeLine))
+	b.stringField(7, s.CodeFile)
+	b.stringField(8, s.FirstSeenVersion)
+	b.stringField(9, s.RemovedInVersion)
+	if s.Blame != nil {
+		var blame protoBuffer
+		blame.stringField(1, s.Blame.Commit)
+		blame.stringField(2, s.Blame.Author)
+		blame.stringField(3, s.Blame.Date.Format(time.RFC3339))
+		b.bytesField(10, blame.Bytes())
+	}
+	b.repeatedStringField(11, s.Owners)
+	b.repeatedStringField(12, s.Metrics)
+	b.stringField(13, s.MinIndexCreatedVersion)
+	b.normalizedField(14, s.NormalizedDefault)
+	b.repeatedStringField(15, s.Tags)
+	b.stringField(16, s.Parser)
+	b.repeatedStringField(17, s.ExampleKeys)
+	b.stringField(18, s.MinArg)
+	b.stringField(19, s.MaxArg)
+	b.normalizedField(20, s.NormalizedMin)
+	b.normalizedField(21, s.NormalizedMax)
+	return b.Bytes()
+}
+
+func (b *protoBuffer) normalizedField(field int, n *NormalizedValue) {
+	if n != nil {
+		var normalized protoBuffer
+		normalized.doubleField(1, n.Value)
+		normalized.stringField(2, n.Unit)
+		normalized.stringField(3, n.Display)
+		b.bytesField(field, normalized.Bytes())
+	}
+}
+
+// writeSettingsProto writes the document as a SettingsDocument message of
+// settings.proto.
+func writeSettingsProto(w io.Writer, doc SettingsDocument) error {
+	var b protoBuffer
+	b.stringField(1, doc.ToolVersion)
+	b.stringField(2, doc.ToolCommit)
+	b.stringField(3, doc.ToolBuildDate)
+	b.uintField(4, uint64(doc.SchemaVersion))
+	b.stringField(5, doc.ExtractedAt.Format(time.RFC3339))
+	b.stringField(6, doc.SourceRoot)
+	b.stringField(7, doc.SourceCommit)
+	for _, s := range doc.Settings {
+		b.bytesField(8, marshalSettingProto(s))
+	}
+	if doc.Partial {
+		b.uintField(9, 1)
+	}
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+type avroBuffer struct {
+	bytes.Buffer
+}
+
+func (b *avroBuffer) long(v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	// binary.PutVarint zig-zag encodes like Avro does
+	n := binary.PutVarint(tmp[:], v)
+	b.Write(tmp[:n])
+}
+
+func (b *avroBuffer) bytesValue(v []byte) {
+	b.long(int64(len(v)))
+	b.Write(v)
+}
+
+func (b *avroBuffer) stringValue(v string) {
+	b.bytesValue([]byte(v))
+}
+
+func (b *avroBuffer) double(v float64) {
+	binary.Write(b, binary.LittleEndian, math.Float64bits(v))
+}
+
+func (b *avroBuffer) stringArray(values []string) {
+	if len(values) > 0 {
+		b.long(int64(len(values)))
+		for _, v := range values {
+			b.stringValue(v)
+		}
+	}
+	b.long(0)
+}
+
+// optionalString writes a ["null", "string"] union, null for empty strings.
+func (b *avroBuffer) optionalString(v string) {
+	if v == "" {
+		b.long(0)
+		return
+	}
+	b.long(1)
+	b.stringValue(v)
+}
+
+func (b *avroBuffer) setting(s ElasticsearchSetting) {
+	b.stringValue(s.Name)
+	b.stringValue(s.RawName)
+	b.stringValue(s.JavaType)
+	b.stringArray(s.Properties)
+	b.stringValue(s.DefaultArg)
+	b.long(int64(s.CodeLine))
+	b.stringValue(s.CodeFile)
+	b.optionalString(s.FirstSeenVersion)
+	b.optionalString(s.RemovedInVersion)
+	if s.Blame == nil {
+		b.long(0)
+	} else {
+		b.long(1)
+		b.stringValue(s.Blame.Commit)
+		b.stringValue(s.Blame.Author)
+		b.stringValue(s.Blame.Date.Format(time.RFC3339))
+	}
+	b.stringArray(s.Owners)
+	b.stringArray(s.Metrics)
+	b.optionalString(s.MinIndexCreatedVersion)
+	b.optionalNormalized(s.NormalizedDefault)
+	b.stringArray(s.Tags)
+	b.optionalString(s.Parser)
+	b.stringArray(s.ExampleKeys)
+	b.optionalString(s.MinArg)
+	b.optionalString(s.MaxArg)
+	b.optionalNormalized(s.NormalizedMin)
+	b.optionalNormalized(s.NormalizedMax)
+}
+
+func (b *avroBuffer) optionalNormalized(n *NormalizedValue) {
+	if n == nil {
+		b.long(0)
+	} else {
+		b.long(1)
+		b.double(n.Value)
+		b.stringValue(n.Unit)
+		b.stringValue(n.Display)
+	}
+}
+
+// writeSettingsAvro writes the settings as an Avro object container file of
+// settings.avsc records, in a single uncompressed block.
+func writeSettingsAvro(w io.Writer, doc SettingsDocument) error {
+	var records avroBuffer
+	for _, s := range doc.Settings {
+		records.setting(s)
+	}
+
+	metadata := [][2]string{
+		{"avro.schema", string(settingsAvroSchema)},
+		{"avro.codec", "null"},
+		{"elasticsearch_bblfsh.tool_version", doc.ToolVersion},
+		{"elasticsearch_bblfsh.schema_version", fmt.Sprint(doc.SchemaVersion)},
+		{"elasticsearch_bblfsh.extracted_at", doc.ExtractedAt.Format(time.RFC3339)},
+		{"elasticsearch_bblfsh.source_root", doc.SourceRoot},
+		{"elasticsearch_bblfsh.source_commit", doc.SourceCommit},
+		{"elasticsearch_bblfsh.partial", fmt.Sprint(doc.Partial)},
+	}
+
+	// The sync marker only has to be unlikely to appear in the data,
+	// deriving it from the data keeps the output reproducible
+	sum := sha256.Sum256(records.Bytes())
+	sync := sum[:16]
+
+	var b avroBuffer
+	b.WriteString("Obj\x01")
+	b.long(int64(len(metadata)))
+	for _, m := range metadata {
+		b.stringValue(m[0])
+		b.bytesValue([]byte(m[1]))
+	}
+	b.long(0)
+	b.Write(sync)
+
+	if len(doc.Settings) > 0 {
+		b.long(int64(len(doc.Settings)))
+		b.long(int64(records.Len()))
+		b.Write(records.Bytes())
+		b.Write(sync)
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
@@ -0,0 +1,290 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+// binaryTestDocument has a setting with every field set, and one with none
+// of the optional ones.
+var binaryTestDocument = SettingsDocument{
+	BuildInfo:     BuildInfo{ToolVersion: "1.2.3", ToolCommit: "abc", ToolBuildDate: "2023-11-01"},
+	SchemaVersion: 1,
+	ExtractedAt:   time.Date(2023, 11, 2, 10, 0, 0, 0, time.UTC),
+	SourceRoot:    "/src/elasticsearch",
+	SourceCommit:  "def",
+	Partial:       true,
+	Settings: []ElasticsearchSetting{
+		{
+			Name: "cluster.info.update.interval", RawName: "INTERVAL", JavaType: "TimeValue",
+			Properties: []string{"NodeScope", "Dynamic"}, DefaultArg: "30s", CodeLine: 42, CodeFile: "server/Info.java",
+			FirstSeenVersion: "7.0", RemovedInVersion: "9.0", MinIndexCreatedVersion: "7.0",
+			Blame:             &GitBlame{Commit: "0123", Author: "someone", Date: time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC)},
+			Owners:            []string{"@elastic/core"},
+			Metrics:           []string{"nodes.fs.total"},
+			NormalizedDefault: &NormalizedValue{Value: 30000, Unit: "duration_ms", Display: "30s"},
+			Tags:              []string{"timing"},
+			Parser:            "TimeValue.parseTimeValue",
+			ExampleKeys:       []string{"cluster.info.one"},
+			MinArg:            "10s", MaxArg: "1m",
+			NormalizedMin: &NormalizedValue{Value: 10000, Unit: "duration_ms", Display: "10s"},
+			NormalizedMax: &NormalizedValue{Value: 0.5, Unit: "ratio", Display: "50%"},
+		},
+		{Name: "a", RawName: "A", JavaType: "Boolean", DefaultArg: "false", CodeFile: "A.java"},
+	},
+}
+
+// jsonValue is a value as encoding/json has it, without the empty values
+// the binary formats can't tell from missing ones.
+func jsonValue(t *testing.T, v interface{}) interface{} {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var value interface{}
+	json.Unmarshal(b, &value)
+	return withoutEmpty(value)
+}
+
+func withoutEmpty(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, value := range v {
+			if value = withoutEmpty(value); value == nil {
+				delete(v, k)
+			} else {
+				v[k] = value
+			}
+		}
+	case []interface{}:
+		if len(v) == 0 {
+			return nil
+		}
+		for i := range v {
+			v[i] = withoutEmpty(v[i])
+		}
+	case string:
+		if v == "" {
+			return nil
+		}
+	case float64:
+		if v == 0 {
+			return nil
+		}
+	case bool:
+		if !v {
+			return nil
+		}
+	}
+	return v
+}
+
+// protoField is a field of a message of settings.proto.
+type protoField struct {
+	name, kind string
+	repeated   bool
+}
+
+// protoMessages reads the messages of settings.proto, by field number.
+func protoMessages(t *testing.T) map[string]map[int]protoField {
+	messages := map[string]map[int]protoField{}
+	var fields map[int]protoField
+	field := regexp.MustCompile(`^\s*(repeated )?(\w+) (\w+) = (\d+);`)
+	for _, line := range strings.Split(string(settingsProto), "\n") {
+		if strings.HasPrefix(line, "message ") {
+			fields = map[int]protoField{}
+			messages[strings.Fields(line)[1]] = fields
+		} else if m := field.FindStringSubmatch(line); m != nil {
+			var number int
+			json.Unmarshal([]byte(m[4]), &number)
+			fields[number] = protoField{name: m[3], kind: m[2], repeated: m[1] != ""}
+		}
+	}
+	if len(messages["ElasticsearchSetting"]) == 0 {
+		t.Fatal("no ElasticsearchSetting message in settings.proto")
+	}
+	return messages
+}
+
+// decodeProtoMessage decodes a message of settings.proto to a value like
+// encoding/json decodes the JSON output to.
+func decodeProtoMessage(t *testing.T, messages map[string]map[int]protoField, name string, b []byte) map[string]interface{} {
+	t.Helper()
+	value := map[string]interface{}{}
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		f, ok := messages[name][int(key>>3)]
+		if !ok {
+			t.Fatalf("%s has no field %d", name, key>>3)
+		}
+		var v interface{}
+		switch key & 7 {
+		case 0:
+			u, n := binary.Uvarint(b)
+			b = b[n:]
+			if v = float64(u); f.kind == "bool" {
+				v = u != 0
+			}
+		case 1:
+			v, b = math.Float64frombits(binary.LittleEndian.Uint64(b)), b[8:]
+		case 2:
+			length, n := binary.Uvarint(b)
+			data := b[n : n+int(length)]
+			b = b[n+int(length):]
+			if v = string(data); messages[f.kind] != nil {
+				v = decodeProtoMessage(t, messages, f.kind, data)
+			}
+		default:
+			t.Fatalf("%s.%s: wire type %d", name, f.name, key&7)
+		}
+		if f.repeated {
+			list, _ := value[f.name].([]interface{})
+			v = append(list, v)
+		}
+		value[f.name] = v
+	}
+	return value
+}
+
+func TestWriteSettingsProto(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeSettingsProto(&b, binaryTestDocument); err != nil {
+		t.Fatal(err)
+	}
+	got := withoutEmpty(decodeProtoMessage(t, protoMessages(t), "SettingsDocument", b.Bytes()))
+	want := jsonValue(t, binaryTestDocument)
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got  %v\nwant %v", got, want)
+	}
+}
+
+// avroDecoder decodes the records of settings.avsc to values like
+// encoding/json decodes the JSON output to.
+type avroDecoder struct {
+	t     *testing.T
+	b     []byte
+	named map[string]interface{}
+}
+
+func (d *avroDecoder) long() int64 {
+	v, n := binary.Varint(d.b)
+	if n <= 0 {
+		d.t.Fatal("invalid long")
+	}
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *avroDecoder) bytes() []byte {
+	n := d.long()
+	v := d.b[:n]
+	d.b = d.b[n:]
+	return v
+}
+
+func (d *avroDecoder) value(schema interface{}) interface{} {
+	switch s := schema.(type) {
+	case string:
+		switch s {
+		case "null":
+			return nil
+		case "string":
+			return string(d.bytes())
+		case "long":
+			return float64(d.long())
+		case "double":
+			v := math.Float64frombits(binary.LittleEndian.Uint64(d.b))
+			d.b = d.b[8:]
+			return v
+		}
+		return d.value(d.named[s])
+	case []interface{}:
+		return d.value(s[d.long()])
+	case map[string]interface{}:
+		switch s["type"] {
+		case "array":
+			list := []interface{}{}
+			for n := d.long(); n != 0; n = d.long() {
+				for i := int64(0); i < n; i++ {
+					list = append(list, d.value(s["items"]))
+				}
+			}
+			return list
+		case "record":
+			d.named[s["name"].(string)] = s
+			record := map[string]interface{}{}
+			for _, f := range s["fields"].([]interface{}) {
+				field := f.(map[string]interface{})
+				record[field["name"].(string)] = d.value(field["type"])
+			}
+			return record
+		}
+	}
+	d.t.Fatalf("unexpected schema %v", schema)
+	return nil
+}
+
+func TestWriteSettingsAvro(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeSettingsAvro(&b, binaryTestDocument); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b.Bytes(), []byte("Obj\x01")) {
+		t.Fatalf("no Avro magic: %q", b.Bytes()[:4])
+	}
+	d := &avroDecoder{t: t, b: b.Bytes()[4:], named: map[string]interface{}{}}
+
+	metadata := map[string]string{}
+	for n := d.long(); n != 0; n = d.long() {
+		for i := int64(0); i < n; i++ {
+			key := string(d.bytes())
+			metadata[key] = string(d.bytes())
+		}
+	}
+	if metadata["avro.schema"] != string(settingsAvroSchema) || metadata["avro.codec"] != "null" ||
+		metadata["elasticsearch_bblfsh.extracted_at"] != "2023-11-02T10:00:00Z" || metadata["elasticsearch_bblfsh.partial"] != "true" {
+		t.Errorf("metadata %v", metadata)
+	}
+	sync := append([]byte(nil), d.b[:16]...)
+	d.b = d.b[16:]
+
+	var schema interface{}
+	if err := json.Unmarshal(settingsAvroSchema, &schema); err != nil {
+		t.Fatal(err)
+	}
+	count, size := d.long(), d.long()
+	if count != 2 || int(size) != len(d.b)-16 || !bytes.Equal(d.b[size:], sync) {
+		t.Fatalf("block of %d records, %d bytes, %d left", count, size, len(d.b))
+	}
+	for i, s := range binaryTestDocument.Settings {
+		got := withoutEmpty(d.value(schema))
+		if want := jsonValue(t, s); !reflect.DeepEqual(got, want) {
+			t.Errorf("setting %d: got  %v\nwant %v", i, got, want)
+		}
+	}
+
+	// No block without settings
+	b.Reset()
+	if err := writeSettingsAvro(&b, SettingsDocument{}); err != nil {
+		t.Fatal(err)
+	}
+	d = &avroDecoder{t: t, b: b.Bytes()[4:]}
+	for n := d.long(); n != 0; n = d.long() {
+		for i := int64(0); i < n; i++ {
+			d.bytes()
+			d.bytes()
+		}
+	}
+	if len(d.b) != 16 {
+		t.Errorf("%d bytes after the header of an empty file", len(d.b))
+	}
+}
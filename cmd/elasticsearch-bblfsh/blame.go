@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// GitBlame is the commit that last touched the line a setting is declared on.
+type GitBlame struct {
+	Commit string    `json:"commit"`
+	Author string    `json:"author"`
+	Date   time.Time `json:"date"`
+}
+
+// blameSettings runs git blame on the declaration line of every setting and
+// records the result on the setting. git is run once per file, with one
+// line range per setting declared in it.
+func blameSettings(root string, settings []ElasticsearchSetting) error {
+	byFile := map[string][]int{}
+	for i, s := range settings {
+		byFile[s.CodeFile] = append(byFile[s.CodeFile], i)
+	}
+
+	for file, indexes := range byFile {
+		args := []string{"-C", root, "blame", "--porcelain"}
+		for _, i := range indexes {
+			line := settings[i].CodeLine
+			args = append(args, "-L", fmt.Sprintf("%d,%d", line, line))
+		}
+		args = append(args, "--", file)
+
+		out, err := exec.Command("git", args...).Output()
+		if err != nil {
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				return fmt.Errorf("git blame %s: %s", file, strings.TrimSpace(string(exitErr.Stderr)))
+			}
+			return fmt.Errorf("git blame %s: %v", file, err)
+		}
+
+		lines := parseBlamePorcelain(out)
+		for _, i := range indexes {
+			if blame, ok := lines[settings[i].CodeLine]; ok {
+				b := blame
+				settings[i].Blame = &b
+			}
+		}
+	}
+
+	return nil
+}
+
+// parseBlamePorcelain maps final line numbers to the commit that last
+// touched them. Commit details are only printed the first time a commit
+// shows up in porcelain output, so they are remembered by SHA.
+func parseBlamePorcelain(out []byte) map[uint32]GitBlame {
+	commits := map[string]*GitBlame{}
+	lines := map[uint32]GitBlame{}
+
+	var current *GitBlame
+	var currentLine uint32
+
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		text := scanner.Text()
+
+		switch {
+		case strings.HasPrefix(text, "\t"):
+			// The content of the line ends each entry
+			if current != nil {
+				lines[currentLine] = *current
+			}
+			current = nil
+		case current == nil:
+			fields := strings.Fields(text)
+			if len(fields) < 3 {
+				continue
+			}
+			sha := fields[0]
+			if commits[sha] == nil {
+				commits[sha] = &GitBlame{Commit: sha}
+			}
+			current = commits[sha]
+			n, _ := strconv.ParseUint(fields[2], 10, 32)
+			currentLine = uint32(n)
+		case strings.HasPrefix(text, "author "):
+			current.Author = strings.TrimPrefix(text, "author ")
+		case strings.HasPrefix(text, "author-time "):
+			seconds, _ := strconv.ParseInt(strings.TrimPrefix(text, "author-time "), 10, 64)
+			current.Date = time.Unix(seconds, 0).UTC()
+		}
+	}
+
+	return lines
+}
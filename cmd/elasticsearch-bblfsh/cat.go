@@ -0,0 +1,110 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// CatColumn is a column of a _cat API table.
+type CatColumn struct {
+	Name        string   `json:"name"`
+	Aliases     []string `json:"aliases,omitempty"`
+	Description string   `json:"description,omitempty"`
+	// Default is whether the column is shown without asking for it with h=
+	Default bool `json:"default"`
+}
+
+// CatAction is a _cat API and the columns of its table.
+type CatAction struct {
+	Class     string      `json:"class"`
+	Endpoints []string    `json:"endpoints"`
+	Columns   []CatColumn `json:"columns"`
+
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// CatActionsDocument is the output of the _cat columns extraction.
+type CatActionsDocument struct {
+	BuildInfo
+	CatActions []CatAction `json:"cat_actions"`
+}
+
+var catActions []CatAction
+
+func getCatActions(rootNode *uast.Node, fileName string) []CatAction {
+	var actions []CatAction
+
+	classes, _ := tools.Filter(rootNode, "//TypeDeclaration")
+	for _, class := range classes {
+		var headerMethod *uast.Node
+		for _, child := range class.Children {
+			if child.InternalType == "MethodDeclaration" && nameOf(child) == "getTableWithHeader" {
+				headerMethod = child
+			}
+		}
+		if headerMethod == nil {
+			continue
+		}
+
+		action := CatAction{
+			Class:    nameOf(class),
+			CodeLine: class.StartPosition.Line,
+			CodeFile: relativePath(fileName),
+		}
+
+		// i.e. controller.registerHandler(GET, "/_cat/indices", this);
+		// or new Route(GET, "/_cat/indices/{index}")
+		literals, _ := tools.Filter(class, "//StringLiteral")
+		for _, literal := range literals {
+			if endpoint := strings.Trim(literal.Token, "\""); strings.HasPrefix(endpoint, "/_cat") {
+				action.Endpoints = append(action.Endpoints, endpoint)
+			}
+		}
+
+		// i.e. table.addCell("docs.count", "alias:dc,docsCount;text-align:right;desc:available docs");
+		cells, _ := tools.Filter(headerMethod, "//MethodInvocation[SimpleName[@internalRole='name'][@token='addCell']]")
+		for _, cell := range cells {
+			arguments := argumentsOf(cell)
+			if len(arguments) == 0 || arguments[0].InternalType != "StringLiteral" {
+				continue
+			}
+			column := CatColumn{Name: strings.Trim(arguments[0].Token, "\""), Default: true}
+			if len(arguments) > 1 && arguments[1].InternalType == "StringLiteral" {
+				parseCatCellAttributes(&column, strings.Trim(arguments[1].Token, "\""))
+			}
+			action.Columns = append(action.Columns, column)
+		}
+
+		actions = append(actions, action)
+	}
+
+	return actions
+}
+
+// parseCatCellAttributes parses the attributes of a table header cell,
+// i.e. "alias:dc,docsCount;text-align:right;desc:available docs"
+func parseCatCellAttributes(column *CatColumn, attributes string) {
+	for _, attribute := range strings.Split(attributes, ";") {
+		parts := strings.SplitN(attribute, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		switch strings.TrimSpace(parts[0]) {
+		case "alias":
+			column.Aliases = strings.Split(parts[1], ",")
+		case "desc":
+			column.Description = parts[1]
+		case "default":
+			column.Default = parts[1] != "false"
+		}
+	}
+}
+
+func sortCatActions(actions []CatAction) []CatAction {
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Class < actions[j].Class })
+	return actions
+}
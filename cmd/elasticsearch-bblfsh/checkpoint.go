@@ -0,0 +1,180 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// checkpointInterval is how often a -checkpoint is written during the walk.
+const checkpointInterval = time.Minute
+
+// checkpointFile is set by -checkpoint, empty to not write any, and
+// checkpointPaths are the -paths of the run.
+var checkpointFile, checkpointPaths string
+
+// lastCheckpoint is when the last checkpoint was written.
+var lastCheckpoint time.Time
+
+// resumedFiles are the files the checkpoint a run resumed from had already
+// processed, which the walk goes past.
+var resumedFiles = map[string]bool{}
+
+// runCheckpoint is what a run interrupted after processing some files
+// needs to carry on: the files processed, their outcome and what each
+// extractor collected from them. It's only valid for a run over the same
+// tree with the same extractors and version.
+type runCheckpoint struct {
+	ToolVersion string    `json:"tool_version"`
+	ToolCommit  string    `json:"tool_commit"`
+	SourceRoot  string    `json:"source_root"`
+	Paths       string    `json:"paths"`
+	Extractors  []string  `json:"extractors"`
+	WrittenAt   time.Time `json:"written_at"`
+
+	Files             []FileOutcome   `json:"files"`
+	Errors            []ErrorCategory `json:"errors,omitempty"`
+	FilesParsed       int             `json:"files_parsed"`
+	FilesFailed       int             `json:"files_failed"`
+	FilesPartial      int             `json:"files_partial"`
+	SettingsExtracted int             `json:"settings_extracted"`
+	SettingsSkipped   int             `json:"settings_skipped"`
+
+	State map[string]json.RawMessage `json:"state"`
+}
+
+// checkpointSupported returns an error naming the enabled extractors a run
+// can't be resumed with. Streamed settings are already written out, they
+// can't be kept in a checkpoint either.
+func checkpointSupported() error {
+	if settingsStream != nil {
+		return fmt.Errorf("-checkpoint can't be used with -format ndjson, the settings are written as they're found")
+	}
+	var unsupported []string
+	for _, e := range enabledExtractors {
+		if e.extract != nil && e.checkpoint == nil {
+			unsupported = append(unsupported, e.name)
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("-checkpoint doesn't support these extractors yet: %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// writeCheckpoint saves the progress of the run, at most every
+// checkpointInterval unless forced.
+func writeCheckpoint(force bool) error {
+	if checkpointFile == "" || (!force && time.Since(lastCheckpoint) < checkpointInterval) {
+		return nil
+	}
+
+	info := buildInfo()
+	checkpoint := runCheckpoint{
+		ToolVersion:       info.ToolVersion,
+		ToolCommit:        info.ToolCommit,
+		SourceRoot:        rootDir,
+		Paths:             checkpointPaths,
+		Extractors:        runManifest.Extractors,
+		WrittenAt:         time.Now().UTC(),
+		Files:             runManifest.Files,
+		Errors:            runErrors.summary(),
+		FilesParsed:       filesParsed,
+		FilesFailed:       filesFailed,
+		FilesPartial:      filesPartial,
+		SettingsExtracted: settingsExtracted,
+		SettingsSkipped:   settingsSkipped,
+		State:             map[string]json.RawMessage{},
+	}
+	for _, e := range enabledExtractors {
+		if e.checkpoint == nil {
+			continue
+		}
+		state, err := json.Marshal(e.checkpoint())
+		if err != nil {
+			return err
+		}
+		checkpoint.State[e.name] = state
+	}
+
+	b, err := json.Marshal(checkpoint)
+	if err != nil {
+		return err
+	}
+	// Write then rename, a run killed while checkpointing keeps the
+	// previous checkpoint
+	if err := ioutil.WriteFile(checkpointFile+".tmp", b, 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(checkpointFile+".tmp", checkpointFile); err != nil {
+		return err
+	}
+	lastCheckpoint = time.Now()
+	logger.Debug("checkpoint written", "file", checkpointFile, "files", len(runManifest.Files))
+	return nil
+}
+
+// resumeCheckpoint restores the progress of the run that wrote the
+// checkpoint. A missing checkpoint starts the run from scratch.
+func resumeCheckpoint() error {
+	b, err := ioutil.ReadFile(checkpointFile)
+	if os.IsNotExist(err) {
+		logger.Info("no checkpoint to resume from, starting over", "file", checkpointFile)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var checkpoint runCheckpoint
+	if err := json.Unmarshal(b, &checkpoint); err != nil {
+		return fmt.Errorf("%s: %v", checkpointFile, err)
+	}
+	info := buildInfo()
+	switch {
+	case checkpoint.ToolVersion != info.ToolVersion || checkpoint.ToolCommit != info.ToolCommit:
+		return fmt.Errorf("%s was written by elasticsearch-bblfsh %s, not this version", checkpointFile, checkpoint.ToolVersion)
+	case checkpoint.SourceRoot != rootDir || checkpoint.Paths != checkpointPaths:
+		return fmt.Errorf("%s is of a run over %s in %s, not this one", checkpointFile, checkpoint.Paths, checkpoint.SourceRoot)
+	case strings.Join(checkpoint.Extractors, ",") != strings.Join(runManifest.Extractors, ","):
+		return fmt.Errorf("%s is of a run with the %s extractors, not this one", checkpointFile, strings.Join(checkpoint.Extractors, ", "))
+	}
+
+	for _, e := range enabledExtractors {
+		state, ok := checkpoint.State[e.name]
+		if !ok || e.restore == nil {
+			continue
+		}
+		if err := e.restore(state); err != nil {
+			return fmt.Errorf("%s: restoring %s: %v", checkpointFile, e.name, err)
+		}
+	}
+
+	runManifest.Files = checkpoint.Files
+	runErrors.restore(checkpoint.Errors)
+	filesParsed, filesFailed, filesPartial = checkpoint.FilesParsed, checkpoint.FilesFailed, checkpoint.FilesPartial
+	settingsExtracted, settingsSkipped = checkpoint.SettingsExtracted, checkpoint.SettingsSkipped
+	for _, f := range checkpoint.Files {
+		resumedFiles[f.File] = true
+		runProgress.update(f.Settings, f.Status == "failed")
+	}
+	lastCheckpoint = time.Now()
+
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "resuming from %s, %d files already processed\n", checkpointFile, len(checkpoint.Files))
+	}
+	return nil
+}
+
+// removeCheckpoint removes the checkpoint of a run that completed.
+func removeCheckpoint() {
+	if checkpointFile == "" {
+		return
+	}
+	if err := os.Remove(checkpointFile); err != nil && !os.IsNotExist(err) {
+		logger.Warn("couldn't remove the checkpoint", "file", checkpointFile, "error", err)
+	}
+}
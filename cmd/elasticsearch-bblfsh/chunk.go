@@ -0,0 +1,152 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// ChunkIndex is the chunks.json of a chunked output directory, listing the
+// chunks in order so loaders can ingest them one at a time.
+type ChunkIndex struct {
+	BuildInfo
+	MaxSize int64         `json:"max_size"`
+	Chunks  []OutputChunk `json:"chunks"`
+}
+
+// OutputChunk is a numbered file holding a consecutive run of settings.
+type OutputChunk struct {
+	File         string `json:"file"`
+	Format       string `json:"format"`
+	Settings     int    `json:"settings"`
+	Size         int64  `json:"size"`
+	FirstSetting string `json:"first_setting"`
+	LastSetting  string `json:"last_setting"`
+}
+
+// encodeChunk encodes a document to a file of the temporary directory,
+// gzipped with -gzip, and returns its name and size.
+func encodeChunk(e Encoder, tmpDir string, doc SettingsDocument) (string, int64, error) {
+	fileName := filepath.Join(tmpDir, "chunk"+e.Extension())
+	os.Remove(fileName)
+	if err := e.Encode(fileName, doc); err != nil {
+		return "", 0, err
+	}
+	if gzipOutput {
+		if err := gzipFile(fileName, fileName+".gz"); err != nil {
+			return "", 0, err
+		}
+		fileName += ".gz"
+	}
+
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return "", 0, err
+	}
+	return fileName, info.Size(), nil
+}
+
+// placeOutput moves a temporary file to its destination, a local file or
+// an s3:// or gs:// URL.
+func placeOutput(tmp, dest string) error {
+	if isObjectURL(dest) {
+		return uploadObject(dest, tmp)
+	}
+
+	in, err := os.Open(tmp)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(dest)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// writeChunkedOutput rolls the settings across numbered files of every
+// format in dir, each at most maxSize bytes, and writes a chunks.json
+// listing them. Settings keep their order, so every chunk is a range of
+// names.
+func writeChunkedOutput(dir string, maxSize int64, formats []string, doc SettingsDocument) error {
+	if !isObjectURL(dir) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmpDir, err := ioutil.TempDir("", "elasticsearch-bblfsh")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	index := ChunkIndex{BuildInfo: buildInfo(), MaxSize: maxSize}
+
+	for _, format := range formats {
+		e := encoders[format]
+		remaining := doc.Settings
+		count := len(remaining)
+
+		for n := 1; len(remaining) > 0; n++ {
+			if count > len(remaining) {
+				count = len(remaining)
+			}
+
+			// Shrink the chunk in proportion to how far over the limit
+			// it is until it fits, then start the next one at that size
+			var tmp string
+			var size int64
+			for {
+				part := doc
+				part.Settings = remaining[:count]
+				if tmp, size, err = encodeChunk(e, tmpDir, part); err != nil {
+					return err
+				}
+				if size <= maxSize {
+					break
+				}
+				if count == 1 {
+					return fmt.Errorf("%s alone is %s as %s, above -max-output-size %s", remaining[0].Name, formatBytes(size), format, formatBytes(maxSize))
+				}
+				shrunk := int(int64(count) * maxSize / size)
+				if shrunk >= count {
+					shrunk = count - 1
+				}
+				if shrunk < 1 {
+					shrunk = 1
+				}
+				count = shrunk
+			}
+
+			name := fmt.Sprintf("elasticsearchSettings-%04d%s", n, e.Extension())
+			if gzipOutput {
+				name += ".gz"
+			}
+			if err := placeOutput(tmp, joinOutputPath(dir, name)); err != nil {
+				return fmt.Errorf("writing %s: %v", name, err)
+			}
+			index.Chunks = append(index.Chunks, OutputChunk{
+				File:         name,
+				Format:       format,
+				Settings:     count,
+				Size:         size,
+				FirstSetting: remaining[0].Name,
+				LastSetting:  remaining[count-1].Name,
+			})
+			remaining = remaining[count:]
+		}
+	}
+
+	tmp := filepath.Join(tmpDir, "chunks.json")
+	if err := writeJSON(tmp, index); err != nil {
+		return err
+	}
+	return placeOutput(tmp, joinOutputPath(dir, "chunks.json"))
+}
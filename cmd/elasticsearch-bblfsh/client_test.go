@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/nickcanz/elasticsearch-bblfsh/client"
+)
+
+// TestClient checks the client package against the serve API it wraps.
+func TestClient(t *testing.T) {
+	mux := http.NewServeMux()
+	(&settingsAPI{dataset: testDataset}).register(mux)
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+	c := client.New(server.URL)
+	c.HTTPClient = server.Client()
+	ctx := context.Background()
+
+	versions, err := c.Versions(ctx)
+	if err != nil || len(versions) != 2 || versions[1].Version != "8.11" || versions[1].Settings != 3 {
+		t.Errorf("Versions: %+v, %v", versions, err)
+	}
+
+	var names []string
+	err = c.EachSetting(ctx, client.SettingsQuery{Sort: "-name", Limit: 2}, func(s client.Setting) error {
+		names = append(names, s.Name)
+		return nil
+	})
+	if want := []string{"transport.tcp.port", "transport.profiles.default.port", "transport.port"}; err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("EachSetting: %v, %v", names, err)
+	}
+
+	setting, version, err := c.Setting(ctx, "transport.tcp.port", "7.17")
+	if err != nil || version != "7.17" || setting.DefaultArg != "9300-9400" || !reflect.DeepEqual(setting.Properties, []string{"NodeScope"}) {
+		t.Errorf("Setting: %+v, %s, %v", setting, version, err)
+	}
+	if _, _, err := c.Setting(ctx, "transport.nope", ""); !client.IsNotFound(err) {
+		t.Errorf("unknown setting: %v", err)
+	}
+
+	events, err := c.Diff(ctx, "7.17", "")
+	if err != nil || len(events) != 3 {
+		t.Fatalf("Diff: %+v, %v", events, err)
+	}
+	for i, want := range []string{"added transport.port", "added transport.profiles.default.port", "changed transport.tcp.port"} {
+		if got := events[i].Event + " " + events[i].Name; got != want || events[i].From != "7.17" || events[i].To != "8.11" {
+			t.Errorf("event %d: %s %s..%s, want %s", i, got, events[i].From, events[i].To, want)
+		}
+	}
+	if changed := events[2]; !reflect.DeepEqual(changed.Fields, []string{"properties"}) || changed.Old == nil || changed.New == nil || len(changed.New.Properties) != 2 {
+		t.Errorf("changed: %+v", changed)
+	}
+	if _, err := c.Diff(ctx, "6.8", ""); !client.IsNotFound(err) {
+		t.Errorf("unknown version: %v", err)
+	}
+}
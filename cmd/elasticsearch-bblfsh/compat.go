@@ -0,0 +1,343 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Severities of compatibility findings.
+const (
+	severityBreaking = "breaking"
+	severityWarning  = "warning"
+	severityInfo     = "info"
+)
+
+// CompatFinding is a single difference between two versions found by one of
+// the extractors.
+type CompatFinding struct {
+	Extractor string `json:"extractor"`
+	Severity  string `json:"severity"`
+	Change    string `json:"change"`
+	Subject   string `json:"subject"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// CompatReport aggregates the differences of every extractor between two
+// versions.
+type CompatReport struct {
+	BuildInfo
+	From     string          `json:"from"`
+	To       string          `json:"to"`
+	Summary  map[string]int  `json:"summary"`
+	Findings []CompatFinding `json:"findings"`
+}
+
+// catalogFiles are the file names each extractor's output is expected under
+// in a version directory of the catalog.
+var catalogFiles = map[string]string{
+	"settings":          "elasticsearchSettings.json",
+	"rest":              "rest.json",
+	"dsl":               "dsl.json",
+	"analysis":          "analysis.json",
+	"painless":          "painless.json",
+	"transport-actions": "transport-actions.json",
+	"cat-columns":       "cat-columns.json",
+	"stats-fields":      "stats-fields.json",
+	"system-indices":    "system-indices.json",
+}
+
+// removedSeverity is how bad it is for something an extractor found to
+// disappear. Removed settings, routes, search DSL, analysis components and
+// painless APIs break configuration, clients, stored searches or scripts.
+// The others break dashboards or audits at worst.
+var removedSeverity = map[string]string{
+	"rest":              severityBreaking,
+	"dsl":               severityBreaking,
+	"analysis":          severityBreaking,
+	"painless":          severityBreaking,
+	"cat-columns":       severityBreaking,
+	"transport-actions": severityWarning,
+	"stats-fields":      severityWarning,
+	"system-indices":    severityWarning,
+}
+
+func readCatalogFile(dir, extractor string, v interface{}) (bool, error) {
+	fileName := filepath.Join(dir, catalogFiles[extractor])
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return true, nil
+}
+
+// catalogKeys reads an extractor's output and returns a key for everything
+// it found, so two versions can be compared as sets.
+func catalogKeys(dir, extractor string) (map[string]bool, bool, error) {
+	keys := map[string]bool{}
+	var found bool
+	var err error
+
+	switch extractor {
+	case "dsl":
+		var doc DSLDocument
+		if found, err = readCatalogFile(dir, extractor, &doc); found {
+			for _, c := range doc.Components {
+				keys[c.Kind+" "+c.Name] = true
+			}
+		}
+	case "analysis":
+		var doc AnalysisDocument
+		if found, err = readCatalogFile(dir, extractor, &doc); found {
+			for _, c := range doc.Components {
+				keys[c.Kind+" "+c.Name] = true
+				for _, p := range c.Parameters {
+					keys[c.Kind+" "+c.Name+" parameter "+p] = true
+				}
+			}
+		}
+	case "painless":
+		var doc PainlessCatalog
+		if found, err = readCatalogFile(dir, extractor, &doc); found {
+			for _, c := range doc.Contexts {
+				keys["context "+c.Name] = true
+			}
+			for _, c := range doc.Classes {
+				keys["class "+c.Name] = true
+				for _, m := range append(append(c.Constructors, c.Methods...), c.Fields...) {
+					keys["class "+c.Name+" member "+m] = true
+				}
+			}
+			for _, i := range doc.StaticImports {
+				keys["static import "+i] = true
+			}
+		}
+	case "transport-actions":
+		var doc TransportActionsDocument
+		if found, err = readCatalogFile(dir, extractor, &doc); found {
+			for _, a := range doc.Actions {
+				keys[a.Name] = true
+			}
+		}
+	case "cat-columns":
+		var doc CatActionsDocument
+		if found, err = readCatalogFile(dir, extractor, &doc); found {
+			for _, a := range doc.CatActions {
+				endpoint := a.Class
+				if len(a.Endpoints) > 0 {
+					endpoint = a.Endpoints[0]
+				}
+				for _, c := range a.Columns {
+					keys[endpoint+" "+c.Name] = true
+				}
+			}
+		}
+	case "stats-fields":
+		var doc StatsFieldsDocument
+		if found, err = readCatalogFile(dir, extractor, &doc); found {
+			for _, f := range doc.Fields {
+				keys[f.Class+" "+f.Path] = true
+			}
+		}
+	case "system-indices":
+		var doc SystemIndicesDocument
+		if found, err = readCatalogFile(dir, extractor, &doc); found {
+			for _, i := range doc.SystemIndices {
+				keys[i.IndexPattern] = true
+			}
+		}
+	}
+
+	return keys, found, err
+}
+
+func settingsFindings(d SettingsDiff) []CompatFinding {
+	var findings []CompatFinding
+	for _, s := range d.Removed {
+		findings = append(findings, CompatFinding{Extractor: "settings", Severity: severityBreaking, Change: "removed", Subject: s.Name})
+	}
+	for _, r := range d.Renamed {
+		findings = append(findings, CompatFinding{Extractor: "settings", Severity: severityBreaking, Change: "renamed", Subject: r.Old.Name, Detail: "probably renamed to " + r.New.Name})
+	}
+	for _, c := range d.Changed {
+		severity := severityWarning
+		if c.Breaking() {
+			severity = severityBreaking
+		}
+		var details []string
+		for _, field := range c.Fields {
+			switch field {
+			case "java_type":
+				details = append(details, fmt.Sprintf("type %s -> %s", c.Old.JavaType, c.New.JavaType))
+			case "default_arg":
+				details = append(details, fmt.Sprintf("default %s -> %s", c.Old.DefaultArg, c.New.DefaultArg))
+			case "properties":
+				details = append(details, fmt.Sprintf("properties %v -> %v", c.Old.Properties, c.New.Properties))
+			case "parser":
+				details = append(details, fmt.Sprintf("parser %s -> %s", c.Old.Parser, c.New.Parser))
+			}
+		}
+		findings = append(findings, CompatFinding{Extractor: "settings", Severity: severity, Change: "changed", Subject: c.Name, Detail: strings.Join(details, ", ")})
+	}
+	for _, s := range d.Added {
+		findings = append(findings, CompatFinding{Extractor: "settings", Severity: severityInfo, Change: "added", Subject: s.Name})
+	}
+	return findings
+}
+
+func restFindings(d RestDiff) []CompatFinding {
+	var findings []CompatFinding
+	for _, r := range d.RemovedRoutes {
+		findings = append(findings, CompatFinding{Extractor: "rest", Severity: severityBreaking, Change: "removed", Subject: r.Method + " " + r.Path})
+	}
+	for _, c := range d.ParameterChanges {
+		subject := c.Route.Method + " " + c.Route.Path
+		for _, p := range c.Removed {
+			findings = append(findings, CompatFinding{Extractor: "rest", Severity: severityBreaking, Change: "removed", Subject: subject, Detail: "parameter " + p})
+		}
+		for _, p := range c.Added {
+			findings = append(findings, CompatFinding{Extractor: "rest", Severity: severityInfo, Change: "added", Subject: subject, Detail: "parameter " + p})
+		}
+	}
+	for _, r := range d.AddedRoutes {
+		findings = append(findings, CompatFinding{Extractor: "rest", Severity: severityInfo, Change: "added", Subject: r.Method + " " + r.Path})
+	}
+	return findings
+}
+
+func buildCompatReport(catalog, from, to string) (CompatReport, error) {
+	report := CompatReport{BuildInfo: buildInfo(), From: from, To: to, Summary: map[string]int{}, Findings: []CompatFinding{}}
+	fromDir := filepath.Join(catalog, from)
+	toDir := filepath.Join(catalog, to)
+
+	for _, dir := range []string{fromDir, toDir} {
+		if _, err := os.Stat(dir); err != nil {
+			return report, err
+		}
+	}
+
+	// Settings and REST have their own diffs with finer grained severities
+	fromSettings, errFrom := readSettings(filepath.Join(fromDir, catalogFiles["settings"]))
+	toSettings, errTo := readSettings(filepath.Join(toDir, catalogFiles["settings"]))
+	if errFrom == nil && errTo == nil {
+		report.Findings = append(report.Findings, settingsFindings(diffSettings(fromSettings, toSettings))...)
+	}
+
+	fromRest, errFrom := readRestEndpoints(filepath.Join(fromDir, catalogFiles["rest"]))
+	toRest, errTo := readRestEndpoints(filepath.Join(toDir, catalogFiles["rest"]))
+	if errFrom == nil && errTo == nil {
+		report.Findings = append(report.Findings, restFindings(diffRestEndpoints(fromRest, toRest))...)
+	}
+
+	var extractors []string
+	for extractor := range removedSeverity {
+		extractors = append(extractors, extractor)
+	}
+	sort.Strings(extractors)
+
+	for _, extractor := range extractors {
+		if extractor == "rest" {
+			continue
+		}
+		fromKeys, fromFound, err := catalogKeys(fromDir, extractor)
+		if err != nil {
+			return report, err
+		}
+		toKeys, toFound, err := catalogKeys(toDir, extractor)
+		if err != nil {
+			return report, err
+		}
+		if !fromFound || !toFound {
+			continue
+		}
+		for _, key := range sortedKeys(fromKeys) {
+			if !toKeys[key] {
+				report.Findings = append(report.Findings, CompatFinding{Extractor: extractor, Severity: removedSeverity[extractor], Change: "removed", Subject: key})
+			}
+		}
+		for _, key := range sortedKeys(toKeys) {
+			if !fromKeys[key] {
+				report.Findings = append(report.Findings, CompatFinding{Extractor: extractor, Severity: severityInfo, Change: "added", Subject: key})
+			}
+		}
+	}
+
+	severityOrder := map[string]int{severityBreaking: 0, severityWarning: 1, severityInfo: 2}
+	sort.SliceStable(report.Findings, func(i, j int) bool {
+		return severityOrder[report.Findings[i].Severity] < severityOrder[report.Findings[j].Severity]
+	})
+	for _, f := range report.Findings {
+		report.Summary[f.Severity]++
+	}
+
+	return report, nil
+}
+
+func writeCompatReportText(w io.Writer, report CompatReport) {
+	fmt.Fprintf(w, "Compatibility report %s -> %s: %d breaking, %d warnings, %d info\n",
+		report.From, report.To, report.Summary[severityBreaking], report.Summary[severityWarning], report.Summary[severityInfo])
+	for _, f := range report.Findings {
+		line := fmt.Sprintf("[%s] %s %s: %s", f.Severity, f.Extractor, f.Change, f.Subject)
+		if f.Detail != "" {
+			line += " (" + f.Detail + ")"
+		}
+		fmt.Fprintln(w, line)
+	}
+}
+
+func runCompatReport(args []string) {
+	flags := flag.NewFlagSet("compat-report", flag.ExitOnError)
+	catalog := flags.String("catalog", ".", "directory with one subdirectory per version holding that version's extractions")
+	from := flags.String("from", "", "version upgrading from")
+	to := flags.String("to", "", "version upgrading to")
+	out := flags.String("out", "-", "write the report to this file, - for stdout")
+	text := flags.Bool("text", false, "write a human readable report instead of JSON")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh compat-report [-catalog dir] -from version -to version")
+		fmt.Fprintln(os.Stderr, "Combines the differences found by every extractor into a single report with severities.")
+		fmt.Fprintln(os.Stderr, "Each version directory holds the extractions under their default names, i.e. 7.10.0/elasticsearchSettings.json and 7.10.0/rest.json.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *from == "" || *to == "" {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	report, err := buildCompatReport(*catalog, *from, *to)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	if *text {
+		w := os.Stdout
+		if *out != "-" {
+			w, err = os.Create(*out)
+			if err != nil {
+				exitWith(exitRuntimeError, err)
+			}
+			defer w.Close()
+		}
+		writeCompatReportText(w, report)
+	} else if err := writeJSON(*out, report); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	if report.Summary[severityBreaking] > 0 {
+		exitWith(exitBreakingChanges, nil)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// gzipOutput is set by -gzip, or by an -out ending in .gz.
+var gzipOutput bool
+
+// gzipFile compresses a file into dst, - for stdout. The header has no name
+// or modification time so the output stays byte-identical between runs.
+func gzipFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out := os.Stdout
+	if dst != "-" {
+		if out, err = os.Create(dst); err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	w := gzip.NewWriter(out)
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	if dst != "-" {
+		return out.Close()
+	}
+	return nil
+}
+
+// readFile reads a file, decompressing it if it's gzipped.
+func readFile(fileName string) ([]byte, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil || !bytes.HasPrefix(b, []byte{0x1f, 0x8b}) {
+		return b, err
+	}
+
+	r, err := gzip.NewReader(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return ioutil.ReadAll(r)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const defaultBblfshEndpoint = "localhost:9432"
+
+// defaultSourceRoot is the working directory, for runs from the checkout.
+func defaultSourceRoot() string {
+	if dir, err := os.Getwd(); err == nil {
+		return dir
+	}
+	return "."
+}
+
+// Config holds the defaults of a run, written by init so the checkout and
+// bblfshd don't have to be where the tool first assumed they were.
+// -source-root and -bblfsh-endpoint override it.
+type Config struct {
+	SourceRoot     string `json:"source_root"`
+	BblfshEndpoint string `json:"bblfsh_endpoint"`
+	Format         string `json:"format,omitempty"`
+	Out            string `json:"out,omitempty"`
+	Paths          string `json:"paths,omitempty"`
+	// Namespaces are the key prefixes approved for the settings of a fork,
+	// checked by the namespaces subcommand
+	Namespaces []string `json:"namespaces,omitempty"`
+	// PublicationLog is the -publication-log of every run, for
+	// publications to be recorded without having to remember the flag
+	PublicationLog string `json:"publication_log,omitempty"`
+}
+
+// configPath is ELASTICSEARCH_BBLFSH_CONFIG, or config.json in the
+// elasticsearch-bblfsh directory of the user's configuration directory.
+func configPath() string {
+	if fileName := os.Getenv("ELASTICSEARCH_BBLFSH_CONFIG"); fileName != "" {
+		return fileName
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "elasticsearch-bblfsh", "config.json")
+}
+
+// loadConfig reads the config file, a missing one gives the defaults.
+func loadConfig() (Config, error) {
+	config := Config{SourceRoot: defaultSourceRoot(), BblfshEndpoint: defaultBblfshEndpoint}
+
+	fileName := configPath()
+	if fileName == "" {
+		return config, nil
+	}
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return config, nil
+	}
+	if err != nil {
+		return config, err
+	}
+	if err := json.Unmarshal(b, &config); err != nil {
+		return config, fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	if config.SourceRoot == "" {
+		config.SourceRoot = defaultSourceRoot()
+	}
+	if config.BblfshEndpoint == "" {
+		config.BblfshEndpoint = defaultBblfshEndpoint
+	}
+	return config, nil
+}
+
+func writeConfig(fileName string, config Config) error {
+	if err := os.MkdirAll(filepath.Dir(fileName), 0755); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, append(b, '\n'), 0644)
+}
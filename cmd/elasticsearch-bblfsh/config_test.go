@@ -0,0 +1,63 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("ELASTICSEARCH_BBLFSH_CONFIG", filepath.Join(dir, "missing.json"))
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	wd, _ := os.Getwd()
+	if config.SourceRoot != wd {
+		t.Errorf("source root %q, want the working directory %q", config.SourceRoot, wd)
+	}
+	if config.BblfshEndpoint != defaultBblfshEndpoint {
+		t.Errorf("endpoint %q, want %q", config.BblfshEndpoint, defaultBblfshEndpoint)
+	}
+}
+
+func TestLoadConfigFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "config.json")
+	t.Setenv("ELASTICSEARCH_BBLFSH_CONFIG", fileName)
+	if err := writeConfig(fileName, Config{SourceRoot: "/src/elasticsearch", Format: "csv"}); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.SourceRoot != "/src/elasticsearch" || config.Format != "csv" {
+		t.Errorf("got %+v", config)
+	}
+	if config.BblfshEndpoint != defaultBblfshEndpoint {
+		t.Errorf("an endpoint left out of the file is %q, want the default", config.BblfshEndpoint)
+	}
+}
+
+func TestWaitForBblfshdTimesOut(t *testing.T) {
+	// A port that was just free, nothing answers on it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	endpoint := l.Addr().String()
+	l.Close()
+
+	start := time.Now()
+	if err := waitForBblfshd(endpoint, 10*time.Millisecond); err == nil {
+		t.Fatal("no error for an endpoint nothing listens on")
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Errorf("waited %s past the timeout", time.Since(start))
+	}
+}
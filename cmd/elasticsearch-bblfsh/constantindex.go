@@ -0,0 +1,167 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// constantIndexVersion is bumped whenever what indexConstants records
+// changes, so an index written by an older version is rebuilt.
+const constantIndexVersion = 2
+
+// fileConstants are the constants one file declares, along with the hash of
+// the content they were read from.
+type fileConstants struct {
+	Hash    string            `json:"hash"`
+	Strings map[string]string `json:"strings,omitempty"`
+	Numbers map[string]string `json:"numbers,omitempty"`
+	Enums   map[string]bool   `json:"enums,omitempty"`
+}
+
+// constantIndex is the constant index kept in the UAST cache, so a run
+// scanning part of the tree still resolves the constants of the rest and a
+// run over the whole tree only reindexes the files that changed.
+type constantIndex struct {
+	Version int                       `json:"version"`
+	Files   map[string]*fileConstants `json:"files"`
+}
+
+// indexedFiles are the constants of stringConstants, numberConstants and
+// enumConstants by the file declaring them, relative to the source root.
+var indexedFiles = map[string]*fileConstants{}
+
+// freshConstants are the files loadConstantIndex found unchanged or
+// reindexed, the walk that follows doesn't index them again.
+var freshConstants = map[string]bool{}
+
+// fileHash returns the SHA-256 of the content of a file, empty when it
+// can't be read.
+func fileHash(fileName string) string {
+	content, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// setFileConstants replaces the constants a file declares in the index. The
+// ones it no longer declares are removed, unless another file has since
+// declared them with another value.
+func setFileConstants(file string, entry *fileConstants) {
+	if previous, ok := indexedFiles[file]; ok {
+		for key, value := range previous.Strings {
+			if _, ok := entry.Strings[key]; !ok && stringConstants[key] == value {
+				delete(stringConstants, key)
+			}
+		}
+		for key, value := range previous.Numbers {
+			if _, ok := entry.Numbers[key]; !ok && numberConstants[key] == value {
+				delete(numberConstants, key)
+			}
+		}
+		for key, value := range previous.Enums {
+			if _, ok := entry.Enums[key]; !ok && enumConstants[key] == value {
+				delete(enumConstants, key)
+			}
+		}
+	}
+
+	for key, value := range entry.Strings {
+		stringConstants[key] = value
+	}
+	for key, value := range entry.Numbers {
+		numberConstants[key] = value
+	}
+	for key, value := range entry.Enums {
+		enumConstants[key] = value
+	}
+	indexedFiles[file] = entry
+}
+
+// constantIndexPath is where the index of the source root is kept in the
+// cache. Each checkout gets its own since the index is keyed by path.
+func constantIndexPath() string {
+	root, err := filepath.Abs(rootDir)
+	if err != nil {
+		root = rootDir
+	}
+	sum := sha256.Sum256([]byte(root))
+	return filepath.Join(uastCacheDir, "constants-"+hex.EncodeToString(sum[:6])+".json")
+}
+
+// loadConstantIndex fills the index with the constants of the previous runs
+// over the checkout. Files that were deleted are dropped and the ones that
+// changed are parsed again, from the UAST cache when possible, so the index
+// matches the tree before the walk starts.
+func loadConstantIndex() error {
+	b, err := ioutil.ReadFile(constantIndexPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	var index constantIndex
+	if err := json.Unmarshal(b, &index); err != nil || index.Version != constantIndexVersion {
+		// Like a damaged tree, a damaged or outdated index is rebuilt
+		logger.Warn("ignoring the cached constant index", "path", constantIndexPath(), "error", err)
+		return nil
+	}
+
+	files := make([]string, 0, len(index.Files))
+	for file := range index.Files {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+
+	reindexed := 0
+	for _, file := range files {
+		entry := index.Files[file]
+		filePath := filepath.Join(rootDir, filepath.FromSlash(file))
+		hash := fileHash(filePath)
+		if hash == "" {
+			continue
+		}
+		if hash == entry.Hash {
+			setFileConstants(file, entry)
+			freshConstants[file] = true
+			continue
+		}
+
+		rootNode, _, err := parseJava(filePath)
+		if err != nil || rootNode == nil {
+			logger.Warn("couldn't reindex the constants of a changed file", "file", file, "error", err)
+			continue
+		}
+		indexConstants(rootNode, filePath)
+		freshConstants[file] = true
+		reindexed++
+	}
+	logger.Debug("loaded the constant index", "files", len(indexedFiles), "reindexed", reindexed)
+	return nil
+}
+
+// writeConstantIndex saves the index for the next run.
+func writeConstantIndex() error {
+	b, err := json.Marshal(constantIndex{Version: constantIndexVersion, Files: indexedFiles})
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(uastCacheDir, 0755); err != nil {
+		return err
+	}
+	// Write then rename like the trees, an interrupted run keeps the
+	// previous index
+	fileName := constantIndexPath()
+	if err := ioutil.WriteFile(fileName+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(fileName+".tmp", fileName)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadConstantIndex(t *testing.T) {
+	defer func(root, cache string) { rootDir, uastCacheDir = root, cache }(rootDir, uastCacheDir)
+	defer func() {
+		indexedFiles, freshConstants, stringConstants = map[string]*fileConstants{}, map[string]bool{}, map[string]string{}
+	}()
+	rootDir, uastCacheDir = t.TempDir(), t.TempDir()
+
+	fileName := filepath.Join(rootDir, "IndexSettings.java")
+	if err := ioutil.WriteFile(fileName, []byte("class IndexSettings {}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	index := constantIndex{Version: constantIndexVersion, Files: map[string]*fileConstants{
+		"IndexSettings.java": {Hash: fileHash(fileName), Strings: map[string]string{"IndexSettings.PREFIX": "index."}},
+		"Deleted.java":       {Hash: "0", Strings: map[string]string{"Deleted.PREFIX": "deleted."}},
+	}}
+	b, _ := json.Marshal(index)
+	if err := ioutil.WriteFile(constantIndexPath(), b, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := loadConstantIndex(); err != nil {
+		t.Fatal(err)
+	}
+	if stringConstants["IndexSettings.PREFIX"] != "index." {
+		t.Errorf("the constants of an unchanged file weren't loaded: %v", stringConstants)
+	}
+	if _, ok := stringConstants["Deleted.PREFIX"]; ok {
+		t.Error("the constants of a deleted file were loaded")
+	}
+	if !freshConstants["IndexSettings.java"] {
+		t.Fatal("an unchanged file isn't fresh")
+	}
+
+	// The walk doesn't index the file again, only once
+	if err := extractors[0].extract(nil, fileName); err != nil {
+		t.Fatal(err)
+	}
+	if freshConstants["IndexSettings.java"] || stringConstants["IndexSettings.PREFIX"] != "index." {
+		t.Errorf("the walk indexed a fresh file again")
+	}
+}
+
+func TestSetFileConstants(t *testing.T) {
+	defer func() { indexedFiles, stringConstants = map[string]*fileConstants{}, map[string]string{} }()
+
+	setFileConstants("A.java", &fileConstants{Strings: map[string]string{"A.X": "x", "A.Y": "y"}})
+	setFileConstants("B.java", &fileConstants{Strings: map[string]string{"A.Y": "other"}})
+	setFileConstants("A.java", &fileConstants{Strings: map[string]string{}})
+	if _, ok := stringConstants["A.X"]; ok {
+		t.Error("a constant the file no longer declares is still indexed")
+	}
+	if stringConstants["A.Y"] != "other" {
+		t.Errorf("a constant declared by another file since was removed: %v", stringConstants)
+	}
+}
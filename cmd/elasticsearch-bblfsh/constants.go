@@ -0,0 +1,286 @@
+package main
+
+import (
+	"strings"
+
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// stringConstants maps "ClassName.FIELD" to the value of every static final
+// String field initialized with a literal in the scanned files, i.e.
+// public static final String NAME = "match";
+// or with a concatenation of literals and constants known by then.
+var stringConstants = map[string]string{}
+
+// numberConstants maps "ClassName.FIELD" to the value of every static final
+// number field initialized with a literal, i.e.
+// public static final int DEFAULT_NUMBER_OF_SHARDS = 1;
+var numberConstants = map[string]string{}
+
+// enumConstants maps "EnumName.CONSTANT" of every enum constant in the
+// scanned files to whether the enum overrides toString, in which case the
+// toString of its constants isn't their name.
+var enumConstants = map[string]bool{}
+
+// nameOf returns the name of a declaration or invocation node.
+func nameOf(node *uast.Node) string {
+	for _, child := range node.Children {
+		if child.Properties["internalRole"] == "name" {
+			return child.Token
+		}
+	}
+	return ""
+}
+
+func hasModifier(node *uast.Node, modifier string) bool {
+	for _, child := range node.Children {
+		if child.InternalType == "Modifier" && (child.Token == modifier || child.Properties["keyword"] == modifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// indexConstants adds the constants declared in a file to the index the
+// other extractors resolve names and values with, replacing the ones the
+// file declared when the index was loaded from the cache.
+func indexConstants(rootNode *uast.Node, fileName string) {
+	entry := &fileConstants{Strings: fileStringConstants(rootNode), Numbers: map[string]string{}, Enums: fileEnumConstants(rootNode)}
+	for key, value := range entry.Strings {
+		stringConstants[key] = value
+	}
+
+	// Concatenations, i.e. SETTING_PREFIX + "number_of_shards", once the
+	// literals of the file are known
+	staticFinalInitializers(rootNode, func(className, field string, initializer *uast.Node) {
+		key := className + "." + field
+		switch initializer.InternalType {
+		case "InfixExpression":
+			if value, ok := resolveConcatenation(initializer, className); ok {
+				entry.Strings[key] = value
+				stringConstants[key] = value
+			}
+		case "NumberLiteral":
+			entry.Numbers[key] = numberLiteral(initializer)
+		case "PrefixExpression":
+			if initializer.Properties["operator"] == "-" && len(initializer.Children) > 0 && initializer.Children[0].InternalType == "NumberLiteral" {
+				entry.Numbers[key] = "-" + numberLiteral(initializer.Children[0])
+			}
+		}
+	})
+
+	if uastCacheDir != "" {
+		entry.Hash = fileHash(fileName)
+	}
+	setFileConstants(relativePath(fileName), entry)
+}
+
+// fileEnumConstants returns the constants of the enums declared in a file,
+// keyed by "EnumName.CONSTANT", and whether the enum overrides toString.
+func fileEnumConstants(rootNode *uast.Node) map[string]bool {
+	constants := map[string]bool{}
+	enums, _ := tools.Filter(rootNode, "//EnumDeclaration")
+
+	for _, enum := range enums {
+		customToString := false
+		for _, child := range enum.Children {
+			if child.InternalType == "MethodDeclaration" && nameOf(child) == "toString" {
+				customToString = true
+			}
+		}
+		for _, child := range enum.Children {
+			if child.InternalType == "EnumConstantDeclaration" {
+				constants[nameOf(enum)+"."+nameOf(child)] = customToString
+			}
+		}
+	}
+	return constants
+}
+
+// numberLiteral returns the value of a number literal as written, without
+// the suffix of longs and floats.
+func numberLiteral(node *uast.Node) string {
+	value := node.Token
+	if value == "" {
+		value = node.Properties["token"]
+	}
+	return strings.TrimRight(value, "lLfFdD")
+}
+
+// staticFinalInitializers calls visit with the initializer of every static
+// final field declared in a file.
+func staticFinalInitializers(rootNode *uast.Node, visit func(className, field string, initializer *uast.Node)) {
+	classes, _ := tools.Filter(rootNode, "//TypeDeclaration")
+
+	for _, class := range classes {
+		className := nameOf(class)
+
+		for _, field := range class.Children {
+			if field.InternalType != "FieldDeclaration" || !hasModifier(field, "static") || !hasModifier(field, "final") {
+				continue
+			}
+			for _, fragment := range field.Children {
+				if fragment.InternalType != "VariableDeclarationFragment" {
+					continue
+				}
+				if initializer := childWithRole(fragment, "initializer"); initializer != nil {
+					visit(className, nameOf(fragment), initializer)
+				}
+			}
+		}
+	}
+}
+
+// fileStringConstants returns the static final String constants declared in
+// a single file, keyed by "ClassName.FIELD".
+func fileStringConstants(rootNode *uast.Node) map[string]string {
+	constants := map[string]string{}
+	staticFinalInitializers(rootNode, func(className, field string, initializer *uast.Node) {
+		if initializer.InternalType == "StringLiteral" {
+			constants[className+"."+field] = strings.Trim(initializer.Token, "\"")
+		}
+	})
+	return constants
+}
+
+// resolveConcatenation is resolveString for concatenations of literals and
+// constants too, i.e. PREFIX + "enabled".
+func resolveConcatenation(node *uast.Node, className string) (string, bool) {
+	if node.InternalType != "InfixExpression" || node.Properties["operator"] != "+" {
+		return resolveString(node, className)
+	}
+	var value strings.Builder
+	for _, child := range node.Children {
+		part, ok := resolveConcatenation(child, className)
+		if !ok {
+			return "", false
+		}
+		value.WriteString(part)
+	}
+	return value.String(), true
+}
+
+// lookupStaticImport returns the value of a constant referred to without its
+// class, as after a static import, when a single class of the index
+// declares a constant of that name.
+func lookupStaticImport(constants map[string]string, field string) (string, bool) {
+	var value string
+	found := 0
+	for key, v := range constants {
+		if strings.HasSuffix(key, "."+field) {
+			value = v
+			found++
+		}
+	}
+	return value, found == 1
+}
+
+// resolveString returns the value of a String expression when it's a literal
+// or a constant, either qualified (MatchQueryBuilder.NAME) or declared in
+// className. It also sees through ParseField, whose first argument is the
+// preferred name. The boolean is false when the value couldn't be resolved.
+func resolveString(node *uast.Node, className string) (string, bool) {
+	switch node.InternalType {
+	case "StringLiteral":
+		return strings.Trim(node.Token, "\""), true
+	case "SimpleName":
+		value, ok := stringConstants[className+"."+node.Token]
+		return value, ok
+	case "QualifiedName":
+		var parts []string
+		for _, child := range node.Children {
+			parts = append(parts, child.Token)
+		}
+		// Only the last class name matters, i.e. for
+		// org.elasticsearch.Foo.NAME look up Foo.NAME
+		if len(parts) >= 2 {
+			value, ok := stringConstants[strings.Join(parts[len(parts)-2:], ".")]
+			return value, ok
+		}
+	case "ClassInstanceCreation":
+		if arguments := argumentsOf(node); len(arguments) > 0 {
+			return resolveString(arguments[0], className)
+		}
+	case "MethodInvocation":
+		// i.e. MatchQueryBuilder.NAME.getPreferredName()
+		for _, child := range node.Children {
+			if child.Properties["internalRole"] == "expression" {
+				return resolveString(child, className)
+			}
+		}
+	}
+	return "", false
+}
+
+// expressionString renders an unresolved expression the way it's written,
+// close enough to be recognizable.
+func expressionString(node *uast.Node) string {
+	if node.Token != "" {
+		return node.Token
+	}
+	var parts []string
+	for _, child := range node.Children {
+		if part := expressionString(child); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// resolveSettingConstants replaces the names and defaults settings are given
+// as constants with their value from the index. Once final, constants
+// written without their class that aren't declared in the class using them
+// are looked up by field name, for static imports, and the ones that still
+// aren't known are left as written. Defaults given as the toString of an
+// enum constant keep the constant's name unless the enum overrides
+// toString, then they're left as written too.
+func resolveSettingConstants(settings []ElasticsearchSetting, final bool) {
+	lookup := func(constants map[string]string, reference, className string) (string, bool) {
+		parts := strings.Split(reference, ".")
+		if len(parts) == 1 {
+			parts = []string{className, reference}
+		}
+		if value, ok := constants[strings.Join(parts[len(parts)-2:], ".")]; ok {
+			return value, true
+		}
+		if final && !strings.Contains(reference, ".") {
+			return lookupStaticImport(constants, reference)
+		}
+		return "", false
+	}
+
+	for i := range settings {
+		s := &settings[i]
+		if s.nameConstant != "" {
+			if value, ok := lookup(stringConstants, s.nameConstant, s.constantClass); ok {
+				s.Name, s.nameConstant = value, ""
+			} else if final {
+				logger.Debug("setting name constant not found", "constant", s.nameConstant, "file", s.CodeFile, "line", s.CodeLine)
+				s.Name, s.nameConstant = s.nameConstant, ""
+			}
+		}
+		if s.defaultConstant != "" {
+			value, ok := lookup(stringConstants, s.defaultConstant, s.constantClass)
+			if !ok {
+				value, ok = lookup(numberConstants, s.defaultConstant, s.constantClass)
+			}
+			if ok {
+				s.DefaultArg, s.defaultConstant = value, ""
+			} else if final {
+				s.DefaultArg, s.defaultConstant = s.defaultConstant, ""
+			}
+		}
+		if s.defaultEnum != "" {
+			parts := strings.Split(s.defaultEnum, ".")
+			customToString, ok := enumConstants[strings.Join(parts[len(parts)-2:], ".")]
+			switch {
+			case ok && customToString:
+				logger.Debug("setting default is the toString of an enum overriding it", "constant", s.defaultEnum, "file", s.CodeFile, "line", s.CodeLine)
+				s.DefaultArg, s.defaultEnum = s.defaultEnum+".toString()", ""
+			case ok || final:
+				s.defaultEnum = ""
+			}
+		}
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// csvHeader is the stable column set of the CSV output. Only ever append
+// columns so spreadsheets built on top of it keep working.
+var csvHeader = []string{"name", "type", "default", "properties", "scope", "file", "line"}
+
+func writeSettingsCSV(w io.Writer, settings []ElasticsearchSetting) error {
+	out := csv.NewWriter(w)
+
+	if err := out.Write(csvHeader); err != nil {
+		return err
+	}
+	for _, s := range settings {
+		record := []string{
+			s.Name,
+			s.JavaType,
+			s.DefaultArg,
+			strings.Join(s.Properties, "|"),
+			s.Scope(),
+			s.CodeFile,
+			fmt.Sprint(s.CodeLine),
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
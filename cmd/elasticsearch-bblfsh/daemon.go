@@ -0,0 +1,482 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RegistryVersion is an extraction of a branch at a commit kept by the
+// daemon.
+type RegistryVersion struct {
+	Branch      string    `json:"branch"`
+	Commit      string    `json:"commit"`
+	ExtractedAt time.Time `json:"extracted_at"`
+	// File and Manifest are relative to the registry directory
+	File     string `json:"file"`
+	Manifest string `json:"manifest"`
+	Settings int    `json:"settings"`
+}
+
+// Registry is the index of the versions the daemon extracted, registry.json
+// in its directory, the oldest first.
+type Registry struct {
+	Versions []RegistryVersion `json:"versions"`
+}
+
+// settingsRegistry is the registry of a daemon, shared between the refresh
+// loop and the HTTP API.
+type settingsRegistry struct {
+	dir string
+
+	mu       sync.RWMutex
+	registry Registry
+}
+
+func (r *settingsRegistry) indexPath() string {
+	return filepath.Join(r.dir, "registry.json")
+}
+
+// load reads the registry a previous daemon left, a missing one is empty.
+func (r *settingsRegistry) load() error {
+	b, err := ioutil.ReadFile(r.indexPath())
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := json.Unmarshal(b, &r.registry); err != nil {
+		return fmt.Errorf("%s: %v", r.indexPath(), err)
+	}
+	return nil
+}
+
+// latest returns the newest version of a branch.
+func (r *settingsRegistry) latest(branch string) (RegistryVersion, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.registry.Versions) - 1; i >= 0; i-- {
+		if v := r.registry.Versions[i]; v.Branch == branch {
+			return v, true
+		}
+	}
+	return RegistryVersion{}, false
+}
+
+// add records a new version and removes the versions of its branch past the
+// newest keep ones, 0 keeping them all.
+func (r *settingsRegistry) add(version RegistryVersion, keep int) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	versions := append(r.registry.Versions, version)
+	if keep > 0 {
+		count := 0
+		for i := len(versions) - 1; i >= 0; i-- {
+			if versions[i].Branch != version.Branch {
+				continue
+			}
+			count++
+			if count <= keep {
+				continue
+			}
+			os.Remove(filepath.Join(r.dir, versions[i].File))
+			os.Remove(filepath.Join(r.dir, versions[i].Manifest))
+			versions = append(versions[:i], versions[i+1:]...)
+		}
+	}
+	r.registry.Versions = versions
+
+	b, err := json.MarshalIndent(r.registry, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Write then rename, the HTTP API never reads half an index
+	if err := ioutil.WriteFile(r.indexPath()+".tmp", b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(r.indexPath()+".tmp", r.indexPath())
+}
+
+// find returns the version of a branch with a commit starting with commit,
+// or its newest one for "latest".
+func (r *settingsRegistry) find(branch, commit string) (RegistryVersion, bool) {
+	if commit == "latest" {
+		return r.latest(branch)
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for i := len(r.registry.Versions) - 1; i >= 0; i-- {
+		v := r.registry.Versions[i]
+		if v.Branch == branch && commit != "" && strings.HasPrefix(v.Commit, commit) {
+			return v, true
+		}
+	}
+	return RegistryVersion{}, false
+}
+
+func (r *settingsRegistry) branchVersions(branch string) []RegistryVersion {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := []RegistryVersion{}
+	for _, v := range r.registry.Versions {
+		if branch == "" || v.Branch == branch {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// ServeHTTP serves the registry:
+//
+//	/versions                    every version
+//	/versions/<branch>           the versions of a branch
+//	/versions/<branch>/latest    the settings of its newest version
+//	/versions/<branch>/<commit>  the settings of the branch at a commit
+//
+// Branches can have slashes, the last segment is only a commit when the
+// path isn't a branch as a whole.
+func (r *settingsRegistry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	rest := strings.Trim(strings.TrimPrefix(req.URL.Path, "/versions"), "/")
+	if rest == "" {
+		writeHTTPJSON(w, Registry{Versions: r.branchVersions("")})
+		return
+	}
+	if versions := r.branchVersions(rest); len(versions) > 0 {
+		writeHTTPJSON(w, Registry{Versions: versions})
+		return
+	}
+
+	slash := strings.LastIndex(rest, "/")
+	if slash < 0 {
+		http.Error(w, "no such branch", http.StatusNotFound)
+		return
+	}
+	version, ok := r.find(rest[:slash], rest[slash+1:])
+	if !ok {
+		http.Error(w, "no such version", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	http.ServeFile(w, req, filepath.Join(r.dir, version.File))
+}
+
+func writeHTTPJSON(w http.ResponseWriter, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(b)
+}
+
+// registryDataset serves the versions of a daemon over the serve API, named
+// branch@commit. A branch alone names its newest version.
+type registryDataset struct {
+	registry *settingsRegistry
+
+	// The settings of the version last asked for are kept, it's the newest
+	// one most of the time
+	mu         sync.Mutex
+	loadedFile string
+	loaded     []ElasticsearchSetting
+}
+
+func (d *registryDataset) versions() []DatasetVersion {
+	versions := []DatasetVersion{}
+	for _, v := range d.registry.branchVersions("") {
+		versions = append(versions, DatasetVersion{
+			Version:      v.Branch + "@" + v.Commit,
+			SourceCommit: v.Commit,
+			ExtractedAt:  v.ExtractedAt,
+			Settings:     v.Settings,
+		})
+	}
+	return versions
+}
+
+func (d *registryDataset) settings(version string) ([]ElasticsearchSetting, string, bool, error) {
+	var v RegistryVersion
+	var ok bool
+	switch at := strings.LastIndex(version, "@"); {
+	case version == "":
+		if all := d.registry.branchVersions(""); len(all) > 0 {
+			v, ok = all[len(all)-1], true
+		}
+	case at >= 0:
+		v, ok = d.registry.find(version[:at], version[at+1:])
+	default:
+		v, ok = d.registry.latest(version)
+	}
+	if !ok {
+		return nil, "", false, nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.loadedFile != v.File {
+		doc, err := readSettingsDocument(filepath.Join(d.registry.dir, v.File))
+		if err != nil {
+			return nil, "", false, err
+		}
+		sortSettings(doc.Settings)
+		d.loadedFile, d.loaded = v.File, doc.Settings
+	}
+	return d.loaded, v.Branch + "@" + v.Commit, true, nil
+}
+
+// branchDirName is the name of the directories of a branch, without the
+// slashes of names like feature/x.
+func branchDirName(branch string) string {
+	return strings.NewReplacer("/", "_", "\\", "_").Replace(branch)
+}
+
+// daemon refreshes the checkout and extracts the branches that moved.
+type daemon struct {
+	registry *settingsRegistry
+	root     string
+	remote   string
+	branches []string
+	keep     int
+	config   Config
+	// runArgs are the flags of the extraction runs
+	runArgs []string
+}
+
+func (d *daemon) git(dir string, args ...string) (string, error) {
+	out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", strings.Join(args, " "), err, strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// checkout moves the worktree of a branch to the commit just fetched and
+// returns it. Each branch has its own worktree so extracting one doesn't
+// disturb the main checkout or another branch.
+func (d *daemon) checkout(branch string) (string, string, error) {
+	worktree := filepath.Join(d.registry.dir, "worktrees", branchDirName(branch))
+	ref := d.remote + "/" + branch
+	if _, err := os.Stat(worktree); os.IsNotExist(err) {
+		if _, err := d.git(d.root, "worktree", "add", "--detach", worktree, ref); err != nil {
+			return "", "", err
+		}
+	} else if _, err := d.git(worktree, "checkout", "--detach", "--force", ref); err != nil {
+		return "", "", err
+	}
+	commit, err := d.git(worktree, "rev-parse", "HEAD")
+	return worktree, commit, err
+}
+
+// extract runs an extraction over a worktree, as a run of its own with
+// -quiet and the daemon's run flags, and records it in the registry.
+func (d *daemon) extract(branch, worktree, commit string) error {
+	dir := filepath.Join(d.registry.dir, branchDirName(branch))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	version := RegistryVersion{
+		Branch:      branch,
+		Commit:      commit,
+		ExtractedAt: time.Now().UTC(),
+		File:        filepath.Join(branchDirName(branch), commit+".json"),
+		Manifest:    filepath.Join(branchDirName(branch), commit+".manifest.json"),
+	}
+
+	// The run gets the daemon's config with the worktree as the checkout,
+	// and -source-root after the run flags for them not to override it
+	config := d.config
+	config.SourceRoot = worktree
+	configFile := worktree + ".config.json"
+	if err := writeConfig(configFile, config); err != nil {
+		return err
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	args := append(append([]string{}, d.runArgs...),
+		"-source-root", worktree,
+		"-format", "json",
+		"-out", filepath.Join(d.registry.dir, version.File),
+		"-manifest", filepath.Join(d.registry.dir, version.Manifest),
+		"-quiet", "-no-progress")
+	cmd := exec.Command(executable, args...)
+	cmd.Env = append(os.Environ(), "ELASTICSEARCH_BBLFSH_CONFIG="+configFile)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	err = cmd.Run()
+	var manifest *RunManifest
+	if b, readErr := ioutil.ReadFile(filepath.Join(d.registry.dir, version.Manifest)); readErr == nil {
+		manifest = &RunManifest{}
+		if json.Unmarshal(b, manifest) != nil {
+			manifest = nil
+		}
+	}
+	runMetrics.observeRun(manifest, err != nil)
+	if err != nil {
+		return fmt.Errorf("extracting %s at %s: %v", branch, commit, err)
+	}
+
+	doc, err := readSettingsDocument(filepath.Join(d.registry.dir, version.File))
+	if err != nil {
+		return err
+	}
+	version.Settings = len(doc.Settings)
+	return d.registry.add(version, d.keep)
+}
+
+// refresh fetches the branches and extracts the ones whose commit changed
+// since their latest version. A branch failing doesn't hold the others
+// back, it's tried again on the next refresh.
+func (d *daemon) refresh() {
+	args := append([]string{"fetch", "--quiet", d.remote}, d.branches...)
+	if _, err := d.git(d.root, args...); err != nil {
+		logger.Error("fetching the branches failed", "error", err)
+		return
+	}
+	for _, branch := range d.branches {
+		if shutdownRequested() {
+			return
+		}
+		worktree, commit, err := d.checkout(branch)
+		if err != nil {
+			logger.Error("checking the branch out failed", "branch", branch, "error", err)
+			continue
+		}
+		if latest, ok := d.registry.latest(branch); ok && latest.Commit == commit {
+			logger.Info("branch unchanged", "branch", branch, "commit", commit)
+			continue
+		}
+		started := time.Now()
+		if err := d.extract(branch, worktree, commit); err != nil {
+			logger.Error("extraction failed", "branch", branch, "commit", commit, "error", err)
+			continue
+		}
+		logger.Info("extracted", "branch", branch, "commit", commit, "duration", time.Since(started).Round(time.Second))
+	}
+}
+
+func runDaemon(args []string) {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	dir := flags.String("dir", "registry", "directory to keep the worktrees, the extracted versions and their registry.json in")
+	branches := flags.String("branches", "main", "comma separated branches to extract")
+	remote := flags.String("remote", "origin", "remote of the checkout to fetch the branches from")
+	interval := flags.Duration("interval", time.Hour, "how often to fetch the branches")
+	keep := flags.Int("keep", 0, "versions to keep per branch, 0 to keep them all")
+	addr := flags.String("addr", "", "serve the versions on this address under /versions, i.e. localhost:8080")
+	server := addServerFlags(flags)
+	logLevelFlag := flags.String("log-level", "info", "debug, info, warn or error")
+	logFormat := flags.String("log-format", "text", "text, or json for one JSON object per log line")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh daemon [-dir dir] [-branches b1,b2] [-interval 1h] [-addr host:port [-user name] [-api-keys-file keys] [-tls-cert cert -tls-key key]] [-- run flags...]")
+		fmt.Fprintln(os.Stderr, "Keeps fetching branches of the configured checkout and extracting the settings of each new commit, keeping every version and serving them.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *interval <= 0 || *keep < 0 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+	if err := setupLogging(*logLevelFlag, *logFormat); err != nil {
+		exitWith(exitUsageError, err)
+	}
+	// The daemon picks the output of the runs, flags after -- tune the
+	// rest, i.e. -extractors or -uast-cache
+	for _, arg := range flags.Args() {
+		name := strings.TrimLeft(strings.SplitN(arg, "=", 2)[0], "-")
+		for _, reserved := range []string{"format", "out", "manifest", "watch", "checkpoint", "resume"} {
+			if strings.HasPrefix(arg, "-") && name == reserved {
+				exitWith(exitUsageError, fmt.Errorf("-%s is set by the daemon, it can't be given to its runs", reserved))
+			}
+		}
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		exitWith(exitUsageError, err)
+	}
+	var names []string
+	for _, branch := range strings.Split(*branches, ",") {
+		if branch = strings.TrimSpace(branch); branch != "" {
+			names = append(names, branch)
+		}
+	}
+	if len(names) == 0 {
+		exitWith(exitUsageError, errors.New("-branches needs at least one branch"))
+	}
+
+	registryDir, err := filepath.Abs(*dir)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	if err := os.MkdirAll(registryDir, 0755); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	registry := &settingsRegistry{dir: registryDir}
+	if err := registry.load(); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	if *addr != "" {
+		mux := http.NewServeMux()
+		mux.Handle("/versions", registry)
+		mux.Handle("/versions/", registry)
+		mux.Handle("/metrics", runMetrics)
+		(&settingsAPI{dataset: &registryDataset{registry: registry}}).register(mux)
+		handler, err := server.handler(mux)
+		if err != nil {
+			exitWith(exitUsageError, err)
+		}
+		listener, err := net.Listen("tcp", *addr)
+		if err != nil {
+			exitWith(exitUsageError, fmt.Errorf("-addr: %v", err))
+		}
+		go func() {
+			if err := server.serve(listener, handler); err != nil {
+				logger.Error("server stopped", "error", err)
+			}
+		}()
+		logger.Info("serving the versions", "url", fmt.Sprintf("%s://%s/versions", server.scheme(), listener.Addr()))
+	}
+
+	d := &daemon{
+		registry: registry,
+		root:     config.SourceRoot,
+		remote:   *remote,
+		branches: names,
+		keep:     *keep,
+		config:   config,
+		runArgs:  flags.Args(),
+	}
+
+	handleShutdownSignals("stopping once the extraction going on is done")
+	for {
+		d.refresh()
+		select {
+		case <-time.After(*interval):
+		case <-shutdown:
+			return
+		}
+	}
+}
@@ -0,0 +1,210 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"reflect"
+	"sort"
+)
+
+// SettingChange describes a setting present in both extractions whose
+// definition differs between them.
+type SettingChange struct {
+	Name   string               `json:"name"`
+	Fields []string             `json:"fields"`
+	Old    ElasticsearchSetting `json:"old"`
+	New    ElasticsearchSetting `json:"new"`
+}
+
+// Breaking reports whether configuration that was valid for the old setting
+// could be rejected or behave differently with the new one: the value type
+// changed, the setting moved scope, or it can no longer be updated dynamically.
+func (c SettingChange) Breaking() bool {
+	if c.Old.JavaType != c.New.JavaType || c.Old.Scope() != c.New.Scope() {
+		return true
+	}
+	return hasProperty(c.Old, "Dynamic") && !hasProperty(c.New, "Dynamic")
+}
+
+func hasProperty(s ElasticsearchSetting, property string) bool {
+	for _, p := range s.Properties {
+		if p == property {
+			return true
+		}
+	}
+	return false
+}
+
+// SettingRename is a removed and an added setting that look like the same
+// setting under a new name.
+type SettingRename struct {
+	Old ElasticsearchSetting `json:"old"`
+	New ElasticsearchSetting `json:"new"`
+}
+
+// SettingsDiff is the result of comparing two extractions.
+type SettingsDiff struct {
+	Added   []ElasticsearchSetting `json:"added"`
+	Removed []ElasticsearchSetting `json:"removed"`
+	Renamed []SettingRename        `json:"renamed"`
+	Changed []SettingChange        `json:"changed"`
+}
+
+// Breaking reports whether any setting was removed, renamed or had a
+// breaking change.
+func (d SettingsDiff) Breaking() bool {
+	if len(d.Removed) > 0 || len(d.Renamed) > 0 {
+		return true
+	}
+	for _, c := range d.Changed {
+		if c.Breaking() {
+			return true
+		}
+	}
+	return false
+}
+
+func settingsByName(settings []ElasticsearchSetting) map[string]ElasticsearchSetting {
+	byName := make(map[string]ElasticsearchSetting, len(settings))
+	for _, s := range settings {
+		byName[s.Name] = s
+	}
+	return byName
+}
+
+func changedFields(old, new ElasticsearchSetting) []string {
+	// Only compare what describes the setting itself, line numbers and
+	// file moves aren't interesting to someone configuring a cluster
+	var fields []string
+	if old.JavaType != new.JavaType {
+		fields = append(fields, "java_type")
+	}
+	if old.DefaultArg != new.DefaultArg {
+		fields = append(fields, "default_arg")
+	}
+	if !reflect.DeepEqual(sortedCopy(old.Properties), sortedCopy(new.Properties)) {
+		fields = append(fields, "properties")
+	}
+	// Another parser may accept another syntax under the same type
+	if old.Parser != new.Parser {
+		fields = append(fields, "parser")
+	}
+	return fields
+}
+
+func sortedCopy(values []string) []string {
+	sorted := append([]string{}, values...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+// probableRename reports whether an added setting looks like a removed one
+// under a new name: same type and default, and either declared in the same
+// file or assigned to the same Java field.
+func probableRename(old, new ElasticsearchSetting) bool {
+	if old.JavaType != new.JavaType || old.DefaultArg != new.DefaultArg {
+		return false
+	}
+	return old.CodeFile == new.CodeFile || (old.RawName != "" && old.RawName == new.RawName)
+}
+
+// detectRenames pairs up removed and added settings that are probable
+// renames of each other. A pair is only reported when neither side has any
+// other candidate, otherwise e.g. a file full of boolean settings defaulting
+// to false would produce arbitrary matches.
+func detectRenames(added, removed []ElasticsearchSetting) ([]SettingRename, []ElasticsearchSetting, []ElasticsearchSetting) {
+	addedCandidates := make([][]int, len(added))
+	removedCandidates := make([][]int, len(removed))
+	for i, o := range removed {
+		for j, n := range added {
+			if probableRename(o, n) {
+				removedCandidates[i] = append(removedCandidates[i], j)
+				addedCandidates[j] = append(addedCandidates[j], i)
+			}
+		}
+	}
+
+	var renames []SettingRename
+	renamedAdded := map[int]bool{}
+	renamedRemoved := map[int]bool{}
+	for i, candidates := range removedCandidates {
+		if len(candidates) != 1 || len(addedCandidates[candidates[0]]) != 1 {
+			continue
+		}
+		j := candidates[0]
+		renames = append(renames, SettingRename{Old: removed[i], New: added[j]})
+		renamedRemoved[i] = true
+		renamedAdded[j] = true
+	}
+
+	var remainingAdded, remainingRemoved []ElasticsearchSetting
+	for j, n := range added {
+		if !renamedAdded[j] {
+			remainingAdded = append(remainingAdded, n)
+		}
+	}
+	for i, o := range removed {
+		if !renamedRemoved[i] {
+			remainingRemoved = append(remainingRemoved, o)
+		}
+	}
+
+	return renames, remainingAdded, remainingRemoved
+}
+
+func diffSettings(old, new []ElasticsearchSetting) SettingsDiff {
+	oldByName := settingsByName(old)
+	newByName := settingsByName(new)
+
+	var d SettingsDiff
+	for name, n := range newByName {
+		o, ok := oldByName[name]
+		if !ok {
+			d.Added = append(d.Added, n)
+			continue
+		}
+		if fields := changedFields(o, n); len(fields) > 0 {
+			d.Changed = append(d.Changed, SettingChange{Name: name, Fields: fields, Old: o, New: n})
+		}
+	}
+	for name, o := range oldByName {
+		if _, ok := newByName[name]; !ok {
+			d.Removed = append(d.Removed, o)
+		}
+	}
+
+	sort.Slice(d.Added, func(i, j int) bool { return d.Added[i].Name < d.Added[j].Name })
+	sort.Slice(d.Removed, func(i, j int) bool { return d.Removed[i].Name < d.Removed[j].Name })
+	sort.Slice(d.Changed, func(i, j int) bool { return d.Changed[i].Name < d.Changed[j].Name })
+
+	d.Renamed, d.Added, d.Removed = detectRenames(d.Added, d.Removed)
+
+	return d
+}
+
+func writeDiffText(w io.Writer, d SettingsDiff) {
+	for _, s := range d.Added {
+		fmt.Fprintf(w, "+ %s\n", s.Name)
+	}
+	for _, s := range d.Removed {
+		fmt.Fprintf(w, "- %s\n", s.Name)
+	}
+	for _, r := range d.Renamed {
+		fmt.Fprintf(w, "> %s -> %s (probable rename)\n", r.Old.Name, r.New.Name)
+	}
+	for _, c := range d.Changed {
+		fmt.Fprintf(w, "~ %s\n", c.Name)
+		for _, field := range c.Fields {
+			switch field {
+			case "java_type":
+				fmt.Fprintf(w, "    java_type: %s -> %s\n", c.Old.JavaType, c.New.JavaType)
+			case "default_arg":
+				fmt.Fprintf(w, "    default_arg: %s -> %s\n", c.Old.DefaultArg, c.New.DefaultArg)
+			case "properties":
+				fmt.Fprintf(w, "    properties: %v -> %v\n", c.Old.Properties, c.New.Properties)
+			case "parser":
+				fmt.Fprintf(w, "    parser: %s -> %s\n", c.Old.Parser, c.New.Parser)
+			}
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"html/template"
+	"io"
+	"sort"
+	"strings"
+)
+
+type diffRow struct {
+	Kind    string
+	Setting ElasticsearchSetting
+	// RenamedFrom is the old name of a probable rename
+	RenamedFrom string
+	Old         *ElasticsearchSetting
+	Fields      []string
+}
+
+func (r diffRow) Scope() string {
+	return r.Setting.Scope()
+}
+
+func (r diffRow) PropertyList() string {
+	return strings.Join(r.Setting.Properties, " ")
+}
+
+func (r diffRow) Changed(field string) bool {
+	for _, f := range r.Fields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+var diffHTMLTemplate = template.Must(template.New("diff").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Elasticsearch settings: {{.OldName}} &rarr; {{.NewName}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; font-size: 14px; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f5f5f5; }
+code { font-size: 13px; }
+.added { background: #e6ffed; }
+.removed { background: #ffeef0; }
+.changed { background: #fffbdd; }
+.renamed { background: #f1f8ff; }
+del { color: #b31d28; }
+ins { color: #22863a; text-decoration: none; }
+#filters { margin-bottom: 1em; }
+#filters label { margin-right: 1.5em; }
+</style>
+</head>
+<body>
+<h1>Elasticsearch settings: {{.OldName}} &rarr; {{.NewName}}</h1>
+<p>{{len .Diff.Added}} added, {{len .Diff.Removed}} removed, {{len .Diff.Renamed}} probably renamed, {{len .Diff.Changed}} changed</p>
+<div id="filters">
+<label><input type="checkbox" class="kind" value="added" checked> added</label>
+<label><input type="checkbox" class="kind" value="removed" checked> removed</label>
+<label><input type="checkbox" class="kind" value="renamed" checked> renamed</label>
+<label><input type="checkbox" class="kind" value="changed" checked> changed</label>
+<label>scope
+<select id="scope">
+<option value="">any</option>
+{{range .Scopes}}<option value="{{.}}">{{.}}</option>
+{{end}}</select>
+</label>
+<label>property
+<select id="property">
+<option value="">any</option>
+{{range .Properties}}<option value="{{.}}">{{.}}</option>
+{{end}}</select>
+</label>
+<label>name <input type="search" id="name"></label>
+</div>
+<table>
+<thead>
+<tr><th></th><th>name</th><th>type</th><th>default</th><th>properties</th><th>file</th></tr>
+</thead>
+<tbody>
+{{range .Rows}}<tr class="{{.Kind}}" data-kind="{{.Kind}}" data-scope="{{.Scope}}" data-properties="{{.PropertyList}}" data-name="{{.Setting.Name}}">
+<td>{{.Kind}}</td>
+<td>{{if .RenamedFrom}}<del><code>{{.RenamedFrom}}</code></del> <ins><code>{{.Setting.Name}}</code></ins>{{else}}<code>{{.Setting.Name}}</code>{{end}}</td>
+<td>{{if .Changed "java_type"}}<del>{{.Old.JavaType}}</del> <ins>{{.Setting.JavaType}}</ins>{{else}}{{.Setting.JavaType}}{{end}}</td>
+<td>{{if .Changed "default_arg"}}<del>{{.Old.DefaultArg}}</del> <ins>{{.Setting.DefaultArg}}</ins>{{else}}{{.Setting.DefaultArg}}{{end}}</td>
+<td>{{if .Changed "properties"}}<del>{{range .Old.Properties}}{{.}} {{end}}</del> <ins>{{range .Setting.Properties}}{{.}} {{end}}</ins>{{else}}{{range .Setting.Properties}}{{.}} {{end}}{{end}}</td>
+<td><code>{{.Setting.CodeFile}}:{{.Setting.CodeLine}}</code></td>
+</tr>
+{{end}}</tbody>
+</table>
+<script>
+(function() {
+  var rows = document.querySelectorAll("tbody tr");
+  var kinds = document.querySelectorAll("input.kind");
+  var scope = document.getElementById("scope");
+  var property = document.getElementById("property");
+  var name = document.getElementById("name");
+
+  function apply() {
+    var shown = {};
+    kinds.forEach(function(k) { shown[k.value] = k.checked; });
+    var q = name.value.toLowerCase();
+    rows.forEach(function(row) {
+      var props = row.dataset.properties.split(" ");
+      var visible = shown[row.dataset.kind] &&
+        (scope.value === "" || row.dataset.scope === scope.value) &&
+        (property.value === "" || props.indexOf(property.value) >= 0) &&
+        (q === "" || row.dataset.name.toLowerCase().indexOf(q) >= 0);
+      row.style.display = visible ? "" : "none";
+    });
+  }
+
+  kinds.forEach(function(k) { k.addEventListener("change", apply); });
+  scope.addEventListener("change", apply);
+  property.addEventListener("change", apply);
+  name.addEventListener("input", apply);
+})();
+</script>
+</body>
+</html>
+`))
+
+func writeDiffHTML(w io.Writer, d SettingsDiff, oldName, newName string) error {
+	var rows []diffRow
+	for _, s := range d.Added {
+		rows = append(rows, diffRow{Kind: "added", Setting: s})
+	}
+	for _, s := range d.Removed {
+		rows = append(rows, diffRow{Kind: "removed", Setting: s})
+	}
+	for _, r := range d.Renamed {
+		rows = append(rows, diffRow{Kind: "renamed", Setting: r.New, RenamedFrom: r.Old.Name})
+	}
+	for _, c := range d.Changed {
+		old := c.Old
+		rows = append(rows, diffRow{Kind: "changed", Setting: c.New, Old: &old, Fields: c.Fields})
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Setting.Name < rows[j].Setting.Name })
+
+	scopes := map[string]bool{}
+	properties := map[string]bool{}
+	for _, r := range rows {
+		if scope := r.Scope(); scope != "" {
+			scopes[scope] = true
+		}
+		for _, p := range r.Setting.Properties {
+			properties[p] = true
+		}
+		if r.Old != nil {
+			for _, p := range r.Old.Properties {
+				properties[p] = true
+			}
+		}
+	}
+
+	return diffHTMLTemplate.Execute(w, struct {
+		OldName    string
+		NewName    string
+		Diff       SettingsDiff
+		Rows       []diffRow
+		Scopes     []string
+		Properties []string
+	}{oldName, newName, d, rows, sortedKeys(scopes), sortedKeys(properties)})
+}
+
+func sortedKeys(set map[string]bool) []string {
+	var keys []string
+	for k := range set {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,10 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import "errors"
+
+// freeSpace stands in on systems the free space isn't looked up on.
+func freeSpace(dir string) (int64, error) {
+	return 0, errors.New("the free space can't be looked up on this system")
+}
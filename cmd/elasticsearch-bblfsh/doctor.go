@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"gopkg.in/bblfsh/client-go.v2"
+	"gopkg.in/bblfsh/sdk.v1/protocol"
+)
+
+// DoctorCheck is the outcome of one check of the doctor subcommand, with
+// what to do about it when it didn't pass.
+type DoctorCheck struct {
+	Name string `json:"name"`
+	// Status is ok, warning or failed
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+	Fix    string `json:"fix,omitempty"`
+}
+
+// DoctorReport is the output of the doctor subcommand.
+type DoctorReport struct {
+	BuildInfo
+	Checks []DoctorCheck `json:"checks"`
+}
+
+func (r *DoctorReport) add(name, status, detail, fix string) {
+	r.Checks = append(r.Checks, DoctorCheck{Name: name, Status: status, Detail: detail, Fix: fix})
+}
+
+func (r *DoctorReport) failed() bool {
+	for _, c := range r.Checks {
+		if c.Status == "failed" {
+			return true
+		}
+	}
+	return false
+}
+
+// checkBblfshd checks bblfshd answers on the endpoint, has the Java driver
+// and the driver parses a file.
+func checkBblfshd(report *DoctorReport, endpoint string) {
+	startFix := fmt.Sprintf("start it with `docker run -d --name bblfshd --privileged -p %s:9432 %s`, or run `elasticsearch-bblfsh init` to do it or give its address", portOf(endpoint), bblfshdImage)
+	if !reachable(endpoint, 2*time.Second) {
+		report.add("bblfshd", "failed", "nothing listens on "+endpoint, startFix)
+		return
+	}
+	client, err := bblfsh.NewClient(endpoint)
+	if err != nil {
+		report.add("bblfshd", "failed", err.Error(), startFix)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	version, err := client.NewVersionRequest().DoWithContext(ctx)
+	if err != nil {
+		report.add("bblfshd", "failed", fmt.Sprintf("%s doesn't answer as bblfshd: %v", endpoint, err), "check it's bblfshd listening on "+endpoint+", "+startFix)
+		return
+	}
+	report.add("bblfshd", "ok", fmt.Sprintf("%s on %s", version.Version, endpoint), "")
+
+	installFix := fmt.Sprintf("install it with `docker exec bblfshd bblfshctl driver install java %s`", javaDriverImage)
+	languages, err := client.NewSupportedLanguagesRequest().DoWithContext(ctx)
+	if err != nil {
+		report.add("java driver", "failed", "listing the drivers failed: "+err.Error(), installFix)
+		return
+	}
+	driverVersion := ""
+	for _, driver := range languages.Languages {
+		if driver.Language == "java" {
+			driverVersion = driver.Version
+		}
+	}
+	if driverVersion == "" {
+		report.add("java driver", "failed", "bblfshd has no Java driver", installFix)
+		return
+	}
+	res, err := client.NewParseRequest().Content("class Doctor { int x = 1; }").Filename("Doctor.java").DoWithContext(ctx)
+	if err == nil && res.Status != protocol.Ok {
+		err = fmt.Errorf("%s", strings.Join(res.Errors, "; "))
+	}
+	if err != nil {
+		report.add("java driver", "failed", fmt.Sprintf("%s can't parse a Java file: %v", driverVersion, err),
+			fmt.Sprintf("reinstall it with `docker exec bblfshd bblfshctl driver remove java && docker exec bblfshd bblfshctl driver install java %s`", javaDriverImage))
+		return
+	}
+	report.add("java driver", "ok", driverVersion, "")
+}
+
+func portOf(endpoint string) string {
+	if i := strings.LastIndex(endpoint, ":"); i >= 0 {
+		return endpoint[i+1:]
+	}
+	return "9432"
+}
+
+// checkCheckout checks the Elasticsearch checkout is there, and git to
+// read its history.
+func checkCheckout(report *DoctorReport, root string) {
+	info, err := os.Stat(root)
+	switch {
+	case err != nil:
+		report.add("checkout", "failed", err.Error(), fmt.Sprintf("clone it with `git clone %s %s`, or run `elasticsearch-bblfsh init` to give where it is", elasticsearchRepository, root))
+	case !info.IsDir():
+		report.add("checkout", "failed", root+" isn't a directory", "run `elasticsearch-bblfsh init` to give where the checkout is")
+	default:
+		report.add("checkout", "ok", root, "")
+	}
+
+	gitPath, lookErr := exec.LookPath("git")
+	if lookErr != nil {
+		report.add("git", "failed", "git isn't in the PATH", "install git, -history, -blame and the daemon run it")
+		return
+	}
+	if err != nil || !info.IsDir() {
+		report.add("git", "ok", gitPath, "")
+		return
+	}
+	out, err := exec.Command("git", "-C", root, "rev-parse", "--short", "HEAD").Output()
+	if err != nil {
+		report.add("git", "warning", root+" isn't a git checkout", "clone it rather than extract an archive for -history, -blame and the daemon to work")
+		return
+	}
+	report.add("git", "ok", fmt.Sprintf("%s, %s at %s", gitPath, root, strings.TrimSpace(string(out))), "")
+}
+
+// checkScratch checks a directory can be written to and has space left,
+// the -uast-cache or the temporary directory.
+func checkScratch(report *DoctorReport, dir string, minFree int64) {
+	name := "scratch dir"
+	if uastCacheDir != "" {
+		name = "uast cache"
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		report.add(name, "failed", err.Error(), "create it, or give another directory")
+		return
+	}
+	f, err := ioutil.TempFile(dir, ".doctor-")
+	if err == nil {
+		f.Close()
+		err = os.Remove(f.Name())
+	}
+	if err != nil {
+		report.add(name, "failed", dir+" isn't writable: "+err.Error(), fmt.Sprintf("`chown -R $USER %s`, or give another directory", dir))
+		return
+	}
+	report.add(name, "ok", dir+" is writable", "")
+
+	free, err := freeSpace(dir)
+	switch {
+	case err != nil:
+		report.add("disk space", "warning", err.Error(), "")
+	case free < minFree:
+		report.add("disk space", "failed", fmt.Sprintf("%s free on %s, less than %s", formatBytes(free), dir, formatBytes(minFree)),
+			"free up space, give a -cache-max-size to the runs or move the cache to a larger disk")
+	default:
+		report.add("disk space", "ok", fmt.Sprintf("%s free on %s", formatBytes(free), dir), "")
+	}
+}
+
+func runDoctor(args []string) {
+	flags := flag.NewFlagSet("doctor", flag.ExitOnError)
+	sourceRoot := flags.String("source-root", "", "checkout to check, the one of the config file otherwise")
+	endpoint := flags.String("bblfsh-endpoint", "", "bblfshd to check, the one of the config file otherwise")
+	flags.StringVar(&uastCacheDir, "uast-cache", "", "-uast-cache of the runs to check, the temporary directory otherwise")
+	minFreeFlag := flags.String("min-free-space", "2GB", "space the cache or temporary directory should have left")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh doctor [-uast-cache dir]")
+		fmt.Fprintln(os.Stderr, "Checks the configuration, the checkout, git, bblfshd and its Java driver, and the cache directory and its free space, and tells how to fix what's wrong.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+	minFree, err := parseSize(*minFreeFlag)
+	if err != nil {
+		exitWith(exitUsageError, fmt.Errorf("-min-free-space: %v", err))
+	}
+
+	report := DoctorReport{BuildInfo: buildInfo(), Checks: []DoctorCheck{}}
+	config, err := loadConfig()
+	if err != nil {
+		report.add("config", "failed", err.Error(), "fix or remove it, or run `elasticsearch-bblfsh init` to write it anew")
+	} else if _, statErr := os.Stat(configPath()); statErr == nil {
+		report.add("config", "ok", configPath(), "")
+	} else {
+		report.add("config", "warning", "no config file, the defaults are used", "run `elasticsearch-bblfsh init` to give where the checkout and bblfshd are")
+	}
+	if *sourceRoot != "" {
+		config.SourceRoot = *sourceRoot
+	}
+	if *endpoint != "" {
+		config.BblfshEndpoint = *endpoint
+	}
+	checkCheckout(&report, config.SourceRoot)
+	checkBblfshd(&report, config.BblfshEndpoint)
+	scratch := uastCacheDir
+	if scratch == "" {
+		scratch = os.TempDir()
+	}
+	checkScratch(&report, scratch, minFree)
+
+	if *asJSON {
+		if err := writeJSON("-", report); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	} else {
+		for _, c := range report.Checks {
+			status := c.Status
+			switch c.Status {
+			case "failed":
+				status = colorize(ansiRed, "FAILED")
+			case "warning":
+				status = colorize(ansiYellow, "warning")
+			}
+			fmt.Printf("%-12s %s: %s\n", c.Name, status, c.Detail)
+			if c.Fix != "" {
+				fmt.Printf("%-12s fix: %s\n", "", c.Fix)
+			}
+		}
+	}
+
+	if report.failed() {
+		exitWith(exitRuntimeError, nil)
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schemaVersion is the version of the output document format. Bump it
+// whenever a change could break consumers of the document.
+const schemaVersion = 1
+
+// SettingsDocument is the output of an extraction: the settings plus enough
+// metadata for consumers to know where they came from.
+type SettingsDocument struct {
+	BuildInfo
+	SchemaVersion int       `json:"schema_version"`
+	ExtractedAt   time.Time `json:"extracted_at"`
+	SourceRoot    string    `json:"source_root"`
+	SourceCommit  string    `json:"source_commit,omitempty"`
+	// Partial is set when the run was interrupted, or sampled with -sample
+	// or -limit, and only has the settings of the files it processed
+	Partial bool `json:"partial,omitempty"`
+
+	Settings []ElasticsearchSetting `json:"settings"`
+}
+
+func newSettingsDocument(root string, settings []ElasticsearchSetting) SettingsDocument {
+	return SettingsDocument{
+		BuildInfo:     buildInfo(),
+		SchemaVersion: schemaVersion,
+		ExtractedAt:   extractionTime(),
+		SourceRoot:    root,
+		SourceCommit:  sourceCommit(root),
+		Settings:      settings,
+	}
+}
+
+// extractionTime is now, unless SOURCE_DATE_EPOCH is set. Like for
+// reproducible builds it pins the timestamp so two runs over the same tree
+// produce byte-identical output.
+func extractionTime() time.Time {
+	if epoch := os.Getenv("SOURCE_DATE_EPOCH"); epoch != "" {
+		if seconds, err := strconv.ParseInt(epoch, 10, 64); err == nil {
+			return time.Unix(seconds, 0).UTC()
+		}
+	}
+	return time.Now().UTC()
+}
+
+// sortSettings orders settings by name, then file and line, so the output
+// doesn't depend on the order files were processed in.
+func sortSettings(settings []ElasticsearchSetting) {
+	sort.SliceStable(settings, func(i, j int) bool {
+		a, b := settings[i], settings[j]
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		if a.CodeFile != b.CodeFile {
+			return a.CodeFile < b.CodeFile
+		}
+		return a.CodeLine < b.CodeLine
+	})
+}
+
+// sourceCommit returns the commit checked out at root, or an empty string if
+// root isn't a git checkout.
+func sourceCommit(root string) string {
+	out, err := exec.Command("git", "-C", root, "rev-parse", "HEAD").Output()
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// readSettingsDocument reads an extraction. Files written before the
+// document format existed are a bare array of settings, they are read as a
+// document with a zero SchemaVersion.
+func readSettingsDocument(fileName string) (SettingsDocument, error) {
+	var doc SettingsDocument
+
+	b, err := readFile(fileName)
+	if err != nil {
+		return doc, err
+	}
+
+	if bytes.HasPrefix(bytes.TrimSpace(b), []byte("[")) {
+		err = json.Unmarshal(b, &doc.Settings)
+	} else {
+		err = json.Unmarshal(b, &doc)
+	}
+	if err != nil {
+		return doc, fmt.Errorf("%s: %v", fileName, err)
+	}
+
+	// Extractions from before defaults were normalized
+	for i, s := range doc.Settings {
+		if s.NormalizedDefault == nil {
+			doc.Settings[i].NormalizedDefault = normalizeDefault(s)
+		}
+		if s.NormalizedMin == nil {
+			doc.Settings[i].NormalizedMin = normalizeValue(s.JavaType, s.MinArg)
+		}
+		if s.NormalizedMax == nil {
+			doc.Settings[i].NormalizedMax = normalizeValue(s.JavaType, s.MaxArg)
+		}
+	}
+
+	return doc, nil
+}
+
+func readSettings(fileName string) ([]ElasticsearchSetting, error) {
+	doc, err := readSettingsDocument(fileName)
+	return doc.Settings, err
+}
+
+// prettyJSON makes writeJSON indent its output.
+var prettyJSON bool
+
+func marshalJSON(v interface{}) ([]byte, error) {
+	if prettyJSON {
+		return json.MarshalIndent(v, "", "  ")
+	}
+	return json.Marshal(v)
+}
+
+// writeJSON writes v to fileName, or stdout if fileName is "-", formatted
+// according to -pretty.
+func writeJSON(fileName string, v interface{}) error {
+	b, err := marshalJSON(v)
+	if err != nil {
+		return err
+	}
+	if fileName == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(fileName, b, 0644)
+}
+
+// atomicFile is a file written under a temporary name and renamed to its
+// own once complete.
+type atomicFile struct {
+	*os.File
+	name string
+}
+
+func createAtomic(name string) (*atomicFile, error) {
+	f, err := os.Create(name + ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	return &atomicFile{File: f, name: name}, nil
+}
+
+// commit closes the file and renames it over the previous one.
+func (f *atomicFile) commit() error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.File.Name(), f.name)
+}
+
+func writeSettingsDocument(fileName string, doc SettingsDocument) error {
+	sortSettings(doc.Settings)
+	return writeJSON(fileName, doc)
+}
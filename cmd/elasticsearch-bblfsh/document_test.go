@@ -0,0 +1,61 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAtomicFile(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "settings.ndjson")
+	if err := ioutil.WriteFile(fileName, []byte("previous\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := createAtomic(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString("new\n")
+	// Until committed, the previous file is left alone
+	if b, _ := ioutil.ReadFile(fileName); string(b) != "previous\n" {
+		t.Fatalf("the file was changed before the commit: %q", b)
+	}
+	if err := f.commit(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(fileName); string(b) != "new\n" {
+		t.Errorf("got %q after the commit", b)
+	}
+	if _, err := os.Stat(fileName + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("the temporary file is left: %v", err)
+	}
+}
+
+func TestReadSettingsDocument(t *testing.T) {
+	dir := t.TempDir()
+	doc := SettingsDocument{SchemaVersion: 3, SourceCommit: "abc", Settings: []ElasticsearchSetting{{Name: "b"}, {Name: "a"}}}
+	fileName := filepath.Join(dir, "settings.json")
+	if err := writeSettingsDocument(fileName, doc); err != nil {
+		t.Fatal(err)
+	}
+	read, err := readSettingsDocument(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.SourceCommit != "abc" || len(read.Settings) != 2 || read.Settings[0].Name != "a" {
+		t.Errorf("got %+v", read)
+	}
+
+	// Files written before the document format are a bare array
+	bare := filepath.Join(dir, "bare.json")
+	ioutil.WriteFile(bare, []byte(`[{"name":"x.y"}]`), 0644)
+	read, err = readSettingsDocument(bare)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.SchemaVersion != 0 || len(read.Settings) != 1 || read.Settings[0].Name != "x.y" {
+		t.Errorf("got %+v for a bare array", read)
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"sort"
+
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// DSLComponent is a query, aggregation or other search DSL element
+// registered with SearchModule or by a search plugin.
+type DSLComponent struct {
+	Kind string `json:"kind"`
+	Name string `json:"name"`
+	// Resolved is false when the name is a constant that couldn't be found
+	// in the scanned files, Name is then the expression as written.
+	Resolved bool `json:"resolved"`
+
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// DSLDocument is the output of the search DSL extraction.
+type DSLDocument struct {
+	BuildInfo
+	Components []DSLComponent `json:"components"`
+}
+
+// dslSpecs maps the spec classes search components are registered with to
+// the kind of component, i.e.
+// registerQuery(new QuerySpec<>(MatchQueryBuilder.NAME, MatchQueryBuilder::new, MatchQueryBuilder::fromXContent));
+var dslSpecs = map[string]string{
+	"QuerySpec":                 "query",
+	"AggregationSpec":           "aggregation",
+	"PipelineAggregationSpec":   "pipeline_aggregation",
+	"SuggesterSpec":             "suggester",
+	"ScoreFunctionSpec":         "score_function",
+	"SignificanceHeuristicSpec": "significance_heuristic",
+}
+
+// dslRegistration is a spec found in a file, its name can only be resolved
+// once every file has been scanned for constants.
+type dslRegistration struct {
+	component DSLComponent
+	nameNode  *uast.Node
+	className string
+}
+
+var dslRegistrations []dslRegistration
+
+func getDSLRegistrations(rootNode *uast.Node, fileName string) []dslRegistration {
+	var registrations []dslRegistration
+
+	classes, _ := tools.Filter(rootNode, "//TypeDeclaration")
+	var className string
+	if len(classes) > 0 {
+		className = nameOf(classes[0])
+	}
+
+	for spec, kind := range dslSpecs {
+		query := "//ClassInstanceCreation/*[@internalRole='type']//SimpleName[@token='" + spec + "']/ancestor::ClassInstanceCreation[1]"
+		nodes, _ := tools.Filter(rootNode, query)
+
+		for _, n := range nodes {
+			arguments := argumentsOf(n)
+			if len(arguments) == 0 {
+				continue
+			}
+			registrations = append(registrations, dslRegistration{
+				component: DSLComponent{
+					Kind:     kind,
+					CodeLine: n.StartPosition.Line,
+					CodeFile: relativePath(fileName),
+				},
+				nameNode:  arguments[0],
+				className: className,
+			})
+		}
+	}
+
+	return registrations
+}
+
+func resolveDSLComponents(registrations []dslRegistration) []DSLComponent {
+	var components []DSLComponent
+	for _, r := range registrations {
+		c := r.component
+		c.Name, c.Resolved = resolveString(r.nameNode, r.className)
+		if !c.Resolved {
+			c.Name = expressionString(r.nameNode)
+		}
+		components = append(components, c)
+	}
+
+	sort.Slice(components, func(i, j int) bool {
+		if components[i].Kind != components[j].Kind {
+			return components[i].Kind < components[j].Kind
+		}
+		return components[i].Name < components[j].Name
+	})
+
+	return components
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"plugin"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// Encoder writes the settings document in an output format.
+type Encoder interface {
+	// Extension is the extension of the default output file, i.e. ".json"
+	Extension() string
+	// Encode writes the document to fileName, or stdout if fileName is "-"
+	Encode(fileName string, doc SettingsDocument) error
+}
+
+// encoders are the output formats -format accepts, by name.
+var encoders = map[string]Encoder{}
+
+func registerEncoder(format string, e Encoder) {
+	encoders[format] = e
+}
+
+func encoderFormats() []string {
+	var formats []string
+	for format := range encoders {
+		formats = append(formats, format)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// fileEncoder is an Encoder for formats written through a file name,
+// databases and the like that can't be written to stdout.
+type fileEncoder struct {
+	extension string
+	encode    func(fileName string, doc SettingsDocument) error
+}
+
+func (e fileEncoder) Extension() string { return e.extension }
+
+func (e fileEncoder) Encode(fileName string, doc SettingsDocument) error {
+	if fileName == "-" {
+		return fmt.Errorf("%s files can't be written to stdout", e.extension)
+	}
+	return e.encode(fileName, doc)
+}
+
+// streamEncoder is an Encoder for formats written to an io.Writer.
+type streamEncoder struct {
+	extension string
+	encode    func(w io.Writer, doc SettingsDocument) error
+}
+
+func (e streamEncoder) Extension() string { return e.extension }
+
+func (e streamEncoder) Encode(fileName string, doc SettingsDocument) error {
+	if fileName == "-" {
+		return e.encode(os.Stdout, doc)
+	}
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := e.encode(f, doc); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+func init() {
+	registerEncoder("json", streamEncoder{".json", func(w io.Writer, doc SettingsDocument) error {
+		b, err := marshalJSON(doc)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}})
+	registerEncoder("csv", streamEncoder{".csv", func(w io.Writer, doc SettingsDocument) error {
+		return writeSettingsCSV(w, doc.Settings)
+	}})
+	registerEncoder("yaml", streamEncoder{".yaml", func(w io.Writer, doc SettingsDocument) error {
+		b, err := marshalYAML(doc)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(b)
+		return err
+	}})
+	registerEncoder("protobuf", streamEncoder{".protobuf", writeSettingsProto})
+	registerEncoder("avro", streamEncoder{".avro", writeSettingsAvro})
+	registerEncoder("parquet", fileEncoder{".parquet", writeSettingsParquet})
+	registerEncoder("sqlite", fileEncoder{".sqlite", writeSettingsSQLite})
+}
+
+// templateEncoder renders the document through an -output-template.
+func templateEncoder(fileName string, t *template.Template) Encoder {
+	return streamEncoder{outputTemplateExtension(fileName), func(w io.Writer, doc SettingsDocument) error {
+		return writeSettingsTemplate(w, t, doc)
+	}}
+}
+
+// loadEncoderPlugin registers the format of a Go plugin built with
+// go build -buildmode=plugin. As plugins can't import this package, they
+// get the document as JSON, the plugin has to export
+//
+//	var Format = "toml"
+//	func Encode(w io.Writer, document []byte) error
+//
+// and may export an Extension for the default output file, ".toml".
+func loadEncoderPlugin(fileName string) error {
+	p, err := plugin.Open(fileName)
+	if err != nil {
+		return err
+	}
+
+	symbol, err := p.Lookup("Format")
+	if err != nil {
+		return err
+	}
+	format, ok := symbol.(*string)
+	if !ok || *format == "" {
+		return fmt.Errorf("%s: Format must be a non-empty string", fileName)
+	}
+
+	symbol, err = p.Lookup("Encode")
+	if err != nil {
+		return err
+	}
+	encode, ok := symbol.(func(io.Writer, []byte) error)
+	if !ok {
+		return fmt.Errorf("%s: Encode must be a func(io.Writer, []byte) error", fileName)
+	}
+
+	extension := "." + *format
+	if symbol, err := p.Lookup("Extension"); err == nil {
+		if e, ok := symbol.(*string); ok && *e != "" {
+			extension = *e
+		}
+	}
+
+	if _, ok := encoders[*format]; ok {
+		return fmt.Errorf("%s: format %q is already registered", fileName, *format)
+	}
+	registerEncoder(*format, streamEncoder{extension, func(w io.Writer, doc SettingsDocument) error {
+		b, err := json.Marshal(doc)
+		if err != nil {
+			return err
+		}
+		return encode(w, b)
+	}})
+	return nil
+}
+
+// parseFormats splits a comma separated -format.
+func parseFormats(value string) ([]string, error) {
+	var formats []string
+	seen := map[string]bool{}
+	for _, format := range strings.Split(value, ",") {
+		format = strings.TrimSpace(format)
+		if format == "ndjson" {
+			if len(strings.Split(value, ",")) > 1 {
+				return nil, fmt.Errorf("ndjson can't be combined with other formats, streamed settings aren't kept")
+			}
+		} else if _, ok := encoders[format]; !ok {
+			return nil, fmt.Errorf("unknown format %q, expected ndjson or %s", format, strings.Join(encoderFormats(), ", "))
+		}
+		if !seen[format] {
+			seen[format] = true
+			formats = append(formats, format)
+		}
+	}
+	return formats, nil
+}
@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// esBulkBatchSize is how many settings are sent per _bulk request.
+const esBulkBatchSize = 500
+
+// esSink bulk indexes settings into an Elasticsearch or OpenSearch cluster.
+type esSink struct {
+	url    string
+	index  string
+	user   string
+	client *http.Client
+}
+
+// esIndexedSetting is the document indexed for a setting, with the
+// provenance of the extraction so several versions can share an index.
+type esIndexedSetting struct {
+	ElasticsearchSetting
+	Scope        string    `json:"scope,omitempty"`
+	SourceCommit string    `json:"source_commit,omitempty"`
+	ExtractedAt  time.Time `json:"extracted_at"`
+	ToolVersion  string    `json:"tool_version"`
+}
+
+type esBulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+func newESSink(url, index, user string) *esSink {
+	return &esSink{
+		url:    strings.TrimSuffix(url, "/"),
+		index:  index,
+		user:   user,
+		client: &http.Client{Timeout: time.Minute},
+	}
+}
+
+// esDocumentID identifies a setting within an extraction, so indexing the
+// same extraction twice overwrites rather than duplicates.
+func esDocumentID(doc SettingsDocument, s ElasticsearchSetting) string {
+	sum := sha1.Sum([]byte(strings.Join([]string{doc.SourceCommit, s.CodeFile, fmt.Sprint(s.CodeLine), s.RawName, s.Name}, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// bulkBody builds the _bulk NDJSON of a batch of settings.
+func (sink *esSink) bulkBody(doc SettingsDocument, settings []ElasticsearchSetting) ([]byte, error) {
+	var body bytes.Buffer
+	enc := json.NewEncoder(&body)
+
+	for _, s := range settings {
+		action := map[string]map[string]string{
+			"index": {"_index": sink.index, "_id": esDocumentID(doc, s)},
+		}
+		if err := enc.Encode(action); err != nil {
+			return nil, err
+		}
+		indexed := esIndexedSetting{
+			ElasticsearchSetting: s,
+			Scope:                s.Scope(),
+			SourceCommit:         doc.SourceCommit,
+			ExtractedAt:          doc.ExtractedAt,
+			ToolVersion:          doc.ToolVersion,
+		}
+		if err := enc.Encode(indexed); err != nil {
+			return nil, err
+		}
+	}
+
+	return body.Bytes(), nil
+}
+
+// authorize adds credentials to a request. Secrets are read from the
+// environment rather than flags so they don't show up in the process list.
+func (sink *esSink) authorize(req *http.Request) {
+	if apiKey := os.Getenv("ELASTICSEARCH_API_KEY"); apiKey != "" {
+		req.Header.Set("Authorization", "ApiKey "+apiKey)
+		return
+	}
+	if sink.user != "" {
+		req.SetBasicAuth(sink.user, os.Getenv("ELASTICSEARCH_PASSWORD"))
+	}
+}
+
+// request sends a request to the cluster and returns the status code and
+// body of the response, retrying with a backoff while the cluster pushes back
+// with 429s.
+func (sink *esSink) request(method, path, contentType string, body []byte) (int, []byte, error) {
+	backoff := time.Second
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, sink.url+path, bytes.NewReader(body))
+		if err != nil {
+			return 0, nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		sink.authorize(req)
+
+		res, err := sink.client.Do(req)
+		if err != nil {
+			return 0, nil, err
+		}
+		b, err := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+		if err != nil {
+			return 0, nil, err
+		}
+
+		if res.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+		return res.StatusCode, b, nil
+	}
+}
+
+// esIndexTemplate is the index template for the indices settings are
+// indexed into, so dynamic mapping doesn't map i.e. defaults like "true" as
+// booleans or the first version seen as a date.
+func esIndexTemplate(pattern string) map[string]interface{} {
+	keyword := map[string]interface{}{"type": "keyword"}
+	date := map[string]interface{}{"type": "date"}
+
+	return map[string]interface{}{
+		"index_patterns": []string{pattern},
+		"template": map[string]interface{}{
+			"mappings": map[string]interface{}{
+				// New fields are kept in _source without being mapped until
+				// the template catches up
+				"dynamic": false,
+				"properties": map[string]interface{}{
+					"name": map[string]interface{}{
+						"type":   "keyword",
+						"fields": map[string]interface{}{"text": map[string]interface{}{"type": "text"}},
+					},
+					"raw_name":   keyword,
+					"java_type":  keyword,
+					"properties": keyword,
+					"default_arg": map[string]interface{}{
+						"type":   "text",
+						"fields": map[string]interface{}{"keyword": map[string]interface{}{"type": "keyword", "ignore_above": 256}},
+					},
+					"scope":                     keyword,
+					"code_line":                 map[string]interface{}{"type": "long"},
+					"code_file":                 keyword,
+					"first_seen_version":        keyword,
+					"removed_in_version":        keyword,
+					"min_index_created_version": keyword,
+					"blame": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"commit": keyword,
+							"author": keyword,
+							"date":   date,
+						},
+					},
+					"owners":  keyword,
+					"metrics": keyword,
+					"normalized_default": map[string]interface{}{
+						"properties": map[string]interface{}{
+							"value":   map[string]interface{}{"type": "double"},
+							"unit":    keyword,
+							"display": keyword,
+						},
+					},
+					"tags":          keyword,
+					"parser":        keyword,
+					"example_keys":  keyword,
+					"source_commit": keyword,
+					"extracted_at":  date,
+					"tool_version":  keyword,
+				},
+			},
+		},
+	}
+}
+
+// putIndexTemplate creates or updates the index template of the index.
+// Clusters without composable templates get a legacy one.
+func (sink *esSink) putIndexTemplate() error {
+	template := esIndexTemplate(sink.index)
+	b, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+
+	status, body, err := sink.request("PUT", "/_index_template/"+sink.index, "application/json", b)
+	if err != nil {
+		return err
+	}
+	if status == http.StatusNotFound || status == http.StatusMethodNotAllowed || (status == http.StatusBadRequest && strings.Contains(string(body), "no handler found")) {
+		legacy := template["template"].(map[string]interface{})
+		legacy["index_patterns"] = template["index_patterns"]
+		if b, err = json.Marshal(legacy); err != nil {
+			return err
+		}
+		status, body, err = sink.request("PUT", "/_template/"+sink.index, "application/json", b)
+		if err != nil {
+			return err
+		}
+	}
+	if status != http.StatusOK {
+		return fmt.Errorf("creating the index template failed with %d: %s", status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// send posts a _bulk request.
+func (sink *esSink) send(body []byte) (*esBulkResponse, error) {
+	status, b, err := sink.request("POST", "/_bulk", "application/x-ndjson", body)
+	if err != nil {
+		return nil, err
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("_bulk request failed with %d: %s", status, strings.TrimSpace(string(b)))
+	}
+
+	var bulk esBulkResponse
+	if err := json.Unmarshal(b, &bulk); err != nil {
+		return nil, fmt.Errorf("reading _bulk response: %v", err)
+	}
+	return &bulk, nil
+}
+
+// indexDocument bulk indexes every setting of the document, after putting
+// the index template in place. Documents the cluster rejects are reported
+// and fail the whole call once every batch was sent.
+func (sink *esSink) indexDocument(doc SettingsDocument) error {
+	if err := sink.putIndexTemplate(); err != nil {
+		return err
+	}
+
+	var failures []string
+	failed := 0
+
+	for start := 0; start < len(doc.Settings); start += esBulkBatchSize {
+		end := start + esBulkBatchSize
+		if end > len(doc.Settings) {
+			end = len(doc.Settings)
+		}
+
+		body, err := sink.bulkBody(doc, doc.Settings[start:end])
+		if err != nil {
+			return err
+		}
+		bulk, err := sink.send(body)
+		if err != nil {
+			return err
+		}
+		if !bulk.Errors {
+			continue
+		}
+
+		for i, item := range bulk.Items {
+			for _, result := range item {
+				if result.Error == nil {
+					continue
+				}
+				failed++
+				// The first few are enough to tell a mapping conflict from
+				// a permission problem
+				if len(failures) < 5 {
+					failures = append(failures, fmt.Sprintf("%s: %s: %s", doc.Settings[start+i].Name, result.Error.Type, result.Error.Reason))
+				}
+			}
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d settings failed to index into %s, i.e.\n  %s", failed, len(doc.Settings), sink.index, strings.Join(failures, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// Exit codes are part of the command line contract so wrapping scripts and
+// CI jobs can branch on the outcome without parsing output.
+const (
+	exitOK = 0
+	// exitRuntimeError is used when the run couldn't complete, e.g. bblfshd
+	// is unreachable or an output file can't be written.
+	exitRuntimeError = 1
+	// exitUsageError is used for unknown subcommands, bad flags or missing
+	// arguments. The flag package already exits with 2 on parse errors.
+	exitUsageError = 2
+	// exitLintFindings is used when a check completed and found problems
+	// with the extracted settings.
+	exitLintFindings = 3
+	// exitBreakingChanges is used by diff when the newer extraction removes
+	// settings or changes them in a way existing configuration could break.
+	exitBreakingChanges = 4
+	// exitParseFailures is used when too many files failed to parse for the
+	// extraction to be trusted.
+	exitParseFailures = 5
+	// exitInterrupted is used when the run was stopped by SIGINT or SIGTERM
+	// and wrote what it extracted until then, which is incomplete.
+	exitInterrupted = 6
+	// exitUpdateAvailable is used by self-update -check when a newer
+	// release is available.
+	exitUpdateAvailable = 7
+	// exitLogTampered is used by publications list when entries of the
+	// publication log were edited or removed.
+	exitLogTampered = 8
+)
+
+// exitWith prints err to stderr, if there is one, and exits with code.
+func exitWith(code int, err error) {
+	stopTrace()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, colorize(ansiRed, err.Error()))
+	}
+	os.Exit(code)
+}
@@ -0,0 +1,441 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// extractor is one of the passes run over the Elasticsearch checkout. What
+// it finds is collected in package variables while the files are walked and
+// written once the walk is done.
+type extractor struct {
+	name        string
+	description string
+	// requires are the extractors that have to run along with this one,
+	// i.e. the string constants registrations are resolved against
+	requires []string
+	// defaultFile is where the output goes when the extractor is enabled
+	// through -extractors rather than its own flag. Passes that only
+	// collect what others need have none
+	defaultFile string
+	// cost is a rough class of how much the extractor adds to a run, see
+	// extractorCosts
+	cost string
+	// document is the type of the output, to describe its schema
+	document interface{}
+	extract  func(rootNode *uast.Node, fileName string) error
+	write    func(fileName string) error
+	// checkpoint returns what the extractor collected so far, for
+	// -checkpoint, and restore puts it back on -resume. Runs with an
+	// extractor that has neither can't be resumed
+	checkpoint func() interface{}
+	restore    func(state json.RawMessage) error
+}
+
+// extractorCosts explains the cost classes of extractors.
+var extractorCosts = map[string]string{
+	"cheap":     "a query or two per file",
+	"moderate":  "several queries per file, or reads files besides the Java sources",
+	"expensive": "walks the body of every matching method",
+}
+
+// settingsExtracted counts the settings found so far, for the manifest.
+var settingsExtracted int
+
+var extractors = []*extractor{
+	{
+		// Runs first so the settings of a file resolve the constants it
+		// declares
+		name:        "constants",
+		description: "String and number constants other extractors resolve names and values with",
+		cost:        "cheap",
+		extract: func(rootNode *uast.Node, fileName string) error {
+			// Once, a file changed since is indexed when -watch walks it
+			// again
+			if file := relativePath(fileName); freshConstants[file] {
+				delete(freshConstants, file)
+				return nil
+			}
+			indexConstants(rootNode, fileName)
+			return nil
+		},
+		checkpoint: func() interface{} { return indexedFiles },
+		restore: func(state json.RawMessage) error {
+			var files map[string]*fileConstants
+			if err := json.Unmarshal(state, &files); err != nil {
+				return err
+			}
+			for file, entry := range files {
+				setFileConstants(file, entry)
+			}
+			return nil
+		},
+	},
+	{
+		name:        "settings",
+		description: "Setting declarations, their type, default and properties",
+		requires:    []string{"constants"},
+		defaultFile: "elasticsearchSettings.json",
+		cost:        "cheap",
+		extract: func(rootNode *uast.Node, fileName string) error {
+			skipped := settingsSkipped
+			settings := getSettings(rootNode, fileName)
+			versions := minIndexCreatedVersions(rootNode, settings)
+			for i := range settings {
+				settings[i].MinIndexCreatedVersion = versions[settings[i].RawName]
+			}
+			if settingsCacheUsable() && !parsedPartially {
+				writeCachedSettings(fileName, settings, settingsSkipped-skipped)
+			}
+			settingsExtracted += len(settings)
+			return emitSettings(settings)
+		},
+		// Settings are kept before their constants are resolved, against
+		// the whole index once the resumed run is done
+		checkpoint: func() interface{} {
+			cached := make([]cachedSetting, len(elasticsearchSettings))
+			for i, s := range elasticsearchSettings {
+				cached[i] = newCachedSetting(s)
+			}
+			return cached
+		},
+		restore: func(state json.RawMessage) error {
+			var cached []cachedSetting
+			if err := json.Unmarshal(state, &cached); err != nil {
+				return err
+			}
+			for _, c := range cached {
+				elasticsearchSettings = append(elasticsearchSettings, c.setting())
+			}
+			return nil
+		},
+	},
+	{
+		name:        "build-settings",
+		description: "Settings and system properties set in *.gradle files",
+		defaultFile: "build-settings.json",
+		cost:        "cheap",
+		document:    BuildSettingsDocument{},
+		write: func(fileName string) error {
+			buildSettings, err := getBuildSettings(rootDir)
+			if err != nil {
+				return err
+			}
+			return writeJSON(fileName, BuildSettingsDocument{BuildInfo: buildInfo(), BuildSettings: buildSettings})
+		},
+	},
+	{
+		name:        "painless",
+		description: "Painless script contexts and whitelisted classes",
+		defaultFile: "painless.json",
+		cost:        "moderate",
+		document:    PainlessCatalog{},
+		extract: func(rootNode *uast.Node, fileName string) error {
+			painlessCatalog.Contexts = append(painlessCatalog.Contexts, getPainlessContexts(rootNode, fileName)...)
+			return nil
+		},
+		write: func(fileName string) error {
+			var err error
+			painlessCatalog.BuildInfo = buildInfo()
+			sort.SliceStable(painlessCatalog.Contexts, func(i, j int) bool { return painlessCatalog.Contexts[i].Name < painlessCatalog.Contexts[j].Name })
+			painlessCatalog.Classes, painlessCatalog.StaticImports, err = getPainlessWhitelists(rootDir)
+			if err != nil {
+				return err
+			}
+			return writeJSON(fileName, painlessCatalog)
+		},
+	},
+	{
+		name:        "analysis",
+		description: "Analyzers, tokenizers, token and char filters and their parameters",
+		defaultFile: "analysis.json",
+		cost:        "moderate",
+		document:    AnalysisDocument{},
+		extract: func(rootNode *uast.Node, fileName string) error {
+			analysisComponents = append(analysisComponents, getAnalysisComponents(rootNode, fileName)...)
+			getAnalysisParameters(rootNode)
+			return nil
+		},
+		write: func(fileName string) error {
+			resolveAnalysisParameters(analysisComponents)
+			return writeJSON(fileName, AnalysisDocument{BuildInfo: buildInfo(), Components: analysisComponents})
+		},
+	},
+	{
+		name:        "dsl",
+		description: "Query, aggregation and other search DSL names",
+		requires:    []string{"constants"},
+		defaultFile: "dsl.json",
+		cost:        "cheap",
+		document:    DSLDocument{},
+		extract: func(rootNode *uast.Node, fileName string) error {
+			dslRegistrations = append(dslRegistrations, getDSLRegistrations(rootNode, fileName)...)
+			return nil
+		},
+		write: func(fileName string) error {
+			return writeJSON(fileName, DSLDocument{BuildInfo: buildInfo(), Components: resolveDSLComponents(dslRegistrations)})
+		},
+	},
+	{
+		name:        "system-indices",
+		description: "System index descriptors",
+		requires:    []string{"constants"},
+		defaultFile: "system-indices.json",
+		cost:        "cheap",
+		document:    SystemIndicesDocument{},
+		extract: func(rootNode *uast.Node, fileName string) error {
+			systemIndexRegistrations = append(systemIndexRegistrations, getSystemIndexRegistrations(rootNode, fileName)...)
+			return nil
+		},
+		write: func(fileName string) error {
+			return writeJSON(fileName, SystemIndicesDocument{BuildInfo: buildInfo(), SystemIndices: resolveSystemIndices(systemIndexRegistrations)})
+		},
+	},
+	{
+		name:        "transport-actions",
+		description: "Transport action names and their request classes",
+		requires:    []string{"constants"},
+		defaultFile: "transport-actions.json",
+		cost:        "moderate",
+		document:    TransportActionsDocument{},
+		extract: func(rootNode *uast.Node, fileName string) error {
+			getTransportActions(rootNode, fileName)
+			return nil
+		},
+		write: func(fileName string) error {
+			return writeJSON(fileName, TransportActionsDocument{BuildInfo: buildInfo(), Actions: resolveTransportActions(actionDeclarations)})
+		},
+	},
+	{
+		name:        "stats-fields",
+		description: "Fields emitted by the toXContent method of stats classes",
+		requires:    []string{"constants"},
+		defaultFile: "stats-fields.json",
+		cost:        "expensive",
+		document:    StatsFieldsDocument{},
+		extract: func(rootNode *uast.Node, fileName string) error {
+			statsFields = append(statsFields, getStatsFields(rootNode, fileName)...)
+			return nil
+		},
+		write: func(fileName string) error {
+			return writeJSON(fileName, StatsFieldsDocument{BuildInfo: buildInfo(), Fields: sortStatsFields(statsFields)})
+		},
+	},
+	{
+		name:        "cat-columns",
+		description: "Columns of every _cat API table",
+		defaultFile: "cat-columns.json",
+		cost:        "moderate",
+		document:    CatActionsDocument{},
+		extract: func(rootNode *uast.Node, fileName string) error {
+			catActions = append(catActions, getCatActions(rootNode, fileName)...)
+			return nil
+		},
+		write: func(fileName string) error {
+			return writeJSON(fileName, CatActionsDocument{BuildInfo: buildInfo(), CatActions: sortCatActions(catActions)})
+		},
+	},
+	{
+		name:        "rest",
+		description: "REST routes and the request parameters their handlers read",
+		requires:    []string{"constants"},
+		defaultFile: "rest.json",
+		cost:        "expensive",
+		document:    RestEndpointsDocument{},
+		extract: func(rootNode *uast.Node, fileName string) error {
+			restEndpointRegistrations = append(restEndpointRegistrations, getRestEndpoints(rootNode, fileName)...)
+			return nil
+		},
+		write: func(fileName string) error {
+			return writeJSON(fileName, RestEndpointsDocument{BuildInfo: buildInfo(), Endpoints: resolveRestEndpoints(restEndpointRegistrations)})
+		},
+	},
+	{
+		name:        "factories",
+		description: "How many settings each Setting factory method and constructor declares",
+		requires:    []string{"settings"},
+		defaultFile: "factories.json",
+		cost:        "cheap",
+		document:    FactoriesDocument{},
+		write: func(fileName string) error {
+			return writeJSON(fileName, FactoriesDocument{BuildInfo: buildInfo(), Factories: sortedFactoryUses()})
+		},
+		checkpoint: func() interface{} { return sortedFactoryUses() },
+		restore: func(state json.RawMessage) error {
+			var uses []FactoryUse
+			if err := json.Unmarshal(state, &uses); err != nil {
+				return err
+			}
+			for i := range uses {
+				factoryUses[factoryShape{uses[i].Factory, uses[i].Arguments}] = &uses[i]
+			}
+			return nil
+		},
+	},
+	{
+		name:        "wrappers",
+		description: "Helper methods settings are declared through instead of a Setting factory",
+		requires:    []string{"settings"},
+		defaultFile: "wrappers.json",
+		cost:        "cheap",
+		document:    WrappersDocument{},
+		write: func(fileName string) error {
+			return writeJSON(fileName, WrappersDocument{BuildInfo: buildInfo(), Helpers: sortedWrapperHelpers()})
+		},
+		checkpoint: func() interface{} { return sortedWrapperHelpers() },
+		restore: func(state json.RawMessage) error {
+			var helpers []WrapperHelper
+			if err := json.Unmarshal(state, &helpers); err != nil {
+				return err
+			}
+			for i := range helpers {
+				wrapperHelpers[helpers[i].Helper] = &helpers[i]
+			}
+			return nil
+		},
+	},
+}
+
+// enabledExtractors are the extractors processFile runs, in the order of
+// extractors.
+var enabledExtractors []*extractor
+
+func extractorNamed(name string) *extractor {
+	for _, e := range extractors {
+		if e.name == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// resolveExtractors returns the named extractors along with everything they
+// require, in the order of extractors.
+func resolveExtractors(names []string) ([]*extractor, error) {
+	enabled := map[string]bool{}
+
+	var enable func(name string) error
+	enable = func(name string) error {
+		e := extractorNamed(name)
+		if e == nil {
+			var known []string
+			for _, e := range extractors {
+				known = append(known, e.name)
+			}
+			return fmt.Errorf("unknown extractor %q, expected one of %s", name, strings.Join(known, ", "))
+		}
+		if enabled[name] {
+			return nil
+		}
+		enabled[name] = true
+		for _, r := range e.requires {
+			if err := enable(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for _, name := range names {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if err := enable(name); err != nil {
+			return nil, err
+		}
+	}
+
+	var resolved []*extractor
+	for _, e := range extractors {
+		if enabled[e.name] {
+			resolved = append(resolved, e)
+		}
+	}
+	return resolved, nil
+}
+
+func extractorEnabled(name string) bool {
+	for _, e := range enabledExtractors {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractorInfo describes an extractor for `extractors list`.
+type ExtractorInfo struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description"`
+	Cost        string          `json:"cost"`
+	Requires    []string        `json:"requires,omitempty"`
+	DefaultFile string          `json:"default_file,omitempty"`
+	Schema      json.RawMessage `json:"schema,omitempty"`
+}
+
+func extractorInfos() []ExtractorInfo {
+	var infos []ExtractorInfo
+
+	for _, e := range extractors {
+		info := ExtractorInfo{
+			Name:        e.name,
+			Description: e.description,
+			Cost:        e.cost,
+			Requires:    e.requires,
+			DefaultFile: e.defaultFile,
+		}
+		switch {
+		case e.name == "settings":
+			info.Schema = settingsSchema
+		case e.document != nil:
+			b, _ := json.Marshal(schemaOf(reflect.TypeOf(e.document)))
+			info.Schema = b
+		}
+		infos = append(infos, info)
+	}
+
+	return infos
+}
+
+func runExtractors(args []string) {
+	flags := flag.NewFlagSet("extractors list", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "write the extractors and the JSON Schema of their output as JSON")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh extractors list [-json]")
+		fmt.Fprintln(os.Stderr, "Lists the available extractors, what they depend on and how much they cost.")
+		flags.PrintDefaults()
+	}
+	if len(args) == 0 || args[0] != "list" {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+	flags.Parse(args[1:])
+
+	if *asJSON {
+		if err := writeJSON("-", extractorInfos()); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tCOST\tREQUIRES\tOUTPUT\tDESCRIPTION")
+	for _, info := range extractorInfos() {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", info.Name, info.Cost, strings.Join(info.Requires, ","), info.DefaultFile, info.Description)
+	}
+	w.Flush()
+
+	fmt.Println()
+	for _, cost := range []string{"cheap", "moderate", "expensive"} {
+		fmt.Printf("%s: %s\n", cost, extractorCosts[cost])
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+
+	javaextractor "github.com/nickcanz/elasticsearch-bblfsh/extractor"
+)
+
+// FactoryUse counts the Setting fields declared through one factory method
+// or constructor with a given number of arguments, and how many of them the
+// extraction rules could read.
+type FactoryUse struct {
+	Factory   string `json:"factory"`
+	Arguments int    `json:"arguments"`
+	Count     int    `json:"count"`
+	Extracted int    `json:"extracted"`
+	Skipped   int    `json:"skipped"`
+	// Example is the file and line of the first declaration found
+	Example string `json:"example"`
+}
+
+// FactoriesDocument is the output of the factories extractor.
+type FactoriesDocument struct {
+	BuildInfo
+	Factories []FactoryUse `json:"factories"`
+}
+
+type factoryShape struct {
+	factory   string
+	arguments int
+}
+
+// factoryUses is the inventory of factories getSettings came across.
+var factoryUses = map[factoryShape]*FactoryUse{}
+
+func recordFactoryUse(factory string, arguments int, extracted bool, fileName string, line uint32) {
+	shape := factoryShape{factory, arguments}
+	use, ok := factoryUses[shape]
+	if !ok {
+		use = &FactoryUse{Factory: factory, Arguments: arguments, Example: fmt.Sprintf("%s:%d", relativePath(fileName), line)}
+		factoryUses[shape] = use
+	}
+	use.Count++
+	if extracted {
+		use.Extracted++
+	} else {
+		use.Skipped++
+	}
+}
+
+// recordFactories adds the declarations of a file to the inventory.
+func recordFactories(fileName string, declared []javaextractor.Setting, skipped []javaextractor.Skipped) {
+	for _, s := range declared {
+		recordFactoryUse(s.Factory, s.Arguments, true, fileName, s.CodeLine)
+	}
+	for _, s := range skipped {
+		recordFactoryUse(s.Factory, s.Arguments, false, fileName, s.CodeLine)
+	}
+}
+
+// sortedFactoryUses returns the inventory, most used first.
+func sortedFactoryUses() []FactoryUse {
+	uses := make([]FactoryUse, 0, len(factoryUses))
+	for _, use := range factoryUses {
+		uses = append(uses, *use)
+	}
+	sort.Slice(uses, func(i, j int) bool {
+		if uses[i].Count != uses[j].Count {
+			return uses[i].Count > uses[j].Count
+		}
+		if uses[i].Factory != uses[j].Factory {
+			return uses[i].Factory < uses[j].Factory
+		}
+		return uses[i].Arguments < uses[j].Arguments
+	})
+	return uses
+}
+
+// FactoryDiff is the result of comparing the factories of two extractions.
+type FactoryDiff struct {
+	// Added are the factories and argument counts the newer version
+	// started using, the ones the rules may not know about
+	Added   []FactoryUse `json:"added"`
+	Removed []FactoryUse `json:"removed"`
+	// NewlySkipped are factories the newer version uses for settings the
+	// rules can't read, while the older had none of them skipped
+	NewlySkipped []FactoryUse `json:"newly_skipped"`
+}
+
+func readFactories(fileName string) ([]FactoryUse, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc FactoriesDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return doc.Factories, nil
+}
+
+func diffFactories(old, new []FactoryUse) FactoryDiff {
+	oldUses := map[factoryShape]FactoryUse{}
+	for _, use := range old {
+		oldUses[factoryShape{use.Factory, use.Arguments}] = use
+	}
+	newUses := map[factoryShape]bool{}
+
+	var d FactoryDiff
+	for _, use := range new {
+		shape := factoryShape{use.Factory, use.Arguments}
+		newUses[shape] = true
+		oldUse, ok := oldUses[shape]
+		if !ok {
+			d.Added = append(d.Added, use)
+			continue
+		}
+		if use.Skipped > 0 && oldUse.Skipped == 0 {
+			d.NewlySkipped = append(d.NewlySkipped, use)
+		}
+	}
+	for _, use := range old {
+		if !newUses[factoryShape{use.Factory, use.Arguments}] {
+			d.Removed = append(d.Removed, use)
+		}
+	}
+	return d
+}
+
+func writeFactoryDiffText(w io.Writer, d FactoryDiff) {
+	for _, use := range d.Added {
+		fmt.Fprintf(w, "+ %s with %d arguments, %d settings, %d skipped, i.e. %s\n", use.Factory, use.Arguments, use.Count, use.Skipped, use.Example)
+	}
+	for _, use := range d.Removed {
+		fmt.Fprintf(w, "- %s with %d arguments\n", use.Factory, use.Arguments)
+	}
+	for _, use := range d.NewlySkipped {
+		fmt.Fprintf(w, "! %s with %d arguments, %d of %d settings skipped, i.e. %s\n", use.Factory, use.Arguments, use.Skipped, use.Count, use.Example)
+	}
+}
+
+func runFactoryDiff(args []string) {
+	flags := flag.NewFlagSet("factory-diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh factory-diff <old-factories.json> <new-factories.json>")
+		fmt.Fprintln(os.Stderr, "Compares the Setting factory methods and constructors used by two versions, produced with -factories.")
+		fmt.Fprintln(os.Stderr, "Exits with 3 when the newer version uses ones the older didn't or has more settings the rules can't read.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	old, err := readFactories(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	new, err := readFactories(flags.Arg(1))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	d := diffFactories(old, new)
+	writeFactoryDiffText(os.Stdout, d)
+
+	if len(d.Added) > 0 || len(d.NewlySkipped) > 0 {
+		exitWith(exitLintFindings, nil)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"math/rand"
+	"regexp"
+	"sort"
+	"sync"
+)
+
+const (
+	// maxErrorCategories bounds the distinct errors kept, the rest are
+	// counted in a catch-all category
+	maxErrorCategories = 50
+	// errorSamplesPerCategory is how many files are kept as examples of
+	// each category
+	errorSamplesPerCategory = 5
+	otherErrorsCategory     = "other"
+)
+
+// ErrorCategory is a kind of error a run hit, with how many files hit it
+// and a sample of them.
+type ErrorCategory struct {
+	Category string        `json:"category"`
+	Count    int           `json:"count"`
+	Samples  []ErrorSample `json:"samples"`
+}
+
+// ErrorSample is a file that failed and the error it failed with.
+type ErrorSample struct {
+	File  string `json:"file"`
+	Error string `json:"error"`
+}
+
+var (
+	quotedPattern = regexp.MustCompile(`"[^"]*"|'[^']*'`)
+	pathPattern   = regexp.MustCompile(`(?:[\w.-]*/)+[\w.-]+`)
+	numberPattern = regexp.MustCompile(`\b(?:0x[0-9a-fA-F]+|\d+)\b`)
+)
+
+// errorCategory reduces an error message to its shape, leaving out the
+// paths, quoted values and numbers that differ between files failing for the
+// same reason.
+func errorCategory(err error) string {
+	s := quotedPattern.ReplaceAllString(err.Error(), `"*"`)
+	s = pathPattern.ReplaceAllString(s, "<path>")
+	s = numberPattern.ReplaceAllString(s, "N")
+	if len(s) > 200 {
+		s = s[:200] + "..."
+	}
+	return s
+}
+
+// errorAggregator counts errors by category and keeps a bounded, uniformly
+// sampled set of them, so a run where every file fails, i.e. with the wrong
+// driver, doesn't keep thousands of messages around. It's safe for
+// concurrent use.
+type errorAggregator struct {
+	mu         sync.Mutex
+	categories map[string]*ErrorCategory
+	random     *rand.Rand
+}
+
+func newErrorAggregator() *errorAggregator {
+	return &errorAggregator{
+		categories: map[string]*ErrorCategory{},
+		// Seeded so the same failures produce the same manifest
+		random: rand.New(rand.NewSource(1)),
+	}
+}
+
+// add records the error of a file and returns its category and how many
+// files hit it so far.
+func (a *errorAggregator) add(file string, err error) (string, int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	category := errorCategory(err)
+	c, ok := a.categories[category]
+	if !ok && len(a.categories) >= maxErrorCategories {
+		category = otherErrorsCategory
+		c, ok = a.categories[category]
+	}
+	if !ok {
+		c = &ErrorCategory{Category: category}
+		a.categories[category] = c
+	}
+	c.Count++
+
+	// Reservoir sampling, every failed file of the category has the same
+	// chance to end up in the sample
+	sample := ErrorSample{File: file, Error: err.Error()}
+	if len(c.Samples) < errorSamplesPerCategory {
+		c.Samples = append(c.Samples, sample)
+	} else if i := a.random.Intn(c.Count); i < errorSamplesPerCategory {
+		c.Samples[i] = sample
+	}
+	return category, c.Count
+}
+
+// restore puts back the categories of a summary, for a resumed run.
+func (a *errorAggregator) restore(categories []ErrorCategory) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	for i := range categories {
+		a.categories[categories[i].Category] = &categories[i]
+	}
+}
+
+// summary returns the categories, the most frequent first.
+func (a *errorAggregator) summary() []ErrorCategory {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	summary := make([]ErrorCategory, 0, len(a.categories))
+	for _, c := range a.categories {
+		summary = append(summary, *c)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Count != summary[j].Count {
+			return summary[i].Count > summary[j].Count
+		}
+		return summary[i].Category < summary[j].Category
+	})
+	return summary
+}
+
+var runErrors = newErrorAggregator()
+
+// reportFileError records the error of a file. Only the first errors of a
+// category are printed, the rest are counted in the manifest.
+func reportFileError(file string, err error) string {
+	category, count := runErrors.add(file, err)
+
+	switch {
+	case count <= errorSamplesPerCategory:
+		logger.Error("failed to parse", "file", file, "error", err)
+	case count == errorSamplesPerCategory+1:
+		logger.Error("more files failed the same way, they're only counted in the run manifest", "category", category)
+	}
+	return category
+}
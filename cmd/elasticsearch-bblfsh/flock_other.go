@@ -0,0 +1,19 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import (
+	"os"
+	"sync"
+)
+
+var warnNoLocking sync.Once
+
+// lockFile stands in on systems runs don't lock their directories on, they
+// aren't kept from running at the same time there.
+func lockFile(f *os.File, wait bool) (bool, error) {
+	warnNoLocking.Do(func() {
+		logger.Warn("runs can't lock the directories they write to on this system, don't run several over the same ones at once")
+	})
+	return true, nil
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// BuildSetting is a setting or system property set by the Gradle build,
+// e.g. for test clusters or to enable a feature flag.
+type BuildSetting struct {
+	Kind  string `json:"kind"`
+	Name  string `json:"name"`
+	Value string `json:"value"`
+
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// BuildSettingsDocument is the output of the build settings extraction.
+type BuildSettingsDocument struct {
+	BuildInfo
+	BuildSettings []BuildSetting `json:"build_settings"`
+}
+
+// bblfsh has no Groovy driver, but the build conventions are regular enough
+// to match line by line, e.g.
+//
+//	setting 'xpack.security.enabled', 'false'
+//	systemProperty 'es.index_mode_feature_flag_registered', 'true'
+//	keystore 'bootstrap.password', 'password'
+var gradleSettingPattern = regexp.MustCompile(`^\s*(setting|systemProperty|keystore|environment)\s*\(?\s*['"]([^'"]+)['"]\s*,\s*(.*?)\s*\)?\s*$`)
+
+// gradleSkipDirs are directories that never contain build files we care about
+// but can be very large.
+var gradleSkipDirs = map[string]bool{
+	".git":         true,
+	".gradle":      true,
+	"build":        true,
+	"node_modules": true,
+}
+
+func getBuildSettings(root string) ([]BuildSetting, error) {
+	var settings []BuildSetting
+
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if gradleSkipDirs[info.Name()] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path.Ext(filePath) != ".gradle" {
+			return nil
+		}
+
+		fileSettings, err := getGradleFileSettings(filePath)
+		if err != nil {
+			return err
+		}
+		settings = append(settings, fileSettings...)
+		return nil
+	})
+
+	return settings, err
+}
+
+func getGradleFileSettings(filePath string) ([]BuildSetting, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var settings []BuildSetting
+	var line uint32
+
+	scanner := bufio.NewScanner(f)
+	// Generated build files can have very long lines
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line++
+		match := gradleSettingPattern.FindStringSubmatch(scanner.Text())
+		if match == nil {
+			continue
+		}
+
+		settings = append(settings, BuildSetting{
+			Kind:     match[1],
+			Name:     match[2],
+			Value:    strings.Trim(match[3], `'"`),
+			CodeLine: line,
+			CodeFile: relativePath(filePath),
+		})
+	}
+
+	return settings, scanner.Err()
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGetGradleFileSettings(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "build.gradle")
+	build := "def data = '" + strings.Repeat("x", 200*1024) + "'\n" +
+		"testClusters.all {\n" +
+		"  setting 'xpack.security.enabled', 'false'\n" +
+		"  systemProperty \"es.feature_flag\", \"true\"\n" +
+		"}\n"
+	if err := ioutil.WriteFile(fileName, []byte(build), 0644); err != nil {
+		t.Fatal(err)
+	}
+	settings, err := getGradleFileSettings(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(settings) != 2 || settings[0].Name != "xpack.security.enabled" || settings[0].Value != "false" || settings[0].CodeLine != 3 ||
+		settings[1].Kind != "systemProperty" || settings[1].Value != "true" {
+		t.Errorf("got %+v", settings)
+	}
+}
@@ -0,0 +1,725 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// A small GraphQL executor, enough for the queries of the settings API:
+// operations with variables, aliases, arguments, fragments, inline
+// fragments and the @include and @skip directives. There are no mutations,
+// subscriptions or introspection, the schema is published as SDL instead.
+
+// gqlToken is a lexical token of a GraphQL document. Kind is 'p' for a
+// punctuator, 'n' a name, 's' a string, 'i' an int, 'f' a float and 0 the
+// end of the document.
+type gqlToken struct {
+	kind  byte
+	value string
+	pos   int
+}
+
+func gqlNameStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func gqlNameChar(c byte) bool {
+	return gqlNameStart(c) || (c >= '0' && c <= '9')
+}
+
+// lexGraphQL splits a document into tokens. Commas, like white space and
+// comments, aren't significant.
+func lexGraphQL(doc string) ([]gqlToken, error) {
+	var tokens []gqlToken
+	for i := 0; i < len(doc); {
+		c := doc[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(doc[i:], "\ufeff"):
+			i += len("\ufeff")
+		case c == '#':
+			for i < len(doc) && doc[i] != '\n' {
+				i++
+			}
+		case strings.HasPrefix(doc[i:], "..."):
+			tokens = append(tokens, gqlToken{'p', "...", i})
+			i += 3
+		case strings.IndexByte("!$()=:@[]{}|&", c) >= 0:
+			tokens = append(tokens, gqlToken{'p', string(c), i})
+			i++
+		case gqlNameStart(c):
+			start := i
+			for i < len(doc) && gqlNameChar(doc[i]) {
+				i++
+			}
+			tokens = append(tokens, gqlToken{'n', doc[start:i], start})
+		case c == '-' || (c >= '0' && c <= '9'):
+			start, kind := i, byte('i')
+			if c == '-' {
+				i++
+			}
+			digits := func() {
+				for i < len(doc) && doc[i] >= '0' && doc[i] <= '9' {
+					i++
+				}
+			}
+			digits()
+			if i < len(doc) && doc[i] == '.' {
+				kind = 'f'
+				i++
+				digits()
+			}
+			if i < len(doc) && (doc[i] == 'e' || doc[i] == 'E') {
+				kind = 'f'
+				i++
+				if i < len(doc) && (doc[i] == '+' || doc[i] == '-') {
+					i++
+				}
+				digits()
+			}
+			tokens = append(tokens, gqlToken{kind, doc[start:i], start})
+		case strings.HasPrefix(doc[i:], `"""`):
+			end := strings.Index(doc[i+3:], `"""`)
+			if end < 0 {
+				return nil, fmt.Errorf("unterminated string at %d", i)
+			}
+			tokens = append(tokens, gqlToken{'s', strings.TrimSpace(doc[i+3 : i+3+end]), i})
+			i += end + 6
+		case c == '"':
+			start := i
+			for i++; i < len(doc) && doc[i] != '"' && doc[i] != '\n'; i++ {
+				if doc[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(doc) || doc[i] != '"' {
+				return nil, fmt.Errorf("unterminated string at %d", start)
+			}
+			i++
+			var value string
+			if err := json.Unmarshal([]byte(doc[start:i]), &value); err != nil {
+				return nil, fmt.Errorf("invalid string at %d", start)
+			}
+			tokens = append(tokens, gqlToken{'s', value, start})
+		default:
+			r, _ := utf8.DecodeRuneInString(doc[i:])
+			return nil, fmt.Errorf("unexpected %q at %d", r, i)
+		}
+	}
+	return append(tokens, gqlToken{0, "", len(doc)}), nil
+}
+
+// gqlVariable is a reference to a variable in a value of a document.
+type gqlVariable string
+
+// gqlSelection is a field, a fragment spread or an inline fragment of a
+// selection set.
+type gqlSelection struct {
+	alias, name string
+	args        map[string]interface{}
+	directives  []gqlDirective
+	selections  []gqlSelection
+	// spread is the fragment spread, typeCondition the type an inline
+	// fragment applies to, empty for every type
+	spread        string
+	inline        bool
+	typeCondition string
+}
+
+type gqlDirective struct {
+	name string
+	args map[string]interface{}
+}
+
+type gqlOperation struct {
+	name       string
+	variables  map[string]interface{}
+	selections []gqlSelection
+}
+
+type gqlFragment struct {
+	typeCondition string
+	selections    []gqlSelection
+}
+
+type gqlDocument struct {
+	operations []gqlOperation
+	fragments  map[string]gqlFragment
+}
+
+type gqlParser struct {
+	tokens []gqlToken
+	i      int
+}
+
+func (p *gqlParser) peek() gqlToken {
+	return p.tokens[p.i]
+}
+
+func (p *gqlParser) next() gqlToken {
+	t := p.tokens[p.i]
+	if t.kind != 0 {
+		p.i++
+	}
+	return t
+}
+
+func (p *gqlParser) is(kind byte, value string) bool {
+	t := p.peek()
+	return t.kind == kind && t.value == value
+}
+
+func (p *gqlParser) expect(kind byte, value string) (gqlToken, error) {
+	t := p.next()
+	if t.kind != kind || (value != "" && t.value != value) {
+		expected := value
+		if expected == "" {
+			expected = map[byte]string{'n': "a name", 's': "a string"}[kind]
+		}
+		found := t.value
+		if t.kind == 0 {
+			found = "the end of the document"
+		}
+		return t, fmt.Errorf("expected %s at %d, found %s", expected, t.pos, found)
+	}
+	return t, nil
+}
+
+// parseGraphQL parses a query document.
+func parseGraphQL(doc string) (gqlDocument, error) {
+	document := gqlDocument{fragments: map[string]gqlFragment{}}
+	tokens, err := lexGraphQL(doc)
+	if err != nil {
+		return document, err
+	}
+	p := &gqlParser{tokens: tokens}
+	for p.peek().kind != 0 {
+		switch t := p.peek(); {
+		case p.is('p', "{"):
+			selections, err := p.selectionSet()
+			if err != nil {
+				return document, err
+			}
+			document.operations = append(document.operations, gqlOperation{selections: selections})
+		case p.is('n', "query"):
+			p.next()
+			op, err := p.operation()
+			if err != nil {
+				return document, err
+			}
+			document.operations = append(document.operations, op)
+		case p.is('n', "fragment"):
+			p.next()
+			name, err := p.expect('n', "")
+			if err != nil {
+				return document, err
+			}
+			if _, err := p.expect('n', "on"); err != nil {
+				return document, err
+			}
+			typeCondition, err := p.expect('n', "")
+			if err != nil {
+				return document, err
+			}
+			if _, err := p.directives(); err != nil {
+				return document, err
+			}
+			selections, err := p.selectionSet()
+			if err != nil {
+				return document, err
+			}
+			document.fragments[name.value] = gqlFragment{typeCondition: typeCondition.value, selections: selections}
+		case t.kind == 'n' && (t.value == "mutation" || t.value == "subscription"):
+			return document, fmt.Errorf("only queries are supported, the settings are read only")
+		default:
+			return document, fmt.Errorf("unexpected %s at %d", t.value, t.pos)
+		}
+	}
+	if len(document.operations) == 0 {
+		return document, fmt.Errorf("no query in the document")
+	}
+	return document, document.validate()
+}
+
+// gqlMaxDepth is how deeply the selection sets of a query can nest, for a
+// public endpoint not to walk the versions of every setting of every
+// version over and over.
+const gqlMaxDepth = 10
+
+// validate checks every fragment spread of a document is of a fragment it
+// defines, without spreading itself, and no query nests deeper than
+// gqlMaxDepth.
+func (d gqlDocument) validate() error {
+	depths := map[string]int{}
+	for name := range d.fragments {
+		if _, err := d.depth([]gqlSelection{{spread: name}}, depths); err != nil {
+			return err
+		}
+	}
+	for _, op := range d.operations {
+		depth, err := d.depth(op.selections, depths)
+		if err != nil {
+			return err
+		}
+		if depth+1 > gqlMaxDepth {
+			return fmt.Errorf("the query nests %d levels deep, more than the %d allowed", depth+1, gqlMaxDepth)
+		}
+	}
+	return nil
+}
+
+// depth returns how many selection sets nest under a selection set, the
+// ones of its fragments included. depths are the depths of the fragments,
+// -1 while a fragment is being looked into.
+func (d gqlDocument) depth(selections []gqlSelection, depths map[string]int) (int, error) {
+	deepest := 0
+	for _, s := range selections {
+		var depth int
+		var err error
+		switch {
+		case s.spread != "":
+			f, ok := d.fragments[s.spread]
+			if !ok {
+				return 0, fmt.Errorf("unknown fragment %s", s.spread)
+			}
+			if depth, ok = depths[s.spread]; !ok {
+				depths[s.spread] = -1
+				if depth, err = d.depth(f.selections, depths); err != nil {
+					return 0, err
+				}
+				depths[s.spread] = depth
+			} else if depth < 0 {
+				return 0, fmt.Errorf("fragment %s spreads itself", s.spread)
+			}
+		case s.inline:
+			depth, err = d.depth(s.selections, depths)
+		case len(s.selections) > 0:
+			depth, err = d.depth(s.selections, depths)
+			depth++
+		}
+		if err != nil {
+			return 0, err
+		}
+		if depth > deepest {
+			deepest = depth
+		}
+	}
+	return deepest, nil
+}
+
+func (p *gqlParser) operation() (gqlOperation, error) {
+	op := gqlOperation{variables: map[string]interface{}{}}
+	if p.peek().kind == 'n' {
+		op.name = p.next().value
+	}
+	if p.is('p', "(") {
+		p.next()
+		for !p.is('p', ")") {
+			if _, err := p.expect('p', "$"); err != nil {
+				return op, err
+			}
+			name, err := p.expect('n', "")
+			if err != nil {
+				return op, err
+			}
+			if _, err := p.expect('p', ":"); err != nil {
+				return op, err
+			}
+			// Types aren't checked, the resolvers check their arguments
+			for p.is('p', "[") || p.is('p', "]") || p.is('p', "!") || p.peek().kind == 'n' {
+				p.next()
+			}
+			op.variables[name.value] = nil
+			if p.is('p', "=") {
+				p.next()
+				if op.variables[name.value], err = p.value(); err != nil {
+					return op, err
+				}
+			}
+		}
+		p.next()
+	}
+	if _, err := p.directives(); err != nil {
+		return op, err
+	}
+	var err error
+	op.selections, err = p.selectionSet()
+	return op, err
+}
+
+func (p *gqlParser) selectionSet() ([]gqlSelection, error) {
+	if _, err := p.expect('p', "{"); err != nil {
+		return nil, err
+	}
+	var selections []gqlSelection
+	for !p.is('p', "}") {
+		if p.peek().kind == 0 {
+			return nil, fmt.Errorf("unterminated selection set")
+		}
+		s, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		selections = append(selections, s)
+	}
+	p.next()
+	if len(selections) == 0 {
+		return nil, fmt.Errorf("empty selection set at %d", p.peek().pos)
+	}
+	return selections, nil
+}
+
+func (p *gqlParser) selection() (gqlSelection, error) {
+	var s gqlSelection
+	var err error
+	if p.is('p', "...") {
+		p.next()
+		switch {
+		case p.is('n', "on"):
+			p.next()
+			t, err := p.expect('n', "")
+			if err != nil {
+				return s, err
+			}
+			s.inline, s.typeCondition = true, t.value
+		case p.peek().kind == 'n':
+			s.spread = p.next().value
+		default:
+			s.inline = true
+		}
+		if s.directives, err = p.directives(); err != nil {
+			return s, err
+		}
+		if s.inline {
+			s.selections, err = p.selectionSet()
+		}
+		return s, err
+	}
+
+	name, err := p.expect('n', "")
+	if err != nil {
+		return s, err
+	}
+	s.alias, s.name = name.value, name.value
+	if p.is('p', ":") {
+		p.next()
+		if name, err = p.expect('n', ""); err != nil {
+			return s, err
+		}
+		s.name = name.value
+	}
+	if s.args, err = p.arguments(); err != nil {
+		return s, err
+	}
+	if s.directives, err = p.directives(); err != nil {
+		return s, err
+	}
+	if p.is('p', "{") {
+		s.selections, err = p.selectionSet()
+	}
+	return s, err
+}
+
+func (p *gqlParser) arguments() (map[string]interface{}, error) {
+	args := map[string]interface{}{}
+	if !p.is('p', "(") {
+		return args, nil
+	}
+	p.next()
+	for !p.is('p', ")") {
+		name, err := p.expect('n', "")
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.expect('p', ":"); err != nil {
+			return nil, err
+		}
+		if args[name.value], err = p.value(); err != nil {
+			return nil, err
+		}
+	}
+	p.next()
+	return args, nil
+}
+
+func (p *gqlParser) directives() ([]gqlDirective, error) {
+	var directives []gqlDirective
+	for p.is('p', "@") {
+		p.next()
+		name, err := p.expect('n', "")
+		if err != nil {
+			return nil, err
+		}
+		args, err := p.arguments()
+		if err != nil {
+			return nil, err
+		}
+		directives = append(directives, gqlDirective{name: name.value, args: args})
+	}
+	return directives, nil
+}
+
+func (p *gqlParser) value() (interface{}, error) {
+	t := p.next()
+	switch t.kind {
+	case 's':
+		return t.value, nil
+	case 'i':
+		return strconv.Atoi(t.value)
+	case 'f':
+		return strconv.ParseFloat(t.value, 64)
+	case 'n':
+		switch t.value {
+		case "true":
+			return true, nil
+		case "false":
+			return false, nil
+		case "null":
+			return nil, nil
+		}
+		// Enum values are passed on as their name
+		return t.value, nil
+	}
+	switch t.value {
+	case "$":
+		name, err := p.expect('n', "")
+		return gqlVariable(name.value), err
+	case "[":
+		list := []interface{}{}
+		for !p.is('p', "]") {
+			if p.peek().kind == 0 {
+				return nil, fmt.Errorf("unterminated list")
+			}
+			v, err := p.value()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, v)
+		}
+		p.next()
+		return list, nil
+	case "{":
+		object := map[string]interface{}{}
+		for !p.is('p', "}") {
+			name, err := p.expect('n', "")
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect('p', ":"); err != nil {
+				return nil, err
+			}
+			if object[name.value], err = p.value(); err != nil {
+				return nil, err
+			}
+		}
+		p.next()
+		return object, nil
+	}
+	return nil, fmt.Errorf("expected a value at %d, found %s", t.pos, t.value)
+}
+
+// gqlObject is a value of an object type of the schema, which resolves its
+// fields.
+type gqlObject interface {
+	gqlType() string
+	resolve(field string, args map[string]interface{}) (interface{}, error)
+}
+
+// gqlError is an error of the response, at the path of the field it
+// happened on.
+type gqlError struct {
+	Message string        `json:"message"`
+	Path    []interface{} `json:"path,omitempty"`
+}
+
+// gqlResult is the result of a selection set, its fields in the order they
+// were asked for.
+type gqlResult struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (r *gqlResult) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(key)
+		buf.Write(k)
+		buf.WriteByte(':')
+		v, err := json.Marshal(r.values[key])
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+type gqlExecution struct {
+	fragments map[string]gqlFragment
+	variables map[string]interface{}
+	errors    []gqlError
+}
+
+// substitute replaces the variables of a value by theirs.
+func (e *gqlExecution) substitute(v interface{}) interface{} {
+	switch v := v.(type) {
+	case gqlVariable:
+		return e.variables[string(v)]
+	case []interface{}:
+		list := make([]interface{}, len(v))
+		for i := range v {
+			list[i] = e.substitute(v[i])
+		}
+		return list
+	case map[string]interface{}:
+		object := map[string]interface{}{}
+		for k := range v {
+			object[k] = e.substitute(v[k])
+		}
+		return object
+	}
+	return v
+}
+
+// included applies @include and @skip.
+func (e *gqlExecution) included(directives []gqlDirective) bool {
+	for _, d := range directives {
+		condition, _ := e.substitute(d.args["if"]).(bool)
+		if (d.name == "include" && !condition) || (d.name == "skip" && condition) {
+			return false
+		}
+	}
+	return true
+}
+
+// collect flattens the fragments of a selection set on an object of a type
+// into its fields, merging the ones with the same response key.
+func (e *gqlExecution) collect(selections []gqlSelection, typeName string, fields []gqlSelection, seen map[string]int, visited map[string]bool) []gqlSelection {
+	for _, s := range selections {
+		if !e.included(s.directives) {
+			continue
+		}
+		switch {
+		case s.spread != "":
+			// Unknown fragments were rejected by parseGraphQL
+			f := e.fragments[s.spread]
+			if visited[s.spread] || f.typeCondition != typeName {
+				continue
+			}
+			visited[s.spread] = true
+			fields = e.collect(f.selections, typeName, fields, seen, visited)
+		case s.inline:
+			if s.typeCondition == "" || s.typeCondition == typeName {
+				fields = e.collect(s.selections, typeName, fields, seen, visited)
+			}
+		default:
+			if i, ok := seen[s.alias]; ok {
+				fields[i].selections = append(append([]gqlSelection(nil), fields[i].selections...), s.selections...)
+				continue
+			}
+			seen[s.alias] = len(fields)
+			fields = append(fields, s)
+		}
+	}
+	return fields
+}
+
+// execute resolves a selection set on an object. A field failing to
+// resolve is null, with an error at its path.
+func (e *gqlExecution) execute(object gqlObject, selections []gqlSelection, path []interface{}) *gqlResult {
+	result := &gqlResult{values: map[string]interface{}{}}
+	for _, field := range e.collect(selections, object.gqlType(), nil, map[string]int{}, map[string]bool{}) {
+		fieldPath := append(append([]interface{}(nil), path...), field.alias)
+		result.keys = append(result.keys, field.alias)
+
+		if field.name == "__typename" {
+			result.values[field.alias] = object.gqlType()
+			continue
+		}
+		args := map[string]interface{}{}
+		for name, v := range field.args {
+			args[name] = e.substitute(v)
+		}
+		value, err := object.resolve(field.name, args)
+		if err == nil {
+			value, err = e.complete(value, field, fieldPath)
+		}
+		if err != nil {
+			e.errors = append(e.errors, gqlError{Message: err.Error(), Path: fieldPath})
+			value = nil
+		}
+		result.values[field.alias] = value
+	}
+	return result
+}
+
+// complete executes the selection set of a field on the objects it
+// resolved to.
+func (e *gqlExecution) complete(value interface{}, field gqlSelection, path []interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case nil:
+		// A setting or version that isn't there
+		return nil, nil
+	case gqlObject:
+		if len(field.selections) == 0 {
+			return nil, fmt.Errorf("%s is a %s, select its fields", field.name, v.gqlType())
+		}
+		return e.execute(v, field.selections, path), nil
+	case []gqlObject:
+		list := make([]interface{}, len(v))
+		for i, o := range v {
+			var err error
+			if list[i], err = e.complete(o, field, append(append([]interface{}(nil), path...), i)); err != nil {
+				return nil, err
+			}
+		}
+		return list, nil
+	}
+	if len(field.selections) > 0 {
+		return nil, fmt.Errorf("%s has no fields to select", field.name)
+	}
+	return value, nil
+}
+
+// gqlResponse is the response to a GraphQL request.
+type gqlResponse struct {
+	Data   *gqlResult `json:"data"`
+	Errors []gqlError `json:"errors,omitempty"`
+}
+
+// executeGraphQL runs an operation of a document, the one named or the only
+// one, against a root object.
+func executeGraphQL(root gqlObject, doc gqlDocument, operationName string, variables map[string]interface{}) (gqlResponse, error) {
+	var op *gqlOperation
+	for i := range doc.operations {
+		if doc.operations[i].name == operationName || (operationName == "" && len(doc.operations) == 1) {
+			op = &doc.operations[i]
+		}
+	}
+	if op == nil {
+		if operationName == "" {
+			return gqlResponse{}, fmt.Errorf("the document has several operations, give the operationName to run")
+		}
+		return gqlResponse{}, fmt.Errorf("no operation named %s", operationName)
+	}
+
+	e := &gqlExecution{fragments: doc.fragments, variables: map[string]interface{}{}}
+	for name, def := range op.variables {
+		e.variables[name] = def
+	}
+	for name, v := range variables {
+		e.variables[name] = v
+	}
+	data := e.execute(root, op.selections, nil)
+	return gqlResponse{Data: data, Errors: e.errors}, nil
+}
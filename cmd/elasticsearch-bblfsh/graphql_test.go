@@ -0,0 +1,223 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testNode is an object nesting into itself, echoing the value argument of
+// its echo field.
+type testNode struct{}
+
+func (testNode) gqlType() string {
+	return "Node"
+}
+
+func (o testNode) resolve(field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "name":
+		return "node", nil
+	case "echo":
+		return args["value"], nil
+	case "child":
+		return testNode{}, nil
+	case "children":
+		return []gqlObject{testNode{}, testNode{}}, nil
+	}
+	return nil, gqlUnknownField(o, field)
+}
+
+func TestLexGraphQL(t *testing.T) {
+	tokens, err := lexGraphQL("\ufeff{ a(b: -1.5e3, c: \"x\\\"y\", d: \"\"\" z \"\"\") # comment\n ...F }")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, tok := range tokens {
+		got = append(got, string(tok.kind)+tok.value)
+	}
+	want := []string{"p{", "na", "p(", "nb", "p:", "f-1.5e3", "nc", "p:", `sx"y`, "nd", "p:", "sz", "p)", "p...", "nF", "p}", "\x00"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+
+	for _, doc := range []string{`{ a(b: "x) }`, `{ a(b: """x) }`, `{ a(b: "\x") }`, `{ a % }`} {
+		if _, err := lexGraphQL(doc); err == nil {
+			t.Errorf("%s: no error", doc)
+		}
+	}
+}
+
+func TestParseGraphQL(t *testing.T) {
+	doc, err := parseGraphQL(`
+		query Q($a: String = "x", $b: [Int]) {
+			alias: echo(value: {list: [1, 2.5, true, null, ENUM], v: $a}) @include(if: $b)
+			...F
+			... on Node { name }
+		}
+		fragment F on Node { child { name } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	op := doc.operations[0]
+	if op.name != "Q" || !reflect.DeepEqual(op.variables, map[string]interface{}{"a": "x", "b": nil}) {
+		t.Errorf("operation %s, variables %v", op.name, op.variables)
+	}
+	if len(op.selections) != 3 {
+		t.Fatalf("%d selections", len(op.selections))
+	}
+	echo := op.selections[0]
+	wantArgs := map[string]interface{}{"value": map[string]interface{}{"list": []interface{}{1, 2.5, true, nil, "ENUM"}, "v": gqlVariable("a")}}
+	if echo.alias != "alias" || echo.name != "echo" || !reflect.DeepEqual(echo.args, wantArgs) {
+		t.Errorf("got %s: %s%v", echo.alias, echo.name, echo.args)
+	}
+	if len(echo.directives) != 1 || echo.directives[0].name != "include" || echo.directives[0].args["if"] != gqlVariable("b") {
+		t.Errorf("directives %v", echo.directives)
+	}
+	if op.selections[1].spread != "F" || !op.selections[2].inline || op.selections[2].typeCondition != "Node" {
+		t.Errorf("fragments %+v", op.selections[1:])
+	}
+	if f := doc.fragments["F"]; f.typeCondition != "Node" || len(f.selections) != 1 {
+		t.Errorf("fragment F %+v", f)
+	}
+}
+
+func TestParseGraphQLErrors(t *testing.T) {
+	// nested selects name under n child fields
+	nested := func(n int) string {
+		return strings.Repeat("child { ", n) + "name" + strings.Repeat(" }", n)
+	}
+	for _, tc := range []struct {
+		doc, want string
+	}{
+		{``, "no query in the document"},
+		{`{ name`, "unterminated selection set"},
+		{`{ }`, "empty selection set at 3"},
+		{`{ echo(value: [1 }`, "expected a value at 17, found }"},
+		{`mutation { name }`, "only queries are supported, the settings are read only"},
+		{`subscription { name }`, "only queries are supported, the settings are read only"},
+		{`{ ...F }`, "unknown fragment F"},
+		{`{ child { ...F } } fragment F on Node { ...G } fragment G on Node { name }`, ""},
+		{`{ ...F } fragment F on Node { child { ...F } }`, "fragment F spreads itself"},
+		{`{ ...F } fragment F on Node { ...G } fragment G on Node { ...F }`, "spreads itself"},
+		{`{ name } fragment F on Node { ...G }`, "unknown fragment G"},
+		{`{ name } fragment F on Node { ...F }`, "fragment F spreads itself"},
+		{`{ ` + nested(gqlMaxDepth) + ` }`, "the query nests 11 levels deep, more than the 10 allowed"},
+		{`{ ` + nested(gqlMaxDepth-1) + ` }`, ""},
+		{`{ child { ...F } } fragment F on Node { ` + nested(gqlMaxDepth) + ` }`, "the query nests 12 levels deep, more than the 10 allowed"},
+		{`{ ... on Node { ... on Node { ` + nested(gqlMaxDepth-1) + ` } } }`, ""},
+	} {
+		_, err := parseGraphQL(tc.doc)
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: %v", tc.doc, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Errorf("%s: got %v, want %s", tc.doc, err, tc.want)
+		}
+	}
+}
+
+func TestExecuteGraphQL(t *testing.T) {
+	for _, tc := range []struct {
+		doc       string
+		variables map[string]interface{}
+		want      string
+	}{
+		{
+			`{ name a: name __typename }`, nil,
+			`{"data":{"name":"node","a":"node","__typename":"Node"}}`,
+		},
+		{
+			`query($v: String = "default") { echo(value: $v) }`, nil,
+			`{"data":{"echo":"default"}}`,
+		},
+		{
+			`query($v: String = "default") { echo(value: $v) }`, map[string]interface{}{"v": "given"},
+			`{"data":{"echo":"given"}}`,
+		},
+		{
+			`query($v: Int) { echo(value: [$v, {n: $v}]) }`, map[string]interface{}{"v": 3},
+			`{"data":{"echo":[3,{"n":3}]}}`,
+		},
+		{
+			`query($yes: Boolean = true) { a: name @include(if: $yes) b: name @skip(if: $yes) c: name @include(if: false) }`, nil,
+			`{"data":{"a":"node"}}`,
+		},
+		{
+			`{ child { name } child { echo(value: 1) } }`, nil,
+			`{"data":{"child":{"name":"node","echo":1}}}`,
+		},
+		{
+			`{ ...F ... on Node { echo(value: "inline") } ... on Other { other } ...O } fragment F on Node { name } fragment O on Other { other }`, nil,
+			`{"data":{"name":"node","echo":"inline"}}`,
+		},
+		{
+			`{ ... { name } }`, nil,
+			`{"data":{"name":"node"}}`,
+		},
+		{
+			`{ children { name } }`, nil,
+			`{"data":{"children":[{"name":"node"},{"name":"node"}]}}`,
+		},
+		{
+			`{ name nope }`, nil,
+			`{"data":{"name":"node","nope":null},"errors":[{"message":"Node has no field nope","path":["nope"]}]}`,
+		},
+		{
+			`{ child { child { nope } } }`, nil,
+			`{"data":{"child":{"child":{"nope":null}}},"errors":[{"message":"Node has no field nope","path":["child","child","nope"]}]}`,
+		},
+		{
+			`{ child }`, nil,
+			`{"data":{"child":null},"errors":[{"message":"child is a Node, select its fields","path":["child"]}]}`,
+		},
+		{
+			`{ name { length } }`, nil,
+			`{"data":{"name":null},"errors":[{"message":"name has no fields to select","path":["name"]}]}`,
+		},
+		{
+			`{ echo(value: null) { name } }`, nil,
+			`{"data":{"echo":null}}`,
+		},
+	} {
+		doc, err := parseGraphQL(tc.doc)
+		if err != nil {
+			t.Errorf("%s: %v", tc.doc, err)
+			continue
+		}
+		res, err := executeGraphQL(testNode{}, doc, "", tc.variables)
+		if err != nil {
+			t.Errorf("%s: %v", tc.doc, err)
+			continue
+		}
+		b, err := json.Marshal(res)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != tc.want {
+			t.Errorf("%s\n got %s\nwant %s", tc.doc, b, tc.want)
+		}
+	}
+}
+
+func TestExecuteGraphQLOperationName(t *testing.T) {
+	doc, err := parseGraphQL(`query A { a: name } query B { b: name }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := executeGraphQL(testNode{}, doc, "", nil); err == nil || !strings.Contains(err.Error(), "give the operationName") {
+		t.Errorf("no operationName: %v", err)
+	}
+	if _, err := executeGraphQL(testNode{}, doc, "C", nil); err == nil || err.Error() != "no operation named C" {
+		t.Errorf("unknown operationName: %v", err)
+	}
+	res, err := executeGraphQL(testNode{}, doc, "B", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := json.Marshal(res); string(b) != `{"data":{"b":"node"}}` {
+		t.Errorf("B: %s", b)
+	}
+}
@@ -0,0 +1,523 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// graphQLSchema is the schema of /graphql, as SDL for clients to generate
+// their types from.
+const graphQLSchema = `"""
+The settings extracted from the Elasticsearch code base, in every version
+the API serves.
+"""
+type Query {
+  "The versions of the dataset, the oldest first"
+  versions: [Version!]!
+  "A version, the newest one when none is given"
+  version(version: String): Version
+  "The settings of a version, the newest one when none is given"
+  settings(version: String, q: String, scope: String, property: String, module: String, namespace: String, dynamic: Boolean, deprecated: Boolean, sort: String, first: Int, after: String): SettingConnection!
+  "A setting, or the affix setting a key is one of"
+  setting(name: String!, version: String): Setting
+  "What changed between two versions"
+  diff(from: String!, to: String!): Diff!
+}
+
+type Version {
+  version: String!
+  sourceCommit: String
+  extractedAt: String!
+  settingsCount: Int!
+  "q is searched for in the names and defaults, namespace covers whole segments of the names. sort is name, version or file, prefixed with - to sort descending. first and after page through the settings, after is the nextCursor of the previous page"
+  settings(q: String, scope: String, property: String, module: String, namespace: String, dynamic: Boolean, deprecated: Boolean, sort: String, first: Int, after: String): SettingConnection!
+  setting(name: String!): Setting
+}
+
+type SettingConnection {
+  version: String!
+  "How many settings match, on every page"
+  total: Int!
+  "Cursor of the next page, null on the last one"
+  nextCursor: String
+  nodes: [Setting!]!
+}
+
+type Setting {
+  name: String!
+  rawName: String!
+  javaType: String!
+  properties: [String!]!
+  defaultArg: String!
+  codeLine: Int!
+  codeFile: String!
+  "node or index"
+  scope: String
+  dynamic: Boolean!
+  deprecated: Boolean!
+  module: String!
+  firstSeenVersion: String
+  removedInVersion: String
+  minIndexCreatedVersion: String
+  normalizedDefault: NormalizedValue
+  parser: String
+  blame: Blame
+  owners: [String!]!
+  metrics: [String!]!
+  tags: [String!]!
+  exampleKeys: [String!]!
+  "The versions of the dataset that have a setting of this name"
+  versions: [Version!]!
+  "The setting whose value is the default of this one, i.e. the one it falls back to"
+  fallback: Setting
+  "The settings falling back to this one, directly or through another, which change along with it unless they're set themselves"
+  dependents: [Setting!]!
+}
+
+type NormalizedValue {
+  value: Float!
+  unit: String!
+  display: String!
+}
+
+type Blame {
+  commit: String!
+  author: String!
+  date: String!
+}
+
+type Diff {
+  from: String!
+  to: String!
+  breaking: Boolean!
+  added: [Setting!]!
+  removed: [Setting!]!
+  renamed: [Rename!]!
+  changed: [Change!]!
+}
+
+type Rename {
+  old: Setting!
+  new: Setting!
+}
+
+type Change {
+  name: String!
+  fields: [String!]!
+  breaking: Boolean!
+  old: Setting!
+  new: Setting!
+}
+`
+
+func gqlUnknownField(object gqlObject, field string) error {
+	return fmt.Errorf("%s has no field %s", object.gqlType(), field)
+}
+
+// gqlOptional is null for an empty string.
+func gqlOptional(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// gqlStrings is never null, the lists of a setting are left out of its JSON
+// when empty.
+func gqlStrings(s []string) []string {
+	if s == nil {
+		return []string{}
+	}
+	return s
+}
+
+func gqlStringArg(args map[string]interface{}, name string) (string, error) {
+	switch v := args[name].(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	}
+	return "", fmt.Errorf("%s has to be a string", name)
+}
+
+// gqlFields is an object whose fields are known upfront.
+type gqlFields struct {
+	name   string
+	fields map[string]interface{}
+}
+
+func (o gqlFields) gqlType() string {
+	return o.name
+}
+
+func (o gqlFields) resolve(field string, args map[string]interface{}) (interface{}, error) {
+	v, ok := o.fields[field]
+	if !ok {
+		return nil, gqlUnknownField(o, field)
+	}
+	return v, nil
+}
+
+// gqlQuery is the root of the schema, over a dataset.
+type gqlQuery struct {
+	dataset settingsDataset
+}
+
+func (q gqlQuery) gqlType() string {
+	return "Query"
+}
+
+// version returns a version of the dataset, the newest one for "".
+func (q gqlQuery) version(name string) (gqlObject, error) {
+	settings, version, ok, err := q.dataset.settings(name)
+	if err != nil || !ok {
+		return nil, err
+	}
+	for _, v := range q.dataset.versions() {
+		if v.Version == version {
+			return gqlVersion{dataset: q.dataset, version: v, settings: settings}, nil
+		}
+	}
+	return gqlVersion{dataset: q.dataset, version: DatasetVersion{Version: version, Settings: len(settings)}, settings: settings}, nil
+}
+
+func (q gqlQuery) resolve(field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "versions":
+		versions := []gqlObject{}
+		for _, v := range q.dataset.versions() {
+			versions = append(versions, gqlVersion{dataset: q.dataset, version: v})
+		}
+		return versions, nil
+	case "version", "settings", "setting":
+		name, err := gqlStringArg(args, "version")
+		if err != nil {
+			return nil, err
+		}
+		v, err := q.version(name)
+		if err != nil || v == nil {
+			if err == nil && field == "settings" {
+				err = fmt.Errorf("no such version")
+			}
+			return nil, err
+		}
+		if field == "version" {
+			return v, nil
+		}
+		delete(args, "version")
+		return v.resolve(field, args)
+	case "diff":
+		var versions [2]gqlVersion
+		for i, name := range []string{"from", "to"} {
+			version, err := gqlStringArg(args, name)
+			if err != nil || version == "" {
+				return nil, fmt.Errorf("%s has to be a version", name)
+			}
+			v, err := q.version(version)
+			if err != nil {
+				return nil, err
+			}
+			if v == nil {
+				return nil, fmt.Errorf("no version %s", version)
+			}
+			versions[i] = v.(gqlVersion)
+		}
+		return newGQLDiff(q.dataset, versions[0], versions[1])
+	}
+	return nil, gqlUnknownField(q, field)
+}
+
+// gqlVersion is a version of the dataset, its settings are read the first
+// time they're asked for.
+type gqlVersion struct {
+	dataset  settingsDataset
+	version  DatasetVersion
+	settings []ElasticsearchSetting
+}
+
+func (v gqlVersion) gqlType() string {
+	return "Version"
+}
+
+func (v gqlVersion) load() ([]ElasticsearchSetting, error) {
+	if v.settings != nil {
+		return v.settings, nil
+	}
+	settings, _, ok, err := v.dataset.settings(v.version.Version)
+	if err == nil && !ok {
+		err = fmt.Errorf("version %s is gone", v.version.Version)
+	}
+	return settings, err
+}
+
+// settingsParams turns the arguments of a settings field into the query
+// parameters of /api/settings.
+func settingsParams(args map[string]interface{}) (url.Values, error) {
+	params := url.Values{}
+	for name, v := range args {
+		param := map[string]string{"first": "limit", "after": "cursor"}[name]
+		if param == "" {
+			param = name
+		}
+		switch v := v.(type) {
+		case nil:
+		case string:
+			params.Set(param, v)
+		case bool:
+			params.Set(param, strconv.FormatBool(v))
+		case int:
+			params.Set(param, strconv.Itoa(v))
+		case float64:
+			// Numbers of JSON variables
+			params.Set(param, strconv.FormatFloat(v, 'f', -1, 64))
+		default:
+			return nil, fmt.Errorf("invalid %s", name)
+		}
+	}
+	return params, nil
+}
+
+func (v gqlVersion) resolve(field string, args map[string]interface{}) (interface{}, error) {
+	switch field {
+	case "version":
+		return v.version.Version, nil
+	case "sourceCommit":
+		return gqlOptional(v.version.SourceCommit), nil
+	case "extractedAt":
+		return v.version.ExtractedAt.Format(time.RFC3339), nil
+	case "settingsCount":
+		return v.version.Settings, nil
+	case "settings":
+		settings, err := v.load()
+		if err != nil {
+			return nil, err
+		}
+		params, err := settingsParams(args)
+		if err != nil {
+			return nil, err
+		}
+		query, err := parseSettingsQuery(params, v.version.Version)
+		if err != nil {
+			return nil, err
+		}
+		page, total, next := query.run(settings, v.version.Version)
+		nodes := make([]gqlObject, len(page))
+		for i, s := range page {
+			nodes[i] = gqlSetting{dataset: v.dataset, setting: s, settings: settings}
+		}
+		return gqlFields{"SettingConnection", map[string]interface{}{
+			"version":    v.version.Version,
+			"total":      total,
+			"nextCursor": gqlOptional(next),
+			"nodes":      nodes,
+		}}, nil
+	case "setting":
+		settings, err := v.load()
+		if err != nil {
+			return nil, err
+		}
+		name, err := gqlStringArg(args, "name")
+		if err != nil {
+			return nil, err
+		}
+		if s, ok := settingsByName(settings)[name]; ok {
+			return gqlSetting{dataset: v.dataset, setting: s, settings: settings}, nil
+		}
+		if s, ok := affixSettingOf(settings, name); ok {
+			return gqlSetting{dataset: v.dataset, setting: s, settings: settings}, nil
+		}
+		return nil, nil
+	}
+	return nil, gqlUnknownField(v, field)
+}
+
+// gqlSetting is a setting of a version, settings are the ones of the
+// version, it falls back to and is fallen back to by.
+type gqlSetting struct {
+	dataset  settingsDataset
+	setting  ElasticsearchSetting
+	settings []ElasticsearchSetting
+}
+
+func (s gqlSetting) gqlType() string {
+	return "Setting"
+}
+
+func (s gqlSetting) resolve(field string, args map[string]interface{}) (interface{}, error) {
+	setting := s.setting
+	switch field {
+	case "name":
+		return setting.Name, nil
+	case "rawName":
+		return setting.RawName, nil
+	case "javaType":
+		return setting.JavaType, nil
+	case "properties":
+		return gqlStrings(setting.Properties), nil
+	case "defaultArg":
+		return setting.DefaultArg, nil
+	case "codeLine":
+		return setting.CodeLine, nil
+	case "codeFile":
+		return setting.CodeFile, nil
+	case "scope":
+		return gqlOptional(setting.Scope()), nil
+	case "dynamic":
+		return updateBadge(setting) == "dynamic", nil
+	case "deprecated":
+		return hasProperty(setting, "Deprecated") || hasProperty(setting, "DeprecatedWarning"), nil
+	case "module":
+		return moduleOf(setting.CodeFile), nil
+	case "firstSeenVersion":
+		return gqlOptional(setting.FirstSeenVersion), nil
+	case "removedInVersion":
+		return gqlOptional(setting.RemovedInVersion), nil
+	case "minIndexCreatedVersion":
+		return gqlOptional(setting.MinIndexCreatedVersion), nil
+	case "normalizedDefault":
+		if v := setting.NormalizedDefault; v != nil {
+			return gqlFields{"NormalizedValue", map[string]interface{}{"value": v.Value, "unit": v.Unit, "display": v.Display}}, nil
+		}
+		return nil, nil
+	case "parser":
+		return gqlOptional(setting.Parser), nil
+	case "blame":
+		if b := setting.Blame; b != nil {
+			return gqlFields{"Blame", map[string]interface{}{"commit": b.Commit, "author": b.Author, "date": b.Date.Format(time.RFC3339)}}, nil
+		}
+		return nil, nil
+	case "owners":
+		return gqlStrings(setting.Owners), nil
+	case "metrics":
+		return gqlStrings(setting.Metrics), nil
+	case "tags":
+		return gqlStrings(setting.Tags), nil
+	case "exampleKeys":
+		return gqlStrings(setting.ExampleKeys), nil
+	case "versions":
+		versions := []gqlObject{}
+		for _, v := range s.dataset.versions() {
+			settings, _, ok, err := s.dataset.settings(v.Version)
+			if err != nil {
+				return nil, err
+			}
+			if _, has := settingsByName(settings)[setting.Name]; ok && has {
+				versions = append(versions, gqlVersion{dataset: s.dataset, version: v, settings: settings})
+			}
+		}
+		return versions, nil
+	case "fallback":
+		if fallback, ok := fallbackOf(s.settings, setting); ok {
+			return gqlSetting{dataset: s.dataset, setting: fallback, settings: s.settings}, nil
+		}
+		return nil, nil
+	case "dependents":
+		byName := settingsByName(s.settings)
+		dependents := []gqlObject{}
+		for _, name := range fallbackSettings(s.settings, setting, nil) {
+			dependents = append(dependents, gqlSetting{dataset: s.dataset, setting: byName[name], settings: s.settings})
+		}
+		return dependents, nil
+	}
+	return nil, gqlUnknownField(s, field)
+}
+
+func newGQLDiff(dataset settingsDataset, from, to gqlVersion) (gqlObject, error) {
+	old, err := from.load()
+	if err != nil {
+		return nil, err
+	}
+	new, err := to.load()
+	if err != nil {
+		return nil, err
+	}
+	d := diffSettings(old, new)
+	settings := func(list, of []ElasticsearchSetting) []gqlObject {
+		objects := []gqlObject{}
+		for _, s := range list {
+			objects = append(objects, gqlSetting{dataset: dataset, setting: s, settings: of})
+		}
+		return objects
+	}
+
+	renamed := []gqlObject{}
+	for _, r := range d.Renamed {
+		renamed = append(renamed, gqlFields{"Rename", map[string]interface{}{
+			"old": gqlSetting{dataset: dataset, setting: r.Old, settings: old},
+			"new": gqlSetting{dataset: dataset, setting: r.New, settings: new},
+		}})
+	}
+	changed := []gqlObject{}
+	for _, c := range d.Changed {
+		changed = append(changed, gqlFields{"Change", map[string]interface{}{
+			"name":     c.Name,
+			"fields":   gqlStrings(c.Fields),
+			"breaking": c.Breaking(),
+			"old":      gqlSetting{dataset: dataset, setting: c.Old, settings: old},
+			"new":      gqlSetting{dataset: dataset, setting: c.New, settings: new},
+		}})
+	}
+	return gqlFields{"Diff", map[string]interface{}{
+		"from":     from.version.Version,
+		"to":       to.version.Version,
+		"breaking": d.Breaking(),
+		"added":    settings(d.Added, new),
+		"removed":  settings(d.Removed, old),
+		"renamed":  renamed,
+		"changed":  changed,
+	}}, nil
+}
+
+// handleGraphQL answers GraphQL queries, POSTed as JSON or given in the
+// query string of a GET.
+func (api *settingsAPI) handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Query         string                 `json:"query"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}
+	switch r.Method {
+	case http.MethodGet:
+		params := r.URL.Query()
+		req.Query, req.OperationName = params.Get("query"), params.Get("operationName")
+		if variables := params.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeGraphQLError(w, "invalid variables: "+err.Error())
+				return
+			}
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeGraphQLError(w, "invalid request: "+err.Error())
+			return
+		}
+	default:
+		writeHTTPError(w, http.StatusMethodNotAllowed, "only GET and POST are supported")
+		return
+	}
+
+	doc, err := parseGraphQL(req.Query)
+	if err != nil {
+		writeGraphQLError(w, err.Error())
+		return
+	}
+	res, err := executeGraphQL(gqlQuery{dataset: api.dataset}, doc, req.OperationName, req.Variables)
+	if err != nil {
+		writeGraphQLError(w, err.Error())
+		return
+	}
+	writeHTTPJSON(w, res)
+}
+
+// writeGraphQLError answers a request that couldn't be run at all.
+func writeGraphQLError(w http.ResponseWriter, message string) {
+	b, _ := json.Marshal(gqlResponse{Errors: []gqlError{{Message: message}}})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	w.Write(b)
+}
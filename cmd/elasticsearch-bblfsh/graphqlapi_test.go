@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// testDataset has two versions, transport.port falling back to
+// transport.tcp.port and transport.profiles.default.port to it in the
+// newest one.
+var testDataset = fileDataset{
+	{Version: "7.17", Settings: []ElasticsearchSetting{
+		{Name: "transport.tcp.port", RawName: "TCP_PORT", JavaType: "String", DefaultArg: "9300-9400", Properties: []string{"NodeScope"}},
+	}},
+	{Version: "8.11", Settings: []ElasticsearchSetting{
+		{Name: "transport.port", RawName: "PORT", JavaType: "String", DefaultArg: "TCP_PORT", Properties: []string{"NodeScope"}},
+		{Name: "transport.profiles.default.port", RawName: "DEFAULT_PORT", JavaType: "String", DefaultArg: "TransportSettings.PORT", Properties: []string{"NodeScope"}},
+		{Name: "transport.tcp.port", RawName: "TCP_PORT", JavaType: "String", DefaultArg: "9300-9400", Properties: []string{"NodeScope", "Dynamic"}},
+	}},
+}
+
+func runTestQuery(t *testing.T, query string, variables map[string]interface{}) string {
+	t.Helper()
+	doc, err := parseGraphQL(query)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	res, err := executeGraphQL(gqlQuery{dataset: testDataset}, doc, "", variables)
+	if err != nil {
+		t.Fatalf("%s: %v", query, err)
+	}
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestGraphQLSettings(t *testing.T) {
+	for _, tc := range []struct {
+		query, want string
+	}{
+		{
+			`{ versions { version settingsCount } }`,
+			`{"data":{"versions":[{"version":"7.17","settingsCount":1},{"version":"8.11","settingsCount":3}]}}`,
+		},
+		{
+			`{ setting(name: "transport.tcp.port") { dynamic dependents { name } } }`,
+			`{"data":{"setting":{"dynamic":true,"dependents":[{"name":"transport.port"},{"name":"transport.profiles.default.port"}]}}}`,
+		},
+		{
+			`{ setting(name: "transport.profiles.default.port") { fallback { name fallback { name fallback { name } } } } }`,
+			`{"data":{"setting":{"fallback":{"name":"transport.port","fallback":{"name":"transport.tcp.port","fallback":null}}}}}`,
+		},
+		{
+			`{ settings(version: "8.11", q: "profiles") { total nodes { name versions { version } } } }`,
+			`{"data":{"settings":{"total":1,"nodes":[{"name":"transport.profiles.default.port","versions":[{"version":"8.11"}]}]}}}`,
+		},
+		{
+			`{ diff(from: "7.17", to: "8.11") { breaking added { name fallback { name } } changed { name fields } } }`,
+			`{"data":{"diff":{"breaking":false,"added":[{"name":"transport.port","fallback":{"name":"transport.tcp.port"}},{"name":"transport.profiles.default.port","fallback":{"name":"transport.port"}}],"changed":[{"name":"transport.tcp.port","fields":["properties"]}]}}}`,
+		},
+		{
+			`{ setting(name: "transport.nope") { name } }`,
+			`{"data":{"setting":null}}`,
+		},
+		{
+			`{ settings(version: "6.8") { total } }`,
+			`{"data":{"settings":null},"errors":[{"message":"no such version","path":["settings"]}]}`,
+		},
+	} {
+		if got := runTestQuery(t, tc.query, nil); got != tc.want {
+			t.Errorf("%s\n got %s\nwant %s", tc.query, got, tc.want)
+		}
+	}
+}
+
+func TestHandleGraphQL(t *testing.T) {
+	mux := http.NewServeMux()
+	(&settingsAPI{dataset: testDataset}).register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	res, err := http.Post(server.URL+"/graphql", "application/json", strings.NewReader(`{"query": "query($v: String) { version(version: $v) { version } }", "variables": {"v": "7.17"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body map[string]interface{}
+	json.NewDecoder(res.Body).Decode(&body)
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || body["data"].(map[string]interface{})["version"].(map[string]interface{})["version"] != "7.17" {
+		t.Errorf("POST: %d %v", res.StatusCode, body)
+	}
+
+	res, err = http.Get(server.URL + "/graphql?query=" + url.QueryEscape("{ nope"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("a query that doesn't parse answered %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,371 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The gRPC service is answered by hand over the HTTP/2 of net/http, like
+// the protobuf output is encoded by hand: the framing is a length prefix
+// and a trailer, not worth the dependencies of grpc-go.
+
+//go:embed settings_service.proto
+var settingsServiceProto []byte
+
+// grpcService is the path prefix of the methods of settings_service.proto.
+const grpcService = "/elasticsearch_bblfsh.Settings/"
+
+// grpcFollowInterval is how often StreamDiff with follow looks for new
+// versions.
+var grpcFollowInterval = 10 * time.Second
+
+// gRPC status codes
+const (
+	grpcOK              = 0
+	grpcInvalidArgument = 3
+	grpcNotFound        = 5
+	grpcUnimplemented   = 12
+	grpcInternal        = 13
+)
+
+// grpcError is an error answered with a gRPC status, the others are
+// INTERNAL.
+type grpcError struct {
+	code    int
+	message string
+}
+
+func (e grpcError) Error() string {
+	return e.message
+}
+
+// decodeProto calls field for every field of a message, with the value of
+// varints and the content of length delimited fields.
+func decodeProto(b []byte, field func(number int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errors.New("invalid message")
+		}
+		b = b[n:]
+		number := int(key >> 3)
+		var v uint64
+		var data []byte
+		switch key & 7 {
+		case 0:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errors.New("invalid message")
+			}
+			b = b[n:]
+		case 1, 5:
+			size := 8
+			if key&7 == 5 {
+				size = 4
+			}
+			if len(b) < size {
+				return errors.New("invalid message")
+			}
+			b = b[size:]
+			continue
+		case 2:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return errors.New("invalid message")
+			}
+			data, b = b[n:n+int(length)], b[n+int(length):]
+		default:
+			return errors.New("invalid message")
+		}
+		if err := field(number, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readGRPCMessage reads the message of a unary or server streaming call.
+func readGRPCMessage(r io.Reader) ([]byte, error) {
+	var prefix [5]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return nil, grpcError{grpcInvalidArgument, "no request message"}
+	}
+	if prefix[0] != 0 {
+		return nil, grpcError{grpcUnimplemented, "compressed messages aren't supported"}
+	}
+	length := binary.BigEndian.Uint32(prefix[1:])
+	if length > 4<<20 {
+		return nil, grpcError{grpcInvalidArgument, "request message larger than 4MB"}
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return nil, grpcError{grpcInvalidArgument, "truncated request message"}
+	}
+	return message, nil
+}
+
+// grpcStream writes the response messages of a call, each one flushed to
+// the client as soon as it's written.
+type grpcStream struct {
+	w http.ResponseWriter
+}
+
+func (s grpcStream) send(message []byte) error {
+	var prefix [5]byte
+	binary.BigEndian.PutUint32(prefix[1:], uint32(len(message)))
+	if _, err := s.w.Write(append(prefix[:], message...)); err != nil {
+		return err
+	}
+	if f, ok := s.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	return nil
+}
+
+// grpcMessageEscape percent-encodes a grpc-message like the protocol
+// requires.
+func grpcMessageEscape(message string) string {
+	var b strings.Builder
+	for i := 0; i < len(message); i++ {
+		c := message[i]
+		if c < 0x20 || c > 0x7e || c == '%' {
+			fmt.Fprintf(&b, "%%%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// handleGRPC answers the calls of settings_service.proto.
+func (api *settingsAPI) handleGRPC(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+		writeHTTPError(w, http.StatusUnsupportedMediaType, "gRPC calls are POSTed as application/grpc")
+		return
+	}
+	if r.ProtoMajor != 2 {
+		writeHTTPError(w, http.StatusHTTPVersionNotSupported, "gRPC calls need HTTP/2")
+		return
+	}
+	w.Header().Set("Content-Type", "application/grpc")
+
+	message, err := readGRPCMessage(r.Body)
+	if err == nil {
+		stream := grpcStream{w}
+		switch method := strings.TrimPrefix(r.URL.Path, grpcService); method {
+		case "ListVersions":
+			err = api.grpcListVersions(stream)
+		case "GetSetting":
+			err = api.grpcGetSetting(stream, message)
+		case "QuerySettings":
+			err = api.grpcQuerySettings(stream, message)
+		case "StreamDiff":
+			err = api.grpcStreamDiff(r, stream, message)
+		default:
+			err = grpcError{grpcUnimplemented, "no method " + method}
+		}
+	}
+
+	status, statusMessage := grpcOK, ""
+	if e, ok := err.(grpcError); ok {
+		status, statusMessage = e.code, e.message
+	} else if err != nil {
+		status, statusMessage = grpcInternal, err.Error()
+	}
+	w.Header().Set(http.TrailerPrefix+"Grpc-Status", strconv.Itoa(status))
+	if statusMessage != "" {
+		w.Header().Set(http.TrailerPrefix+"Grpc-Message", grpcMessageEscape(statusMessage))
+	}
+}
+
+// grpcSettings returns the settings of a version, the newest one for "".
+func (api *settingsAPI) grpcSettings(version string) ([]ElasticsearchSetting, string, error) {
+	settings, version, ok, err := api.dataset.settings(version)
+	if err != nil {
+		return nil, "", err
+	}
+	if !ok {
+		return nil, "", grpcError{grpcNotFound, "no such version"}
+	}
+	return settings, version, nil
+}
+
+func (api *settingsAPI) grpcListVersions(stream grpcStream) error {
+	var b protoBuffer
+	for _, v := range api.dataset.versions() {
+		var version protoBuffer
+		version.stringField(1, v.Version)
+		version.stringField(2, v.SourceCommit)
+		version.stringField(3, v.ExtractedAt.Format(time.RFC3339))
+		version.uintField(4, uint64(v.Settings))
+		b.bytesField(1, version.Bytes())
+	}
+	return stream.send(b.Bytes())
+}
+
+func (api *settingsAPI) grpcGetSetting(stream grpcStream, message []byte) error {
+	var name, version string
+	err := decodeProto(message, func(number int, v uint64, data []byte) error {
+		switch number {
+		case 1:
+			name = string(data)
+		case 2:
+			version = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		return grpcError{grpcInvalidArgument, err.Error()}
+	}
+	settings, version, err := api.grpcSettings(version)
+	if err != nil {
+		return err
+	}
+	setting, ok := settingsByName(settings)[name]
+	if !ok {
+		if setting, ok = affixSettingOf(settings, name); !ok {
+			return grpcError{grpcNotFound, "no such setting"}
+		}
+	}
+	var b protoBuffer
+	b.stringField(1, version)
+	b.bytesField(2, marshalSettingProto(setting))
+	return stream.send(b.Bytes())
+}
+
+func (api *settingsAPI) grpcQuerySettings(stream grpcStream, message []byte) error {
+	params := url.Values{}
+	names := map[int]string{1: "version", 2: "q", 3: "scope", 4: "property", 5: "module", 6: "namespace", 7: "dynamic", 8: "deprecated", 9: "sort", 10: "limit", 11: "cursor"}
+	err := decodeProto(message, func(number int, v uint64, data []byte) error {
+		switch number {
+		case 7, 8:
+			params.Set(names[number], strconv.FormatBool(v != 0))
+		case 10:
+			if v > 0 {
+				params.Set(names[number], strconv.FormatUint(v, 10))
+			}
+		default:
+			if name, ok := names[number]; ok {
+				params.Set(name, string(data))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return grpcError{grpcInvalidArgument, err.Error()}
+	}
+	settings, version, err := api.grpcSettings(params.Get("version"))
+	if err != nil {
+		return err
+	}
+	query, err := parseSettingsQuery(params, version)
+	if err != nil {
+		return grpcError{grpcInvalidArgument, err.Error()}
+	}
+
+	page, total, next := query.run(settings, version)
+	stream.w.Header().Set("Version", version)
+	stream.w.Header().Set("Total", strconv.Itoa(total))
+	if next != "" {
+		stream.w.Header().Set("Next-Cursor", next)
+	}
+	stream.w.WriteHeader(http.StatusOK)
+	for _, s := range page {
+		if err := stream.send(marshalSettingProto(s)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sendDiff streams the events of the diff between two versions.
+func (api *settingsAPI) sendDiff(stream grpcStream, from, to string) error {
+	old, from, err := api.grpcSettings(from)
+	if err != nil {
+		return err
+	}
+	new, to, err := api.grpcSettings(to)
+	if err != nil {
+		return err
+	}
+	for _, e := range diffEvents(diffSettings(old, new), from, to) {
+		var b protoBuffer
+		b.stringField(1, e.Event)
+		b.stringField(2, e.Name)
+		if e.Breaking {
+			b.uintField(3, 1)
+		}
+		b.repeatedStringField(4, e.Fields)
+		if e.Old != nil {
+			b.bytesField(5, marshalSettingProto(*e.Old))
+		}
+		if e.New != nil {
+			b.bytesField(6, marshalSettingProto(*e.New))
+		}
+		b.stringField(7, e.From)
+		b.stringField(8, e.To)
+		if err := stream.send(b.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (api *settingsAPI) grpcStreamDiff(r *http.Request, stream grpcStream, message []byte) error {
+	var from, to string
+	follow := false
+	err := decodeProto(message, func(number int, v uint64, data []byte) error {
+		switch number {
+		case 1:
+			from = string(data)
+		case 2:
+			to = string(data)
+		case 3:
+			follow = v != 0
+		}
+		return nil
+	})
+	if err != nil {
+		return grpcError{grpcInvalidArgument, err.Error()}
+	}
+	if from == "" {
+		return grpcError{grpcInvalidArgument, "from has to be a version"}
+	}
+	if _, to, err = api.grpcSettings(to); err != nil {
+		return err
+	}
+	// The headers go out right away, for clients following the diffs to
+	// know the call was accepted before the first new version
+	stream.w.WriteHeader(http.StatusOK)
+	if f, ok := stream.w.(http.Flusher); ok {
+		f.Flush()
+	}
+	if err := api.sendDiff(stream, from, to); err != nil || !follow {
+		return err
+	}
+
+	latest := to
+	for {
+		select {
+		case <-r.Context().Done():
+			return nil
+		case <-time.After(grpcFollowInterval):
+		}
+		versions := api.dataset.versions()
+		if len(versions) == 0 || versions[len(versions)-1].Version == latest {
+			continue
+		}
+		newest := versions[len(versions)-1].Version
+		if err := api.sendDiff(stream, latest, newest); err != nil {
+			return err
+		}
+		latest = newest
+	}
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func grpcFrame(message []byte) []byte {
+	frame := make([]byte, 5)
+	binary.BigEndian.PutUint32(frame[1:], uint32(len(message)))
+	return append(frame, message...)
+}
+
+// grpcServer serves the API of a dataset over HTTP/2, like gRPC clients
+// call it.
+func grpcServer(dataset settingsDataset) *httptest.Server {
+	mux := http.NewServeMux()
+	(&settingsAPI{dataset: dataset}).register(mux)
+	server := httptest.NewUnstartedServer(mux)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	return server
+}
+
+// grpcCall calls a method with the frame of a request, and returns the
+// response with its body read: the messages until the end of the call.
+func grpcCall(t *testing.T, server *httptest.Server, method string, frame []byte) (*http.Response, [][]byte) {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, server.URL+grpcService+method, bytes.NewReader(frame))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var messages [][]byte
+	for {
+		message, err := readGRPCMessage(res.Body)
+		if err != nil {
+			break
+		}
+		messages = append(messages, message)
+	}
+	return res, messages
+}
+
+func TestReadGRPCMessage(t *testing.T) {
+	for _, tc := range []struct {
+		frame   []byte
+		message string
+		code    int
+		err     string
+	}{
+		{grpcFrame([]byte("hello")), "hello", grpcOK, ""},
+		{grpcFrame(nil), "", grpcOK, ""},
+		{nil, "", grpcInvalidArgument, "no request message"},
+		{[]byte{0, 0, 0}, "", grpcInvalidArgument, "no request message"},
+		{grpcFrame([]byte("hello"))[:7], "", grpcInvalidArgument, "truncated request message"},
+		{append([]byte{1}, grpcFrame([]byte("hello"))[1:]...), "", grpcUnimplemented, "compressed messages aren't supported"},
+		{[]byte{0, 0, 0x40, 0, 0}, "", grpcInvalidArgument, "truncated request message"},
+		{[]byte{0, 0, 0x40, 0, 1}, "", grpcInvalidArgument, "request message larger than 4MB"},
+	} {
+		message, err := readGRPCMessage(bytes.NewReader(tc.frame))
+		e, _ := err.(grpcError)
+		if string(message) != tc.message || e.code != tc.code || e.message != tc.err {
+			t.Errorf("%x: got %q, %v, want %q, %d %s", tc.frame, message, err, tc.message, tc.code, tc.err)
+		}
+	}
+}
+
+func TestGRPCMessageEscape(t *testing.T) {
+	for message, want := range map[string]string{
+		"no such version": "no such version",
+		"100% done":       "100%25 done",
+		"déjà\nvu":        "d%C3%A9j%C3%A0%0Avu",
+	} {
+		if got := grpcMessageEscape(message); got != want {
+			t.Errorf("%q: got %q, want %q", message, got, want)
+		}
+	}
+}
+
+func TestDecodeProto(t *testing.T) {
+	var b protoBuffer
+	b.stringField(1, "name")
+	b.uintField(2, 300)
+	b.doubleField(3, 1.5)
+	b.Write([]byte{4<<3 | 5, 1, 2, 3, 4})
+	b.repeatedStringField(5, []string{"a", "b"})
+
+	type field struct {
+		number int
+		v      uint64
+		data   string
+	}
+	var got []field
+	err := decodeProto(b.Bytes(), func(number int, v uint64, data []byte) error {
+		got = append(got, field{number, v, string(data)})
+		return nil
+	})
+	// Fixed size fields are skipped, the requests have none
+	want := []field{{1, 0, "name"}, {2, 300, ""}, {5, 0, "a"}, {5, 0, "b"}}
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, %v, want %v", got, err, want)
+	}
+
+	for _, invalid := range [][]byte{{0x0a, 5, 'a'}, {0x09, 1, 2}, {0x0d, 1}, {0x0b}, {0x80}, {0x10}} {
+		if err := decodeProto(invalid, func(int, uint64, []byte) error { return nil }); err == nil {
+			t.Errorf("%x: no error", invalid)
+		}
+	}
+}
+
+func TestHandleGRPC(t *testing.T) {
+	server := grpcServer(testDataset)
+	defer server.Close()
+
+	var query protoBuffer
+	query.stringField(9, "-name")
+	query.uintField(10, 2)
+	var unknown protoBuffer
+	unknown.stringField(1, "transport.nope")
+	var known protoBuffer
+	known.stringField(1, "transport.tcp.port")
+	known.stringField(2, "7.17")
+	var unknownVersion protoBuffer
+	unknownVersion.stringField(1, "transport.tcp.port")
+	unknownVersion.stringField(2, "6.8")
+
+	for _, tc := range []struct {
+		method   string
+		frame    []byte
+		messages int
+		status   string
+		message  string
+	}{
+		{"ListVersions", grpcFrame(nil), 1, "0", ""},
+		{"GetSetting", grpcFrame(known.Bytes()), 1, "0", ""},
+		{"GetSetting", grpcFrame(unknown.Bytes()), 0, "5", "no such setting"},
+		{"GetSetting", grpcFrame(unknownVersion.Bytes()), 0, "5", "no such version"},
+		{"GetSetting", grpcFrame([]byte{0x0a, 5}), 0, "3", "invalid message"},
+		{"QuerySettings", grpcFrame(query.Bytes()), 2, "0", ""},
+		{"StreamDiff", grpcFrame(nil), 0, "3", "from has to be a version"},
+		{"Nope", grpcFrame(nil), 0, "12", "no method Nope"},
+		{"ListVersions", append([]byte{1}, grpcFrame(nil)[1:]...), 0, "12", "compressed messages aren't supported"},
+		{"ListVersions", nil, 0, "3", "no request message"},
+	} {
+		res, messages := grpcCall(t, server, tc.method, tc.frame)
+		if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "application/grpc" {
+			t.Errorf("%s: %d %s", tc.method, res.StatusCode, res.Header.Get("Content-Type"))
+		}
+		if len(messages) != tc.messages || res.Trailer.Get("Grpc-Status") != tc.status || res.Trailer.Get("Grpc-Message") != tc.message {
+			t.Errorf("%s %x: got %d messages, status %s %q, want %d, %s %q", tc.method, tc.frame, len(messages),
+				res.Trailer.Get("Grpc-Status"), res.Trailer.Get("Grpc-Message"), tc.messages, tc.status, tc.message)
+		}
+		if tc.method == "QuerySettings" && (res.Header.Get("Total") != "3" || res.Header.Get("Version") != "8.11" || res.Header.Get("Next-Cursor") == "") {
+			t.Errorf("QuerySettings headers: %v", res.Header)
+		}
+	}
+
+	// Not gRPC
+	res, err := server.Client().Post(server.URL+grpcService+"ListVersions", "application/json", bytes.NewReader(grpcFrame(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusUnsupportedMediaType {
+		t.Errorf("JSON call answered %d", res.StatusCode)
+	}
+
+	// Over HTTP/1.1
+	http1 := httptest.NewServer(server.Config.Handler)
+	defer http1.Close()
+	res, err = http.Post(http1.URL+grpcService+"ListVersions", "application/grpc", bytes.NewReader(grpcFrame(nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusHTTPVersionNotSupported {
+		t.Errorf("HTTP/1.1 call answered %d", res.StatusCode)
+	}
+}
+
+// growingDataset is a dataset versions are added to, like a daemon's.
+type growingDataset struct {
+	mu sync.Mutex
+	fileDataset
+}
+
+func (d *growingDataset) add(e versionedExtraction) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.fileDataset = append(d.fileDataset, e)
+}
+
+func (d *growingDataset) versions() []DatasetVersion {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.fileDataset.versions()
+}
+
+func (d *growingDataset) settings(version string) ([]ElasticsearchSetting, string, bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.fileDataset.settings(version)
+}
+
+func TestStreamDiff(t *testing.T) {
+	defer func(interval time.Duration) { grpcFollowInterval = interval }(grpcFollowInterval)
+	grpcFollowInterval = 10 * time.Millisecond
+
+	dataset := &growingDataset{fileDataset: fileDataset{
+		{Version: "1.0", Settings: []ElasticsearchSetting{
+			{Name: "a.removed", JavaType: "Boolean", DefaultArg: "false", CodeFile: "A.java"},
+			{Name: "b.old", RawName: "B", JavaType: "String", DefaultArg: "x", CodeFile: "B.java"},
+			{Name: "c", JavaType: "Integer", DefaultArg: "1", CodeFile: "C.java", Properties: []string{"NodeScope"}},
+		}},
+		{Version: "2.0", Settings: []ElasticsearchSetting{
+			{Name: "b.new", RawName: "B", JavaType: "String", DefaultArg: "x", CodeFile: "B.java"},
+			{Name: "c", JavaType: "Integer", DefaultArg: "1", CodeFile: "C.java", Properties: []string{"NodeScope", "Dynamic"}},
+			{Name: "z.added", JavaType: "Long", DefaultArg: "7", CodeFile: "Z.java"},
+			{Name: "d.added", JavaType: "Long", DefaultArg: "5", CodeFile: "D.java"},
+		}},
+	}}
+	// The call is waited for to end before grpcFollowInterval is set back,
+	// HTTP/2 handlers can outlive Close
+	var calls sync.WaitGroup
+	mux := http.NewServeMux()
+	(&settingsAPI{dataset: dataset}).register(mux)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		defer calls.Done()
+		mux.ServeHTTP(w, r)
+	}))
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	defer server.Close()
+
+	var request protoBuffer
+	request.stringField(1, "1.0")
+	request.uintField(3, 1)
+	req, err := http.NewRequest(http.MethodPost, server.URL+grpcService+"StreamDiff", bytes.NewReader(grpcFrame(request.Bytes())))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	res, err := server.Client().Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The events of a diff are in the order of diffEvents, each kind of
+	// event sorted by name
+	next := func() string {
+		t.Helper()
+		message, err := readGRPCMessage(res.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var event []string
+		decodeProto(message, func(number int, v uint64, data []byte) error {
+			switch number {
+			case 1, 2, 7, 8:
+				event = append(event, string(data))
+			case 3:
+				event = append(event, "breaking")
+			}
+			return nil
+		})
+		return strings.Join(event, " ")
+	}
+	for _, want := range []string{
+		"added d.added 1.0 2.0",
+		"added z.added 1.0 2.0",
+		"removed a.removed breaking 1.0 2.0",
+		"renamed b.old breaking 1.0 2.0",
+		"changed c 1.0 2.0",
+	} {
+		if got := next(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+
+	// Following, the diff of a version added goes out once it's there
+	dataset.add(versionedExtraction{Version: "3.0", Settings: []ElasticsearchSetting{
+		{Name: "b.new", RawName: "B", JavaType: "String", DefaultArg: "x", CodeFile: "B.java"},
+	}})
+	for _, want := range []string{
+		"removed c breaking 2.0 3.0",
+		"removed d.added breaking 2.0 3.0",
+		"removed z.added breaking 2.0 3.0",
+	} {
+		if got := next(); got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	}
+	res.Body.Close()
+	calls.Wait()
+}
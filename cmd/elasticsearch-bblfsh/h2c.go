@@ -0,0 +1,14 @@
+//go:build go1.24
+
+package main
+
+import "net/http"
+
+// allowCleartextHTTP2 has a server without TLS answer HTTP/2 with prior
+// knowledge as well as HTTP/1.1, which is how gRPC clients connect to it.
+func allowCleartextHTTP2(server *http.Server) {
+	server.Protocols = new(http.Protocols)
+	server.Protocols.SetHTTP1(true)
+	server.Protocols.SetHTTP2(true)
+	server.Protocols.SetUnencryptedHTTP2(true)
+}
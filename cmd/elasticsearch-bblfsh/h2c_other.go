@@ -0,0 +1,9 @@
+//go:build !go1.24
+
+package main
+
+import "net/http"
+
+// allowCleartextHTTP2 does nothing before Go 1.24, which added HTTP/2
+// without TLS to net/http. gRPC clients then need -tls-cert.
+func allowCleartextHTTP2(server *http.Server) {}
@@ -0,0 +1,32 @@
+//go:build go1.24
+
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/nickcanz/elasticsearch-bblfsh/client"
+)
+
+// TestCleartextGRPC checks the client calls StreamDiff over HTTP/2 without
+// TLS, like serve answers it without -tls-cert.
+func TestCleartextGRPC(t *testing.T) {
+	mux := http.NewServeMux()
+	(&settingsAPI{dataset: testDataset}).register(mux)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := &http.Server{Handler: mux}
+	allowCleartextHTTP2(server)
+	go server.Serve(listener)
+	defer server.Close()
+
+	events, err := client.New("http://"+listener.Addr().String()).Diff(context.Background(), "7.17", "8.11")
+	if err != nil || len(events) != 3 {
+		t.Errorf("got %+v, %v", events, err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// versionedExtraction is an extraction tagged with the Elasticsearch version
+// it was run against.
+type versionedExtraction struct {
+	Version  string
+	File     string
+	Document SettingsDocument
+	Settings []ElasticsearchSetting
+}
+
+// readVersionedExtractions loads "version=file" arguments and returns them
+// ordered from the oldest to the newest version.
+func readVersionedExtractions(args []string) ([]versionedExtraction, error) {
+	var extractions []versionedExtraction
+
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("expected version=file, got %q", arg)
+		}
+
+		doc, err := readSettingsDocument(parts[1])
+		if err != nil {
+			return nil, err
+		}
+
+		extractions = append(extractions, versionedExtraction{Version: parts[0], File: parts[1], Document: doc, Settings: doc.Settings})
+	}
+
+	sort.SliceStable(extractions, func(i, j int) bool {
+		return compareVersions(extractions[i].Version, extractions[j].Version) < 0
+	})
+
+	return extractions, nil
+}
+
+// annotateFirstSeen returns the settings of the newest extraction with
+// FirstSeenVersion set to the oldest version each setting name appears in.
+func annotateFirstSeen(extractions []versionedExtraction) []ElasticsearchSetting {
+	if len(extractions) == 0 {
+		return nil
+	}
+
+	firstSeen := map[string]string{}
+	for _, e := range extractions {
+		for _, s := range e.Settings {
+			if _, ok := firstSeen[s.Name]; !ok {
+				firstSeen[s.Name] = e.Version
+			}
+		}
+	}
+
+	latest := extractions[len(extractions)-1].Settings
+	settings := make([]ElasticsearchSetting, len(latest))
+	for i, s := range latest {
+		s.FirstSeenVersion = firstSeen[s.Name]
+		settings[i] = s
+	}
+
+	return settings
+}
+
+// removedSettings returns a tombstone for every setting that appears in an
+// older extraction but not in the newest one. Each tombstone carries the last
+// known definition of the setting, its FirstSeenVersion and the version it
+// disappeared in as RemovedInVersion.
+func removedSettings(extractions []versionedExtraction) []ElasticsearchSetting {
+	if len(extractions) == 0 {
+		return nil
+	}
+
+	firstSeen := map[string]string{}
+	lastSeen := map[string]ElasticsearchSetting{}
+	removedIn := map[string]string{}
+
+	for i, e := range extractions {
+		present := settingsByName(e.Settings)
+		for name, s := range present {
+			if _, ok := firstSeen[name]; !ok {
+				firstSeen[name] = e.Version
+			}
+			lastSeen[name] = s
+			delete(removedIn, name)
+		}
+		if i == 0 {
+			continue
+		}
+		for name := range lastSeen {
+			if _, ok := present[name]; !ok {
+				if _, ok := removedIn[name]; !ok {
+					removedIn[name] = e.Version
+				}
+			}
+		}
+	}
+
+	var tombstones []ElasticsearchSetting
+	for name, version := range removedIn {
+		s := lastSeen[name]
+		s.FirstSeenVersion = firstSeen[name]
+		s.RemovedInVersion = version
+		tombstones = append(tombstones, s)
+	}
+	sort.Slice(tombstones, func(i, j int) bool { return tombstones[i].Name < tombstones[j].Name })
+
+	return tombstones
+}
+
+func runHistory(args []string) {
+	flags := flag.NewFlagSet("history", flag.ExitOnError)
+	out := flags.String("out", "", "write the annotated settings to this file instead of stdout")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	removedOut := flags.String("removed-out", "", "write settings that no longer exist in the newest version to this file")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh history [-out file] [-removed-out file] <version=file>...")
+		fmt.Fprintln(os.Stderr, "Annotates the newest extraction with the version each setting first appeared in.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	extractions, err := readVersionedExtractions(flags.Args())
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	// Both outputs keep the metadata of the newest extraction they're
+	// derived from
+	latest := extractions[len(extractions)-1].Document
+
+	if *removedOut != "" {
+		removed := latest
+		removed.Settings = removedSettings(extractions)
+		if err := writeSettingsDocument(*removedOut, removed); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+
+	annotated := latest
+	annotated.Settings = annotateFirstSeen(extractions)
+
+	if *out == "" {
+		sortSettings(annotated.Settings)
+		b, err := marshalJSON(annotated)
+		if err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		if _, err := os.Stdout.Write(b); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		return
+	}
+
+	if err := writeSettingsDocument(*out, annotated); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/bblfsh/client-go.v2"
+)
+
+const (
+	elasticsearchRepository = "https://github.com/elastic/elasticsearch.git"
+	bblfshdImage            = "bblfsh/bblfshd"
+	javaDriverImage         = "bblfsh/java-driver"
+)
+
+// prompter asks questions on the terminal, an empty answer or the end of
+// the input taking the default.
+type prompter struct {
+	in  *bufio.Reader
+	out io.Writer
+	eof bool
+}
+
+func (p *prompter) ask(question, def string) string {
+	if def != "" {
+		fmt.Fprintf(p.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(p.out, "%s: ", question)
+	}
+	answer, err := p.in.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	if err != nil {
+		p.eof = true
+		if answer == "" {
+			fmt.Fprintln(p.out)
+		}
+	}
+	if answer == "" {
+		return def
+	}
+	return answer
+}
+
+func (p *prompter) confirm(question string, def bool) bool {
+	choices := "y/N"
+	if def {
+		choices = "Y/n"
+	}
+	switch strings.ToLower(p.ask(question+" ("+choices+")", "")) {
+	case "y", "yes":
+		return true
+	case "n", "no":
+		return false
+	}
+	return def
+}
+
+// runCommand runs a command with its output on stderr, for the steps of
+// init that take a while.
+func runCommand(name string, args ...string) error {
+	fmt.Fprintf(os.Stderr, "$ %s %s\n", name, strings.Join(args, " "))
+	cmd := exec.Command(name, args...)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// reachable tells whether something listens on a host:port.
+func reachable(endpoint string, timeout time.Duration) bool {
+	conn, err := net.DialTimeout("tcp", endpoint, timeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	return true
+}
+
+// bblfshdReadyTimeout is how long init waits for a bblfshd it started to
+// answer.
+var bblfshdReadyTimeout = time.Minute
+
+// waitForBblfshd polls bblfshd until it answers a version request, the port
+// docker publishes accepts connections before the daemon is up.
+func waitForBblfshd(endpoint string, timeout time.Duration) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := errors.New("nothing listens")
+		if reachable(endpoint, time.Second) {
+			var client *bblfsh.Client
+			if client, err = bblfsh.NewClient(endpoint); err == nil {
+				ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+				_, err = client.NewVersionRequest().DoWithContext(ctx)
+				cancel()
+			}
+		}
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("bblfshd didn't come up on %s: %v", endpoint, err)
+		}
+		time.Sleep(time.Second)
+	}
+}
+
+// startBblfshd starts bblfshd in Docker, listening on the port of endpoint,
+// waits for it to answer and installs the Java driver.
+func startBblfshd(endpoint string) error {
+	_, port, err := net.SplitHostPort(endpoint)
+	if err != nil {
+		return err
+	}
+	if err := runCommand("docker", "run", "-d", "--name", "bblfshd", "--privileged", "-p", port+":9432", bblfshdImage); err != nil {
+		return err
+	}
+	// bblfshctl talks to the daemon, which takes a moment to start
+	if err := waitForBblfshd(endpoint, bblfshdReadyTimeout); err != nil {
+		return err
+	}
+	return runCommand("docker", "exec", "bblfshd", "bblfshctl", "driver", "install", "java", javaDriverImage)
+}
+
+func runInit(args []string) {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh init")
+		fmt.Fprintln(os.Stderr, "Asks where the Elasticsearch checkout and bblfshd are, cloning or starting them if needed, and the output to write, then saves the answers to the config file.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	fileName := configPath()
+	if fileName == "" {
+		exitWith(exitRuntimeError, fmt.Errorf("no configuration directory, set ELASTICSEARCH_BBLFSH_CONFIG"))
+	}
+	// Running init again edits the existing answers
+	config, err := loadConfig()
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	p := &prompter{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+
+	root := p.ask("Elasticsearch checkout", config.SourceRoot)
+	if strings.HasPrefix(root, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			root = filepath.Join(home, root[2:])
+		}
+	}
+	if root, err = filepath.Abs(root); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		if p.confirm(fmt.Sprintf("%s doesn't exist, clone Elasticsearch into it?", root), true) {
+			if err := runCommand("git", "clone", elasticsearchRepository, root); err != nil {
+				exitWith(exitRuntimeError, fmt.Errorf("cloning Elasticsearch: %v", err))
+			}
+		}
+	}
+	config.SourceRoot = root
+
+	config.BblfshEndpoint = p.ask("bblfshd address", config.BblfshEndpoint)
+	if !reachable(config.BblfshEndpoint, 2*time.Second) {
+		if _, err := exec.LookPath("docker"); err != nil {
+			fmt.Fprintf(os.Stderr, "Nothing listens on %s, start bblfshd before running the tool: https://doc.bblf.sh/user/getting-started.html\n", config.BblfshEndpoint)
+		} else if p.confirm(fmt.Sprintf("Nothing listens on %s, start bblfshd with the Java driver in Docker?", config.BblfshEndpoint), true) {
+			if err := startBblfshd(config.BblfshEndpoint); err != nil {
+				exitWith(exitRuntimeError, fmt.Errorf("starting bblfshd: %v", err))
+			}
+		}
+	}
+
+	for {
+		format := p.ask("Output formats, comma separated", defaultString(config.Format, "json"))
+		if _, err := parseFormats(format); err != nil {
+			if p.eof {
+				exitWith(exitUsageError, err)
+			}
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		config.Format = format
+		break
+	}
+	config.Out = p.ask("Output file, empty for elasticsearchSettings.<format>", config.Out)
+	config.Paths = p.ask("Directories to scan, comma separated", defaultString(config.Paths, defaultPaths))
+
+	if err := writeConfig(fileName, config); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s, run elasticsearch-bblfsh to extract the settings\n", fileName)
+}
+
+func defaultString(value, def string) string {
+	if value == "" {
+		return def
+	}
+	return value
+}
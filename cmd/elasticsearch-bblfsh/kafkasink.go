@@ -0,0 +1,151 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl/plain"
+)
+
+// kafkaSink publishes settings and diff events to a Kafka topic, keyed by
+// setting name so the events of a setting stay ordered on a partition.
+type kafkaSink struct {
+	writer *kafka.Writer
+}
+
+// SettingDiffEvent is the message published for every entry of a diff.
+type SettingDiffEvent struct {
+	Event    string                `json:"event"`
+	Name     string                `json:"name"`
+	Breaking bool                  `json:"breaking"`
+	Fields   []string              `json:"fields,omitempty"`
+	Old      *ElasticsearchSetting `json:"old,omitempty"`
+	New      *ElasticsearchSetting `json:"new,omitempty"`
+	From     string                `json:"from"`
+	To       string                `json:"to"`
+}
+
+// key is the name of the setting the event is about once it happened, so a
+// rename is on the partition of the events of the setting's new name.
+func (e SettingDiffEvent) key() string {
+	if e.Event == "renamed" {
+		return e.New.Name
+	}
+	return e.Name
+}
+
+// newKafkaSink connects to comma separated brokers. KAFKA_USERNAME and
+// KAFKA_PASSWORD authenticate with SASL/PLAIN, read from the environment
+// like the Elasticsearch sink's secrets.
+func newKafkaSink(brokers, topic string, useTLS bool) *kafkaSink {
+	transport := &kafka.Transport{}
+	if useTLS {
+		transport.TLS = &tls.Config{}
+	}
+	if user := os.Getenv("KAFKA_USERNAME"); user != "" {
+		transport.SASL = plain.Mechanism{Username: user, Password: os.Getenv("KAFKA_PASSWORD")}
+	}
+
+	var addrs []string
+	for _, broker := range strings.Split(brokers, ",") {
+		addrs = append(addrs, strings.TrimSpace(broker))
+	}
+
+	return &kafkaSink{writer: &kafka.Writer{
+		Addr:         kafka.TCP(addrs...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		RequiredAcks: kafka.RequireAll,
+		Transport:    transport,
+		BatchSize:    esBulkBatchSize,
+	}}
+}
+
+func (sink *kafkaSink) message(event, key string, value interface{}) (kafka.Message, error) {
+	b, err := json.Marshal(value)
+	if err != nil {
+		return kafka.Message{}, err
+	}
+	return kafka.Message{
+		Key:     []byte(key),
+		Value:   b,
+		Headers: []kafka.Header{{Key: "event", Value: []byte(event)}},
+		Time:    time.Now(),
+	}, nil
+}
+
+func (sink *kafkaSink) write(messages []kafka.Message) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+	defer cancel()
+	if err := sink.writer.WriteMessages(ctx, messages...); err != nil {
+		sink.writer.Close()
+		return err
+	}
+	return sink.writer.Close()
+}
+
+// publishDocument publishes a message per setting, with the provenance of
+// the extraction like the documents of the Elasticsearch sink.
+func (sink *kafkaSink) publishDocument(doc SettingsDocument) error {
+	var messages []kafka.Message
+	for _, s := range doc.Settings {
+		m, err := sink.message("setting", s.Name, esIndexedSetting{
+			ElasticsearchSetting: s,
+			Scope:                s.Scope(),
+			SourceCommit:         doc.SourceCommit,
+			ExtractedAt:          doc.ExtractedAt,
+			ToolVersion:          doc.ToolVersion,
+		})
+		if err != nil {
+			return err
+		}
+		messages = append(messages, m)
+	}
+	return sink.write(messages)
+}
+
+// diffEvents returns an event per added, removed, renamed and changed
+// setting of a diff between the from and to extractions.
+func diffEvents(d SettingsDiff, from, to string) []SettingDiffEvent {
+	var events []SettingDiffEvent
+	for i := range d.Added {
+		events = append(events, SettingDiffEvent{Event: "added", Name: d.Added[i].Name, New: &d.Added[i]})
+	}
+	for i := range d.Removed {
+		events = append(events, SettingDiffEvent{Event: "removed", Name: d.Removed[i].Name, Breaking: true, Old: &d.Removed[i]})
+	}
+	for i := range d.Renamed {
+		r := &d.Renamed[i]
+		events = append(events, SettingDiffEvent{Event: "renamed", Name: r.Old.Name, Breaking: true, Old: &r.Old, New: &r.New})
+	}
+	for i := range d.Changed {
+		c := &d.Changed[i]
+		events = append(events, SettingDiffEvent{Event: "changed", Name: c.Name, Breaking: c.Breaking(), Fields: c.Fields, Old: &c.Old, New: &c.New})
+	}
+	for i := range events {
+		events[i].From, events[i].To = from, to
+	}
+	return events
+}
+
+// publishDiff publishes the events of a diff between the from and to
+// extractions.
+func (sink *kafkaSink) publishDiff(d SettingsDiff, from, to string) error {
+	var messages []kafka.Message
+	for _, e := range diffEvents(d, from, to) {
+		m, err := sink.message(e.Event, e.key(), e)
+		if err != nil {
+			return err
+		}
+		messages = append(messages, m)
+	}
+	if len(messages) == 0 {
+		return sink.writer.Close()
+	}
+	return sink.write(messages)
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestSettingDiffEventKey(t *testing.T) {
+	d := SettingsDiff{
+		Added:   []ElasticsearchSetting{{Name: "a.added"}},
+		Removed: []ElasticsearchSetting{{Name: "a.removed"}},
+		Renamed: []SettingRename{{Old: ElasticsearchSetting{Name: "b.old"}, New: ElasticsearchSetting{Name: "b.new"}}},
+	}
+	var got []string
+	for _, e := range diffEvents(d, "1.0", "2.0") {
+		got = append(got, e.Event+" "+e.Name+" "+e.key())
+	}
+	want := []string{"added a.added a.added", "removed a.removed a.removed", "renamed b.old b.new"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("got %q, want %q", got[i], want[i])
+		}
+	}
+}
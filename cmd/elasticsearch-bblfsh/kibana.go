@@ -0,0 +1,290 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// kibanaSavedObject is a line of a Kibana saved objects export, the format
+// Stack Management > Saved Objects imports.
+type kibanaSavedObject struct {
+	ID                   string                 `json:"id"`
+	Type                 string                 `json:"type"`
+	Attributes           map[string]interface{} `json:"attributes"`
+	References           []kibanaReference      `json:"references"`
+	CoreMigrationVersion string                 `json:"coreMigrationVersion"`
+	TypeMigrationVersion string                 `json:"typeMigrationVersion"`
+}
+
+type kibanaReference struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// kibanaMigrationVersion is the Kibana version the saved objects are written
+// for, older Kibanas refuse to import them.
+const kibanaMigrationVersion = "8.9.0"
+
+// kibanaLayer is the id of the single layer of every Lens visualization.
+const kibanaLayer = "settings"
+
+func kibanaCountColumn() map[string]interface{} {
+	return map[string]interface{}{
+		"label":         "Settings",
+		"customLabel":   true,
+		"dataType":      "number",
+		"operationType": "count",
+		"sourceField":   "___records___",
+		"isBucketed":    false,
+		"scale":         "ratio",
+		"params":        map[string]interface{}{"emptyAsNull": true},
+	}
+}
+
+func kibanaTermsColumn(label, field string, size int, orderBy map[string]interface{}, direction string) map[string]interface{} {
+	return map[string]interface{}{
+		"label":         label,
+		"customLabel":   true,
+		"dataType":      "string",
+		"operationType": "terms",
+		"sourceField":   field,
+		"isBucketed":    true,
+		"scale":         "ordinal",
+		"params": map[string]interface{}{
+			"size":           size,
+			"orderBy":        orderBy,
+			"orderDirection": direction,
+			"otherBucket":    false,
+			"missingBucket":  false,
+		},
+	}
+}
+
+// kibanaLens returns a Lens visualization of a single layer on the settings
+// index pattern.
+func kibanaLens(id, title, visualizationType, query string, columns map[string]interface{}, columnOrder []string, visualization map[string]interface{}, indexPatternID string) kibanaSavedObject {
+	return kibanaSavedObject{
+		ID:   id,
+		Type: "lens",
+		Attributes: map[string]interface{}{
+			"title":             title,
+			"description":       "",
+			"visualizationType": visualizationType,
+			"state": map[string]interface{}{
+				"datasourceStates": map[string]interface{}{
+					"formBased": map[string]interface{}{
+						"layers": map[string]interface{}{
+							kibanaLayer: map[string]interface{}{
+								"columns":           columns,
+								"columnOrder":       columnOrder,
+								"incompleteColumns": map[string]interface{}{},
+							},
+						},
+					},
+				},
+				"visualization": visualization,
+				"query":         map[string]interface{}{"query": query, "language": "kuery"},
+				"filters":       []interface{}{},
+			},
+		},
+		References: []kibanaReference{
+			{ID: indexPatternID, Name: "indexpattern-datasource-layer-" + kibanaLayer, Type: "index-pattern"},
+		},
+		CoreMigrationVersion: kibanaMigrationVersion,
+		TypeMigrationVersion: kibanaMigrationVersion,
+	}
+}
+
+func kibanaBarChart(termsColumn string) map[string]interface{} {
+	return map[string]interface{}{
+		"preferredSeriesType": "bar_horizontal",
+		"legend":              map[string]interface{}{"isVisible": false, "position": "right"},
+		"valueLabels":         "show",
+		"layers": []interface{}{
+			map[string]interface{}{
+				"layerId":    kibanaLayer,
+				"layerType":  "data",
+				"seriesType": "bar_horizontal",
+				"xAccessor":  termsColumn,
+				"accessors":  []string{"count"},
+			},
+		},
+	}
+}
+
+// kibanaSavedObjects returns an index pattern on the index -es-url indexes
+// into, a few Lens visualizations of the settings and a dashboard of them.
+func kibanaSavedObjects(index string) []kibanaSavedObject {
+	indexPatternID := "elasticsearch-bblfsh-" + index
+	byCount := map[string]interface{}{"type": "column", "columnId": "count"}
+	alphabetical := map[string]interface{}{"type": "alphabetical", "fallback": false}
+
+	visualizations := []kibanaSavedObject{
+		kibanaLens(indexPatternID+"-total", "Settings", "lnsMetric", "",
+			map[string]interface{}{
+				"names": map[string]interface{}{
+					"label":         "Settings",
+					"customLabel":   true,
+					"dataType":      "number",
+					"operationType": "unique_count",
+					"sourceField":   "name",
+					"isBucketed":    false,
+					"scale":         "ratio",
+					"params":        map[string]interface{}{"emptyAsNull": true},
+				},
+			},
+			[]string{"names"},
+			map[string]interface{}{"layerId": kibanaLayer, "layerType": "data", "metricAccessor": "names"},
+			indexPatternID),
+		kibanaLens(indexPatternID+"-scope", "Settings by scope", "lnsPie", "",
+			map[string]interface{}{
+				"scope": kibanaTermsColumn("Scope", "scope", 5, byCount, "desc"),
+				"count": kibanaCountColumn(),
+			},
+			[]string{"scope", "count"},
+			map[string]interface{}{
+				"shape": "donut",
+				"layers": []interface{}{
+					map[string]interface{}{
+						"layerId":         kibanaLayer,
+						"layerType":       "data",
+						"primaryGroups":   []string{"scope"},
+						"metrics":         []string{"count"},
+						"numberDisplay":   "value",
+						"categoryDisplay": "default",
+						"legendDisplay":   "default",
+					},
+				},
+			},
+			indexPatternID),
+		kibanaLens(indexPatternID+"-properties", "Settings by property", "lnsXY", "",
+			map[string]interface{}{
+				"property": kibanaTermsColumn("Property", "properties", 20, byCount, "desc"),
+				"count":    kibanaCountColumn(),
+			},
+			[]string{"property", "count"},
+			kibanaBarChart("property"),
+			indexPatternID),
+		kibanaLens(indexPatternID+"-first-seen", "Settings added per version", "lnsXY", "first_seen_version:*",
+			map[string]interface{}{
+				"version": kibanaTermsColumn("First seen in", "first_seen_version", 50, alphabetical, "asc"),
+				"count":   kibanaCountColumn(),
+			},
+			[]string{"version", "count"},
+			kibanaBarChart("version"),
+			indexPatternID),
+		kibanaLens(indexPatternID+"-deprecated", "Deprecated settings", "lnsDatatable", "properties:Deprecated",
+			map[string]interface{}{
+				"name":  kibanaTermsColumn("Setting", "name", 500, alphabetical, "asc"),
+				"file":  kibanaTermsColumn("File", "code_file", 1, byCount, "desc"),
+				"count": kibanaCountColumn(),
+			},
+			[]string{"name", "file", "count"},
+			map[string]interface{}{
+				"layerId":   kibanaLayer,
+				"layerType": "data",
+				"columns": []interface{}{
+					map[string]interface{}{"columnId": "name"},
+					map[string]interface{}{"columnId": "file"},
+					map[string]interface{}{"columnId": "count", "hidden": true},
+				},
+			},
+			indexPatternID),
+	}
+
+	// Two panels per row, the metric and the pie chart side by side on top
+	var panels []interface{}
+	var references []kibanaReference
+	for i, v := range visualizations {
+		panelIndex := fmt.Sprint(i)
+		panels = append(panels, map[string]interface{}{
+			"type":             "lens",
+			"panelIndex":       panelIndex,
+			"gridData":         map[string]interface{}{"x": (i % 2) * 24, "y": (i / 2) * 15, "w": 24, "h": 15, "i": panelIndex},
+			"embeddableConfig": map[string]interface{}{"enhancements": map[string]interface{}{}},
+			"panelRefName":     "panel_" + panelIndex,
+		})
+		references = append(references, kibanaReference{ID: v.ID, Name: panelIndex + ":panel_" + panelIndex, Type: "lens"})
+	}
+	panelsJSON, _ := json.Marshal(panels)
+
+	dashboard := kibanaSavedObject{
+		ID:   indexPatternID + "-dashboard",
+		Type: "dashboard",
+		Attributes: map[string]interface{}{
+			"title":       "Elasticsearch settings",
+			"description": "Settings extracted by elasticsearch-bblfsh and indexed into " + index,
+			"panelsJSON":  string(panelsJSON),
+			"optionsJSON": `{"useMargins":true,"syncColors":false,"syncCursor":true,"syncTooltips":false,"hidePanelTitles":false}`,
+			"timeRestore": false,
+			"kibanaSavedObjectMeta": map[string]interface{}{
+				"searchSourceJSON": `{"query":{"query":"","language":"kuery"},"filter":[]}`,
+			},
+		},
+		References:           references,
+		CoreMigrationVersion: kibanaMigrationVersion,
+		TypeMigrationVersion: kibanaMigrationVersion,
+	}
+
+	indexPattern := kibanaSavedObject{
+		ID:   indexPatternID,
+		Type: "index-pattern",
+		Attributes: map[string]interface{}{
+			"title":         index,
+			"name":          "Elasticsearch settings",
+			"timeFieldName": "extracted_at",
+		},
+		References:           []kibanaReference{},
+		CoreMigrationVersion: kibanaMigrationVersion,
+		TypeMigrationVersion: "8.0.0",
+	}
+
+	objects := []kibanaSavedObject{indexPattern}
+	objects = append(objects, visualizations...)
+	return append(objects, dashboard)
+}
+
+func writeKibanaSavedObjects(w io.Writer, objects []kibanaSavedObject) error {
+	out := json.NewEncoder(w)
+	for _, o := range objects {
+		if err := out.Encode(o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runKibana(args []string) {
+	flags := flag.NewFlagSet("kibana", flag.ExitOnError)
+	index := flags.String("es-index", "elasticsearch-settings", "index the settings were indexed into with -es-url")
+	out := flags.String("out", "-", "file to write the saved objects to, - for stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh kibana [-es-index index] [-out saved-objects.ndjson]")
+		fmt.Fprintln(os.Stderr, "Writes Kibana saved objects browsing the settings indexed with -es-url: an index pattern, Lens visualizations and a dashboard. Import them from Stack Management > Saved Objects, Kibana "+kibanaMigrationVersion+" or later.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 0 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	w := os.Stdout
+	if *out != "-" {
+		var err error
+		w, err = os.Create(*out)
+		if err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		defer w.Close()
+	}
+
+	if err := writeKibanaSavedObjects(w, kibanaSavedObjects(*index)); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+)
+
+// logLevel is set by -log-level, and to error by -quiet.
+var logLevel = func() *slog.LevelVar {
+	level := new(slog.LevelVar)
+	level.Set(slog.LevelWarn)
+	return level
+}()
+
+// logger is where warnings, errors and the debug logs of a run go. Runs
+// with -log-format json get one JSON object per line instead.
+var logger = slog.New(&terminalHandler{w: os.Stderr, mu: &sync.Mutex{}})
+
+// setupLogging sets the level and format of the logger from the flags.
+func setupLogging(level, format string) error {
+	switch strings.ToLower(level) {
+	case "debug":
+		logLevel.Set(slog.LevelDebug)
+	case "info":
+		logLevel.Set(slog.LevelInfo)
+	case "warn", "warning":
+		logLevel.Set(slog.LevelWarn)
+	case "error":
+		logLevel.Set(slog.LevelError)
+	default:
+		return fmt.Errorf("-log-level must be debug, info, warn or error, got %q", level)
+	}
+
+	switch format {
+	case "text":
+	case "json":
+		logger = slog.New(progressClearingHandler{slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})})
+	default:
+		return fmt.Errorf("-log-format must be text or json, got %q", format)
+	}
+	return nil
+}
+
+// terminalHandler writes a record as "warning: message key=value", colored
+// on terminals, for people reading the output rather than log pipelines.
+type terminalHandler struct {
+	w      io.Writer
+	mu     *sync.Mutex
+	attrs  []slog.Attr
+	prefix string
+}
+
+func (h *terminalHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= logLevel.Level()
+}
+
+func (h *terminalHandler) Handle(_ context.Context, r slog.Record) error {
+	var b bytes.Buffer
+	switch {
+	case r.Level >= slog.LevelError:
+		b.WriteString(colorize(ansiRed, "error:"))
+	case r.Level >= slog.LevelWarn:
+		b.WriteString(colorize(ansiYellow, "warning:"))
+	case r.Level >= slog.LevelInfo:
+		b.WriteString("info:")
+	default:
+		b.WriteString(colorize(ansiDim, "debug:"))
+	}
+	b.WriteString(" ")
+	b.WriteString(r.Message)
+
+	// Attributes of WithAttrs already carry the group prefix
+	writeAttr := func(prefix string, a slog.Attr) {
+		if a.Equal(slog.Attr{}) {
+			return
+		}
+		value := a.Value.Resolve().String()
+		if value == "" || strings.ContainsAny(value, " \"=") {
+			value = fmt.Sprintf("%q", value)
+		}
+		fmt.Fprintf(&b, " %s=%s", colorize(ansiDim, prefix+a.Key), value)
+	}
+	for _, a := range h.attrs {
+		writeAttr("", a)
+	}
+	r.Attrs(func(a slog.Attr) bool {
+		writeAttr(h.prefix, a)
+		return true
+	})
+	b.WriteString("\n")
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	runProgress.clear()
+	_, err := h.w.Write(b.Bytes())
+	return err
+}
+
+func (h *terminalHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	clone.attrs = append(append([]slog.Attr{}, h.attrs...), attrs...)
+	for i := len(h.attrs); i < len(clone.attrs); i++ {
+		clone.attrs[i].Key = h.prefix + clone.attrs[i].Key
+	}
+	return &clone
+}
+
+func (h *terminalHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	clone.prefix = h.prefix + name + "."
+	return &clone
+}
+
+// progressClearingHandler removes the progress bar before a record is
+// written, so the bar doesn't end up in the middle of a log line.
+type progressClearingHandler struct {
+	slog.Handler
+}
+
+func (h progressClearingHandler) Handle(ctx context.Context, r slog.Record) error {
+	runProgress.clear()
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h progressClearingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return progressClearingHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h progressClearingHandler) WithGroup(name string) slog.Handler {
+	return progressClearingHandler{h.Handler.WithGroup(name)}
+}
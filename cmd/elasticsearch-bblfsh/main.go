@@ -1,230 +1,1091 @@
 package main
 
 import (
+	"compress/gzip"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io/ioutil"
+	"log/slog"
 	"os"
 	"path"
 	"path/filepath"
-	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"gopkg.in/bblfsh/client-go.v2"
-	"gopkg.in/bblfsh/client-go.v2/tools"
-	"gopkg.in/bblfsh/sdk.v1/uast"
 )
 
-func getRawName(node *uast.Node) string {
-	nameQuery := "//FieldDeclaration/VariableDeclarationFragment/SimpleName"
-	nameNode, _ := tools.Filter(node, nameQuery)
+type ElasticsearchSetting struct {
+	Name       string   `json:"name"`
+	RawName    string   `json:"raw_name"`
+	JavaType   string   `json:"java_type"`
+	Properties []string `json:"properties"`
+	DefaultArg string   `json:"default_arg"`
 
-	if len(nameNode) > 0 {
-		return nameNode[0].Token
-	} else {
-		return ""
-	}
-}
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
 
-func getType(node *uast.Node) string {
-	typeQuery := "//FieldDeclaration/ParameterizedType/SimpleType[@internalRole='typeArguments']/SimpleName"
-	nestedTypeQuery := "//FieldDeclaration/ParameterizedType/ParameterizedType[@internalRole='typeArguments']/*"
+	FirstSeenVersion string `json:"first_seen_version,omitempty"`
+	RemovedInVersion string `json:"removed_in_version,omitempty"`
 
-	typeNode, _ := tools.Filter(node, typeQuery)
-	if len(typeNode) > 0 {
-		return typeNode[0].Token
-	} else {
-		nestedTypeNodes, _ := tools.Filter(node, nestedTypeQuery)
+	// MinIndexCreatedVersion is the oldest version an index has to be
+	// created with for an index setting to be accepted or used
+	MinIndexCreatedVersion string `json:"min_index_created_version,omitempty"`
 
-		var nestedTypes []string
-		for _, nestedNode := range nestedTypeNodes {
-			nestedTypes = append(nestedTypes, nestedNode.Children[0].Token)
-		}
+	// NormalizedDefault is DefaultArg as a number in a fixed unit, when it
+	// isn't computed at runtime
+	NormalizedDefault *NormalizedValue `json:"normalized_default,omitempty"`
+
+	// MinArg and MaxArg are the bounds the setting is declared with, as
+	// written, and NormalizedMin and NormalizedMax the ones that can be
+	// normalized like the default
+	MinArg        string           `json:"min_arg,omitempty"`
+	MaxArg        string           `json:"max_arg,omitempty"`
+	NormalizedMin *NormalizedValue `json:"normalized_min,omitempty"`
+	NormalizedMax *NormalizedValue `json:"normalized_max,omitempty"`
+
+	// Parser is the function values are parsed with when the setting is
+	// declared with one rather than through a typed factory, for
+	// validators to pick the syntax to check values against
+	Parser string `json:"parser,omitempty"`
+
+	Blame  *GitBlame `json:"blame,omitempty"`
+	Owners []string  `json:"owners,omitempty"`
+
+	// Metrics are the node stats metric paths related to the setting,
+	// from a curated mapping
+	Metrics []string `json:"metrics,omitempty"`
+
+	// Tags are free-form labels, set by a -script
+	Tags []string `json:"tags,omitempty"`
+
+	// ExampleKeys are keys of an affix setting, whose Name has a * for the
+	// namespace, found in the tests and docs of the checkout, i.e.
+	// cluster.remote.cluster_one.seeds for cluster.remote.*.seeds
+	ExampleKeys []string `json:"example_keys,omitempty"`
 
-		return strings.Join(nestedTypes, " of ")
+	// nameConstant and defaultConstant are the constants the name and the
+	// default are given as, until they're resolved, and constantClass the
+	// class they're written in
+	nameConstant    string
+	defaultConstant string
+	constantClass   string
+	// defaultEnum is the enum constant whose toString is the default,
+	// until the enum is known not to override it
+	defaultEnum string
+}
+
+// Scope returns "node" or "index" depending on which scope property the
+// setting was declared with, or an empty string if it has neither.
+func (s ElasticsearchSetting) Scope() string {
+	for _, prop := range s.Properties {
+		switch prop {
+		case "NodeScope":
+			return "node"
+		case "IndexScope":
+			return "index"
+		}
 	}
+	return ""
 }
 
-func getArguments(node *uast.Node) []*uast.Node {
-	// Sometimes settings are created from a helper method, so they're considered a method
-	// i.e. Setting.boolSetting("indices.query.query_string.allowLeadingWildcard", true, Property.NodeScope);
-	// So the arguments are method arguments
-	// But sometimes they are constructed new
-	// i.e new Setting<>("index.translog.durability", Translog.Durability.REQUEST.name(),
-	// So the arguments are part of the class construction
+var elasticsearchSettings []ElasticsearchSetting
+var bblfshClient *bblfsh.Client
+var rootDir string
 
-	methodArgumentsQuery := "//FieldDeclaration/VariableDeclarationFragment/MethodInvocation/*[@internalRole='arguments']"
-	classArgumentsQuery := "//FieldDeclaration/VariableDeclarationFragment/ClassInstanceCreation/*[@internalRole='arguments']"
+// defaultPaths are the directories scanned unless -paths or the config
+// file say otherwise.
+var defaultPaths = path.Join("server", "src", "main", "java", "org", "elasticsearch")
 
-	methodArgumentNodes, _ := tools.Filter(node, methodArgumentsQuery)
+var filesParsed int
+var filesFailed int
 
-	if len(methodArgumentNodes) > 0 {
-		return methodArgumentNodes
-	} else {
-		classArguementNodes, _ := tools.Filter(node, classArgumentsQuery)
-		return classArguementNodes
-	}
+// failureRateExceeded tells whether more files failed to parse than the
+// -max-failure-rate allows, for the run to fail before writing any output.
+func failureRateExceeded(maxRate float64) bool {
+	return filesParsed > 0 && float64(filesFailed)/float64(filesParsed) > maxRate
 }
 
-func getSettingProperties(nodes []*uast.Node) []string {
-	// Sometimes, settings are defined as "Setting.Property.Dynamic"
-	// And sometimes as just "Property.Dynamic"
-	// We're trying to pull out just the "Dynamic" part, so we we have two different queries
-	// to try the fully qualified "long" way vs the shorter definition
-	shortSettingPropertiesQuery := "//QualifiedName/SimpleName[@token='Property']/../SimpleName[@internalRole='name']"
-	longSettingPropertiesQuery := "//QualifiedName/QualifiedName/SimpleName[@token='Property']/../../SimpleName[@internalRole='name']"
+var codeOwners []codeOwnersRule
+var blameEnabled bool
 
-	var props []string
+// settingsStream is set for -format ndjson, settings are then written as
+// soon as their file is processed instead of all at once at the end.
+var settingsStream *json.Encoder
 
-	for _, propNode := range nodes {
-		longSettingPropertyNodes, _ := tools.Filter(propNode, longSettingPropertiesQuery)
+// emitSettings writes the settings of a file out if streaming, or keeps them
+// for the document otherwise. Kept settings are finished once every file was
+// walked, when the constants of files walked after theirs are known too.
+func emitSettings(settings []ElasticsearchSetting) error {
+	if settingsStream == nil {
+		elasticsearchSettings = append(elasticsearchSettings, settings...)
+		return nil
+	}
 
-		if len(longSettingPropertyNodes) > 0 {
-			for _, prop := range longSettingPropertyNodes {
-				props = append(props, prop.Token)
-			}
-		} else {
-			shortSettingPropertyNodes, _ := tools.Filter(propNode, shortSettingPropertiesQuery)
+	settings, err := finishSettings(settings, false)
+	if err != nil {
+		return err
+	}
+	for _, setting := range settings {
+		if err := settingsStream.Encode(setting); err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-			if len(shortSettingPropertyNodes) > 0 {
-				for _, prop := range shortSettingPropertyNodes {
-					props = append(props, prop.Token)
-				}
-			}
+// finishSettings resolves the constants settings are declared with, attaches
+// owners, metrics and blame and runs the -script over them. final is set
+// once the walk is done, names and defaults still unresolved by then are
+// left as written.
+func finishSettings(settings []ElasticsearchSetting, final bool) ([]ElasticsearchSetting, error) {
+	resolveSettingConstants(settings, final)
+
+	for i := range settings {
+		settings[i].Owners = ownersFor(codeOwners, settings[i].CodeFile)
+		settings[i].Metrics = settingMetrics[settings[i].Name]
+		settings[i].NormalizedDefault = normalizeDefault(settings[i])
+		settings[i].NormalizedMin = normalizeValue(settings[i].JavaType, settings[i].MinArg)
+		settings[i].NormalizedMax = normalizeValue(settings[i].JavaType, settings[i].MaxArg)
+	}
+
+	if blameEnabled {
+		if err := blameSettings(rootDir, settings); err != nil {
+			return nil, err
+		}
+	}
+	if redactPaths {
+		for i := range settings {
+			redactSetting(&settings[i])
 		}
 	}
 
-	return props
+	if settingsScript != nil {
+		return settingsScript.apply(settings)
+	}
+	return settings, nil
 }
 
-func getDefaultArg(node *uast.Node) string {
-	var defaultArg string
-
-	switch node.InternalType {
-	case "NumberLiteral":
-		defaultArg = fmt.Sprintf("%v", node.Properties["token"])
-	case "BooleanLiteral":
-		defaultArg = fmt.Sprintf("%v", node.Properties["booleanValue"])
-	case "MethodInvocation":
-		var arguments []string
-		for _, child := range node.Children {
-			switch child.InternalType {
-			case "NumberLiteral":
-				arguments = append(arguments, child.Properties["token"])
-			default:
-				arguments = append(arguments, child.Token)
+func processFile(filePath string, info os.FileInfo, err error) error {
+	if err != nil {
+		return err
+	}
+	if shutdownRequested() {
+		return errInterrupted
+	}
+
+	if skipDir(filePath, info) {
+		dirsSkipped++
+		return filepath.SkipDir
+	}
+	if !info.IsDir() && path.Ext(filePath) != ".java" {
+		filesSkipped++
+	}
+
+	if !info.IsDir() && path.Ext(filePath) == ".java" {
+		if resumedFiles[relativePath(filePath)] || scannedFirst[relativePath(filePath)] {
+			return nil
+		}
+		if limitReached() {
+			return filepath.SkipAll
+		}
+		if !inSample(relativePath(filePath)) {
+			filesSampledOut++
+			return nil
+		}
+		if quarantined(filePath) {
+			filesQuarantined++
+			logger.Warn("skipped as quarantined, it crashed bblfshd in previous runs", "file", relativePath(filePath))
+			return nil
+		}
+		filesParsed++
+		started := time.Now()
+		if settingsCacheUsable() {
+			if settings, skipped, ok := readCachedSettings(filePath); ok {
+				logger.Debug("unchanged since a previous run", "file", relativePath(filePath), "settings", len(settings))
+				settingsExtracted += len(settings)
+				settingsSkipped += skipped
+				recordFileOutcome(relativePath(filePath), info.Size(), started, time.Now(), len(settings), true, nil)
+				runManifest.Files[len(runManifest.Files)-1].Unchanged = true
+				return emitSettings(settings)
 			}
 		}
-		defaultArg = strings.Join(arguments, "->")
-	case "ClassInstanceCreation":
-		var arguments []string
-		for _, child := range node.Children {
-			switch child.InternalType {
-			case "NumberLiteral":
-				arguments = append(arguments, child.Properties["token"])
-			case "QualifiedName":
-				var subArgs []string
-				for _, subChild := range child.Children {
-					subArgs = append(subArgs, subChild.Token)
-				}
-				arguments = append(arguments, strings.Join(subArgs, "."))
+		partial := filesPartial
+		rootNode, cached, err := parseJava(filePath)
+		parsedPartially = filesPartial > partial
+		recordParse(filePath, err)
+		if err == nil && rootNode == nil {
+			err = errors.New("bblfshd returned no UAST")
+		}
+		parsed := time.Now()
+		if err != nil {
+			filesFailed++
+			recordFileOutcome(relativePath(filePath), info.Size(), started, parsed, 0, false, err)
+			return nil
+		}
+		logger.Debug("parsed", "file", relativePath(filePath), "cached", cached, "duration", parsed.Sub(started))
+
+		found := settingsExtracted
+		for _, e := range enabledExtractors {
+			if e.extract == nil {
+				continue
+			}
+			extractStarted := time.Now()
+			if err := e.extract(rootNode, filePath); err != nil {
+				return err
 			}
+			logger.Debug("extracted", "file", relativePath(filePath), "extractor", e.name, "duration", time.Since(extractStarted))
+		}
+		recordFileOutcome(relativePath(filePath), info.Size(), started, parsed, settingsExtracted-found, cached, nil)
+		if err := writeCheckpoint(false); err != nil {
+			logger.Warn("writing the checkpoint failed", "file", checkpointFile, "error", err)
 		}
-		defaultArg = strings.Join(arguments, "->")
-	default:
-		defaultArg = node.Token
 	}
 
-	return defaultArg
+	return nil
 }
 
-type ElasticsearchSetting struct {
-	Name       string   `json:"name"`
-	RawName    string   `json:"raw_name"`
-	JavaType   string   `json:"java_type"`
-	Properties []string `json:"properties"`
-	DefaultArg string   `json:"default_arg"`
-
-	CodeLine uint32 `json:"code_line"`
-	CodeFile string `json:"code_file"`
+// parseRate parses a rate given either as a percentage ("1%") or as a
+// fraction ("0.01").
+func parseRate(value string) (float64, error) {
+	var rate float64
+	var err error
+	if strings.HasSuffix(value, "%") {
+		rate, err = strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		rate = rate / 100
+	} else {
+		rate, err = strconv.ParseFloat(value, 64)
+	}
+	if err != nil || rate < 0 || rate > 1 {
+		return 0, fmt.Errorf("invalid rate %q, expected e.g. 1%% or 0.01", value)
+	}
+	return rate, nil
 }
 
-func getSettings(rootNode *uast.Node, fileName string) []ElasticsearchSetting {
-	query := "//FieldDeclaration/ParameterizedType/SimpleType/SimpleName[@token='Setting']/../../.."
-	nodes, _ := tools.Filter(rootNode, query)
-
-	var settings []ElasticsearchSetting
+// parseSize parses a size in bytes with an optional unit, i.e. "10GB",
+// "512MB" or Elasticsearch's "32g". Units are powers of 1024.
+func parseSize(value string) (int64, error) {
+	units := []struct {
+		suffix     string
+		multiplier int64
+	}{
+		{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10},
+		{"T", 1 << 40}, {"G", 1 << 30}, {"M", 1 << 20}, {"K", 1 << 10}, {"B", 1},
+	}
 
-	for _, n := range nodes {
-		rawSettingName := getRawName(n)
-		settingType := getType(n)
+	number := strings.ToUpper(strings.TrimSpace(value))
+	multiplier := int64(1)
+	for _, unit := range units {
+		if strings.HasSuffix(number, unit.suffix) {
+			number = strings.TrimSpace(strings.TrimSuffix(number, unit.suffix))
+			multiplier = unit.multiplier
+			break
+		}
+	}
+	size, err := strconv.ParseFloat(number, 64)
+	if err != nil || size < 0 {
+		return 0, fmt.Errorf("invalid size %q, expected e.g. 10GB or 512MB", value)
+	}
+	return int64(size * float64(multiplier)), nil
+}
 
-		argumentNodes := getArguments(n)
+func runDiff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	htmlOut := flags.String("html", "", "write a standalone HTML page of the diff to this file")
+	kafkaBrokers := flags.String("kafka-brokers", "", "also publish an event per difference to Kafka through these comma separated brokers, authenticating with KAFKA_USERNAME and KAFKA_PASSWORD if set")
+	kafkaTopic := flags.String("kafka-topic", "elasticsearch-settings-changes", "Kafka topic to publish the diff events to")
+	kafkaTLS := flags.Bool("kafka-tls", false, "connect to the Kafka brokers over TLS")
+	var sinkPlugins stringsFlag
+	flags.Var(&sinkPlugins, "sink-plugin", "also send the diff events to this program, with its arguments, speaking the sink plugin protocol over stdio. Can be repeated")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh diff [-html out.html] [-kafka-brokers host:9092] <old.json> <new.json>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
 
-		if len(argumentNodes) > 2 {
+	if flags.NArg() != 2 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
 
-			settingName := argumentNodes[0].Token
-			defaultArg := getDefaultArg(argumentNodes[1])
-			settingProperties := getSettingProperties(argumentNodes)
+	oldFile, newFile := flags.Arg(0), flags.Arg(1)
+	oldSettings, err := readSettings(oldFile)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	newSettings, err := readSettings(newFile)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
 
-			relativeFilePath := path.Join(strings.Split(fileName, "/")[len(strings.Split(rootDir, "/")):]...)
+	d := diffSettings(oldSettings, newSettings)
 
-			setting := ElasticsearchSetting{
-				Name:       strings.Trim(settingName, "\""),
-				RawName:    rawSettingName,
-				JavaType:   settingType,
-				Properties: settingProperties,
-				DefaultArg: strings.Trim(defaultArg, "\""),
-				CodeLine:   n.StartPosition.Line,
-				CodeFile:   relativeFilePath}
+	if *htmlOut == "" {
+		writeDiffText(os.Stdout, d)
+	} else {
+		f, err := os.Create(*htmlOut)
+		if err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		err = writeDiffHTML(f, d, oldFile, newFile)
+		f.Close()
+		if err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
 
-			settings = append(settings, setting)
-		} else {
-			fmt.Errorf("Problem with %v", rawSettingName)
+	if *kafkaBrokers != "" {
+		if err := newKafkaSink(*kafkaBrokers, *kafkaTopic, *kafkaTLS).publishDiff(d, oldFile, newFile); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+	for _, spec := range sinkPlugins {
+		sink, err := newPluginSink(spec)
+		if err != nil {
+			exitWith(exitUsageError, err)
+		}
+		if err := sink.publishDiff(d, oldFile, newFile); err != nil {
+			exitWith(exitRuntimeError, err)
 		}
 	}
 
-	return settings
+	if d.Breaking() {
+		exitWith(exitBreakingChanges, nil)
+	}
 }
 
-var elasticsearchSettings []ElasticsearchSetting
-var bblfshClient *bblfsh.Client
-var rootDir string
+func main() {
+	if len(os.Args) > 1 && !strings.HasPrefix(os.Args[1], "-") {
+		switch os.Args[1] {
+		case "compat-report":
+			runCompatReport(os.Args[2:])
+			return
+		case "daemon":
+			runDaemon(os.Args[2:])
+			return
+		case "diff":
+			runDiff(os.Args[2:])
+			return
+		case "doctor":
+			runDoctor(os.Args[2:])
+			return
+		case "extractors":
+			runExtractors(os.Args[2:])
+			return
+		case "factory-diff":
+			runFactoryDiff(os.Args[2:])
+			return
+		case "generate":
+			runGenerate(os.Args[2:])
+			return
+		case "history":
+			runHistory(os.Args[2:])
+			return
+		case "init":
+			runInit(os.Args[2:])
+			return
+		case "kibana":
+			runKibana(os.Args[2:])
+			return
+		case "render":
+			runRender(os.Args[2:])
+			return
+		case "namespaces":
+			runNamespaces(os.Args[2:])
+			return
+		case "plan":
+			runPlan(os.Args[2:])
+			return
+		case "publications":
+			runPublications(os.Args[2:])
+			return
+		case "rest-diff":
+			runRestDiff(os.Args[2:])
+			return
+		case "rolling-upgrade":
+			runRollingUpgrade(os.Args[2:])
+			return
+		case "round-trip":
+			runRoundTrip(os.Args[2:])
+			return
+		case "schema":
+			runSchema(os.Args[2:])
+			return
+		case "segments":
+			runSegments(os.Args[2:])
+			return
+		case "self-update":
+			runSelfUpdate(os.Args[2:])
+			return
+		case "serve":
+			runServe(os.Args[2:])
+			return
+		case "site":
+			runSite(os.Args[2:])
+			return
+		case "what-if":
+			runWhatIf(os.Args[2:])
+			return
+		case "validate":
+			runValidate(os.Args[2:])
+			return
+		case "version":
+			fmt.Println(buildInfo())
+			return
+		default:
+			fmt.Fprintf(os.Stderr, "unknown subcommand %q\n", os.Args[1])
+			exitWith(exitUsageError, nil)
+		}
+	}
 
-func processFile(filePath string, info os.FileInfo, err error) error {
+	config, err := loadConfig()
 	if err != nil {
-		return err
+		exitWith(exitUsageError, err)
 	}
 
-	if !info.IsDir() && path.Ext(filePath) == ".java" {
+	flag.StringVar(&config.SourceRoot, "source-root", config.SourceRoot, "Elasticsearch checkout to extract the settings of, the working directory unless the config file gives another")
+	flag.StringVar(&config.BblfshEndpoint, "bblfsh-endpoint", config.BblfshEndpoint, "address of bblfshd")
+	out := flag.String("out", config.Out, "write the settings to this file, - for stdout (default elasticsearchSettings.<format>). Only for a single -format")
+	format := flag.String("format", defaultString(config.Format, "json"), "comma separated output formats of the settings: json for a single document, ndjson for one setting per line written as they are extracted, csv, yaml, parquet, protobuf, avro, sqlite to add them to a database, table for an aligned table, or the ones of -encoder-plugin")
+	var encoderPlugins stringsFlag
+	flag.Var(&encoderPlugins, "encoder-plugin", "load an output format from this Go plugin, can be repeated")
+	outputTemplateFile := flag.String("output-template", "", "render the settings through this text/template file, once for the whole document or once per setting if it defines a \"setting\" template. Replaces the default -format, adds to one given explicitly")
+	flag.BoolVar(&gzipOutput, "gzip", false, "gzip the settings output and add .gz to its file names. Implied by an -out ending in .gz")
+	splitBy := flag.String("split-by", "", "write a directory of smaller files, one per package or module, to -out (default elasticsearchSettings) instead of a single file")
+	maxOutputSizeFlag := flag.String("max-output-size", "", "roll the settings across numbered files of at most this size, e.g. 10MB, in the -out directory (default elasticsearchSettings) with a chunks.json listing them")
+	pretty := flag.Bool("pretty", false, "indent the JSON output")
+	compact := flag.Bool("compact", false, "write the JSON output on a single line, the default")
+	printVersion := flag.Bool("version", false, "print the version and exit")
+	maxFailureRateFlag := flag.String("max-failure-rate", "0%", "fraction of files allowed to fail parsing before the run is considered failed, e.g. 1%")
+	flag.BoolVar(&quiet, "quiet", false, "only print errors, not warnings, the run summary or the table of settings")
+	noProgress := flag.Bool("no-progress", false, "don't show a progress bar, it's only shown when stderr is a terminal")
+	logLevelFlag := flag.String("log-level", "warn", "debug, info, warn or error. debug logs every file parsed and the settings declarations found in it")
+	logFormat := flag.String("log-format", "text", "text, or json for one JSON object per log line")
+	noColor := flag.Bool("no-color", false, "don't color warnings and errors, also set by the NO_COLOR environment variable")
+	flag.BoolVar(&redactPaths, "redact-paths", false, "leave the checkout path, blame authors, individual code owners and local paths and user names in the manifest out of the output, for catalogs shared externally")
+	flag.BoolVar(&blameEnabled, "blame", false, "record the commit, author and date of the declaration line of every setting using git blame")
+	scriptFile := flag.String("script", "", "Starlark script whose transform(setting) function can change, tag or drop every setting before it's written out")
+	esURL := flag.String("es-url", "", "also bulk index the settings into the Elasticsearch or OpenSearch cluster at this URL")
+	esIndex := flag.String("es-index", "elasticsearch-settings", "index to bulk index the settings into")
+	esUser := flag.String("es-user", "", "user to authenticate to -es-url with, the password is read from ELASTICSEARCH_PASSWORD. ELASTICSEARCH_API_KEY is used instead if set")
+	kafkaBrokers := flag.String("kafka-brokers", "", "also publish every setting to Kafka through these comma separated brokers, authenticating with KAFKA_USERNAME and KAFKA_PASSWORD if set")
+	kafkaTopic := flag.String("kafka-topic", "elasticsearch-settings", "Kafka topic to publish the settings to")
+	kafkaTLS := flag.Bool("kafka-tls", false, "connect to the Kafka brokers over TLS")
+	var sinkPlugins stringsFlag
+	flag.Var(&sinkPlugins, "sink-plugin", "also send the settings to this program, with its arguments, speaking the sink plugin protocol over stdio. Can be repeated")
+	metricsMapFile := flag.String("metrics-map", "", "JSON object of setting names to node stats metric paths, merged over the built-in mapping")
+	flag.StringVar(&publicationLog, "publication-log", config.PublicationLog, "append who published which settings, at which commit, where, to this file whenever they're uploaded to s3:// or gs://, or sent to -es-url, -kafka-brokers or a -sink-plugin. See the publications subcommand")
+	flag.StringVar(&uastCacheDir, "uast-cache", "", "keep the parsed UASTs in this directory and reuse them for files whose content didn't change")
+	uastStoreFile := flag.String("uast-store", "", "keep the responses of bblfshd in this bbolt database, failed and partial ones included, and replay them for files whose content didn't change")
+	flag.BoolVar(&offline, "offline", false, "parse files only from the -uast-store, without connecting to bblfshd. Files it doesn't have fail")
+	flag.BoolVar(&affixExamples, "affix-examples", false, "look for keys of the affix settings, i.e. cluster.remote.*.seeds, in the tests and docs of the checkout and add the most used ones as example_keys")
+	flag.StringVar(&checkpointFile, "checkpoint", "", "save the progress of the run to this file every minute, for -resume")
+	resume := flag.Bool("resume", false, "carry on from the -checkpoint of an interrupted run over the same tree instead of starting over")
+	sampleFlag := flag.String("sample", "", "only process this fraction of the Java files, i.e. 5%, always the same ones, for a quick check of the setup before a full run")
+	flag.IntVar(&fileLimit, "limit", 0, "stop after processing this many Java files, 0 for no limit")
+	noWait := flag.Bool("no-wait", false, "fail right away when another run holds the -uast-cache or output directory, rather than wait for it to be done")
+	wait := flag.Bool("wait", true, "wait for the other runs writing to the -uast-cache or output directory to be done, -wait=false is -no-wait")
+	flag.StringVar(&quarantineFile, "quarantine", "", "keep the files that crash bblfshd in this file, and skip the ones that crashed it in -quarantine-after runs until they or the driver change")
+	flag.IntVar(&quarantineAfter, "quarantine-after", quarantineAfter, "how many runs a file has to crash bblfshd in to be quarantined")
+	flag.StringVar(&priorityFile, "priority", "", "process first the packages that declared the most settings per file in previous runs, as ranked in this file, and update it with this run. A run stopped by -limit or a signal then has the settings that matter most")
+	flag.BoolVar(&incremental, "incremental", false, "with -uast-cache, reuse the settings extracted from files whose content didn't change since a previous run instead of parsing them again")
+	cacheMaxSizeFlag := flag.String("cache-max-size", "", "remove the least recently used UASTs once the -uast-cache directory grows past this size, e.g. 10GB")
+	extractorsFlag := flag.String("extractors", "settings", "comma separated extractors to run, the ones they depend on are enabled too. Enabling one through its own flag below adds it to these")
+	buildSettingsFile := flag.String("build-settings", "", "also extract settings and system properties set in *.gradle files and write them to this file")
+	painlessFile := flag.String("painless", "", "also extract painless script contexts and whitelisted classes and write them to this file")
+	analysisFile := flag.String("analysis", "", "also extract the registered analyzers, tokenizers, token and char filters and their parameters and write them to this file")
+	dslFile := flag.String("dsl", "", "also extract the registered query, aggregation and other search DSL names and write them to this file")
+	systemIndicesFile := flag.String("system-indices", "", "also extract the system index descriptors and write them to this file")
+	transportActionsFile := flag.String("transport-actions", "", "also extract the registered transport action names and their request classes and write them to this file")
+	statsFieldsFile := flag.String("stats-fields", "", "also extract the fields emitted by the toXContent method of stats classes and write them to this file")
+	catColumnsFile := flag.String("cat-columns", "", "also extract the columns of every _cat API table and write them to this file")
+	restFile := flag.String("rest", "", "also extract the REST routes and the request parameters their handlers read and write them to this file")
+	factoriesFile := flag.String("factories", "", "also write how many settings are declared through each Setting factory method and constructor to this file")
+	wrappersFile := flag.String("wrappers", "", "also write the helper methods settings are declared through instead of a Setting factory to this file")
+	flag.BoolVar(&followWrappers, "follow-wrappers", false, "read settings declared through a helper method of their own file from the Setting factory call the helper returns")
+	paths := flag.String("paths", defaultString(config.Paths, defaultPaths), "comma separated directories to scan, relative to the Elasticsearch checkout")
+	manifestFile := flag.String("manifest", "run-manifest.json", "write the run manifest to this file, empty to skip it")
+	timingsFile := flag.String("timings", "", "write how long parsing and extracting took for every file to this CSV file")
+	flag.BoolVar(&slowFilesReport, "slow-files", false, "list the 20 files that took the longest after the summary")
+	pprofAddr := flag.String("pprof-addr", "", "serve the pprof endpoints on this address while the run lasts, i.e. localhost:6060")
+	traceOut := flag.String("trace-out", "", "record an execution trace of the run into this file, for go tool trace")
+	metricsAddr := flag.String("metrics-addr", "", "serve Prometheus metrics of the run on this address under /metrics, i.e. localhost:9090")
+	watch := flag.Bool("watch", false, "keep running once the outputs are written, extracting the settings of the files that change again and rewriting the outputs, until Ctrl-C")
+	flag.Parse()
+	if *noColor {
+		colorOutput = false
+	}
+	if err := setupLogging(*logLevelFlag, *logFormat); err != nil {
+		exitWith(exitUsageError, err)
+	}
+	logLevelGiven := false
+	flag.Visit(func(f *flag.Flag) { logLevelGiven = logLevelGiven || f.Name == "log-level" })
+	if quiet && !logLevelGiven {
+		logLevel.Set(slog.LevelError)
+	}
+
+	if *printVersion {
+		fmt.Println(buildInfo())
+		return
+	}
+
+	if *pprofAddr != "" {
+		if err := startPprofServer(*pprofAddr); err != nil {
+			exitWith(exitUsageError, err)
+		}
+	}
+	if *metricsAddr != "" {
+		if err := startMetricsServer(*metricsAddr); err != nil {
+			exitWith(exitUsageError, err)
+		}
+	}
+	if *traceOut != "" {
+		if err := startTrace(*traceOut); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		defer stopTrace()
+	}
+
+	if *pretty && *compact {
+		exitWith(exitUsageError, errors.New("-pretty and -compact can't be used together"))
+	}
+	prettyJSON = *pretty
+
+	for _, fileName := range encoderPlugins {
+		if err := loadEncoderPlugin(fileName); err != nil {
+			exitWith(exitUsageError, err)
+		}
+	}
+	formats, err := parseFormats(*format)
+	if err != nil {
+		exitWith(exitUsageError, err)
+	}
+	formatGiven := false
+	flag.Visit(func(f *flag.Flag) { formatGiven = formatGiven || f.Name == "format" })
+	// Interactive runs with the default output also get the settings on
+	// the terminal, scripts piping the output keep getting only the file
+	tableToTerminal := !quiet && !formatGiven && *out == "" && *outputTemplateFile == "" && isTerminal(os.Stdout)
+	if *outputTemplateFile != "" {
+		t, err := loadOutputTemplate(*outputTemplateFile)
 		if err != nil {
-			panic(err)
+			exitWith(exitUsageError, err)
 		}
-		res, err := bblfshClient.NewParseRequest().ReadFile(filePath).Do()
+		registerEncoder("template", templateEncoder(*outputTemplateFile, t))
+		if formatGiven {
+			formats = append(formats, "template")
+		} else {
+			formats = []string{"template"}
+		}
+	}
+	streaming := formats[0] == "ndjson"
+	if strings.HasSuffix(*out, ".gz") {
+		gzipOutput = true
+	}
+	if streaming && *esURL != "" {
+		exitWith(exitUsageError, errors.New("-es-url can't be used with -format ndjson, streamed settings aren't kept"))
+	}
+	if streaming && *kafkaBrokers != "" {
+		exitWith(exitUsageError, errors.New("-kafka-brokers can't be used with -format ndjson, streamed settings aren't kept"))
+	}
+	if streaming && len(sinkPlugins) > 0 {
+		exitWith(exitUsageError, errors.New("-sink-plugin can't be used with -format ndjson, streamed settings aren't kept"))
+	}
+	var pluginSinks []*pluginSink
+	for _, spec := range sinkPlugins {
+		sink, err := newPluginSink(spec)
 		if err != nil {
-			panic(err)
+			exitWith(exitUsageError, err)
+		}
+		pluginSinks = append(pluginSinks, sink)
+	}
+	if *splitBy != "" {
+		if *splitBy != "package" && *splitBy != "module" {
+			exitWith(exitUsageError, fmt.Errorf("-split-by must be package or module, got %q", *splitBy))
+		}
+		if streaming {
+			exitWith(exitUsageError, errors.New("-split-by can't be used with -format ndjson"))
+		}
+		if *out == "-" {
+			exitWith(exitUsageError, errors.New("-split-by writes a directory, it can't be written to stdout"))
+		}
+	}
+	var maxOutputSize int64
+	if *maxOutputSizeFlag != "" {
+		var err error
+		if maxOutputSize, err = parseSize(*maxOutputSizeFlag); err != nil {
+			exitWith(exitUsageError, err)
+		}
+		if *splitBy != "" {
+			exitWith(exitUsageError, errors.New("-max-output-size can't be used with -split-by"))
+		}
+		if streaming {
+			exitWith(exitUsageError, errors.New("-max-output-size can't be used with -format ndjson"))
+		}
+		if *out == "-" {
+			exitWith(exitUsageError, errors.New("-max-output-size writes a directory, it can't be written to stdout"))
+		}
+	}
+	if *splitBy == "" && maxOutputSize == 0 && len(formats) > 1 && *out != "" {
+		exitWith(exitUsageError, errors.New("-out can only be used with a single format, several are written to elasticsearchSettings.<format>"))
+	}
+	if isObjectURL(*out) {
+		if _, _, err := splitObjectURL(*out); err != nil {
+			exitWith(exitUsageError, err)
 		}
-		if reflect.TypeOf(res.UAST).Name() != "Node" {
-			fmt.Errorf("Node must be the root of a UAST")
+	}
+	if _, ok := encoders[formats[0]].(fileEncoder); ok && *out == "-" {
+		exitWith(exitUsageError, fmt.Errorf("-format %s can't be written to stdout", formats[0]))
+	}
+	if streaming && *out == "" {
+		*out = "elasticsearchSettings.ndjson"
+		if gzipOutput {
+			*out += ".gz"
 		}
+	}
 
-		settings := getSettings(res.UAST, filePath)
-		elasticsearchSettings = append(elasticsearchSettings, settings...)
+	// Extractors with an output file given on the command line run on top
+	// of the -extractors ones, the others write to their default file
+	outputFiles := map[string]*string{
+		"build-settings":    buildSettingsFile,
+		"painless":          painlessFile,
+		"analysis":          analysisFile,
+		"dsl":               dslFile,
+		"system-indices":    systemIndicesFile,
+		"transport-actions": transportActionsFile,
+		"stats-fields":      statsFieldsFile,
+		"cat-columns":       catColumnsFile,
+		"rest":              restFile,
+		"factories":         factoriesFile,
+		"wrappers":          wrappersFile,
+	}
+	names := strings.Split(*extractorsFlag, ",")
+	for _, e := range extractors {
+		if file, ok := outputFiles[e.name]; ok && *file != "" {
+			names = append(names, e.name)
+		}
+	}
+	enabled, err := resolveExtractors(names)
+	if err != nil {
+		exitWith(exitUsageError, err)
+	}
+	enabledExtractors = enabled
+	for _, e := range enabledExtractors {
+		runManifest.Extractors = append(runManifest.Extractors, e.name)
+		if file, ok := outputFiles[e.name]; ok && *file == "" {
+			*file = e.defaultFile
+		}
 	}
 
-	return nil
-}
+	maxFailureRate, err := parseRate(*maxFailureRateFlag)
+	if err != nil {
+		exitWith(exitUsageError, err)
+	}
 
-func main() {
-	client, _ := bblfsh.NewClient("localhost:9432")
+	if *sampleFlag != "" {
+		if sampleRate, err = parseRate(*sampleFlag); err != nil {
+			exitWith(exitUsageError, fmt.Errorf("-sample: %v", err))
+		}
+	}
+	if fileLimit < 0 {
+		exitWith(exitUsageError, errors.New("-limit can't be negative"))
+	}
+	if quarantineAfter < 1 {
+		exitWith(exitUsageError, errors.New("-quarantine-after has to be at least 1"))
+	}
+	if quarantineFile != "" {
+		if err := loadQuarantine(); err != nil {
+			exitWith(exitUsageError, fmt.Errorf("-quarantine: %v", err))
+		}
+	}
+
+	if incremental && uastCacheDir == "" {
+		exitWith(exitUsageError, errors.New("-incremental needs -uast-cache, where the settings of every file are kept"))
+	}
+
+	var cacheMaxSize int64
+	if *cacheMaxSizeFlag != "" {
+		cacheMaxSize, err = parseSize(*cacheMaxSizeFlag)
+		if err != nil {
+			exitWith(exitUsageError, err)
+		}
+	}
+
+	if offline && *uastStoreFile == "" {
+		exitWith(exitUsageError, errors.New("-offline needs -uast-store, the files are parsed from it"))
+	}
+	lockedDirs := []string{}
+	if uastCacheDir != "" {
+		lockedDirs = append(lockedDirs, uastCacheDir)
+	}
+	if *out != "-" && !isObjectURL(*out) {
+		lockedDirs = append(lockedDirs, filepath.Dir(*out))
+	}
+	if err := acquireRunLocks(lockedDirs, *wait && !*noWait); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	if *uastStoreFile != "" {
+		if err := openUASTStore(*uastStoreFile); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		defer closeUASTStore()
+	}
+
+	var client *bblfsh.Client
+	if !offline {
+		client, err = bblfsh.NewClient(config.BblfshEndpoint)
+		if err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
 	bblfshClient = client
-	rootDir = "/home/nick/personal/elasticsearch"
-	err := filepath.Walk(path.Join(rootDir, "server", "src", "main", "java", "org", "elasticsearch"), processFile)
+	rootDir = config.SourceRoot
+
+	codeOwners, err = readCodeOwners(rootDir)
 	if err != nil {
-		panic(err)
+		exitWith(exitRuntimeError, err)
+	}
+
+	if err := loadSettingMetrics(*metricsMapFile); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	if *scriptFile != "" {
+		script, err := loadSettingScript(*scriptFile)
+		if err != nil {
+			exitWith(exitUsageError, err)
+		}
+		settingsScript = script
+	}
+
+	var streamUpload *os.File
+	var streamFile *atomicFile
+	var streamGzip *gzip.Writer
+	if streaming && extractorEnabled("settings") {
+		w := os.Stdout
+		if isObjectURL(*out) {
+			// Streamed to a temporary file, uploaded once complete
+			w, err = ioutil.TempFile("", "elasticsearch-bblfsh-*.ndjson")
+			if err != nil {
+				exitWith(exitRuntimeError, err)
+			}
+			streamUpload = w
+			defer os.Remove(w.Name())
+		} else if *out != "-" {
+			// Streamed under a temporary name, for a run that fails not to
+			// leave a truncated file in place of the previous one
+			if streamFile, err = createAtomic(*out); err != nil {
+				exitWith(exitRuntimeError, err)
+			}
+			w = streamFile.File
+		}
+		if gzipOutput {
+			streamGzip = gzip.NewWriter(w)
+			settingsStream = json.NewEncoder(streamGzip)
+		} else {
+			settingsStream = json.NewEncoder(w)
+		}
+	}
+
+	if affixExamples && settingsStream != nil {
+		exitWith(exitUsageError, errors.New("-affix-examples can't be used with -format ndjson, the settings are written before the examples are looked for"))
+	}
+	if *resume && checkpointFile == "" {
+		exitWith(exitUsageError, errors.New("-resume needs the -checkpoint to resume from"))
+	}
+	if checkpointFile != "" {
+		if err := checkpointSupported(); err != nil {
+			exitWith(exitUsageError, err)
+		}
+		checkpointPaths = *paths
+	}
+
+	if *watch {
+		others := map[string]bool{
+			"-split-by":        *splitBy != "",
+			"-max-output-size": maxOutputSize > 0,
+			"-es-url":          *esURL != "",
+			"-kafka-brokers":   *kafkaBrokers != "",
+			"-sink-plugin":     len(sinkPlugins) > 0,
+			"-checkpoint":      checkpointFile != "",
+		}
+		if err := watchSupported(streaming, others); err != nil {
+			exitWith(exitUsageError, err)
+		}
+	}
+
+	if *manifestFile != "" {
+		readPreviousSummary(*manifestFile)
+	}
+	startManifest(client)
+	if uastStore != nil && !offline {
+		if err := recordStoreVersions(); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+	if uastCacheDir != "" && extractorEnabled("constants") {
+		if err := loadConstantIndex(); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+	if !quiet && !*noProgress && isTerminal(os.Stderr) {
+		runProgress = newProgress(os.Stderr, countJavaFiles(rootDir, strings.Split(*paths, ",")))
+	}
+	if *resume {
+		if err := resumeCheckpoint(); err != nil {
+			runProgress.clear()
+			exitWith(exitRuntimeError, err)
+		}
+	}
+	lastCheckpoint = time.Now()
+	handleShutdownSignals("writing what was extracted so far")
+	err = nil
+	if priorityFile != "" {
+		err = scanDensePackages(strings.Split(*paths, ","))
+	}
+	for _, dir := range strings.Split(*paths, ",") {
+		if err == nil {
+			err = filepath.Walk(path.Join(rootDir, strings.TrimSpace(dir)), processFile)
+		}
+		if err == filepath.SkipAll {
+			// The -limit was reached by the packages scanned first
+			break
+		}
+		if err == errInterrupted {
+			runManifest.Interrupted = true
+			break
+		}
+		if err != nil {
+			runProgress.clear()
+			// Keep what was done so far for -resume
+			if err := writeCheckpoint(true); err != nil {
+				logger.Warn("writing the checkpoint failed", "file", checkpointFile, "error", err)
+			}
+			exitWith(exitRuntimeError, err)
+		}
+	}
+	runProgress.clear()
+	runProgress = nil
+
+	// A run failing from here on resumes with nothing left to walk, one
+	// that completes doesn't need its checkpoint anymore
+	if err := writeCheckpoint(true); err != nil {
+		logger.Warn("writing the checkpoint failed", "file", checkpointFile, "error", err)
+	}
+	if err := writeQuarantine(); err != nil {
+		logger.Warn("writing the quarantine failed", "file", quarantineFile, "error", err)
+	}
+	if err := writePackageRanking(); err != nil {
+		logger.Warn("writing the package ranking failed", "file", priorityFile, "error", err)
+	}
+	if runManifest.Interrupted {
+		// Whatever way the rest of the run returns, the output is written
+		// but incomplete
+		defer func() {
+			closeUASTStore()
+			err := fmt.Errorf("interrupted after %d files, the output is partial", len(runManifest.Files))
+			if checkpointFile != "" {
+				err = fmt.Errorf("%v, run again with -resume to complete it", err)
+			}
+			exitWith(exitInterrupted, err)
+		}()
+	} else {
+		defer removeCheckpoint()
+	}
+
+	var watchedSettings []ElasticsearchSetting
+	if settingsStream == nil {
+		if affixExamples {
+			if err := findAffixExamples(rootDir, elasticsearchSettings); err != nil {
+				exitWith(exitRuntimeError, err)
+			}
+		}
+		if *watch {
+			// Finishing changes the settings in place, -watch finishes them
+			// anew on every change
+			watchedSettings = append([]ElasticsearchSetting(nil), elasticsearchSettings...)
+		}
+		if elasticsearchSettings, err = finishSettings(elasticsearchSettings, true); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+
+	if uastCacheDir != "" && extractorEnabled("constants") {
+		if err := writeConstantIndex(); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+	if uastCacheDir != "" && cacheMaxSize > 0 {
+		if err := pruneUASTCache(uastCacheDir, cacheMaxSize); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+
+	// Don't overwrite a previous good extraction with one that's missing
+	// a large part of the tree, e.g. because the java driver is broken. The
+	// check comes before any output is written, the manifest and the
+	// outputs of the other extractors included
+	if failureRateExceeded(maxFailureRate) {
+		printRunSummary(os.Stderr)
+		exitWith(exitParseFailures, fmt.Errorf("%d of %d files failed to parse, above the allowed %s", filesFailed, filesParsed, *maxFailureRateFlag))
+	}
+
+	for _, e := range enabledExtractors {
+		if e.write == nil || e.name == "settings" {
+			continue
+		}
+		if err := e.write(*outputFiles[e.name]); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		recordOutput(*outputFiles[e.name])
 	}
 
-	b, _ := json.Marshal(elasticsearchSettings)
+	if *manifestFile != "" {
+		if err := writeManifest(*manifestFile); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		recordOutput(*manifestFile)
+	}
+	if *timingsFile != "" {
+		if err := writeTimingsCSV(*timingsFile); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		recordOutput(*timingsFile)
+	}
+
+	if streamGzip != nil {
+		if err := streamGzip.Close(); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+	if streamFile != nil {
+		if err := streamFile.commit(); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+	if streamUpload != nil {
+		streamUpload.Close()
+		if err := uploadObject(*out, streamUpload.Name()); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
 
-	err = ioutil.WriteFile("elasticsearchSettings.json", b, 0644)
+	if settingsStream != nil {
+		recordOutput(*out)
+	}
+	if settingsStream != nil || !extractorEnabled("settings") {
+		printRunSummary(os.Stderr)
+		return
+	}
+
+	doc := newSettingsDocument(rootDir, elasticsearchSettings)
+	doc.Partial = runManifest.Interrupted || sampledRun()
+	if redactPaths {
+		doc.SourceRoot = redacted
+	}
+	sortSettings(doc.Settings)
+
+	if *esURL != "" {
+		if err := newESSink(*esURL, *esIndex, *esUser).indexDocument(doc); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		index := strings.TrimSuffix(*esURL, "/") + "/" + *esIndex
+		if err := publishedDocument("elasticsearch", index, doc); err != nil {
+			exitWith(exitRuntimeError, fmt.Errorf("recording the publication to %s failed: %v", index, err))
+		}
+		recordOutput(index)
+	}
+	if *kafkaBrokers != "" {
+		if err := newKafkaSink(*kafkaBrokers, *kafkaTopic, *kafkaTLS).publishDocument(doc); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		if err := publishedDocument("kafka", *kafkaBrokers+"/"+*kafkaTopic, doc); err != nil {
+			exitWith(exitRuntimeError, fmt.Errorf("recording the publication to Kafka topic %s failed: %v", *kafkaTopic, err))
+		}
+		recordOutput("Kafka topic " + *kafkaTopic)
+	}
+	for _, sink := range pluginSinks {
+		if err := sink.publishDocument(doc); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		if err := publishedDocument("sink-plugin", sink.command, doc); err != nil {
+			exitWith(exitRuntimeError, fmt.Errorf("recording the publication to sink plugin %s failed: %v", sink.command, err))
+		}
+		recordOutput("sink plugin " + sink.command)
+	}
+
+	if *splitBy != "" {
+		dir := *out
+		if dir == "" {
+			dir = "elasticsearchSettings"
+		}
+		if err := writeSplitOutput(dir, *splitBy, formats, doc); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		recordOutput(dir)
+		printRunSummary(os.Stderr)
+		return
+	}
+	if maxOutputSize > 0 {
+		dir := *out
+		if dir == "" {
+			dir = "elasticsearchSettings"
+		}
+		if err := writeChunkedOutput(dir, maxOutputSize, formats, doc); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		recordOutput(dir)
+		printRunSummary(os.Stderr)
+		return
+	}
+
+	outputFile := func(e Encoder) string {
+		if *out != "" {
+			return *out
+		}
+		fileName := "elasticsearchSettings" + e.Extension()
+		if gzipOutput {
+			fileName += ".gz"
+		}
+		return fileName
+	}
+	for _, format := range formats {
+		e := encoders[format]
+		if err := encodeOutput(e, outputFile(e), doc); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		recordOutput(outputFile(e))
+	}
+	if tableToTerminal {
+		if err := writeSettingsTable(os.Stdout, doc); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+	printRunSummary(os.Stderr)
+
+	if *watch && !runManifest.Interrupted {
+		// Files already processed are processed again when they change
+		resumedFiles, scannedFirst = map[string]bool{}, map[string]bool{}
+		watcher, err := newSettingsWatcher(strings.Split(*paths, ","), watchedSettings, func(settings []ElasticsearchSetting) error {
+			doc := newSettingsDocument(rootDir, settings)
+			if redactPaths {
+				doc.SourceRoot = redacted
+			}
+			sortSettings(doc.Settings)
+			for _, format := range formats {
+				e := encoders[format]
+				if err := encodeOutput(e, outputFile(e), doc); err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		if err := watcher.run(); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
 }
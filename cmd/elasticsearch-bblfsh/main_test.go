@@ -0,0 +1,38 @@
+package main
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	for value, want := range map[string]float64{"0%": 0, "1%": 0.01, "0.5": 0.5, "100%": 1} {
+		got, err := parseRate(value)
+		if err != nil || got != want {
+			t.Errorf("parseRate(%q) = %v, %v, want %v", value, got, err, want)
+		}
+	}
+	for _, value := range []string{"", "abc", "-1%", "150%"} {
+		if _, err := parseRate(value); err == nil {
+			t.Errorf("parseRate(%q) gave no error", value)
+		}
+	}
+}
+
+func TestFailureRateExceeded(t *testing.T) {
+	defer func(parsed, failed int) { filesParsed, filesFailed = parsed, failed }(filesParsed, filesFailed)
+
+	for _, tc := range []struct {
+		parsed, failed int
+		maxRate        float64
+		want           bool
+	}{
+		{0, 0, 0, false},
+		{100, 0, 0, false},
+		{100, 1, 0, true},
+		{100, 1, 0.01, false},
+		{100, 2, 0.01, true},
+	} {
+		filesParsed, filesFailed = tc.parsed, tc.failed
+		if got := failureRateExceeded(tc.maxRate); got != tc.want {
+			t.Errorf("%d of %d failed with %v allowed: got %v, want %v", tc.failed, tc.parsed, tc.maxRate, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/fs"
+	"io/ioutil"
+	"time"
+
+	javaextractor "github.com/nickcanz/elasticsearch-bblfsh/extractor"
+	"gopkg.in/bblfsh/client-go.v2"
+)
+
+// ruleSources are the files of the settings and constants extractors: their
+// UAST queries, and the code reading the hits and normalizing the values.
+// main.go isn't one, changing a flag or an output doesn't throw away the
+// settings -incremental runs cached.
+//
+//go:embed settings.go constants.go constantindex.go wrappers.go values.go
+var ruleSources embed.FS
+
+// rulesVersion identifies the rules settings are extracted with, for
+// extractions made with different rules to be told apart. It's a hash of
+// their code rather than a number to bump, which changes with any query.
+var rulesVersion = hashRules()
+
+func hashRules() string {
+	h := sha256.New()
+	h.Write([]byte(javaextractor.RulesHash()))
+	entries, _ := fs.ReadDir(ruleSources, ".")
+	for _, e := range entries {
+		b, _ := ruleSources.ReadFile(e.Name())
+		h.Write(b)
+	}
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// FileOutcome records what happened to a single file during a run. Error
+// is the category of the error a failed file hit, the messages of a sample
+// of them are in the errors of the manifest. DurationMs is split between
+// getting the UAST, from bblfshd or the cache, and running the extractors.
+type FileOutcome struct {
+	File     string `json:"file"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Settings int    `json:"settings"`
+	Cached   bool   `json:"cached,omitempty"`
+	// Unchanged files had their settings reused by an -incremental run
+	Unchanged  bool  `json:"unchanged,omitempty"`
+	Size       int64 `json:"size"`
+	ParseMs    int64 `json:"parse_ms"`
+	ExtractMs  int64 `json:"extract_ms"`
+	DurationMs int64 `json:"duration_ms"`
+}
+
+// RunManifest records the provenance of an extraction: its inputs, the
+// outcome of every file and how long it took. It's written next to the
+// settings catalog rather than inside it so the catalog stays small.
+type RunManifest struct {
+	BuildInfo
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	DurationMs int64     `json:"duration_ms"`
+
+	Flags          map[string]string `json:"flags"`
+	RulesVersion   string            `json:"rules_version"`
+	BblfshdVersion string            `json:"bblfshd_version"`
+	DriverVersion  string            `json:"driver_version"`
+	// Extractors are the extractors that ran, including the ones enabled
+	// as a dependency of another
+	Extractors []string `json:"extractors"`
+	// Interrupted runs were stopped by a signal before the walk was done
+	Interrupted bool `json:"interrupted,omitempty"`
+
+	Summary RunSummary      `json:"summary"`
+	Files   []FileOutcome   `json:"files"`
+	Errors  []ErrorCategory `json:"errors,omitempty"`
+}
+
+var runManifest RunManifest
+
+func startManifest(client *bblfsh.Client) {
+	runManifest.BuildInfo = buildInfo()
+	runManifest.StartedAt = time.Now().UTC()
+	runManifest.RulesVersion = rulesVersion
+
+	runManifest.Flags = map[string]string{}
+	flag.VisitAll(func(f *flag.Flag) {
+		runManifest.Flags[f.Name] = f.Value.String()
+	})
+
+	// -offline runs parse with the bblfshd that filled the store
+	if client == nil {
+		runManifest.BblfshdVersion, runManifest.DriverVersion = storedVersions()
+		return
+	}
+
+	// Versions are best effort, a bblfshd that can't report them can
+	// still parse files
+	if res, err := client.NewVersionRequest().Do(); err == nil {
+		runManifest.BblfshdVersion = res.Version
+	}
+	if res, err := client.NewSupportedLanguagesRequest().Do(); err == nil {
+		for _, driver := range res.Languages {
+			if driver.Language == "java" {
+				runManifest.DriverVersion = driver.Version
+			}
+		}
+	}
+}
+
+// recordFileOutcome records a file processed between started and now, which
+// was parsed at parsed.
+func recordFileOutcome(file string, size int64, started, parsed time.Time, settings int, cached bool, err error) {
+	now := time.Now()
+	outcome := FileOutcome{
+		File:       file,
+		Status:     "ok",
+		Settings:   settings,
+		Cached:     cached,
+		Size:       size,
+		ParseMs:    parsed.Sub(started).Nanoseconds() / int64(time.Millisecond),
+		ExtractMs:  now.Sub(parsed).Nanoseconds() / int64(time.Millisecond),
+		DurationMs: now.Sub(started).Nanoseconds() / int64(time.Millisecond),
+	}
+	if err != nil {
+		outcome.Status = "failed"
+		outcome.Error = reportFileError(file, err)
+	}
+	runManifest.Files = append(runManifest.Files, outcome)
+	runProgress.update(settings, err != nil)
+	runMetrics.observeFile(parsed.Sub(started), cached, err != nil, settings)
+}
+
+func writeManifest(fileName string) error {
+	runManifest.FinishedAt = time.Now().UTC()
+	runManifest.DurationMs = runManifest.FinishedAt.Sub(runManifest.StartedAt).Nanoseconds() / int64(time.Millisecond)
+	runManifest.Errors = runErrors.summary()
+	runManifest.Summary = runSummary()
+
+	if redactPaths {
+		redactManifest(&runManifest)
+	}
+
+	b, err := json.MarshalIndent(runManifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(fileName, b, 0644)
+}
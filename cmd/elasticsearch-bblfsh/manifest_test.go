@@ -0,0 +1,18 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestRulesVersion(t *testing.T) {
+	if !regexp.MustCompile(`^[0-9a-f]{12}$`).MatchString(rulesVersion) {
+		t.Errorf("rulesVersion = %q, want 12 hex digits", rulesVersion)
+	}
+	if hashRules() != rulesVersion {
+		t.Error("the rules hash isn't stable")
+	}
+	if _, err := ruleSources.ReadFile("settings.go"); err != nil {
+		t.Error("the settings extractor isn't among the rules:", err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+)
+
+// defaultMetricsMap pairs settings controlling sizes and limits with the node
+// stats metrics showing how close a node is to them. It's curated by hand,
+// the metrics can't be derived from the code declaring the settings.
+//
+//go:embed metrics.json
+var defaultMetricsMap []byte
+
+// settingMetrics maps setting names to their related node stats metric
+// paths, with * standing for the node id.
+var settingMetrics map[string][]string
+
+// loadSettingMetrics reads the built-in mapping and merges the one in
+// fileName, if any, over it. Entries in fileName replace built-in ones for the
+// same setting, an empty list removes them.
+func loadSettingMetrics(fileName string) error {
+	settingMetrics = map[string][]string{}
+	if err := json.Unmarshal(defaultMetricsMap, &settingMetrics); err != nil {
+		return err
+	}
+	if fileName == "" {
+		return nil
+	}
+
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+	var extra map[string][]string
+	if err := json.Unmarshal(b, &extra); err != nil {
+		return fmt.Errorf("%s: %v", fileName, err)
+	}
+	for name, metrics := range extra {
+		if len(metrics) == 0 {
+			delete(settingMetrics, name)
+			continue
+		}
+		settingMetrics[name] = metrics
+	}
+	return nil
+}
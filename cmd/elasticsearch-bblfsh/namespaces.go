@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// NamespaceViolation is a setting outside the approved namespaces.
+type NamespaceViolation struct {
+	Name     string `json:"name"`
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// NamespaceReport is the output of the namespaces subcommand.
+type NamespaceReport struct {
+	BuildInfo
+	Approved []string `json:"approved"`
+	// Checked is how many settings were checked, only the ones the fork
+	// added when compared with an upstream extraction
+	Checked int                  `json:"checked"`
+	Outside []NamespaceViolation `json:"outside"`
+}
+
+// inNamespace tells whether a setting key is in a namespace, i.e.
+// acme.search.timeout in acme. A namespace covers whole segments, acme
+// doesn't cover acmecorp.timeout.
+func inNamespace(name, namespace string) bool {
+	namespace = strings.TrimSuffix(namespace, ".")
+	return name == namespace || strings.HasPrefix(name, namespace+".")
+}
+
+// checkNamespaces returns the settings outside the approved namespaces.
+// With upstream settings, only the ones the fork added are checked, the
+// settings it shares with upstream are upstream's to name.
+func checkNamespaces(settings, upstream []ElasticsearchSetting, approved []string) NamespaceReport {
+	report := NamespaceReport{BuildInfo: buildInfo(), Approved: approved, Outside: []NamespaceViolation{}}
+	upstreamNames := settingsByName(upstream)
+
+	for _, s := range settings {
+		if _, ok := upstreamNames[s.Name]; ok {
+			continue
+		}
+		report.Checked++
+		covered := false
+		for _, namespace := range approved {
+			if inNamespace(s.Name, namespace) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			report.Outside = append(report.Outside, NamespaceViolation{Name: s.Name, CodeLine: s.CodeLine, CodeFile: s.CodeFile})
+		}
+	}
+
+	sort.Slice(report.Outside, func(i, j int) bool {
+		return report.Outside[i].Name < report.Outside[j].Name
+	})
+	return report
+}
+
+func runNamespaces(args []string) {
+	flags := flag.NewFlagSet("namespaces", flag.ExitOnError)
+	var allowed stringsFlag
+	flags.Var(&allowed, "allow", "approved namespace, i.e. acme, can be given several times (default the namespaces of the config file)")
+	upstreamFile := flags.String("upstream", "", "extraction of the upstream version the fork is based on, to only check the settings the fork added")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh namespaces [-allow namespace...] [-upstream upstream.json] <settings.json>")
+		fmt.Fprintln(os.Stderr, "Lists the settings outside the approved namespaces, so the settings a fork adds stay in its own and don't collide with upstream ones on upgrades.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	approved := []string(allowed)
+	if len(approved) == 0 {
+		config, err := loadConfig()
+		if err != nil {
+			exitWith(exitUsageError, err)
+		}
+		approved = config.Namespaces
+	}
+	if len(approved) == 0 {
+		exitWith(exitUsageError, errors.New("no approved namespaces, give them with -allow or in the namespaces of the config file"))
+	}
+
+	settings, err := readSettings(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	var upstream []ElasticsearchSetting
+	if *upstreamFile != "" {
+		if upstream, err = readSettings(*upstreamFile); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	}
+
+	report := checkNamespaces(settings, upstream, approved)
+
+	if *asJSON {
+		if err := writeJSON("-", report); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	} else if len(report.Outside) == 0 {
+		fmt.Printf("all %d settings checked are in %s\n", report.Checked, strings.Join(approved, ", "))
+	} else {
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "SETTING\tDECLARED IN")
+		for _, v := range report.Outside {
+			fmt.Fprintf(w, "%s\t%s:%d\n", v.Name, v.CodeFile, v.CodeLine)
+		}
+		w.Flush()
+		fmt.Printf("%d of the %d settings checked are outside %s\n", len(report.Outside), report.Checked, strings.Join(approved, ", "))
+	}
+
+	if len(report.Outside) > 0 {
+		exitWith(exitLintFindings, nil)
+	}
+}
@@ -0,0 +1,427 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Output files can be uploaded to S3 or Google Cloud Storage instead of
+// written locally. Both are signed by hand, like the Elasticsearch sink,
+// rather than pulling in the cloud SDKs for a single PUT.
+
+var objectStoreClient = &http.Client{Timeout: 5 * time.Minute}
+
+// isObjectURL reports whether an output is an s3:// or gs:// URL.
+func isObjectURL(fileName string) bool {
+	return strings.HasPrefix(fileName, "s3://") || strings.HasPrefix(fileName, "gs://")
+}
+
+// splitObjectURL splits s3://bucket/key into its bucket and key.
+func splitObjectURL(objectURL string) (string, string, error) {
+	u, err := url.Parse(objectURL)
+	if err != nil {
+		return "", "", err
+	}
+	key := strings.TrimPrefix(u.Path, "/")
+	if u.Host == "" || key == "" || strings.HasSuffix(key, "/") {
+		return "", "", fmt.Errorf("%s: expected %s://bucket/path/to/object", objectURL, u.Scheme)
+	}
+	return u.Host, key, nil
+}
+
+func contentTypeOf(key string) string {
+	switch path.Ext(key) {
+	case ".json":
+		return "application/json"
+	case ".ndjson":
+		return "application/x-ndjson"
+	case ".yaml":
+		return "application/yaml"
+	case ".csv":
+		return "text/csv"
+	case ".gz":
+		return "application/gzip"
+	}
+	if t := mime.TypeByExtension(path.Ext(key)); t != "" {
+		return t
+	}
+	return "application/octet-stream"
+}
+
+// uploadObject uploads a local file to an s3:// or gs:// URL.
+func uploadObject(objectURL, fileName string) error {
+	bucket, key, err := splitObjectURL(objectURL)
+	if err != nil {
+		return err
+	}
+	body, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return err
+	}
+
+	var req *http.Request
+	if strings.HasPrefix(objectURL, "s3://") {
+		req, err = s3PutRequest(bucket, key, body)
+	} else {
+		req, err = gcsUploadRequest(bucket, key, body)
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %v", objectURL, err)
+	}
+
+	backoff := time.Second
+	for attempt := 0; ; attempt++ {
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+		res, err := objectStoreClient.Do(req)
+		if err != nil {
+			return fmt.Errorf("%s: %v", objectURL, err)
+		}
+		b, _ := ioutil.ReadAll(res.Body)
+		res.Body.Close()
+
+		// Both stores ask clients to back off with 429s and 503s
+		if (res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable) && attempt < 3 {
+			time.Sleep(backoff)
+			backoff *= 2
+			continue
+		}
+		if res.StatusCode/100 != 2 {
+			return fmt.Errorf("%s: upload failed with %s: %s", objectURL, res.Status, bytes.TrimSpace(b))
+		}
+		if err := recordPublication(objectURL[:strings.Index(objectURL, ":")], objectURL, hashBytes(body), 0); err != nil {
+			return fmt.Errorf("%s was uploaded but recording it in the -publication-log failed: %v", objectURL, err)
+		}
+		return nil
+	}
+}
+
+// encodeOutput encodes the document to a file, or to a temporary file it
+// then compresses with -gzip or uploads for s3:// and gs:// URLs.
+func encodeOutput(e Encoder, fileName string, doc SettingsDocument) error {
+	if !isObjectURL(fileName) && !gzipOutput {
+		return e.Encode(fileName, doc)
+	}
+
+	dir, err := ioutil.TempDir("", "elasticsearch-bblfsh")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	tmp := filepath.Join(dir, "settings"+e.Extension())
+	if err := e.Encode(tmp, doc); err != nil {
+		return err
+	}
+	if gzipOutput {
+		if !isObjectURL(fileName) {
+			return gzipFile(tmp, fileName)
+		}
+		if err := gzipFile(tmp, tmp+".gz"); err != nil {
+			return err
+		}
+		tmp += ".gz"
+	}
+	return uploadObject(fileName, tmp)
+}
+
+type awsCredentials struct {
+	accessKeyID, secretAccessKey, sessionToken string
+}
+
+// loadAWSCredentials reads the credentials from AWS_ACCESS_KEY_ID and
+// AWS_SECRET_ACCESS_KEY, or else from the AWS_PROFILE profile of the shared
+// credentials file.
+func loadAWSCredentials() (awsCredentials, error) {
+	if id := os.Getenv("AWS_ACCESS_KEY_ID"); id != "" {
+		return awsCredentials{id, os.Getenv("AWS_SECRET_ACCESS_KEY"), os.Getenv("AWS_SESSION_TOKEN")}, nil
+	}
+
+	fileName := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if fileName == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return awsCredentials{}, err
+		}
+		fileName = filepath.Join(home, ".aws", "credentials")
+	}
+	profile := os.Getenv("AWS_PROFILE")
+	if profile == "" {
+		profile = "default"
+	}
+
+	f, err := os.Open(fileName)
+	if err != nil {
+		return awsCredentials{}, errors.New("no AWS credentials, set AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY or configure a profile in ~/.aws/credentials")
+	}
+	defer f.Close()
+
+	var creds awsCredentials
+	var section string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			continue
+		}
+		parts := strings.SplitN(line, "=", 2)
+		if section != profile || len(parts) != 2 {
+			continue
+		}
+		value := strings.TrimSpace(parts[1])
+		switch strings.TrimSpace(parts[0]) {
+		case "aws_access_key_id":
+			creds.accessKeyID = value
+		case "aws_secret_access_key":
+			creds.secretAccessKey = value
+		case "aws_session_token":
+			creds.sessionToken = value
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return awsCredentials{}, err
+	}
+	if creds.accessKeyID == "" {
+		return awsCredentials{}, fmt.Errorf("no profile %q in %s", profile, fileName)
+	}
+	return creds, nil
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3EscapePath escapes an object key the way Signature Version 4 expects,
+// everything but unreserved characters and slashes.
+func s3EscapePath(key string) string {
+	var b strings.Builder
+	for _, c := range []byte(key) {
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || strings.IndexByte("-_.~/", c) >= 0 {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// signAWSV4 signs a request without a query string with Signature Version
+// 4, over all of its headers and the hash of its payload.
+func signAWSV4(req *http.Request, creds awsCredentials, region, service string, payloadHash [sha256.Size]byte, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if creds.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", creds.sessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(values[0])
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		"",
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	scope := day + "/" + region + "/" + service + "/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	signingKey := hmacSHA256([]byte("AWS4"+creds.secretAccessKey), day)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", creds.accessKeyID, scope, signedHeaders, signature))
+}
+
+// s3PutRequest returns a PutObject request signed with Signature Version 4.
+// AWS_ENDPOINT_URL_S3 or AWS_ENDPOINT_URL point it at an S3 compatible
+// store like MinIO, with path style addressing.
+func s3PutRequest(bucket, key string, body []byte) (*http.Request, error) {
+	creds, err := loadAWSCredentials()
+	if err != nil {
+		return nil, err
+	}
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		region = "us-east-1"
+	}
+
+	endpoint := os.Getenv("AWS_ENDPOINT_URL_S3")
+	if endpoint == "" {
+		endpoint = os.Getenv("AWS_ENDPOINT_URL")
+	}
+	var objectPath string
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://%s.s3.%s.amazonaws.com", bucket, region)
+		objectPath = "/" + s3EscapePath(key)
+	} else {
+		objectPath = "/" + bucket + "/" + s3EscapePath(key)
+	}
+
+	req, err := http.NewRequest("PUT", strings.TrimSuffix(endpoint, "/")+objectPath, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.URL.RawPath = objectPath
+	req.Header.Set("Content-Type", contentTypeOf(key))
+	signAWSV4(req, creds, region, "s3", sha256.Sum256(body), time.Now())
+	return req, nil
+}
+
+// gcsServiceAccount is the part of a service account key file needed to get
+// an access token.
+type gcsServiceAccount struct {
+	ClientEmail string `json:"client_email"`
+	PrivateKey  string `json:"private_key"`
+	TokenURI    string `json:"token_uri"`
+}
+
+// gcsAccessToken returns GOOGLE_OAUTH_ACCESS_TOKEN, i.e. from
+// gcloud auth print-access-token, or else exchanges a JWT signed with the
+// GOOGLE_APPLICATION_CREDENTIALS service account key for a token.
+func gcsAccessToken() (string, error) {
+	if token := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); token != "" {
+		return token, nil
+	}
+	keyFile := os.Getenv("GOOGLE_APPLICATION_CREDENTIALS")
+	if keyFile == "" {
+		return "", errors.New("no Google Cloud credentials, set GOOGLE_OAUTH_ACCESS_TOKEN or GOOGLE_APPLICATION_CREDENTIALS to a service account key file")
+	}
+
+	b, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return "", err
+	}
+	var account gcsServiceAccount
+	if err := json.Unmarshal(b, &account); err != nil {
+		return "", fmt.Errorf("%s: %v", keyFile, err)
+	}
+	block, _ := pem.Decode([]byte(account.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("%s: no private key", keyFile)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("%s: %v", keyFile, err)
+	}
+	key, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("%s: the private key isn't an RSA key", keyFile)
+	}
+	if account.TokenURI == "" {
+		account.TokenURI = "https://oauth2.googleapis.com/token"
+	}
+
+	now := time.Now()
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   account.ClientEmail,
+		"scope": "https://www.googleapis.com/auth/devstorage.read_write",
+		"aud":   account.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	encoding := base64.RawURLEncoding
+	unsigned := encoding.EncodeToString([]byte(`{"alg":"RS256","typ":"JWT"}`)) + "." + encoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	res, err := objectStoreClient.PostForm(account.TokenURI, url.Values{
+		"grant_type": {"urn:ietf:params:oauth:grant-type:jwt-bearer"},
+		"assertion":  {unsigned + "." + encoding.EncodeToString(signature)},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error_description"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("getting an access token for %s failed with %s: %s", account.ClientEmail, res.Status, token.Error)
+	}
+	return token.AccessToken, nil
+}
+
+// gcsUploadRequest returns a simple media upload request of the JSON API.
+// STORAGE_EMULATOR_HOST points it at an emulator, without credentials.
+func gcsUploadRequest(bucket, key string, body []byte) (*http.Request, error) {
+	endpoint := "https://storage.googleapis.com"
+	var token string
+	if emulator := os.Getenv("STORAGE_EMULATOR_HOST"); emulator != "" {
+		endpoint = emulator
+		if !strings.Contains(endpoint, "://") {
+			endpoint = "http://" + endpoint
+		}
+	} else {
+		var err error
+		if token, err = gcsAccessToken(); err != nil {
+			return nil, err
+		}
+	}
+
+	query := url.Values{"uploadType": {"media"}, "name": {key}}
+	req, err := http.NewRequest("POST", strings.TrimSuffix(endpoint, "/")+"/upload/storage/v1/b/"+url.PathEscape(bucket)+"/o?"+query.Encode(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentTypeOf(key))
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	return req, nil
+}
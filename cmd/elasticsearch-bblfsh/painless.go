@@ -0,0 +1,172 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// PainlessContext is a script context registered with a ScriptContext
+// instance, e.g. "score" or "ingest".
+type PainlessContext struct {
+	Name string `json:"name"`
+
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// PainlessClass is a class made available to painless scripts by a whitelist
+// file, along with its whitelisted members.
+type PainlessClass struct {
+	Name         string   `json:"name"`
+	Constructors []string `json:"constructors,omitempty"`
+	Methods      []string `json:"methods,omitempty"`
+	Fields       []string `json:"fields,omitempty"`
+
+	CodeFile string `json:"code_file"`
+}
+
+// PainlessCatalog is everything painless scripts can use in a version.
+type PainlessCatalog struct {
+	BuildInfo
+	Contexts      []PainlessContext `json:"contexts"`
+	Classes       []PainlessClass   `json:"classes"`
+	StaticImports []string          `json:"static_imports,omitempty"`
+}
+
+var painlessCatalog PainlessCatalog
+
+func getPainlessContexts(rootNode *uast.Node, fileName string) []PainlessContext {
+	// i.e. public static final ScriptContext<Factory> CONTEXT = new ScriptContext<>("score", Factory.class);
+	query := "//ClassInstanceCreation/ParameterizedType/SimpleType/SimpleName[@token='ScriptContext']/../../.."
+	nodes, _ := tools.Filter(rootNode, query)
+
+	var contexts []PainlessContext
+	for _, n := range nodes {
+		arguments := argumentsOf(n)
+		if len(arguments) == 0 || arguments[0].InternalType != "StringLiteral" {
+			continue
+		}
+		contexts = append(contexts, PainlessContext{
+			Name:     strings.Trim(arguments[0].Token, "\""),
+			CodeLine: n.StartPosition.Line,
+			CodeFile: relativePath(fileName),
+		})
+	}
+
+	return contexts
+}
+
+// getPainlessWhitelists finds the painless whitelist files of the checkout,
+// the text files under a painless resources directory.
+func getPainlessWhitelists(root string) ([]PainlessClass, []string, error) {
+	var classes []PainlessClass
+	var staticImports []string
+
+	err := filepath.Walk(root, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if gradleSkipDirs[info.Name()] || info.Name() == "test" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if path.Ext(filePath) != ".txt" || !strings.Contains(filePath, "/resources/") || !strings.Contains(filePath, "painless") {
+			return nil
+		}
+
+		fileClasses, fileImports, err := parsePainlessWhitelist(filePath)
+		if err != nil {
+			return err
+		}
+		classes = append(classes, fileClasses...)
+		staticImports = append(staticImports, fileImports...)
+		return nil
+	})
+
+	sort.SliceStable(classes, func(i, j int) bool { return classes[i].Name < classes[j].Name })
+	sort.Strings(staticImports)
+
+	return classes, staticImports, err
+}
+
+// parsePainlessWhitelist parses the whitelist format, i.e.
+//
+//	class java.lang.String {
+//	  ()
+//	  int length()
+//	  int CASE_INSENSITIVE_ORDER
+//	}
+//	static_import {
+//	  double saturation(double, double) from_class org.elasticsearch.script.ScoreScriptUtils
+//	}
+func parsePainlessWhitelist(filePath string) ([]PainlessClass, []string, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var classes []PainlessClass
+	var staticImports []string
+	var current *PainlessClass
+	inStaticImport := false
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		line = strings.TrimSpace(line)
+
+		switch {
+		case line == "":
+		case line == "}":
+			if current != nil {
+				classes = append(classes, *current)
+			}
+			current = nil
+			inStaticImport = false
+		case strings.HasPrefix(line, "static_import"):
+			inStaticImport = true
+		case strings.HasPrefix(line, "class "):
+			fields := strings.Fields(strings.TrimSuffix(line, "{"))
+			current = &PainlessClass{Name: fields[1], CodeFile: relativePath(filePath)}
+		case inStaticImport:
+			staticImports = append(staticImports, stripPainlessAnnotations(line))
+		case current != nil:
+			member := stripPainlessAnnotations(line)
+			switch {
+			case strings.HasPrefix(member, "("):
+				current.Constructors = append(current.Constructors, member)
+			case strings.Contains(member, "("):
+				current.Methods = append(current.Methods, member)
+			default:
+				current.Fields = append(current.Fields, member)
+			}
+		}
+	}
+
+	return classes, staticImports, scanner.Err()
+}
+
+// stripPainlessAnnotations removes annotations like @nondeterministic from a
+// whitelist entry so entries compare equal across versions.
+func stripPainlessAnnotations(line string) string {
+	var kept []string
+	for _, field := range strings.Fields(line) {
+		if !strings.HasPrefix(field, "@") {
+			kept = append(kept, field)
+		}
+	}
+	return strings.Join(kept, " ")
+}
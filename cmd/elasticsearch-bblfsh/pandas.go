@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// pandasRow is a row of the tidy table generate pandas writes, one per
+// setting with a column per variable. The CSV, the Parquet file and the
+// column dictionary are all derived from its fields, in order.
+type pandasRow struct {
+	Name                   string    `parquet:"name" description:"Setting name, the Java field name when it couldn't be resolved"`
+	RawName                string    `parquet:"raw_name" description:"Name of the Java field declaring the setting"`
+	JavaType               string    `parquet:"java_type" description:"Type argument of Setting<T>, i.e. Boolean or ByteSizeValue"`
+	Scope                  string    `parquet:"scope" description:"node or index, empty if declared with neither"`
+	Dynamic                bool      `parquet:"dynamic" description:"Whether the setting can be updated on a running cluster or index"`
+	Deprecated             bool      `parquet:"deprecated" description:"Whether the setting is deprecated"`
+	Properties             string    `parquet:"properties" description:"Setting.Property values separated by |, i.e. Dynamic|NodeScope"`
+	DefaultArg             string    `parquet:"default_arg" description:"The default as written in the Java source"`
+	DefaultValue           *float64  `parquet:"default_value,optional" description:"The default as a number in default_unit, missing when computed at runtime"`
+	DefaultUnit            string    `parquet:"default_unit" description:"ratio, bytes, duration_ms, number or boolean, empty when default_value is missing"`
+	Module                 string    `parquet:"module" description:"Module or plugin declaring the setting, i.e. server or modules/repository-s3"`
+	CodeFile               string    `parquet:"code_file" description:"Java file declaring the setting, relative to the Elasticsearch checkout"`
+	CodeLine               int32     `parquet:"code_line" description:"Line of the declaration in code_file"`
+	FirstSeenVersion       string    `parquet:"first_seen_version" description:"Oldest version the setting was seen in, with history"`
+	RemovedInVersion       string    `parquet:"removed_in_version" description:"Version the setting was removed in, for tombstones"`
+	MinIndexCreatedVersion string    `parquet:"min_index_created_version" description:"Oldest version an index has to be created with for the setting to apply"`
+	SourceCommit           string    `parquet:"source_commit" description:"Commit of the Elasticsearch checkout the settings were extracted from"`
+	ExtractedAt            time.Time `parquet:"extracted_at,timestamp" description:"When the settings were extracted, UTC"`
+}
+
+func pandasRows(doc SettingsDocument) []pandasRow {
+	rows := make([]pandasRow, len(doc.Settings))
+	for i, s := range doc.Settings {
+		row := pandasRow{
+			Name:                   displayName(s),
+			RawName:                s.RawName,
+			JavaType:               s.JavaType,
+			Scope:                  s.Scope(),
+			Dynamic:                updateBadge(s) == "dynamic",
+			Deprecated:             hasProperty(s, "Deprecated") || hasProperty(s, "DeprecatedWarning"),
+			Properties:             strings.Join(s.Properties, "|"),
+			DefaultArg:             s.DefaultArg,
+			Module:                 moduleOf(s.CodeFile),
+			CodeFile:               s.CodeFile,
+			CodeLine:               int32(s.CodeLine),
+			FirstSeenVersion:       s.FirstSeenVersion,
+			RemovedInVersion:       s.RemovedInVersion,
+			MinIndexCreatedVersion: s.MinIndexCreatedVersion,
+			SourceCommit:           doc.SourceCommit,
+			ExtractedAt:            doc.ExtractedAt.UTC(),
+		}
+		if n := s.NormalizedDefault; n != nil {
+			value := n.Value
+			row.DefaultValue, row.DefaultUnit = &value, n.Unit
+		}
+		rows[i] = row
+	}
+	return rows
+}
+
+// pandasColumn describes a column of the table for the dictionary.
+type pandasColumn struct {
+	Name        string `json:"name"`
+	Dtype       string `json:"dtype"`
+	Description string `json:"description"`
+}
+
+func pandasColumns() []pandasColumn {
+	var columns []pandasColumn
+	t := reflect.TypeOf(pandasRow{})
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		var dtype string
+		switch field.Type.Kind() {
+		case reflect.Bool:
+			dtype = "bool"
+		case reflect.Int32:
+			dtype = "int32"
+		case reflect.Ptr:
+			dtype = "float64"
+		case reflect.Struct:
+			dtype = "datetime64[ns, UTC]"
+		default:
+			dtype = "string"
+		}
+		columns = append(columns, pandasColumn{
+			Name:        strings.Split(field.Tag.Get("parquet"), ",")[0],
+			Dtype:       dtype,
+			Description: field.Tag.Get("description"),
+		})
+	}
+	return columns
+}
+
+// writePandasCSV writes the rows as CSV. Missing values are left empty so
+// pandas reads them as NaN, booleans are True and False like pandas writes
+// them.
+func writePandasCSV(w io.Writer, rows []pandasRow) error {
+	out := csv.NewWriter(w)
+	columns := pandasColumns()
+
+	header := make([]string, len(columns))
+	for i, c := range columns {
+		header[i] = c.Name
+	}
+	if err := out.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		v := reflect.ValueOf(row)
+		record := make([]string, v.NumField())
+		for i := range record {
+			switch value := v.Field(i).Interface().(type) {
+			case bool:
+				if value {
+					record[i] = "True"
+				} else {
+					record[i] = "False"
+				}
+			case int32:
+				record[i] = strconv.Itoa(int(value))
+			case *float64:
+				if value != nil {
+					record[i] = strconv.FormatFloat(*value, 'g', -1, 64)
+				}
+			case time.Time:
+				record[i] = value.Format(time.RFC3339)
+			default:
+				record[i] = fmt.Sprint(value)
+			}
+		}
+		if err := out.Write(record); err != nil {
+			return err
+		}
+	}
+
+	out.Flush()
+	return out.Error()
+}
+
+func writePandasDictionary(w io.Writer, columns []pandasColumn) {
+	fmt.Fprintln(w, "# Columns of settings.csv and settings.parquet")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "One row per setting. The CSV and the Parquet file hold the same table, read the CSV with the dtypes below or the Parquet file as is.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "| column | dtype | description |")
+	fmt.Fprintln(w, "| --- | --- | --- |")
+	for _, c := range columns {
+		fmt.Fprintf(w, "| `%s` | %s | %s |\n", c.Name, c.Dtype, c.Description)
+	}
+}
+
+// pandasNotebook returns an example notebook loading the table.
+func pandasNotebook(columns []pandasColumn) ([]byte, error) {
+	dtypes := map[string]string{}
+	for _, c := range columns {
+		if c.Dtype != "datetime64[ns, UTC]" {
+			dtypes[c.Name] = c.Dtype
+		}
+	}
+	dtypesJSON, err := json.Marshal(dtypes)
+	if err != nil {
+		return nil, err
+	}
+
+	markdown := func(lines ...string) map[string]interface{} {
+		return map[string]interface{}{"cell_type": "markdown", "metadata": map[string]interface{}{}, "source": lines}
+	}
+	code := func(lines ...string) map[string]interface{} {
+		for i := range lines[:len(lines)-1] {
+			lines[i] += "\n"
+		}
+		return map[string]interface{}{"cell_type": "code", "execution_count": nil, "metadata": map[string]interface{}{}, "outputs": []interface{}{}, "source": lines}
+	}
+
+	notebook := map[string]interface{}{
+		"nbformat":       4,
+		"nbformat_minor": 5,
+		"metadata": map[string]interface{}{
+			"kernelspec":    map[string]interface{}{"display_name": "Python 3", "language": "python", "name": "python3"},
+			"language_info": map[string]interface{}{"name": "python"},
+		},
+		"cells": []interface{}{
+			markdown("# Elasticsearch settings\n", "\n", "The columns are described in `columns.md`."),
+			code(
+				"import pandas as pd",
+				"",
+				"settings = pd.read_parquet(\"settings.parquet\")",
+				"# or, without pyarrow",
+				"# settings = pd.read_csv(\"settings.csv\", dtype="+string(dtypesJSON)+", parse_dates=[\"extracted_at\"])",
+				"settings.head()",
+			),
+			markdown("Settings per scope and whether they can be updated on a running cluster"),
+			code("settings.groupby([\"scope\", \"dynamic\"]).size().unstack(fill_value=0)"),
+			markdown("Modules declaring the most settings"),
+			code("settings[\"module\"].value_counts().head(20)"),
+			markdown("The largest size defaults, in megabytes"),
+			code(
+				"sizes = settings[settings[\"default_unit\"] == \"bytes\"]",
+				"(sizes.set_index(\"name\")[\"default_value\"] / 2**20).sort_values(ascending=False).head(20)",
+			),
+			markdown("Deprecated settings that are still dynamic"),
+			code("settings[settings[\"deprecated\"] & settings[\"dynamic\"]][[\"name\", \"code_file\"]]"),
+		},
+	}
+	return json.MarshalIndent(notebook, "", " ")
+}
+
+func writePandasExport(dir string, doc SettingsDocument) error {
+	rows := pandasRows(doc)
+	columns := pandasColumns()
+
+	f, err := os.Create(filepath.Join(dir, "settings.csv"))
+	if err != nil {
+		return err
+	}
+	if err := writePandasCSV(f, rows); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	if err := parquet.WriteFile(filepath.Join(dir, "settings.parquet"), rows); err != nil {
+		return err
+	}
+
+	f, err = os.Create(filepath.Join(dir, "columns.md"))
+	if err != nil {
+		return err
+	}
+	writePandasDictionary(f, columns)
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	notebook, err := pandasNotebook(columns)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(filepath.Join(dir, "settings.ipynb"), notebook, 0644)
+}
+
+func runGenerate(args []string) {
+	usage := func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh generate pandas [-out dir] <settings.json>")
+		fmt.Fprintln(os.Stderr, "Generates artifacts from previously extracted settings.")
+		fmt.Fprintln(os.Stderr, "  pandas  a tidy settings.csv and settings.parquet pair, their column dictionary and an example notebook, for dataframe analysis")
+	}
+	if len(args) == 0 {
+		usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	switch args[0] {
+	case "pandas":
+		runGeneratePandas(args[1:])
+	default:
+		usage()
+		exitWith(exitUsageError, nil)
+	}
+}
+
+func runGeneratePandas(args []string) {
+	flags := flag.NewFlagSet("generate pandas", flag.ExitOnError)
+	out := flags.String("out", "pandas", "directory to write the files to")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh generate pandas [-out dir] <settings.json>")
+		fmt.Fprintln(os.Stderr, "Writes settings.csv and settings.parquet with one row per setting, columns.md describing their columns and settings.ipynb loading them.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	doc, err := readSettingsDocument(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	sortSettings(doc.Settings)
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	if err := writePandasExport(*out, doc); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// parquetSetting is a row of the Parquet output. Rows are flat and carry the
+// provenance of their extraction, so files from several runs can be queried
+// together, i.e. with DuckDB's read_parquet('settings-*.parquet').
+type parquetSetting struct {
+	Name                   string    `parquet:"name"`
+	RawName                string    `parquet:"raw_name"`
+	JavaType               string    `parquet:"java_type"`
+	DefaultArg             string    `parquet:"default_arg"`
+	Properties             []string  `parquet:"properties,list"`
+	Scope                  string    `parquet:"scope"`
+	CodeFile               string    `parquet:"code_file"`
+	CodeLine               int32     `parquet:"code_line"`
+	FirstSeenVersion       string    `parquet:"first_seen_version"`
+	RemovedInVersion       string    `parquet:"removed_in_version"`
+	MinIndexCreatedVersion string    `parquet:"min_index_created_version"`
+	DefaultValue           *float64  `parquet:"default_value,optional"`
+	DefaultUnit            string    `parquet:"default_unit"`
+	SourceCommit           string    `parquet:"source_commit"`
+	ExtractedAt            time.Time `parquet:"extracted_at,timestamp"`
+	ToolVersion            string    `parquet:"tool_version"`
+}
+
+func writeSettingsParquet(fileName string, doc SettingsDocument) error {
+	rows := make([]parquetSetting, len(doc.Settings))
+	for i, s := range doc.Settings {
+		var value *float64
+		var unit string
+		if s.NormalizedDefault != nil {
+			value, unit = &s.NormalizedDefault.Value, s.NormalizedDefault.Unit
+		}
+		rows[i] = parquetSetting{
+			Name:                   s.Name,
+			RawName:                s.RawName,
+			JavaType:               s.JavaType,
+			DefaultArg:             s.DefaultArg,
+			Properties:             s.Properties,
+			Scope:                  s.Scope(),
+			CodeFile:               s.CodeFile,
+			CodeLine:               int32(s.CodeLine),
+			FirstSeenVersion:       s.FirstSeenVersion,
+			RemovedInVersion:       s.RemovedInVersion,
+			MinIndexCreatedVersion: s.MinIndexCreatedVersion,
+			DefaultValue:           value,
+			DefaultUnit:            unit,
+			SourceCommit:           doc.SourceCommit,
+			ExtractedAt:            doc.ExtractedAt,
+			ToolVersion:            doc.ToolVersion,
+		}
+	}
+	return parquet.WriteFile(fileName, rows)
+}
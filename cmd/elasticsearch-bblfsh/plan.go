@@ -0,0 +1,140 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+// PlannedValue is the absolute value a percentage based default works out to
+// on a given hardware profile.
+type PlannedValue struct {
+	Name    string `json:"name"`
+	Default string `json:"default"`
+	// Of is what the percentage is taken of, "heap" or "disk"
+	Of           string `json:"of"`
+	PerNodeBytes int64  `json:"per_node_bytes"`
+	ClusterBytes int64  `json:"cluster_bytes"`
+	Dynamic      bool   `json:"dynamic"`
+}
+
+// CapacityPlan is the output of the plan subcommand.
+type CapacityPlan struct {
+	BuildInfo
+	HeapBytes int64          `json:"heap_bytes"`
+	DiskBytes int64          `json:"disk_bytes,omitempty"`
+	Nodes     int            `json:"nodes"`
+	Values    []PlannedValue `json:"values"`
+}
+
+// formatBytes formats a size the way Elasticsearch does, i.e. "22.4gb".
+func formatBytes(size int64) string {
+	units := []string{"b", "kb", "mb", "gb", "tb", "pb"}
+	value := float64(size)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strings.TrimSuffix(strconv.FormatFloat(value, 'f', 1, 64), ".0") + units[unit]
+}
+
+// planCapacity evaluates the percentage based defaults of settings against
+// the heap and disk of a node. Sizes are a percentage of the heap, disk
+// watermarks one of the disk. Watermarks are skipped without a disk size.
+func planCapacity(settings []ElasticsearchSetting, heap, disk int64, nodes int) CapacityPlan {
+	plan := CapacityPlan{BuildInfo: buildInfo(), HeapBytes: heap, DiskBytes: disk, Nodes: nodes, Values: []PlannedValue{}}
+
+	for _, s := range settings {
+		if s.NormalizedDefault == nil || s.NormalizedDefault.Unit != normalizedUnits[valueRatio] {
+			continue
+		}
+		fraction := s.NormalizedDefault.Value
+
+		var of string
+		var total int64
+		switch {
+		case strings.Contains(s.Name, "disk.watermark"):
+			of, total = "disk", disk
+		case s.JavaType == "ByteSizeValue":
+			of, total = "heap", heap
+		default:
+			continue
+		}
+		if total == 0 {
+			continue
+		}
+
+		perNode := int64(fraction * float64(total))
+		plan.Values = append(plan.Values, PlannedValue{
+			Name:         s.Name,
+			Default:      s.DefaultArg,
+			Of:           of,
+			PerNodeBytes: perNode,
+			ClusterBytes: perNode * int64(nodes),
+			Dynamic:      updateBadge(s) == "dynamic",
+		})
+	}
+
+	return plan
+}
+
+func runPlan(args []string) {
+	flags := flag.NewFlagSet("plan", flag.ExitOnError)
+	heapFlag := flags.String("heap", "", "heap size of a node, i.e. 32g")
+	diskFlag := flags.String("disk", "", "data disk size of a node, i.e. 2tb, to evaluate the disk watermarks")
+	nodes := flags.Int("nodes", 1, "number of nodes in the cluster")
+	asJSON := flags.Bool("json", false, "write the plan as JSON")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh plan -heap size [-disk size] [-nodes n] <settings.json>")
+		fmt.Fprintln(os.Stderr, "Prints the absolute values the percentage based defaults of breakers, caches and the like work out to on a default configured node.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *heapFlag == "" || *nodes < 1 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	heap, err := parseSize(*heapFlag)
+	if err != nil {
+		exitWith(exitUsageError, err)
+	}
+	var disk int64
+	if *diskFlag != "" {
+		if disk, err = parseSize(*diskFlag); err != nil {
+			exitWith(exitUsageError, err)
+		}
+	}
+
+	settings, err := readSettings(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	sortSettings(settings)
+
+	plan := planCapacity(settings, heap, disk, *nodes)
+
+	if *asJSON {
+		if err := writeJSON("-", plan); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tDEFAULT\tOF\tPER NODE\tCLUSTER\tUPDATES")
+	for _, v := range plan.Values {
+		updates := "static"
+		if v.Dynamic {
+			updates = "dynamic"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", v.Name, v.Default, v.Of, formatBytes(v.PerNodeBytes), formatBytes(v.ClusterBytes), updates)
+	}
+	w.Flush()
+}
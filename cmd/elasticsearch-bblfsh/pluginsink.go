@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// sinkProtocolVersion is the version of the sink plugin protocol. Plugins
+// are told it in ELASTICSEARCH_BBLFSH_SINK_PROTOCOL and have to answer with
+// it in their handshake.
+const sinkProtocolVersion = 1
+
+// sinkHandshakeTimeout is how long a plugin has to answer the handshake,
+// so a program that isn't a sink plugin fails fast instead of hanging.
+const sinkHandshakeTimeout = 10 * time.Second
+
+// pluginSink runs a program as an output sink. The program is started
+// with ELASTICSEARCH_BBLFSH_SINK_PROTOCOL set and talks NDJSON over stdio:
+//
+//	plugin: {"type":"handshake","protocol_version":1,"name":"cmdb"}
+//	host:   {"type":"begin","kind":"settings","document":{...}}
+//	host:   {"type":"setting","setting":{...}}      for -sink-plugin of a run
+//	host:   {"type":"event","event":{...}}          for -sink-plugin of diff
+//	host:   {"type":"end","count":1234}
+//	plugin: {"type":"done"} or {"type":"done","error":"..."}
+//
+// Plugins may send {"type":"log","level":"warning","message":"..."} at any
+// time, and whatever they write to stderr is passed through. The host
+// closes stdin after end, the plugin exits once it's done.
+type pluginSink struct {
+	command string
+	args    []string
+}
+
+// sinkDocument is the document a begin message describes, without its
+// settings.
+type sinkDocument struct {
+	BuildInfo
+	SchemaVersion int        `json:"schema_version,omitempty"`
+	ExtractedAt   *time.Time `json:"extracted_at,omitempty"`
+	SourceRoot    string     `json:"source_root,omitempty"`
+	SourceCommit  string     `json:"source_commit,omitempty"`
+	From          string     `json:"from,omitempty"`
+	To            string     `json:"to,omitempty"`
+}
+
+type sinkMessage struct {
+	Type     string            `json:"type"`
+	Kind     string            `json:"kind,omitempty"`
+	Document *sinkDocument     `json:"document,omitempty"`
+	Setting  *esIndexedSetting `json:"setting,omitempty"`
+	Event    *SettingDiffEvent `json:"event,omitempty"`
+}
+
+// sinkEnd is the last message, which always has the count, even of an empty
+// document or diff.
+type sinkEnd struct {
+	Type  string `json:"type"`
+	Count int    `json:"count"`
+}
+
+type sinkReply struct {
+	Type            string `json:"type"`
+	ProtocolVersion int    `json:"protocol_version"`
+	Name            string `json:"name"`
+	Level           string `json:"level"`
+	Message         string `json:"message"`
+	Error           string `json:"error"`
+}
+
+// newPluginSink parses a -sink-plugin value, the program and its arguments
+// separated by spaces.
+func newPluginSink(spec string) (*pluginSink, error) {
+	fields := strings.Fields(spec)
+	if len(fields) == 0 {
+		return nil, errors.New("-sink-plugin needs a program to run")
+	}
+	return &pluginSink{command: fields[0], args: fields[1:]}, nil
+}
+
+// run starts the plugin, sends it the messages and waits for it to be done.
+func (sink *pluginSink) run(messages []interface{}) error {
+	cmd := exec.Command(sink.command, sink.args...)
+	cmd.Env = append(os.Environ(), fmt.Sprintf("ELASTICSEARCH_BBLFSH_SINK_PROTOCOL=%d", sinkProtocolVersion))
+	cmd.Stderr = os.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("sink plugin %s: %v", sink.command, err)
+	}
+
+	replies := make(chan sinkReply)
+	readErr := make(chan error, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		for scanner.Scan() {
+			var reply sinkReply
+			if err := json.Unmarshal(scanner.Bytes(), &reply); err != nil {
+				readErr <- fmt.Errorf("unreadable message %q: %v", scanner.Text(), err)
+				close(replies)
+				return
+			}
+			replies <- reply
+		}
+		readErr <- scanner.Err()
+		close(replies)
+	}()
+
+	name, err := sink.handshake(replies)
+	if err != nil {
+		cmd.Process.Kill()
+		// The reader may be blocked on a reply nobody reads any more
+		for range replies {
+		}
+		cmd.Wait()
+		return fmt.Errorf("sink plugin %s: %v", sink.command, err)
+	}
+
+	// Messages are written while replies are read, so a plugin logging a
+	// lot can't deadlock on a full pipe
+	writeErr := make(chan error, 1)
+	go func() {
+		enc := json.NewEncoder(stdin)
+		for _, m := range messages {
+			if err := enc.Encode(m); err != nil {
+				writeErr <- err
+				stdin.Close()
+				return
+			}
+		}
+		writeErr <- stdin.Close()
+	}()
+
+	var done *sinkReply
+	for reply := range replies {
+		switch reply.Type {
+		case "log":
+			level := slog.LevelWarn
+			switch reply.Level {
+			case "error":
+				level = slog.LevelError
+			case "info":
+				level = slog.LevelInfo
+			case "debug":
+				level = slog.LevelDebug
+			}
+			logger.Log(context.Background(), level, reply.Message, "sink_plugin", name)
+		case "done":
+			r := reply
+			done = &r
+		}
+	}
+
+	werr := <-writeErr
+	rerr := <-readErr
+	// A plugin failing says why in its done message, then exits non-zero
+	waitErr := cmd.Wait()
+	switch {
+	case done != nil && done.Error != "":
+		return fmt.Errorf("sink plugin %s: %s", name, done.Error)
+	case waitErr != nil:
+		return fmt.Errorf("sink plugin %s: %v", name, waitErr)
+	case werr != nil && werr != io.ErrClosedPipe:
+		return fmt.Errorf("sink plugin %s: %v", name, werr)
+	case rerr != nil:
+		return fmt.Errorf("sink plugin %s: %v", name, rerr)
+	case done == nil:
+		return fmt.Errorf("sink plugin %s exited without saying it was done", name)
+	}
+	return nil
+}
+
+// handshake waits for the plugin to announce itself and returns its name.
+func (sink *pluginSink) handshake(replies <-chan sinkReply) (string, error) {
+	select {
+	case reply, ok := <-replies:
+		if !ok || reply.Type != "handshake" {
+			return "", errors.New("expected a handshake as the first message, is it a sink plugin?")
+		}
+		if reply.ProtocolVersion != sinkProtocolVersion {
+			return "", fmt.Errorf("speaks protocol version %d, expected %d", reply.ProtocolVersion, sinkProtocolVersion)
+		}
+		if reply.Name == "" {
+			return sink.command, nil
+		}
+		return reply.Name, nil
+	case <-time.After(sinkHandshakeTimeout):
+		return "", fmt.Errorf("no handshake within %s", sinkHandshakeTimeout)
+	}
+}
+
+// publishDocument sends every setting, with the provenance of the
+// extraction like the documents of the Elasticsearch sink.
+func (sink *pluginSink) publishDocument(doc SettingsDocument) error {
+	messages := []interface{}{sinkMessage{Type: "begin", Kind: "settings", Document: &sinkDocument{
+		BuildInfo:     doc.BuildInfo,
+		SchemaVersion: doc.SchemaVersion,
+		ExtractedAt:   &doc.ExtractedAt,
+		SourceRoot:    doc.SourceRoot,
+		SourceCommit:  doc.SourceCommit,
+	}}}
+	for _, s := range doc.Settings {
+		messages = append(messages, sinkMessage{Type: "setting", Setting: &esIndexedSetting{
+			ElasticsearchSetting: s,
+			Scope:                s.Scope(),
+			SourceCommit:         doc.SourceCommit,
+			ExtractedAt:          doc.ExtractedAt,
+			ToolVersion:          doc.ToolVersion,
+		}})
+	}
+	messages = append(messages, sinkEnd{Type: "end", Count: len(doc.Settings)})
+	return sink.run(messages)
+}
+
+// publishDiff sends the events of a diff between the from and to
+// extractions.
+func (sink *pluginSink) publishDiff(d SettingsDiff, from, to string) error {
+	messages := []interface{}{sinkMessage{Type: "begin", Kind: "diff", Document: &sinkDocument{BuildInfo: buildInfo(), From: from, To: to}}}
+	events := diffEvents(d, from, to)
+	for i := range events {
+		messages = append(messages, sinkMessage{Type: "event", Event: &events[i]})
+	}
+	messages = append(messages, sinkEnd{Type: "end", Count: len(events)})
+	return sink.run(messages)
+}
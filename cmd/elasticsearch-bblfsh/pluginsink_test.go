@@ -0,0 +1,65 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// TestSinkPluginProcess is the plugin the tests run, the test binary
+// started again, behaving as SINK_PLUGIN_TEST says.
+func TestSinkPluginProcess(t *testing.T) {
+	mode := os.Getenv("SINK_PLUGIN_TEST")
+	if mode == "" || os.Getenv("ELASTICSEARCH_BBLFSH_SINK_PROTOCOL") == "" {
+		return
+	}
+	if mode == "no-handshake" {
+		// More replies than the host reads before giving up
+		for i := 0; i < 10; i++ {
+			fmt.Println(`{"type":"done"}`)
+		}
+		os.Exit(0)
+	}
+	fmt.Println(`{"type":"handshake","protocol_version":1,"name":"test"}`)
+	var last string
+	for scanner := bufio.NewScanner(os.Stdin); scanner.Scan(); {
+		last = scanner.Text()
+	}
+	switch mode {
+	case "fail":
+		fmt.Println(`{"type":"done","error":"the CMDB is down"}`)
+		os.Exit(1)
+	case "end":
+		if last != `{"type":"end","count":0}` {
+			fmt.Printf("{\"type\":\"done\",\"error\":%q}\n", "last message "+last)
+			os.Exit(1)
+		}
+	}
+	fmt.Println(`{"type":"done"}`)
+	os.Exit(0)
+}
+
+func TestPluginSink(t *testing.T) {
+	sink, err := newPluginSink(os.Args[0] + " -test.run=^TestSinkPluginProcess$")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		mode, err string
+	}{
+		{"ok", ""},
+		// An empty diff still ends with its count
+		{"end", ""},
+		// The plugin's error rather than its exit status
+		{"fail", "sink plugin test: the CMDB is down"},
+		{"no-handshake", "expected a handshake as the first message"},
+	} {
+		t.Setenv("SINK_PLUGIN_TEST", tc.mode)
+		err := sink.publishDiff(SettingsDiff{}, "old.json", "new.json")
+		if (err == nil) != (tc.err == "") || err != nil && !strings.Contains(err.Error(), tc.err) {
+			t.Errorf("%s: got %v, want %q", tc.mode, err, tc.err)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// priorityFile is set by -priority to the ranking of packages the walk
+// visits first, and learns the ranking of the next run into.
+var priorityFile string
+
+// scannedFirst are the files processed ahead of the walk, from the packages
+// ranked first, which the walk goes past.
+var scannedFirst = map[string]bool{}
+
+// PackageDensity is how many settings the Java files of a package, a
+// directory relative to the checkout, declared the last time it was
+// processed.
+type PackageDensity struct {
+	Package  string `json:"package"`
+	Files    int    `json:"files"`
+	Settings int    `json:"settings"`
+}
+
+func (p PackageDensity) density() float64 {
+	if p.Files == 0 {
+		return 0
+	}
+	return float64(p.Settings) / float64(p.Files)
+}
+
+// PackageRanking is the -priority file: the packages by settings per
+// file, the densest first.
+type PackageRanking struct {
+	UpdatedAt time.Time        `json:"updated_at"`
+	Packages  []PackageDensity `json:"packages"`
+}
+
+func (r *PackageRanking) sort() {
+	sort.Slice(r.Packages, func(i, j int) bool {
+		a, b := r.Packages[i], r.Packages[j]
+		if a.density() != b.density() {
+			return a.density() > b.density()
+		}
+		if a.Settings != b.Settings {
+			return a.Settings > b.Settings
+		}
+		return a.Package < b.Package
+	})
+}
+
+// readPackageRanking reads a ranking, an empty one when there's no file
+// yet.
+func readPackageRanking(fileName string) (PackageRanking, error) {
+	var ranking PackageRanking
+	b, err := ioutil.ReadFile(fileName)
+	if os.IsNotExist(err) {
+		return ranking, nil
+	}
+	if err != nil {
+		return ranking, err
+	}
+	err = json.Unmarshal(b, &ranking)
+	return ranking, err
+}
+
+// learnPackageRanking updates a ranking with the files a run processed.
+// Packages the run processed files of are counted again from those,
+// failed files left out, the others keep what an earlier run found.
+func learnPackageRanking(ranking PackageRanking, files []FileOutcome) PackageRanking {
+	counted := map[string]*PackageDensity{}
+	for _, f := range files {
+		if f.Error != "" {
+			continue
+		}
+		pkg := path.Dir(f.File)
+		if counted[pkg] == nil {
+			counted[pkg] = &PackageDensity{Package: pkg}
+		}
+		counted[pkg].Files++
+		counted[pkg].Settings += f.Settings
+	}
+
+	learned := PackageRanking{UpdatedAt: time.Now().UTC(), Packages: []PackageDensity{}}
+	for _, p := range ranking.Packages {
+		if counted[p.Package] == nil {
+			learned.Packages = append(learned.Packages, p)
+		}
+	}
+	for _, p := range counted {
+		learned.Packages = append(learned.Packages, *p)
+	}
+	learned.sort()
+	return learned
+}
+
+// writePackageRanking learns the files of the run into the -priority file.
+// A partial run still tells about the packages it got to.
+func writePackageRanking() error {
+	if priorityFile == "" {
+		return nil
+	}
+	ranking, err := readPackageRanking(priorityFile)
+	if err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(learnPackageRanking(ranking, runManifest.Files), "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := priorityFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, priorityFile)
+}
+
+// inSkippedDir tells whether a directory is, or is under, one the walk
+// skips.
+func inSkippedDir(dir string) bool {
+	for ; len(dir) > len(rootDir); dir = filepath.Dir(dir) {
+		info, err := os.Stat(dir)
+		if err != nil || skipDir(dir, info) {
+			return true
+		}
+	}
+	return false
+}
+
+// scanDensePackages processes the Java files of the packages of the
+// -priority ranking that declared settings, the densest first, so a run
+// stopped by -limit or a signal has the most settings it could get. The
+// packages have to be under one of the scanned dirs.
+func scanDensePackages(dirs []string) error {
+	ranking, err := readPackageRanking(priorityFile)
+	if err != nil {
+		return err
+	}
+	ranking.sort()
+
+	for _, p := range ranking.Packages {
+		if p.Settings == 0 {
+			break
+		}
+		scanned := false
+		for _, dir := range dirs {
+			scannedDir := relativePath(path.Join(rootDir, strings.TrimSpace(dir)))
+			if scannedDir == "." || p.Package == scannedDir || strings.HasPrefix(p.Package, scannedDir+"/") {
+				scanned = true
+				break
+			}
+		}
+		pkgDir := path.Join(rootDir, p.Package)
+		if !scanned || inSkippedDir(pkgDir) {
+			continue
+		}
+
+		entries, err := ioutil.ReadDir(pkgDir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, info := range entries {
+			if info.IsDir() || path.Ext(info.Name()) != ".java" {
+				continue
+			}
+			filePath := path.Join(pkgDir, info.Name())
+			if err := processFile(filePath, info, nil); err != nil {
+				return err
+			}
+			scannedFirst[relativePath(filePath)] = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/pprof"
+	"os"
+	"runtime"
+	"runtime/trace"
+)
+
+// traceFile is the -trace-out file while an execution trace is recorded.
+var traceFile *os.File
+
+// startPprofServer serves the pprof endpoints on addr for the rest of the
+// run, i.e. go tool pprof http://localhost:6060/debug/pprof/profile. The
+// handlers get a mux of their own so they're never served by anything
+// else using the default one.
+func startPprofServer(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("-pprof-addr: %v", err)
+	}
+
+	// Blocking and mutex profiles are off by default, sample enough of
+	// them to see where the walk waits on bblfshd
+	runtime.SetBlockProfileRate(int(1e6))
+	runtime.SetMutexProfileFraction(100)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logger.Error("pprof server stopped", "error", err)
+		}
+	}()
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "pprof listening on http://%s/debug/pprof/\n", listener.Addr())
+	}
+	return nil
+}
+
+// startTrace records an execution trace of the run into fileName, for
+// go tool trace.
+func startTrace(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := trace.Start(f); err != nil {
+		f.Close()
+		return err
+	}
+	traceFile = f
+	return nil
+}
+
+// stopTrace flushes the execution trace, if one is recorded. exitWith calls
+// it so runs that fail still leave a complete trace.
+func stopTrace() {
+	if traceFile == nil {
+		return
+	}
+	trace.Stop()
+	if err := traceFile.Close(); err != nil {
+		logger.Error("writing the execution trace failed", "file", traceFile.Name(), "error", err)
+	}
+	traceFile = nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	// progressWindow is how many of the latest files the throughput, and
+	// so the ETA, is computed over, so it follows the run slowing down on
+	// large files or speeding up on cached ones
+	progressWindow   = 100
+	progressInterval = 200 * time.Millisecond
+	progressBarWidth = 30
+)
+
+// skipDir tells whether the walk skips a directory. Only production code
+// declares settings, src/test and the like are skipped when scanning
+// modules and plugins.
+func skipDir(filePath string, info os.FileInfo) bool {
+	return info.IsDir() && path.Base(path.Dir(filePath)) == "src" && info.Name() != "main"
+}
+
+// countJavaFiles counts the files a walk of dirs will parse, for the
+// progress bar to have a total.
+func countJavaFiles(root string, dirs []string) int {
+	total := 0
+	for _, dir := range dirs {
+		filepath.Walk(path.Join(root, strings.TrimSpace(dir)), func(filePath string, info os.FileInfo, err error) error {
+			if err != nil {
+				return nil
+			}
+			if skipDir(filePath, info) {
+				return filepath.SkipDir
+			}
+			if !info.IsDir() && path.Ext(filePath) == ".java" && inSample(relativePath(filePath)) {
+				total++
+			}
+			return nil
+		})
+	}
+	if fileLimit > 0 && total > fileLimit {
+		total = fileLimit
+	}
+	return total
+}
+
+// progress draws a progress bar of the walk on a terminal.
+type progress struct {
+	w        io.Writer
+	total    int
+	done     int
+	failed   int
+	settings int
+	// finished are the times the latest files finished at
+	finished []time.Time
+	drawn    time.Time
+}
+
+// runProgress is the progress bar of the run, nil when it isn't shown.
+var runProgress *progress
+
+func newProgress(w io.Writer, total int) *progress {
+	return &progress{w: w, total: total}
+}
+
+// update records a finished file and redraws the bar, at most every
+// progressInterval.
+func (p *progress) update(settings int, failed bool) {
+	if p == nil {
+		return
+	}
+	p.done++
+	p.settings += settings
+	if failed {
+		p.failed++
+	}
+
+	now := time.Now()
+	p.finished = append(p.finished, now)
+	if len(p.finished) > progressWindow {
+		p.finished = p.finished[1:]
+	}
+	if now.Sub(p.drawn) >= progressInterval || p.done == p.total {
+		p.draw()
+		p.drawn = now
+	}
+}
+
+// eta is the time left at the throughput of the latest files.
+func (p *progress) eta() (time.Duration, bool) {
+	if len(p.finished) < 2 || p.done >= p.total {
+		return 0, false
+	}
+	elapsed := p.finished[len(p.finished)-1].Sub(p.finished[0])
+	if elapsed <= 0 {
+		return 0, false
+	}
+	perFile := elapsed / time.Duration(len(p.finished)-1)
+	return perFile * time.Duration(p.total-p.done), true
+}
+
+func (p *progress) draw() {
+	filled := 0
+	if p.total > 0 {
+		filled = progressBarWidth * p.done / p.total
+	}
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	bar := strings.Repeat("#", filled) + strings.Repeat("-", progressBarWidth-filled)
+
+	line := fmt.Sprintf("[%s] %d/%d files, %d settings", bar, p.done, p.total, p.settings)
+	if p.failed > 0 {
+		line += ", " + colorizeCount(ansiRed, p.failed, "failed")
+	}
+	if eta, ok := p.eta(); ok {
+		line += ", ETA " + eta.Round(time.Second).String()
+	}
+	// \x1b[K clears what's left of a longer previous line
+	fmt.Fprintf(p.w, "\r%s\x1b[K", line)
+}
+
+// clear removes the bar, before printing a warning or once the walk is
+// done. The next update draws it again.
+func (p *progress) clear() {
+	if p == nil {
+		return
+	}
+	fmt.Fprint(p.w, "\r\x1b[K")
+	p.drawn = time.Time{}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// parseDurationBuckets are the upper bounds, in seconds, of the parse
+// latency histogram. Most files parse in tens of milliseconds, the largest
+// ones take seconds.
+var parseDurationBuckets = []float64{0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// runMetrics are the counters exposed on /metrics, in the Prometheus text
+// format, so scheduled extractions can be monitored and alerted on. The
+// daemon adds up the ones of its runs.
+var runMetrics = newPrometheusMetrics()
+
+type prometheusMetrics struct {
+	mu sync.Mutex
+
+	// runs are the extractions of the daemon, by whether they failed
+	runs              map[bool]int64
+	parses            map[bool]int64
+	parseErrors       int64
+	partialParses     int64
+	settingsExtracted int64
+
+	// parseBuckets counts the parses up to each of parseDurationBuckets
+	parseBuckets []int64
+	parseCount   int64
+	parseSum     float64
+}
+
+func newPrometheusMetrics() *prometheusMetrics {
+	return &prometheusMetrics{
+		runs:         map[bool]int64{},
+		parses:       map[bool]int64{},
+		parseBuckets: make([]int64, len(parseDurationBuckets)),
+	}
+}
+
+// observeFile records a file processed by the run.
+func (m *prometheusMetrics) observeFile(parse time.Duration, cached, failed bool, settings int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.parses[cached]++
+	if failed {
+		m.parseErrors++
+	}
+	m.settingsExtracted += int64(settings)
+
+	seconds := parse.Seconds()
+	for i, bound := range parseDurationBuckets {
+		if seconds <= bound {
+			m.parseBuckets[i]++
+		}
+	}
+	m.parseCount++
+	m.parseSum += seconds
+}
+
+func (m *prometheusMetrics) observePartialParse() {
+	m.mu.Lock()
+	m.partialParses++
+	m.mu.Unlock()
+}
+
+// observeRun records an extraction the daemon ran in a process of its own,
+// and the files of its manifest when it got to write one.
+func (m *prometheusMetrics) observeRun(manifest *RunManifest, failed bool) {
+	if manifest != nil {
+		for _, f := range manifest.Files {
+			m.observeFile(time.Duration(f.ParseMs)*time.Millisecond, f.Cached, f.Status == "failed", f.Settings)
+		}
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.runs[failed]++
+	if manifest != nil {
+		m.partialParses += int64(manifest.Summary.FilesPartial)
+	}
+}
+
+// formatFloat formats a value the way Prometheus expects them.
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// writeTo writes the metrics in the Prometheus text exposition format.
+func (m *prometheusMetrics) writeTo(w io.Writer) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	info := buildInfo()
+	fmt.Fprintln(w, "# HELP elasticsearch_bblfsh_build_info Version of elasticsearch-bblfsh.")
+	fmt.Fprintln(w, "# TYPE elasticsearch_bblfsh_build_info gauge")
+	fmt.Fprintf(w, "elasticsearch_bblfsh_build_info{version=%q,commit=%q} 1\n", info.ToolVersion, info.ToolCommit)
+
+	fmt.Fprintln(w, "# HELP elasticsearch_bblfsh_runs_total Extractions run by the daemon.")
+	fmt.Fprintln(w, "# TYPE elasticsearch_bblfsh_runs_total counter")
+	fmt.Fprintf(w, "elasticsearch_bblfsh_runs_total{failed=\"false\"} %d\n", m.runs[false])
+	fmt.Fprintf(w, "elasticsearch_bblfsh_runs_total{failed=\"true\"} %d\n", m.runs[true])
+
+	fmt.Fprintln(w, "# HELP elasticsearch_bblfsh_parses_total Java files parsed by bblfshd or read from the UAST cache, failures included.")
+	fmt.Fprintln(w, "# TYPE elasticsearch_bblfsh_parses_total counter")
+	fmt.Fprintf(w, "elasticsearch_bblfsh_parses_total{cached=\"false\"} %d\n", m.parses[false])
+	fmt.Fprintf(w, "elasticsearch_bblfsh_parses_total{cached=\"true\"} %d\n", m.parses[true])
+
+	fmt.Fprintln(w, "# HELP elasticsearch_bblfsh_parse_errors_total Java files that failed to parse.")
+	fmt.Fprintln(w, "# TYPE elasticsearch_bblfsh_parse_errors_total counter")
+	fmt.Fprintf(w, "elasticsearch_bblfsh_parse_errors_total %d\n", m.parseErrors)
+
+	fmt.Fprintln(w, "# HELP elasticsearch_bblfsh_partial_parses_total Java files bblfshd only partially parsed.")
+	fmt.Fprintln(w, "# TYPE elasticsearch_bblfsh_partial_parses_total counter")
+	fmt.Fprintf(w, "elasticsearch_bblfsh_partial_parses_total %d\n", m.partialParses)
+
+	fmt.Fprintln(w, "# HELP elasticsearch_bblfsh_settings_extracted_total Settings extracted.")
+	fmt.Fprintln(w, "# TYPE elasticsearch_bblfsh_settings_extracted_total counter")
+	fmt.Fprintf(w, "elasticsearch_bblfsh_settings_extracted_total %d\n", m.settingsExtracted)
+
+	fmt.Fprintln(w, "# HELP elasticsearch_bblfsh_parse_duration_seconds Time to get the UAST of a file.")
+	fmt.Fprintln(w, "# TYPE elasticsearch_bblfsh_parse_duration_seconds histogram")
+	for i, bound := range parseDurationBuckets {
+		fmt.Fprintf(w, "elasticsearch_bblfsh_parse_duration_seconds_bucket{le=%q} %d\n", formatFloat(bound), m.parseBuckets[i])
+	}
+	fmt.Fprintf(w, "elasticsearch_bblfsh_parse_duration_seconds_bucket{le=\"+Inf\"} %d\n", m.parseCount)
+	fmt.Fprintf(w, "elasticsearch_bblfsh_parse_duration_seconds_sum %s\n", formatFloat(m.parseSum))
+	fmt.Fprintf(w, "elasticsearch_bblfsh_parse_duration_seconds_count %d\n", m.parseCount)
+}
+
+// ServeHTTP serves the metrics to a Prometheus scrape.
+func (m *prometheusMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.writeTo(w)
+}
+
+// startMetricsServer serves /metrics on addr for the rest of the run.
+func startMetricsServer(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("-metrics-addr: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", runMetrics)
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logger.Error("metrics server stopped", "error", err)
+		}
+	}()
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "metrics on http://%s/metrics\n", listener.Addr())
+	}
+	return nil
+}
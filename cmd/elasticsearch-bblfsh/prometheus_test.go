@@ -0,0 +1,52 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPrometheusMetrics(t *testing.T) {
+	m := newPrometheusMetrics()
+	m.observeFile(20*time.Millisecond, false, false, 3)
+	m.observeFile(2*time.Second, true, true, 0)
+	m.observePartialParse()
+
+	// The runs of the daemon add up
+	manifest := &RunManifest{Files: []FileOutcome{{Status: "ok", ParseMs: 40, Settings: 5}}}
+	manifest.Summary.FilesPartial = 1
+	m.observeRun(manifest, false)
+	m.observeRun(nil, true)
+
+	server := httptest.NewServer(m)
+	defer server.Close()
+	res, err := server.Client().Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if ct := res.Header.Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Content-Type %q", ct)
+	}
+	b, _ := ioutil.ReadAll(res.Body)
+	for _, line := range []string{
+		`elasticsearch_bblfsh_runs_total{failed="false"} 1`,
+		`elasticsearch_bblfsh_runs_total{failed="true"} 1`,
+		`elasticsearch_bblfsh_parses_total{cached="false"} 2`,
+		`elasticsearch_bblfsh_parses_total{cached="true"} 1`,
+		`elasticsearch_bblfsh_parse_errors_total 1`,
+		`elasticsearch_bblfsh_partial_parses_total 2`,
+		`elasticsearch_bblfsh_settings_extracted_total 8`,
+		`elasticsearch_bblfsh_parse_duration_seconds_bucket{le="0.025"} 1`,
+		`elasticsearch_bblfsh_parse_duration_seconds_bucket{le="0.05"} 2`,
+		`elasticsearch_bblfsh_parse_duration_seconds_bucket{le="2.5"} 3`,
+		`elasticsearch_bblfsh_parse_duration_seconds_bucket{le="+Inf"} 3`,
+		`elasticsearch_bblfsh_parse_duration_seconds_count 3`,
+	} {
+		if !strings.Contains(string(b), line+"\n") {
+			t.Errorf("no %s in\n%s", line, b)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/user"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// publicationLog is set by -publication-log to the file every publication
+// of the settings to an object store or a sink is appended to.
+var publicationLog string
+
+// Publication is an entry of the -publication-log: who published which
+// settings, at which commit of the checkout, where. Entries are chained by
+// the hash of the previous line, for entries edited or removed afterwards to
+// show, but for the last ones.
+type Publication struct {
+	PublishedAt time.Time `json:"published_at"`
+	// User is ELASTICSEARCH_BBLFSH_PUBLISHER, i.e. the actor of a CI job,
+	// or the local user
+	User string `json:"user"`
+	Host string `json:"host"`
+	// Ref is the commit of the checkout the settings were extracted from
+	Ref string `json:"ref,omitempty"`
+	// Hash is the SHA-256 of the object uploaded, or of the settings
+	// document as compact JSON for the sinks it's sent to setting by setting
+	Hash string `json:"hash"`
+	// Sink is s3, gs, elasticsearch, kafka or sink-plugin
+	Sink        string `json:"sink"`
+	Destination string `json:"destination"`
+	Settings    int    `json:"settings,omitempty"`
+	ToolVersion string `json:"tool_version"`
+	// Previous is the SHA-256 of the previous line of the log, empty for
+	// the first one
+	Previous string `json:"previous,omitempty"`
+}
+
+func publisher() string {
+	if name := os.Getenv("ELASTICSEARCH_BBLFSH_PUBLISHER"); name != "" {
+		return name
+	}
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+func hashBytes(line []byte) string {
+	sum := sha256.Sum256(line)
+	return hex.EncodeToString(sum[:])
+}
+
+// documentHash is the hash of a document published to a sink.
+func documentHash(doc SettingsDocument) (string, error) {
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return "", err
+	}
+	return hashBytes(b), nil
+}
+
+// recordPublication appends a publication to the -publication-log. The log
+// is locked for runs publishing at the same time to chain their entries one
+// after the other, and synced before the run goes on.
+func recordPublication(sink, destination, hash string, settings int) error {
+	if publicationLog == "" {
+		return nil
+	}
+	f, err := os.OpenFile(publicationLog, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := lockFile(f, true); err != nil {
+		return err
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return err
+	}
+
+	host, _ := os.Hostname()
+	p := Publication{
+		PublishedAt: time.Now().UTC(),
+		User:        publisher(),
+		Host:        host,
+		Hash:        hash,
+		Sink:        sink,
+		Destination: destination,
+		Settings:    settings,
+		ToolVersion: buildInfo().ToolVersion,
+	}
+	if rootDir != "" {
+		p.Ref = sourceCommit(rootDir)
+	}
+	if lines := bytes.Split(bytes.TrimRight(b, "\n"), []byte("\n")); len(b) > 0 {
+		p.Previous = hashBytes(lines[len(lines)-1])
+	}
+	line, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if len(b) > 0 && b[len(b)-1] != '\n' {
+		// The last entry of a run killed halfway through writing it
+		line = append([]byte("\n"), line...)
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+// publishedDocument records the publication of a document to a sink.
+func publishedDocument(sink, destination string, doc SettingsDocument) error {
+	hash, err := documentHash(doc)
+	if err != nil {
+		return err
+	}
+	return recordPublication(sink, destination, hash, len(doc.Settings))
+}
+
+// readPublications reads the -publication-log, and returns the lines
+// whose entry doesn't chain to the previous line.
+func readPublications(fileName string) ([]Publication, []int, error) {
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+
+	var publications []Publication
+	var broken []int
+	previous := ""
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Bytes()
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var p Publication
+		if err := json.Unmarshal(line, &p); err != nil {
+			broken = append(broken, n)
+			previous = hashBytes(line)
+			continue
+		}
+		if p.Previous != previous {
+			broken = append(broken, n)
+		}
+		previous = hashBytes(line)
+		publications = append(publications, p)
+	}
+	return publications, broken, scanner.Err()
+}
+
+func runPublications(args []string) {
+	if len(args) == 0 || args[0] != "list" {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh publications list [-log file] [-sink s3] [-destination s3://bucket] [-ref commit] [-hash sha256] [-since 2006-01-02]")
+		exitWith(exitUsageError, nil)
+	}
+	config, err := loadConfig()
+	if err != nil {
+		exitWith(exitUsageError, err)
+	}
+	flags := flag.NewFlagSet("publications list", flag.ExitOnError)
+	logFile := flags.String("log", config.PublicationLog, "-publication-log of the runs")
+	sink := flags.String("sink", "", "only list the publications to this sink: s3, gs, elasticsearch, kafka or sink-plugin")
+	destination := flags.String("destination", "", "only list the publications to destinations containing this")
+	ref := flags.String("ref", "", "only list the publications of the commits starting with this")
+	hash := flags.String("hash", "", "only list the publications of the settings whose hash starts with this")
+	since := flags.String("since", "", "only list the publications since this date or RFC 3339 time")
+	asJSON := flags.Bool("json", false, "write the publications as JSON")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh publications list [-log file] [-sink s3] [-destination s3://bucket] [-ref commit] [-hash sha256] [-since 2006-01-02]")
+		fmt.Fprintln(os.Stderr, "Lists the publications of the settings recorded in the -publication-log, who published which settings, at which commit, where, and checks no entry was edited or removed since.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args[1:])
+
+	if flags.NArg() != 0 || *logFile == "" {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+	var sinceTime time.Time
+	if *since != "" {
+		if sinceTime, err = time.Parse(time.RFC3339, *since); err != nil {
+			if sinceTime, err = time.ParseInLocation("2006-01-02", *since, time.Local); err != nil {
+				exitWith(exitUsageError, fmt.Errorf("-since: expected a date or an RFC 3339 time, got %q", *since))
+			}
+		}
+	}
+
+	all, broken, err := readPublications(*logFile)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	publications := []Publication{}
+	for _, p := range all {
+		switch {
+		case *sink != "" && p.Sink != *sink:
+		case *destination != "" && !strings.Contains(p.Destination, *destination):
+		case *ref != "" && !strings.HasPrefix(p.Ref, *ref):
+		case *hash != "" && !strings.HasPrefix(p.Hash, *hash):
+		case p.PublishedAt.Before(sinceTime):
+		default:
+			publications = append(publications, p)
+		}
+	}
+
+	if *asJSON {
+		if err := writeJSON("-", publications); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	} else {
+		short := func(s string) string {
+			if len(s) > 12 {
+				return s[:12]
+			}
+			return s
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "PUBLISHED AT\tUSER\tREF\tHASH\tDESTINATION")
+		for _, p := range publications {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", p.PublishedAt.Local().Format("2006-01-02 15:04:05"), p.User, short(p.Ref), short(p.Hash), p.Destination)
+		}
+		w.Flush()
+	}
+
+	if len(broken) > 0 {
+		lines := make([]string, len(broken))
+		for i, n := range broken {
+			lines[i] = fmt.Sprint(n)
+		}
+		exitWith(exitLogTampered, fmt.Errorf("%s was edited: the entries on lines %s don't follow the previous ones", *logFile, strings.Join(lines, ", ")))
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"sort"
+	"time"
+)
+
+// quarantineFile is set by -quarantine to the list of files that crashed
+// bblfshd, and quarantineAfter by -quarantine-after to how many runs a file
+// has to crash it in to be skipped by the next ones.
+var (
+	quarantineFile  string
+	quarantineAfter = 3
+)
+
+// filesQuarantined counts the files the run skipped as quarantined.
+var filesQuarantined int
+
+// QuarantinedFile is a file that crashed bblfshd, rather than failing to
+// parse with errors the driver reported. Once it crashed it in enough runs
+// it's quarantined, until its content or the driver changes.
+type QuarantinedFile struct {
+	File string `json:"file"`
+	// Hash is the SHA-256 of the content that crashed the driver
+	Hash          string    `json:"hash"`
+	DriverVersion string    `json:"driver_version"`
+	Crashes       int       `json:"crashes"`
+	LastError     string    `json:"last_error"`
+	LastCrashAt   time.Time `json:"last_crash_at"`
+	Quarantined   bool      `json:"quarantined"`
+}
+
+// Quarantine is the -quarantine file.
+type Quarantine struct {
+	Files []QuarantinedFile `json:"files"`
+}
+
+// driverError is an error getting an answer from bblfshd at all, i.e. its
+// driver crashing on the file, as opposed to the errors it answers with.
+type driverError struct {
+	err error
+}
+
+func (e driverError) Error() string {
+	return e.err.Error()
+}
+
+var (
+	// quarantine are the files of the -quarantine file, by path
+	quarantine = map[string]QuarantinedFile{}
+	// crashedFiles are the files that crashed bblfshd during the run, and
+	// recoveredFiles the ones of the quarantine that parsed this time
+	crashedFiles   = map[string]QuarantinedFile{}
+	recoveredFiles = map[string]bool{}
+)
+
+// loadQuarantine reads the -quarantine file, there's none the first time.
+func loadQuarantine() error {
+	b, err := ioutil.ReadFile(quarantineFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var q Quarantine
+	if err := json.Unmarshal(b, &q); err != nil {
+		return err
+	}
+	for _, f := range q.Files {
+		quarantine[f.File] = f
+	}
+	return nil
+}
+
+func contentHash(filePath string) (string, error) {
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// quarantined tells whether a file is to be skipped: it crashed bblfshd in
+// enough runs, and neither it nor the driver changed since.
+func quarantined(filePath string) bool {
+	f, ok := quarantine[relativePath(filePath)]
+	if !ok || !f.Quarantined || f.DriverVersion != runManifest.DriverVersion {
+		return false
+	}
+	hash, err := contentHash(filePath)
+	return err == nil && hash == f.Hash
+}
+
+// recordParse records whether a file crashed bblfshd, for the quarantine
+// to be updated at the end of the run.
+func recordParse(filePath string, err error) {
+	if quarantineFile == "" {
+		return
+	}
+	rel := relativePath(filePath)
+	if _, crashed := err.(driverError); !crashed {
+		if _, ok := quarantine[rel]; ok && err == nil {
+			recoveredFiles[rel] = true
+		}
+		return
+	}
+	hash, hashErr := contentHash(filePath)
+	if hashErr != nil {
+		return
+	}
+	f := QuarantinedFile{File: rel, Hash: hash, DriverVersion: runManifest.DriverVersion, Crashes: 1, LastError: err.Error(), LastCrashAt: time.Now().UTC()}
+	if previous, ok := quarantine[rel]; ok && previous.Hash == hash && previous.DriverVersion == f.DriverVersion {
+		f.Crashes += previous.Crashes
+	}
+	f.Quarantined = f.Crashes >= quarantineAfter
+	crashedFiles[rel] = f
+}
+
+// writeQuarantine updates the -quarantine file with the files that crashed
+// bblfshd or parsed again during the run. When nothing parsed at all it's
+// bblfshd that's down rather than files crashing it, and the crashes of the
+// run aren't counted.
+func writeQuarantine() error {
+	if quarantineFile == "" {
+		return nil
+	}
+	parsed := false
+	for _, f := range runManifest.Files {
+		if f.Status != "failed" && !f.Cached {
+			parsed = true
+			break
+		}
+	}
+
+	files := map[string]QuarantinedFile{}
+	for rel, f := range quarantine {
+		if !recoveredFiles[rel] {
+			files[rel] = f
+		}
+	}
+	if parsed {
+		for rel, f := range crashedFiles {
+			if f.Quarantined && !files[rel].Quarantined {
+				logger.Warn("quarantined a file that crashed bblfshd, the next runs skip it until it or the driver changes", "file", rel, "crashes", f.Crashes, "error", f.LastError)
+			}
+			files[rel] = f
+		}
+	}
+
+	q := Quarantine{Files: []QuarantinedFile{}}
+	for _, f := range files {
+		q.Files = append(q.Files, f)
+	}
+	sort.Slice(q.Files, func(i, j int) bool {
+		return q.Files[i].File < q.Files[j].File
+	})
+	b, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := quarantineFile + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(b, '\n'), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, quarantineFile)
+}
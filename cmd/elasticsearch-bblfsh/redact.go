@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// redactPaths is set by -redact-paths, for catalogs shared outside the
+// machine they were extracted on.
+var redactPaths bool
+
+const redacted = "<redacted>"
+
+// redactString removes the checkout root, the home directory and the user
+// name from a string like a flag value or an error message.
+func redactString(s string) string {
+	if root := strings.TrimSuffix(rootDir, "/"); root != "" {
+		s = replacePath(s, root, "<root>")
+	}
+	if home, err := os.UserHomeDir(); err == nil && home != "" && home != "/" {
+		s = replacePath(s, home, "~")
+	}
+	for _, name := range localUserNames() {
+		s = regexp.MustCompile(`(^|/)`+regexp.QuoteMeta(name)+`(/|$)`).ReplaceAllString(s, "${1}<user>${2}")
+	}
+	return s
+}
+
+// replacePath replaces an absolute path in s where it starts a path, so
+// /root doesn't match /tmp/root or /rootfs.
+func replacePath(s, path, replacement string) string {
+	re := regexp.MustCompile(`(^|[^\w./-])` + regexp.QuoteMeta(path) + `(/|[^\w.-]|$)`)
+	return re.ReplaceAllString(s, "${1}"+replacement+"${2}")
+}
+
+func localUserNames() []string {
+	var names []string
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		names = append(names, u.Username)
+	}
+	if name := os.Getenv("USER"); name != "" && (len(names) == 0 || names[0] != name) {
+		names = append(names, name)
+	}
+	return names
+}
+
+// redactSetting removes who wrote and owns a setting. Teams are kept, they
+// say which area a setting belongs to rather than who works on it.
+func redactSetting(s *ElasticsearchSetting) {
+	if s.Blame != nil {
+		blame := *s.Blame
+		blame.Author = redacted
+		s.Blame = &blame
+	}
+
+	var owners []string
+	for _, owner := range s.Owners {
+		if strings.HasPrefix(owner, "@") && strings.Contains(owner, "/") {
+			owners = append(owners, owner)
+		} else {
+			owners = append(owners, redacted)
+		}
+	}
+	s.Owners = owners
+}
+
+func redactManifest(m *RunManifest) {
+	for name, value := range m.Flags {
+		m.Flags[name] = redactString(value)
+	}
+	for i := range m.Errors {
+		for j := range m.Errors[i].Samples {
+			m.Errors[i].Samples[j].Error = redactString(m.Errors[i].Samples[j].Error)
+		}
+	}
+}
+
+// relativePath returns fileName relative to the Elasticsearch checkout,
+// slash separated. Files outside of it, which the walk shouldn't produce,
+// are reduced to their base name rather than leak an absolute path.
+func relativePath(fileName string) string {
+	rel, err := filepath.Rel(rootDir, fileName)
+	if err != nil || filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return filepath.Base(fileName)
+	}
+	return filepath.ToSlash(rel)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// namespace is the first segment of a setting name, i.e. "cluster" for
+// "cluster.routing.allocation.enable".
+func namespace(name string) string {
+	if name == "" {
+		return "unresolved"
+	}
+	return strings.SplitN(name, ".", 2)[0]
+}
+
+// displayName is the setting name, or the Java field it's assigned to when
+// the name couldn't be resolved.
+func displayName(s ElasticsearchSetting) string {
+	if s.Name == "" {
+		return s.RawName
+	}
+	return s.Name
+}
+
+// groupByNamespace splits sorted settings into runs sharing a namespace,
+// keeping their order.
+func groupByNamespace(settings []ElasticsearchSetting) ([]string, map[string][]ElasticsearchSetting) {
+	var namespaces []string
+	groups := map[string][]ElasticsearchSetting{}
+
+	for _, s := range settings {
+		ns := namespace(s.Name)
+		if _, ok := groups[ns]; !ok {
+			namespaces = append(namespaces, ns)
+		}
+		groups[ns] = append(groups[ns], s)
+	}
+
+	return namespaces, groups
+}
+
+func updateBadge(s ElasticsearchSetting) string {
+	if hasProperty(s, "Dynamic") || hasProperty(s, "OperatorDynamic") {
+		return "dynamic"
+	}
+	return "static"
+}
+
+// markdownCode wraps a value in a code span, escaping what would otherwise
+// end the span or the table cell.
+func markdownCode(s string) string {
+	if s == "" {
+		return ""
+	}
+	s = strings.Join(strings.Fields(s), " ")
+	s = strings.Replace(s, "|", "\\|", -1)
+	if strings.Contains(s, "`") {
+		return "`` " + s + " ``"
+	}
+	return "`" + s + "`"
+}
+
+func writeMarkdownTable(w io.Writer, settings []ElasticsearchSetting) {
+	fmt.Fprintln(w, "| Setting | Type | Default | Scope | Updates |")
+	fmt.Fprintln(w, "| ------- | ---- | ------- | ----- | ------- |")
+	for _, s := range settings {
+		fmt.Fprintf(w, "| %s | %s | %s | %s | **%s** |\n", markdownCode(displayName(s)), s.JavaType, markdownCode(s.DefaultArg), s.Scope(), updateBadge(s))
+	}
+}
+
+func writeSettingsMarkdown(w io.Writer, settings []ElasticsearchSetting, grouped bool) {
+	if !grouped {
+		writeMarkdownTable(w, settings)
+		return
+	}
+
+	namespaces, groups := groupByNamespace(settings)
+	for i, ns := range namespaces {
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "## %s\n\n", ns)
+		writeMarkdownTable(w, groups[ns])
+	}
+}
+
+// asciidocAnchor is the anchor the Elasticsearch reference docs would give a
+// setting, i.e. "cluster-routing-allocation-enable".
+func asciidocAnchor(name string) string {
+	return strings.NewReplacer(".", "-", "_", "-", "*", "", "<", "", ">", "").Replace(strings.ToLower(name))
+}
+
+// asciidocUpdateMarker links to the page explaining dynamic or static
+// settings for the scope of the setting, the way the reference docs do.
+func asciidocUpdateMarker(s ElasticsearchSetting) string {
+	badge := updateBadge(s)
+	title := strings.Title(badge)
+	if s.Scope() == "index" {
+		return fmt.Sprintf("(<<%s-index-settings,%s>>)", badge, title)
+	}
+	return fmt.Sprintf("(<<%s-cluster-setting,%s>>)", badge, title)
+}
+
+func writeAsciiDocEntries(w io.Writer, settings []ElasticsearchSetting) {
+	for _, s := range settings {
+		name := displayName(s)
+		fmt.Fprintf(w, "[[%s]]\n", asciidocAnchor(name))
+		fmt.Fprintf(w, "`%s`::\n", name)
+		fmt.Fprintln(w, asciidocUpdateMarker(s))
+		fmt.Fprintf(w, "// TODO: describe %s, declared in %s\n", name, s.CodeFile)
+		line := "Type: `" + s.JavaType + "`."
+		if s.DefaultArg != "" {
+			line += " Defaults to `" + strings.Join(strings.Fields(s.DefaultArg), " ") + "`."
+		}
+		fmt.Fprintln(w, line)
+		fmt.Fprintln(w)
+	}
+}
+
+// writeSettingsAsciiDoc writes a stub per setting in the style of the
+// Elasticsearch reference docs, for docs writers to fill in or reconcile
+// with the existing pages.
+func writeSettingsAsciiDoc(w io.Writer, settings []ElasticsearchSetting, grouped bool) {
+	if !grouped {
+		writeAsciiDocEntries(w, settings)
+		return
+	}
+
+	namespaces, groups := groupByNamespace(settings)
+	for _, ns := range namespaces {
+		fmt.Fprintf(w, "[[%s-settings]]\n", asciidocAnchor(ns))
+		fmt.Fprintf(w, "==== `%s` settings\n\n", ns)
+		writeAsciiDocEntries(w, groups[ns])
+	}
+}
+
+func runRender(args []string) {
+	flags := flag.NewFlagSet("render", flag.ExitOnError)
+	format := flags.String("format", "markdown", "output format, markdown or asciidoc")
+	grouped := flags.Bool("group", false, "group the settings by namespace, the first segment of their name")
+	out := flags.String("out", "-", "write to this file, - for stdout")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh render [-format markdown|asciidoc] [-group] <settings.json>")
+		fmt.Fprintln(os.Stderr, "Renders previously extracted settings as a table for runbooks and wikis, or as reference docs stubs.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+	if *format != "markdown" && *format != "asciidoc" {
+		exitWith(exitUsageError, fmt.Errorf("unknown format %q, expected markdown or asciidoc", *format))
+	}
+
+	settings, err := readSettings(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	sortSettings(settings)
+
+	w := os.Stdout
+	if *out != "-" {
+		w, err = os.Create(*out)
+		if err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		defer w.Close()
+	}
+
+	if *format == "asciidoc" {
+		writeSettingsAsciiDoc(w, settings, *grouped)
+		return
+	}
+	writeSettingsMarkdown(w, settings, *grouped)
+}
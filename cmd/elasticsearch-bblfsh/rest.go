@@ -0,0 +1,165 @@
+package main
+
+import (
+	"sort"
+
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// RestRoute is an HTTP method and path a REST handler is registered for.
+type RestRoute struct {
+	Method string `json:"method"`
+	Path   string `json:"path"`
+}
+
+// RestEndpoint is a REST handler, the routes it serves and the request
+// parameters it reads.
+type RestEndpoint struct {
+	Class      string      `json:"class"`
+	Routes     []RestRoute `json:"routes"`
+	Parameters []string    `json:"parameters"`
+
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// RestEndpointsDocument is the output of the REST endpoints extraction.
+type RestEndpointsDocument struct {
+	BuildInfo
+	Endpoints []RestEndpoint `json:"endpoints"`
+}
+
+// restParameterMethods are the RestRequest methods that read a parameter.
+var restParameterMethods = map[string]bool{
+	"param":                          true,
+	"hasParam":                       true,
+	"paramAsBoolean":                 true,
+	"paramAsInt":                     true,
+	"paramAsLong":                    true,
+	"paramAsFloat":                   true,
+	"paramAsTime":                    true,
+	"paramAsSize":                    true,
+	"paramAsStringArray":             true,
+	"paramAsStringArrayOrEmptyIfAll": true,
+}
+
+// restRouteTypes are the classes routes are declared with.
+var restRouteTypes = map[string]bool{
+	"Route":           true,
+	"ReplacedRoute":   true,
+	"DeprecatedRoute": true,
+}
+
+// restEndpointRegistration is a REST handler found in a file. Paths and
+// parameter names can be constants, which are resolved once every file has
+// been scanned.
+type restEndpointRegistration struct {
+	endpoint   RestEndpoint
+	routes     [][2]*uast.Node
+	parameters []*uast.Node
+	className  string
+}
+
+var restEndpointRegistrations []restEndpointRegistration
+
+func getRestEndpoints(rootNode *uast.Node, fileName string) []restEndpointRegistration {
+	var registrations []restEndpointRegistration
+
+	classes, _ := tools.Filter(rootNode, "//TypeDeclaration")
+	for _, class := range classes {
+		// Every REST handler implements BaseRestHandler#prepareRequest
+		isHandler := false
+		for _, child := range class.Children {
+			if child.InternalType == "MethodDeclaration" && nameOf(child) == "prepareRequest" {
+				isHandler = true
+			}
+		}
+		if !isHandler {
+			continue
+		}
+
+		r := restEndpointRegistration{
+			endpoint: RestEndpoint{
+				Class:    nameOf(class),
+				CodeLine: class.StartPosition.Line,
+				CodeFile: relativePath(fileName),
+			},
+			className: nameOf(class),
+		}
+
+		// i.e. controller.registerHandler(GET, "/_cluster/health", this);
+		invocations, _ := tools.Filter(class, "//MethodInvocation")
+		for _, n := range invocations {
+			name := nameOf(n)
+			arguments := argumentsOf(n)
+			switch {
+			case name == "registerHandler" || name == "registerAsDeprecatedHandler":
+				if len(arguments) >= 2 {
+					r.routes = append(r.routes, [2]*uast.Node{arguments[0], arguments[1]})
+				}
+			case restParameterMethods[name]:
+				// i.e. request.paramAsBoolean("local", false)
+				if len(arguments) > 0 {
+					r.parameters = append(r.parameters, arguments[0])
+				}
+			}
+		}
+
+		// i.e. new Route(GET, "/_cluster/health/{index}")
+		creations, _ := tools.Filter(class, "//ClassInstanceCreation")
+		for _, n := range creations {
+			for _, child := range n.Children {
+				if child.Properties["internalRole"] == "type" && restRouteTypes[typeName(child)] {
+					if arguments := argumentsOf(n); len(arguments) >= 2 {
+						r.routes = append(r.routes, [2]*uast.Node{arguments[0], arguments[1]})
+					}
+				}
+			}
+		}
+
+		registrations = append(registrations, r)
+	}
+
+	return registrations
+}
+
+func resolveRestEndpoints(registrations []restEndpointRegistration) []RestEndpoint {
+	var endpoints []RestEndpoint
+
+	for _, r := range registrations {
+		e := r.endpoint
+		resolve := func(node *uast.Node) string {
+			if value, ok := resolveString(node, r.className); ok {
+				return value
+			}
+			return expressionString(node)
+		}
+
+		for _, route := range r.routes {
+			// Methods are enum constants, only the constant matters, i.e.
+			// GET or RestRequest.Method.GET
+			method := route[0].Token
+			if route[0].InternalType == "QualifiedName" && len(route[0].Children) > 0 {
+				method = route[0].Children[len(route[0].Children)-1].Token
+			}
+			e.Routes = append(e.Routes, RestRoute{Method: method, Path: resolve(route[1])})
+		}
+
+		seen := map[string]bool{}
+		for _, node := range r.parameters {
+			parameter := resolve(node)
+			if !seen[parameter] {
+				seen[parameter] = true
+				e.Parameters = append(e.Parameters, parameter)
+			}
+		}
+		sort.Strings(e.Parameters)
+
+		endpoints = append(endpoints, e)
+	}
+
+	sort.Slice(endpoints, func(i, j int) bool { return endpoints[i].Class < endpoints[j].Class })
+
+	return endpoints
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sort"
+)
+
+// RestParameterChange lists the parameters of a route that were added or
+// removed between two extractions.
+type RestParameterChange struct {
+	Route   RestRoute `json:"route"`
+	Added   []string  `json:"added,omitempty"`
+	Removed []string  `json:"removed,omitempty"`
+}
+
+// RestDiff is the result of comparing the REST endpoints of two extractions.
+type RestDiff struct {
+	AddedRoutes      []RestRoute           `json:"added_routes"`
+	RemovedRoutes    []RestRoute           `json:"removed_routes"`
+	ParameterChanges []RestParameterChange `json:"parameter_changes"`
+}
+
+// Breaking reports whether client scripts could break: a route or a
+// parameter they may be using is gone.
+func (d RestDiff) Breaking() bool {
+	if len(d.RemovedRoutes) > 0 {
+		return true
+	}
+	for _, c := range d.ParameterChanges {
+		if len(c.Removed) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func readRestEndpoints(fileName string) ([]RestEndpoint, error) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc RestEndpointsDocument
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, fmt.Errorf("%s: %v", fileName, err)
+	}
+	return doc.Endpoints, nil
+}
+
+// parametersByRoute maps every route to the parameters read by the handler
+// serving it.
+func parametersByRoute(endpoints []RestEndpoint) map[RestRoute]map[string]bool {
+	routes := map[RestRoute]map[string]bool{}
+	for _, e := range endpoints {
+		for _, route := range e.Routes {
+			if routes[route] == nil {
+				routes[route] = map[string]bool{}
+			}
+			for _, p := range e.Parameters {
+				routes[route][p] = true
+			}
+		}
+	}
+	return routes
+}
+
+func diffRestEndpoints(old, new []RestEndpoint) RestDiff {
+	oldRoutes := parametersByRoute(old)
+	newRoutes := parametersByRoute(new)
+
+	var d RestDiff
+	for route, newParameters := range newRoutes {
+		oldParameters, ok := oldRoutes[route]
+		if !ok {
+			d.AddedRoutes = append(d.AddedRoutes, route)
+			continue
+		}
+		change := RestParameterChange{Route: route}
+		for p := range newParameters {
+			if !oldParameters[p] {
+				change.Added = append(change.Added, p)
+			}
+		}
+		for p := range oldParameters {
+			if !newParameters[p] {
+				change.Removed = append(change.Removed, p)
+			}
+		}
+		if len(change.Added) > 0 || len(change.Removed) > 0 {
+			sort.Strings(change.Added)
+			sort.Strings(change.Removed)
+			d.ParameterChanges = append(d.ParameterChanges, change)
+		}
+	}
+	for route := range oldRoutes {
+		if _, ok := newRoutes[route]; !ok {
+			d.RemovedRoutes = append(d.RemovedRoutes, route)
+		}
+	}
+
+	sortRoutes(d.AddedRoutes)
+	sortRoutes(d.RemovedRoutes)
+	sort.Slice(d.ParameterChanges, func(i, j int) bool {
+		return routeLess(d.ParameterChanges[i].Route, d.ParameterChanges[j].Route)
+	})
+
+	return d
+}
+
+func routeLess(a, b RestRoute) bool {
+	if a.Path != b.Path {
+		return a.Path < b.Path
+	}
+	return a.Method < b.Method
+}
+
+func sortRoutes(routes []RestRoute) {
+	sort.Slice(routes, func(i, j int) bool { return routeLess(routes[i], routes[j]) })
+}
+
+func writeRestDiffText(w io.Writer, d RestDiff) {
+	for _, r := range d.AddedRoutes {
+		fmt.Fprintf(w, "+ %s %s\n", r.Method, r.Path)
+	}
+	for _, r := range d.RemovedRoutes {
+		fmt.Fprintf(w, "- %s %s\n", r.Method, r.Path)
+	}
+	for _, c := range d.ParameterChanges {
+		fmt.Fprintf(w, "~ %s %s\n", c.Route.Method, c.Route.Path)
+		for _, p := range c.Added {
+			fmt.Fprintf(w, "    + %s\n", p)
+		}
+		for _, p := range c.Removed {
+			fmt.Fprintf(w, "    - %s\n", p)
+		}
+	}
+}
+
+func runRestDiff(args []string) {
+	flags := flag.NewFlagSet("rest-diff", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh rest-diff <old-rest.json> <new-rest.json>")
+		fmt.Fprintln(os.Stderr, "Compares REST routes and the parameters they read, produced with -rest.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	old, err := readRestEndpoints(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	new, err := readRestEndpoints(flags.Arg(1))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	d := diffRestEndpoints(old, new)
+	writeRestDiffText(os.Stdout, d)
+
+	if d.Breaking() {
+		exitWith(exitBreakingChanges, nil)
+	}
+}
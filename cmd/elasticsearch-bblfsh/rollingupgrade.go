@@ -0,0 +1,137 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// RollingUpgradeCaution is a setting that behaves differently on the old and
+// new nodes of a cluster in the middle of a rolling upgrade.
+type RollingUpgradeCaution struct {
+	Name   string `json:"name"`
+	Scope  string `json:"scope"`
+	Reason string `json:"reason"`
+	Detail string `json:"detail"`
+}
+
+// RollingUpgradeReport is the output of the rolling-upgrade subcommand.
+type RollingUpgradeReport struct {
+	BuildInfo
+	From     string                  `json:"from"`
+	To       string                  `json:"to"`
+	Cautions []RollingUpgradeCaution `json:"cautions"`
+}
+
+func isDynamic(s ElasticsearchSetting) bool {
+	return updateBadge(s) == "dynamic"
+}
+
+// rollingUpgradeCautions looks at a settings diff from the point of view of
+// a mixed version cluster: the master validates cluster settings updates
+// against its own version while every node applies them with its own.
+func rollingUpgradeCautions(d SettingsDiff) []RollingUpgradeCaution {
+	var cautions []RollingUpgradeCaution
+	add := func(s ElasticsearchSetting, reason, detail string) {
+		cautions = append(cautions, RollingUpgradeCaution{Name: s.Name, Scope: s.Scope(), Reason: reason, Detail: detail})
+	}
+
+	for _, s := range d.Removed {
+		switch {
+		case s.Scope() == "index":
+			add(s, "removed", "indices setting it get it archived by upgraded nodes")
+		case isDynamic(s):
+			add(s, "removed", "a persistent or transient value is archived by upgraded nodes, remove it before upgrading")
+		default:
+			add(s, "removed", "upgraded nodes fail to start with it in elasticsearch.yml, remove it before upgrading")
+		}
+	}
+
+	for _, r := range d.Renamed {
+		add(r.Old, "renamed", fmt.Sprintf("upgraded nodes read %s instead, set both until every node is upgraded", r.New.Name))
+	}
+
+	for _, c := range d.Changed {
+		for _, field := range c.Fields {
+			switch field {
+			case "java_type":
+				if isDynamic(c.Old) || isDynamic(c.New) {
+					add(c.New, "type-changed", fmt.Sprintf("%s on old nodes, %s on upgraded ones, a value accepted by one master may be rejected by the other", c.Old.JavaType, c.New.JavaType))
+				}
+			case "default_arg":
+				add(c.New, "default-changed", fmt.Sprintf("old nodes default to %s, upgraded ones to %s, set it explicitly to keep them consistent", c.Old.DefaultArg, c.New.DefaultArg))
+			case "properties":
+				switch {
+				case isDynamic(c.Old) && !isDynamic(c.New):
+					add(c.New, "became-static", "updates through the settings API are rejected once the master is upgraded")
+				case !isDynamic(c.Old) && isDynamic(c.New):
+					add(c.New, "became-dynamic", "can only be updated through the settings API once the master is upgraded")
+				}
+				if c.Old.Scope() != c.New.Scope() {
+					add(c.New, "scope-changed", fmt.Sprintf("%s scope on old nodes, %s scope on upgraded ones", c.Old.Scope(), c.New.Scope()))
+				}
+			}
+		}
+	}
+
+	for _, s := range d.Added {
+		if isDynamic(s) {
+			add(s, "added", "old nodes reject it as unknown, only set it once every node is upgraded")
+		}
+	}
+
+	return cautions
+}
+
+func runRollingUpgrade(args []string) {
+	flags := flag.NewFlagSet("rolling-upgrade", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "write the caution list as JSON")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh rolling-upgrade <old.json> <new.json>")
+		fmt.Fprintln(os.Stderr, "Lists the settings that behave differently on old and upgraded nodes during a rolling upgrade between the two versions.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	oldFile, newFile := flags.Arg(0), flags.Arg(1)
+	oldSettings, err := readSettings(oldFile)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	newSettings, err := readSettings(newFile)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	report := RollingUpgradeReport{
+		BuildInfo: buildInfo(),
+		From:      oldFile,
+		To:        newFile,
+		Cautions:  rollingUpgradeCautions(diffSettings(oldSettings, newSettings)),
+	}
+	if report.Cautions == nil {
+		report.Cautions = []RollingUpgradeCaution{}
+	}
+
+	if *asJSON {
+		if err := writeJSON("-", report); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		return
+	}
+
+	for _, c := range report.Cautions {
+		scope := c.Scope
+		if scope == "" {
+			scope = "unscoped"
+		}
+		fmt.Printf("%s (%s, %s): %s\n", c.Name, scope, strings.Replace(c.Reason, "-", " ", -1), c.Detail)
+	}
+}
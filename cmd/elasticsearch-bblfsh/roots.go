@@ -0,0 +1,6 @@
+package main
+
+// Static release builds run in scratch and distroless images without a CA
+// bundle. The Mozilla roots are used then for S3, GCS, Elasticsearch, Kafka
+// and self-update, the system roots whenever there are any.
+import _ "golang.org/x/crypto/x509roots/fallback"
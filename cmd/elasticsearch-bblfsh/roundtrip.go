@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// elasticsearchImage is the image the round-trip boots a node of, tagged
+// with the version.
+const elasticsearchImage = "docker.elastic.co/elasticsearch/elasticsearch"
+
+// roundTripIndex is the index the index settings are set on.
+const roundTripIndex = "elasticsearch-bblfsh-round-trip"
+
+// RoundTripResult is the outcome of setting one setting to its default.
+type RoundTripResult struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+	// Key is the key set, an example key for affix settings
+	Key      string `json:"key"`
+	Scope    string `json:"scope"`
+	Accepted bool   `json:"accepted"`
+	Error    string `json:"error,omitempty"`
+}
+
+// RoundTripReport is the output of the round-trip subcommand.
+type RoundTripReport struct {
+	BuildInfo
+	ElasticsearchVersion string            `json:"elasticsearch_version"`
+	Checked              int               `json:"checked"`
+	Rejected             int               `json:"rejected"`
+	Skipped              int               `json:"skipped"`
+	Results              []RoundTripResult `json:"results"`
+}
+
+// roundTripValue returns the default of a setting as it's given to the
+// settings API, when it's a value rather than computed at runtime.
+func roundTripValue(s ElasticsearchSetting) (string, bool) {
+	if s.NormalizedDefault != nil {
+		v := s.NormalizedDefault.settingValue()
+		// Fractional sizes like 22.4gb are deprecated, bytes are exact
+		if v.Kind == valueBytes && v.Number >= 0 {
+			return strconv.FormatInt(int64(v.Number), 10) + "b", true
+		}
+		return formatSettingValue(v), true
+	}
+	if value, err := strconv.Unquote(s.DefaultArg); err == nil {
+		return value, true
+	}
+	switch s.JavaType {
+	case "Boolean":
+		if _, err := strconv.ParseBool(s.DefaultArg); err == nil {
+			return s.DefaultArg, true
+		}
+	case "Integer", "Long", "Float", "Double":
+		value := strings.TrimRight(s.DefaultArg, "LlFfDd")
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// roundTripKey is the key a setting is set with, affix settings are set
+// through one of their example keys.
+func roundTripKey(s ElasticsearchSetting) (string, bool) {
+	if !strings.Contains(s.Name, "*") {
+		return s.Name, true
+	}
+	if len(s.ExampleKeys) > 0 {
+		return s.ExampleKeys[0], true
+	}
+	return "", false
+}
+
+// esErrorReason returns the reason of an Elasticsearch error response.
+func esErrorReason(body []byte) string {
+	var res struct {
+		Error struct {
+			Reason string `json:"reason"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || res.Error.Reason == "" {
+		return strings.TrimSpace(string(body))
+	}
+	return res.Error.Reason
+}
+
+// hasSecurity reports whether a node of an image and a version knows
+// xpack.security.enabled: the OSS images and the versions before X-Pack
+// refuse to start with a setting they don't know.
+func hasSecurity(image, version string) bool {
+	return !strings.HasSuffix(image, "-oss") && compareVersions(version, "5.0.0") >= 0
+}
+
+// startElasticsearch starts a single node cluster of a version in Docker,
+// without security, and returns its URL and container.
+func startElasticsearch(version, image string) (string, string, error) {
+	container := fmt.Sprintf("elasticsearch-bblfsh-round-trip-%d", os.Getpid())
+	args := []string{"run", "-d", "--rm", "--name", container, "-p", "127.0.0.1::9200",
+		"-e", "discovery.type=single-node", "-e", "ES_JAVA_OPTS=-Xms1g -Xmx1g"}
+	if hasSecurity(image, version) {
+		args = append(args, "-e", "xpack.security.enabled=false")
+	}
+	err := runCommand("docker", append(args, image+":"+version)...)
+	if err != nil {
+		return "", "", err
+	}
+	out, err := exec.Command("docker", "port", container, "9200").Output()
+	if err != nil {
+		return "", container, fmt.Errorf("docker port: %v", err)
+	}
+	// One line per address family, the first will do
+	address := strings.TrimSpace(strings.SplitN(string(out), "\n", 2)[0])
+	return "http://" + address, container, nil
+}
+
+// waitForElasticsearch waits for the cluster to answer and returns its
+// version.
+func waitForElasticsearch(sink *esSink, timeout time.Duration) (string, error) {
+	sink.client.Timeout = 5 * time.Second
+	defer func() { sink.client.Timeout = time.Minute }()
+	for deadline := time.Now().Add(timeout); time.Now().Before(deadline); time.Sleep(2 * time.Second) {
+		status, body, err := sink.request(http.MethodGet, "/_cluster/health?wait_for_status=yellow&timeout=1s", "application/json", nil)
+		if err != nil || status != http.StatusOK {
+			continue
+		}
+		status, body, err = sink.request(http.MethodGet, "/", "application/json", nil)
+		if err != nil || status != http.StatusOK {
+			continue
+		}
+		var info struct {
+			Version struct {
+				Number string `json:"number"`
+			} `json:"version"`
+		}
+		json.Unmarshal(body, &info)
+		return info.Version.Number, nil
+	}
+	return "", fmt.Errorf("%s didn't come up within %s", sink.url, timeout)
+}
+
+// roundTrip sets every dynamic setting with a default value to it and
+// resets it, cluster settings through _cluster/settings and index settings
+// on an index created for it. Settings the cluster already has a value for
+// are left alone.
+func roundTrip(sink *esSink, settings []ElasticsearchSetting) (RoundTripReport, error) {
+	report := RoundTripReport{BuildInfo: buildInfo(), Results: []RoundTripResult{}}
+
+	status, body, err := sink.request(http.MethodGet, "/_cluster/settings?flat_settings=true", "application/json", nil)
+	if err != nil {
+		return report, err
+	}
+	if status != http.StatusOK {
+		return report, fmt.Errorf("reading the cluster settings: %s", esErrorReason(body))
+	}
+	var existing struct {
+		Persistent map[string]interface{} `json:"persistent"`
+		Transient  map[string]interface{} `json:"transient"`
+	}
+	if err := json.Unmarshal(body, &existing); err != nil {
+		return report, err
+	}
+
+	if status, body, err = sink.request(http.MethodPut, "/"+roundTripIndex, "application/json", nil); err != nil {
+		return report, err
+	}
+	if status != http.StatusOK {
+		return report, fmt.Errorf("creating %s: %s", roundTripIndex, esErrorReason(body))
+	}
+	defer sink.request(http.MethodDelete, "/"+roundTripIndex, "application/json", nil)
+
+	seen := map[string]bool{}
+	for _, s := range settings {
+		if updateBadge(s) != "dynamic" || seen[s.Name] {
+			continue
+		}
+		seen[s.Name] = true
+		value, ok := roundTripValue(s)
+		key, hasKey := roundTripKey(s)
+		_, persistent := existing.Persistent[key]
+		_, transient := existing.Transient[key]
+		if !ok || !hasKey || persistent || transient {
+			report.Skipped++
+			continue
+		}
+
+		result := RoundTripResult{Name: s.Name, Value: value, Key: key, Scope: s.Scope()}
+		var path string
+		var set, reset []byte
+		if result.Scope == "index" {
+			path = "/" + roundTripIndex + "/_settings"
+			set, _ = json.Marshal(map[string]interface{}{key: value})
+			reset, _ = json.Marshal(map[string]interface{}{key: nil})
+		} else {
+			path = "/_cluster/settings"
+			set, _ = json.Marshal(map[string]interface{}{"persistent": map[string]interface{}{key: value}})
+			reset, _ = json.Marshal(map[string]interface{}{"persistent": map[string]interface{}{key: nil}})
+		}
+
+		status, body, err := sink.request(http.MethodPut, path, "application/json", set)
+		if err != nil {
+			return report, err
+		}
+		result.Accepted = status == http.StatusOK
+		if result.Accepted {
+			if status, body, err := sink.request(http.MethodPut, path, "application/json", reset); err != nil || status != http.StatusOK {
+				logger.Warn("couldn't reset a setting", "key", key, "error", err, "response", esErrorReason(body))
+			}
+		} else {
+			result.Error = esErrorReason(body)
+			report.Rejected++
+		}
+		report.Checked++
+		report.Results = append(report.Results, result)
+	}
+	return report, nil
+}
+
+func runRoundTrip(args []string) {
+	flags := flag.NewFlagSet("round-trip", flag.ExitOnError)
+	version := flags.String("es-version", "", "Elasticsearch version to boot a node of in Docker, the one the settings were extracted from")
+	image := flags.String("image", elasticsearchImage, "image to boot the node from, tagged with -es-version")
+	esURL := flags.String("es-url", "", "use the cluster at this URL instead of booting one, it should be a throwaway cluster")
+	esUser := flags.String("es-user", "", "user to authenticate to -es-url with, the password is read from ELASTICSEARCH_PASSWORD. ELASTICSEARCH_API_KEY is used instead if set")
+	timeout := flags.Duration("timeout", 3*time.Minute, "how long to wait for the node to come up")
+	keepContainer := flags.Bool("keep-container", false, "leave the node running afterwards, to look into a rejected setting")
+	asJSON := flags.Bool("json", false, "write the report as JSON")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh round-trip (-es-version v | -es-url url) <settings.json>")
+		fmt.Fprintln(os.Stderr, "Sets every dynamic setting of an extraction to its default on a real node and checks the node accepts it, to validate the extracted names, scopes and defaults end to end.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || (*version == "") == (*esURL == "") {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	settings, err := readSettings(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	sortSettings(settings)
+
+	// Removes the node booted for the round-trip, exiting doesn't run
+	// deferred calls
+	cleanup := func() {}
+	url := *esURL
+	if url == "" {
+		if _, err := exec.LookPath("docker"); err != nil {
+			exitWith(exitRuntimeError, errors.New("booting a node needs docker, give the -es-url of a cluster otherwise"))
+		}
+		var container string
+		url, container, err = startElasticsearch(*version, *image)
+		if container != "" && !*keepContainer {
+			cleanup = func() { exec.Command("docker", "rm", "-f", container).Run() }
+		}
+		if err != nil {
+			cleanup()
+			exitWith(exitRuntimeError, fmt.Errorf("starting Elasticsearch: %v", err))
+		}
+	}
+
+	sink := newESSink(url, "", *esUser)
+	running, err := waitForElasticsearch(sink, *timeout)
+	if err != nil {
+		cleanup()
+		exitWith(exitRuntimeError, err)
+	}
+	report, err := roundTrip(sink, settings)
+	cleanup()
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	report.ElasticsearchVersion = running
+
+	printRoundTrip(report, *asJSON)
+	if report.Rejected > 0 {
+		exitWith(exitLintFindings, nil)
+	}
+}
+
+func printRoundTrip(report RoundTripReport, asJSON bool) {
+	if asJSON {
+		if err := writeJSON("-", report); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		return
+	}
+	for _, r := range report.Results {
+		if !r.Accepted {
+			fmt.Printf("%s = %s: %s\n", r.Key, r.Value, r.Error)
+		}
+	}
+	fmt.Printf("Elasticsearch %s accepted %d of %d dynamic settings set to their default, %d skipped as computed at runtime, already set or affix settings without an example key\n",
+		report.ElasticsearchVersion, report.Checked-report.Rejected, report.Checked, report.Skipped)
+}
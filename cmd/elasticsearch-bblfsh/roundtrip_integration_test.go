@@ -0,0 +1,62 @@
+//go:build integration
+
+package main
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+// TestRoundTripIntegration boots a node in Docker and round-trips a few
+// settings through it. It runs with go test -tags integration, against
+// ELASTICSEARCH_BBLFSH_IT_VERSION, 8.11.0 by default, of
+// ELASTICSEARCH_BBLFSH_IT_IMAGE.
+func TestRoundTripIntegration(t *testing.T) {
+	if _, err := exec.LookPath("docker"); err != nil {
+		t.Skip("the integration test needs docker")
+	}
+	version := os.Getenv("ELASTICSEARCH_BBLFSH_IT_VERSION")
+	if version == "" {
+		version = "8.11.0"
+	}
+	image := os.Getenv("ELASTICSEARCH_BBLFSH_IT_IMAGE")
+	if image == "" {
+		image = elasticsearchImage
+	}
+
+	url, container, err := startElasticsearch(version, image)
+	if container != "" {
+		defer exec.Command("docker", "rm", "-f", container).Run()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink := newESSink(url, "", "")
+	running, err := waitForElasticsearch(sink, 3*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if running != version {
+		t.Errorf("booted %s, want %s", running, version)
+	}
+
+	settings := []ElasticsearchSetting{
+		{Name: "cluster.routing.allocation.enable", JavaType: "String", DefaultArg: `"all"`, Properties: []string{"Dynamic", "NodeScope"}},
+		{Name: "index.refresh_interval", JavaType: "TimeValue", NormalizedDefault: &NormalizedValue{1000, "duration_ms", "1s"}, Properties: []string{"Dynamic", "IndexScope"}},
+		{Name: "index.elasticsearch_bblfsh.unknown", JavaType: "Boolean", DefaultArg: "true", Properties: []string{"Dynamic", "IndexScope"}},
+	}
+	report, err := roundTrip(sink, settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.Checked != 3 || report.Rejected != 1 {
+		t.Fatalf("checked %d and rejected %d settings, want 3 and 1: %+v", report.Checked, report.Rejected, report.Results)
+	}
+	for _, r := range report.Results {
+		if r.Accepted == (r.Name == "index.elasticsearch_bblfsh.unknown") {
+			t.Errorf("%s: accepted %v, %s", r.Name, r.Accepted, r.Error)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import "testing"
+
+func TestHasSecurity(t *testing.T) {
+	for _, tc := range []struct {
+		image, version string
+		want           bool
+	}{
+		{elasticsearchImage, "8.11.0", true},
+		{elasticsearchImage, "6.8.23", true},
+		{elasticsearchImage, "5.6.16", true},
+		{elasticsearchImage + "-oss", "6.8.23", false},
+		{elasticsearchImage + "-oss", "7.10.2", false},
+		{"elasticsearch", "2.4.6", false},
+	} {
+		if got := hasSecurity(tc.image, tc.version); got != tc.want {
+			t.Errorf("hasSecurity(%s, %s) = %v, want %v", tc.image, tc.version, got, tc.want)
+		}
+	}
+}
+
+func TestRoundTripValue(t *testing.T) {
+	for _, tc := range []struct {
+		setting ElasticsearchSetting
+		want    string
+		ok      bool
+	}{
+		{ElasticsearchSetting{JavaType: "Boolean", DefaultArg: "true"}, "true", true},
+		{ElasticsearchSetting{JavaType: "Long", DefaultArg: "10L"}, "10", true},
+		{ElasticsearchSetting{JavaType: "String", DefaultArg: `"all"`}, "all", true},
+		{ElasticsearchSetting{JavaType: "ByteSizeValue", NormalizedDefault: &NormalizedValue{512 << 20, "bytes", "512mb"}}, "536870912b", true},
+		{ElasticsearchSetting{JavaType: "TimeValue", NormalizedDefault: &NormalizedValue{1000, "duration_ms", "1s"}}, "1s", true},
+		{ElasticsearchSetting{JavaType: "Integer", DefaultArg: "computeDefault->settings"}, "", false},
+	} {
+		got, ok := roundTripValue(tc.setting)
+		if got != tc.want || ok != tc.ok {
+			t.Errorf("roundTripValue(%+v) = %q, %v, want %q, %v", tc.setting, got, ok, tc.want, tc.ok)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runLockFile is the file runs lock in the directories they write to.
+const runLockFile = ".elasticsearch-bblfsh.lock"
+
+// runLocks are the lock files the run holds. They're kept open for the
+// whole run, the locks go away with the process however it exits.
+var runLocks []*os.File
+
+// lockHolder is written to a lock file by the run holding it, for the runs
+// waiting on it to tell which one it is.
+type lockHolder struct {
+	PID       int       `json:"pid"`
+	Host      string    `json:"host"`
+	StartedAt time.Time `json:"started_at"`
+	Args      []string  `json:"args"`
+}
+
+func (h lockHolder) String() string {
+	return fmt.Sprintf("pid %d on %s, running since %s: %s", h.PID, h.Host, h.StartedAt.Local().Format("15:04:05"), strings.Join(h.Args, " "))
+}
+
+// readLockHolder returns who holds a lock file, as well as it can tell.
+func readLockHolder(fileName string) string {
+	var holder lockHolder
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil || json.Unmarshal(b, &holder) != nil {
+		return "another run"
+	}
+	return holder.String()
+}
+
+// acquireRunLocks locks the directories the run writes to, the -uast-cache
+// and the output directory, so runs sharing them, i.e. an ad-hoc one and
+// the ones of a daemon, don't write the cache or the outputs at the same
+// time. Without wait, a held lock fails the run rather than waiting for
+// it. Directories are locked in order so two runs never wait on each
+// other.
+func acquireRunLocks(dirs []string, wait bool) error {
+	seen := map[string]bool{}
+	var locked []string
+	for _, dir := range dirs {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return err
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			locked = append(locked, abs)
+		}
+	}
+	sort.Strings(locked)
+
+	host, _ := os.Hostname()
+	holder, err := json.Marshal(lockHolder{PID: os.Getpid(), Host: host, StartedAt: time.Now().UTC(), Args: os.Args})
+	if err != nil {
+		return err
+	}
+	for _, dir := range locked {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		fileName := filepath.Join(dir, runLockFile)
+		f, err := os.OpenFile(fileName, os.O_RDWR|os.O_CREATE, 0644)
+		if err != nil {
+			return err
+		}
+		ok, err := lockFile(f, false)
+		if err == nil && !ok {
+			if !wait {
+				f.Close()
+				return fmt.Errorf("%s is in use by %s. Run again once it's done, or with -wait to wait for it", dir, readLockHolder(fileName))
+			}
+			if !quiet {
+				fmt.Fprintf(os.Stderr, "waiting for %s to be done with %s\n", readLockHolder(fileName), dir)
+			}
+			ok, err = lockFile(f, true)
+		}
+		if err != nil {
+			f.Close()
+			return fmt.Errorf("locking %s: %v", dir, err)
+		}
+		runLocks = append(runLocks, f)
+
+		// Only informational, a failure to write it doesn't make the lock
+		// any less held
+		if f.Truncate(0) == nil {
+			f.WriteAt(holder, 0)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,37 @@
+package main
+
+import "hash/fnv"
+
+// sampleRate is set by -sample to only process a fraction of the Java
+// files, and fileLimit by -limit to stop after that many, for smoke runs
+// checking the setup before a full one.
+var (
+	sampleRate = 1.0
+	fileLimit  int
+)
+
+// filesSampledOut counts the Java files left out of the -sample.
+var filesSampledOut int
+
+// inSample tells whether a file is in the -sample. Files are picked by a
+// hash of their path, so every run over the tree picks the same ones
+// whatever the order of the walk.
+func inSample(rel string) bool {
+	if sampleRate >= 1 {
+		return true
+	}
+	h := fnv.New32a()
+	h.Write([]byte(rel))
+	return float64(h.Sum32()%10000) < sampleRate*10000
+}
+
+// limitReached tells whether the run processed its -limit of files.
+func limitReached() bool {
+	return fileLimit > 0 && len(runManifest.Files) >= fileLimit
+}
+
+// sampledRun tells whether the run leaves files out on purpose, its output
+// is then partial too.
+func sampledRun() bool {
+	return sampleRate < 1 || fileLimit > 0
+}
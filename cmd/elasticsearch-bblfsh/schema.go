@@ -0,0 +1,297 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// settingsSchema is the JSON Schema describing the output document. It's the
+// contract downstream tooling codes against, keep it in sync with
+// SettingsDocument and ElasticsearchSetting.
+//
+//go:embed settings.schema.json
+var settingsSchema []byte
+
+// jsonSchema is the subset of JSON Schema settings.schema.json uses.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 interface{}            `json:"type"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	Required             []string               `json:"required"`
+	AdditionalProperties *bool                  `json:"additionalProperties"`
+	Items                *jsonSchema            `json:"items"`
+	OneOf                []*jsonSchema          `json:"oneOf"`
+	Minimum              *float64               `json:"minimum"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+}
+
+func loadSettingsSchema() (*jsonSchema, error) {
+	var schema jsonSchema
+	if err := json.Unmarshal(settingsSchema, &schema); err != nil {
+		return nil, fmt.Errorf("settings.schema.json: %v", err)
+	}
+	return &schema, nil
+}
+
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	default:
+		return "object"
+	}
+}
+
+func (s *jsonSchema) allowsType(actual string) bool {
+	var allowed []string
+	switch t := s.Type.(type) {
+	case nil:
+		return true
+	case string:
+		allowed = []string{t}
+	case []interface{}:
+		for _, a := range t {
+			allowed = append(allowed, fmt.Sprint(a))
+		}
+	}
+	for _, a := range allowed {
+		if a == actual || (a == "number" && actual == "integer") {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *jsonSchema) resolve(root *jsonSchema) *jsonSchema {
+	if s.Ref != "" {
+		return root.Definitions[strings.TrimPrefix(s.Ref, "#/definitions/")]
+	}
+	return s
+}
+
+// validate returns a description of every way value doesn't match schema.
+// root is used to resolve references to definitions.
+func (s *jsonSchema) validate(root *jsonSchema, value interface{}, at string) []string {
+	if s.Ref != "" {
+		return s.resolve(root).validate(root, value, at)
+	}
+
+	if len(s.OneOf) > 0 {
+		// Report the errors of the option meant for this type of value,
+		// the others would only complain about the type
+		var closest []string
+		for _, option := range s.OneOf {
+			errs := option.validate(root, value, at)
+			if len(errs) == 0 {
+				return nil
+			}
+			if closest == nil || option.resolve(root).allowsType(jsonType(value)) {
+				closest = errs
+			}
+		}
+		return closest
+	}
+
+	actual := jsonType(value)
+	if !s.allowsType(actual) {
+		return []string{fmt.Sprintf("%s: expected %v, got %s", at, s.Type, actual)}
+	}
+
+	var errs []string
+	switch v := value.(type) {
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			errs = append(errs, fmt.Sprintf("%s: %v is less than the minimum %v", at, v, *s.Minimum))
+		}
+	case []interface{}:
+		if s.Items != nil {
+			for i, item := range v {
+				errs = append(errs, s.Items.validate(root, item, fmt.Sprintf("%s[%d]", at, i))...)
+			}
+		}
+	case map[string]interface{}:
+		for _, required := range s.Required {
+			if _, ok := v[required]; !ok {
+				errs = append(errs, fmt.Sprintf("%s: missing required property %q", at, required))
+			}
+		}
+		var keys []string
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			property, ok := s.Properties[key]
+			if !ok {
+				if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+					errs = append(errs, fmt.Sprintf("%s: unexpected property %q", at, key))
+				}
+				continue
+			}
+			errs = append(errs, property.validate(root, v[key], at+"."+key)...)
+		}
+	}
+
+	return errs
+}
+
+// schemaOf describes the JSON encoding of a Go type as a JSON Schema, for
+// the documents that don't have a hand written one like settings.
+func schemaOf(t reflect.Type) map[string]interface{} {
+	switch t.Kind() {
+	case reflect.Ptr:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": []string{"array", "null"}, "items": schemaOf(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t == reflect.TypeOf(time.Time{}) {
+			return map[string]interface{}{"type": "string", "format": "date-time"}
+		}
+		properties := map[string]interface{}{}
+		required := []string{}
+		addStructProperties(t, properties, &required)
+		return map[string]interface{}{"type": "object", "properties": properties, "required": required}
+	}
+	return map[string]interface{}{}
+}
+
+func addStructProperties(t reflect.Type, properties map[string]interface{}, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || field.PkgPath != "" {
+			continue
+		}
+		// Embedded structs like BuildInfo are flattened into their parent
+		if field.Anonymous && tag == "" {
+			addStructProperties(field.Type, properties, required)
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		name := parts[0]
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = schemaOf(field.Type)
+		omitempty := false
+		for _, option := range parts[1:] {
+			if option == "omitempty" {
+				omitempty = true
+			}
+		}
+		if !omitempty {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func runSchema(args []string) {
+	flags := flag.NewFlagSet("schema", flag.ExitOnError)
+	format := flags.String("format", "json", "schema to print: json for the JSON Schema, proto for the protobuf definition, avro for the Avro schema, openapi for the OpenAPI document of the serve API, graphql for the GraphQL schema of its /graphql, grpc for its gRPC service or es-template for the index template -es-url puts in place")
+	esIndex := flags.String("es-index", "elasticsearch-settings", "index pattern of the es-template")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh schema [-format json|proto|avro|openapi|graphql|grpc|es-template]")
+		fmt.Fprintln(os.Stderr, "Prints the schema of the settings output.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	switch *format {
+	case "json":
+		os.Stdout.Write(settingsSchema)
+	case "proto":
+		os.Stdout.Write(settingsProto)
+	case "avro":
+		os.Stdout.Write(settingsAvroSchema)
+	case "openapi":
+		os.Stdout.Write(openAPISpec)
+	case "graphql":
+		fmt.Print(graphQLSchema)
+	case "grpc":
+		os.Stdout.Write(settingsServiceProto)
+	case "es-template":
+		prettyJSON = true
+		if err := writeJSON("-", esIndexTemplate(*esIndex)); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	default:
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+}
+
+func runValidate(args []string) {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh validate <file>...")
+		fmt.Fprintln(os.Stderr, "Checks previously extracted settings against the published JSON Schema.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	schema, err := loadSettingsSchema()
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	invalid := false
+
+	for _, fileName := range flags.Args() {
+		b, err := ioutil.ReadFile(fileName)
+		if err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(b, &value); err != nil {
+			exitWith(exitRuntimeError, fmt.Errorf("%s: %v", fileName, err))
+		}
+
+		errs := schema.validate(schema, value, "$")
+		for _, e := range errs {
+			fmt.Printf("%s: %s\n", fileName, e)
+		}
+		if len(errs) > 0 {
+			invalid = true
+		}
+	}
+
+	if invalid {
+		exitWith(exitLintFindings, nil)
+	}
+}
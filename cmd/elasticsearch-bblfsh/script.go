@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+
+	starlarkjson "go.starlark.net/lib/json"
+	"go.starlark.net/starlark"
+)
+
+// settingsScript is the -script transforming every setting before it's
+// written out, nil without one.
+var settingsScript *settingScript
+
+// settingsDropped counts the settings the script left out.
+var settingsDropped int
+
+// settingScript runs a Starlark script defining
+//
+//	def transform(setting):
+//	    ...
+//	    return setting
+//
+// over every extracted setting. The setting is a dict with the fields of
+// the JSON output, the script may change them, add tags or return None to
+// leave the setting out. Besides the Starlark builtins the script has the
+// json module (json.encode, json.decode), and print goes to the log at the
+// info level.
+type settingScript struct {
+	fileName  string
+	thread    *starlark.Thread
+	transform starlark.Callable
+}
+
+func loadSettingScript(fileName string) (*settingScript, error) {
+	src, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	thread := &starlark.Thread{
+		Name: fileName,
+		Print: func(_ *starlark.Thread, msg string) {
+			logger.Info(msg, "script", fileName)
+		},
+	}
+	predeclared := starlark.StringDict{"json": starlarkjson.Module}
+	globals, err := starlark.ExecFile(thread, fileName, src, predeclared)
+	if err != nil {
+		return nil, scriptError(err)
+	}
+
+	transform, ok := globals["transform"].(starlark.Callable)
+	if !ok {
+		return nil, fmt.Errorf("%s doesn't define a transform(setting) function", fileName)
+	}
+	return &settingScript{fileName: fileName, thread: thread, transform: transform}, nil
+}
+
+// scriptError includes the Starlark stack of an error, which points at the
+// line of the script that failed.
+func scriptError(err error) error {
+	var evalErr *starlark.EvalError
+	if errors.As(err, &evalErr) {
+		return errors.New(evalErr.Backtrace())
+	}
+	return err
+}
+
+// apply runs the script over a file's settings and returns those it kept.
+// Settings go back and forth as JSON, so the script sees exactly the fields
+// of the output and can't set one that doesn't exist.
+func (script *settingScript) apply(settings []ElasticsearchSetting) ([]ElasticsearchSetting, error) {
+	decode := starlarkjson.Module.Members["decode"]
+	encode := starlarkjson.Module.Members["encode"]
+
+	kept := settings[:0]
+	for _, s := range settings {
+		b, err := json.Marshal(s)
+		if err != nil {
+			return nil, err
+		}
+		value, err := starlark.Call(script.thread, decode, starlark.Tuple{starlark.String(b)}, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := starlark.Call(script.thread, script.transform, starlark.Tuple{value}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: transforming %s: %v", script.fileName, s.Name, scriptError(err))
+		}
+		if result == starlark.None {
+			settingsDropped++
+			logger.Debug("setting dropped by script", "setting", s.Name, "file", s.CodeFile)
+			continue
+		}
+		if _, ok := result.(*starlark.Dict); !ok {
+			return nil, fmt.Errorf("%s: transform returned a %s for %s, expected a dict or None", script.fileName, result.Type(), s.Name)
+		}
+
+		encoded, err := starlark.Call(script.thread, encode, starlark.Tuple{result}, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%s: transforming %s: %v", script.fileName, s.Name, err)
+		}
+		var transformed ElasticsearchSetting
+		dec := json.NewDecoder(bytes.NewReader([]byte(encoded.(starlark.String).GoString())))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&transformed); err != nil {
+			return nil, fmt.Errorf("%s: transform returned an invalid setting for %s: %v", script.fileName, s.Name, err)
+		}
+		kept = append(kept, transformed)
+	}
+	return kept, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// KeySegment is one of the dot separated segments setting keys are made of,
+// i.e. "breaker" in indices.breaker.total.limit.
+type KeySegment struct {
+	Segment string `json:"segment"`
+	// Count is how many settings have the segment in their key
+	Count int `json:"count"`
+	// Positions are where the segment appears in keys, 0 for the first
+	// segment, so a segment used both as a namespace and a leaf shows
+	Positions []int    `json:"positions"`
+	Settings  []string `json:"settings"`
+}
+
+// KeySegmentIndex is the output of the segments subcommand.
+type KeySegmentIndex struct {
+	BuildInfo
+	Segments []KeySegment `json:"segments"`
+}
+
+// indexKeySegments returns the distinct segments of the setting keys, the
+// most used first. The * of affix settings stands for any namespace, it
+// isn't a segment.
+func indexKeySegments(settings []ElasticsearchSetting) []KeySegment {
+	type entry struct {
+		positions map[int]bool
+		settings  map[string]bool
+	}
+	entries := map[string]*entry{}
+	for _, s := range settings {
+		for i, segment := range strings.Split(s.Name, ".") {
+			if segment == "" || strings.Contains(segment, "*") {
+				continue
+			}
+			e, ok := entries[segment]
+			if !ok {
+				e = &entry{positions: map[int]bool{}, settings: map[string]bool{}}
+				entries[segment] = e
+			}
+			e.positions[i] = true
+			e.settings[s.Name] = true
+		}
+	}
+
+	segments := make([]KeySegment, 0, len(entries))
+	for segment, e := range entries {
+		k := KeySegment{Segment: segment, Count: len(e.settings)}
+		for position := range e.positions {
+			k.Positions = append(k.Positions, position)
+		}
+		sort.Ints(k.Positions)
+		for name := range e.settings {
+			k.Settings = append(k.Settings, name)
+		}
+		sort.Strings(k.Settings)
+		segments = append(segments, k)
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		if segments[i].Count != segments[j].Count {
+			return segments[i].Count > segments[j].Count
+		}
+		return segments[i].Segment < segments[j].Segment
+	})
+	return segments
+}
+
+func runSegments(args []string) {
+	flags := flag.NewFlagSet("segments", flag.ExitOnError)
+	prefix := flags.String("prefix", "", "only the segments starting with this, i.e. to complete a key being typed")
+	minCount := flags.Int("min-count", 1, "only the segments used by at least this many settings")
+	listSettings := flags.Bool("settings", false, "list the settings under each segment")
+	asJSON := flags.Bool("json", false, "write the index as JSON, with the settings under each segment")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh segments [-prefix p] [-min-count n] [-settings] <settings.json>")
+		fmt.Fprintln(os.Stderr, "Lists the distinct segments of the setting keys, i.e. indices, breaker or recovery, with how many settings use each.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || *minCount < 1 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	settings, err := readSettings(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	index := KeySegmentIndex{BuildInfo: buildInfo(), Segments: []KeySegment{}}
+	for _, segment := range indexKeySegments(settings) {
+		if segment.Count >= *minCount && strings.HasPrefix(segment.Segment, *prefix) {
+			index.Segments = append(index.Segments, segment)
+		}
+	}
+
+	if *asJSON {
+		if err := writeJSON("-", index); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SEGMENT\tSETTINGS\tPOSITIONS")
+	for _, segment := range index.Segments {
+		positions := make([]string, len(segment.Positions))
+		for i, position := range segment.Positions {
+			positions[i] = fmt.Sprint(position)
+		}
+		fmt.Fprintf(w, "%s\t%d\t%s\n", segment.Segment, segment.Count, strings.Join(positions, ","))
+		if *listSettings {
+			for _, name := range segment.Settings {
+				fmt.Fprintf(w, "  %s\t\t\n", name)
+			}
+		}
+	}
+	w.Flush()
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const (
+	defaultReleaseFeed = "https://api.github.com/repos/nickcanz/elasticsearch-bblfsh/releases/latest"
+	checksumsAsset     = "SHA256SUMS"
+	// The signature is the base64 encoded ed25519 signature of
+	// SHA256SUMS
+	signatureAsset = "SHA256SUMS.sig"
+)
+
+// releasePublicKey is the base64 encoded ed25519 key releases are signed
+// with, injected into release builds with
+// -ldflags "-X main.releasePublicKey=...". Builds without one only verify
+// checksums.
+var releasePublicKey = ""
+
+// release is the part of a GitHub release, or a mirror serving the same
+// JSON, that self-update needs.
+type release struct {
+	TagName string `json:"tag_name"`
+	Assets  []struct {
+		Name string `json:"name"`
+		URL  string `json:"browser_download_url"`
+	} `json:"assets"`
+}
+
+func (r release) assetURL(name string) (string, bool) {
+	for _, a := range r.Assets {
+		if a.Name == name {
+			return a.URL, true
+		}
+	}
+	return "", false
+}
+
+// binaryAsset is the name of the release binary for this platform.
+func binaryAsset() string {
+	name := fmt.Sprintf("elasticsearch-bblfsh_%s_%s", runtime.GOOS, runtime.GOARCH)
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
+
+func download(url string) ([]byte, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	// Unauthenticated requests to the GitHub API are heavily rate limited
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" && strings.HasPrefix(url, "https://api.github.com/") {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	res, err := updateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, res.Status)
+	}
+	return b, nil
+}
+
+// verifyChecksum checks binary against its line of a sha256sum style
+// checksums file.
+func verifyChecksum(checksums []byte, name string, binary []byte) error {
+	sum := sha256.Sum256(binary)
+	scanner := bufio.NewScanner(bytes.NewReader(checksums))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.TrimPrefix(fields[1], "*") != name {
+			continue
+		}
+		if fields[0] != hex.EncodeToString(sum[:]) {
+			return fmt.Errorf("checksum mismatch for %s, expected %s, got %x", name, fields[0], sum)
+		}
+		return nil
+	}
+	return fmt.Errorf("%s has no checksum for %s", checksumsAsset, name)
+}
+
+// verifySignature checks the signature of the checksums file against the
+// release key.
+func verifySignature(checksums, signature []byte) error {
+	key, err := base64.StdEncoding.DecodeString(releasePublicKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return errors.New("the release public key built into this binary is invalid")
+	}
+	sig, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("%s: %v", signatureAsset, err)
+	}
+	if !ed25519.Verify(key, checksums, sig) {
+		return fmt.Errorf("%s doesn't match the signature in %s", checksumsAsset, signatureAsset)
+	}
+	return nil
+}
+
+// replaceExecutable swaps the running binary for a new one. The new binary
+// is written next to it first so the swap is a rename on the same file
+// system, and a failed download never leaves a half written executable.
+func replaceExecutable(binary []byte) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(exe), ".elasticsearch-bblfsh-update-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(binary); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return "", err
+	}
+
+	// Windows can't replace a running executable, but it can rename it
+	if runtime.GOOS == "windows" {
+		old := exe + ".old"
+		os.Remove(old)
+		if err := os.Rename(exe, old); err != nil {
+			return "", err
+		}
+	}
+	return exe, os.Rename(tmp.Name(), exe)
+}
+
+func runSelfUpdate(args []string) {
+	flags := flag.NewFlagSet("self-update", flag.ExitOnError)
+	feed := flags.String("feed", defaultReleaseFeed, "URL of the latest release, as JSON in the format of the GitHub releases API")
+	check := flags.Bool("check", false, "only tell whether a newer release is available, exiting with 7 if there is")
+	force := flags.Bool("force", false, "install the latest release even if it isn't newer, i.e. over a dev build")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh self-update [-check] [-force] [-feed url]")
+		fmt.Fprintln(os.Stderr, "Replaces this binary with the latest release for the platform, after verifying its checksum and, for release builds, the signature of the checksums.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 0 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	b, err := download(*feed)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	var latest release
+	if err := json.Unmarshal(b, &latest); err != nil {
+		exitWith(exitRuntimeError, fmt.Errorf("reading the release feed: %v", err))
+	}
+	if latest.TagName == "" {
+		exitWith(exitRuntimeError, errors.New("the release feed has no tag_name"))
+	}
+
+	newer := version == "dev" || compareVersions(latest.TagName, version) > 0
+	if *check {
+		if !newer {
+			fmt.Printf("%s is the latest release\n", version)
+			return
+		}
+		fmt.Printf("%s is available, this is %s\n", latest.TagName, version)
+		exitWith(exitUpdateAvailable, nil)
+	}
+	if version == "dev" && !*force {
+		exitWith(exitUsageError, fmt.Errorf("this is a dev build, use -force to replace it with %s", latest.TagName))
+	}
+	if !newer && !*force {
+		fmt.Printf("%s is the latest release\n", version)
+		return
+	}
+
+	name := binaryAsset()
+	binaryURL, ok := latest.assetURL(name)
+	if !ok {
+		exitWith(exitRuntimeError, fmt.Errorf("release %s has no binary for %s/%s", latest.TagName, runtime.GOOS, runtime.GOARCH))
+	}
+	checksumsURL, ok := latest.assetURL(checksumsAsset)
+	if !ok {
+		exitWith(exitRuntimeError, fmt.Errorf("release %s has no %s, refusing to install an unverified binary", latest.TagName, checksumsAsset))
+	}
+
+	checksums, err := download(checksumsURL)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	if releasePublicKey != "" {
+		signatureURL, ok := latest.assetURL(signatureAsset)
+		if !ok {
+			exitWith(exitRuntimeError, fmt.Errorf("release %s has no %s, refusing to install an unsigned binary", latest.TagName, signatureAsset))
+		}
+		signature, err := download(signatureURL)
+		if err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+		if err := verifySignature(checksums, signature); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	} else {
+		logger.Warn("this build has no release key, only the checksum of the download is verified")
+	}
+
+	binary, err := download(binaryURL)
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	if err := verifyChecksum(checksums, name, binary); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	exe, err := replaceExecutable(binary)
+	if err != nil {
+		exitWith(exitRuntimeError, fmt.Errorf("replacing the binary: %v", err))
+	}
+	fmt.Printf("updated %s from %s to %s\n", exe, version, latest.TagName)
+}
@@ -0,0 +1,408 @@
+package main
+
+import (
+	_ "embed"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// DatasetVersion is a version of the settings the serve API has.
+type DatasetVersion struct {
+	Version      string    `json:"version"`
+	SourceCommit string    `json:"source_commit,omitempty"`
+	ExtractedAt  time.Time `json:"extracted_at"`
+	Settings     int       `json:"settings"`
+}
+
+// settingsDataset is what the serve API serves: the extraction files given
+// to serve, or the versions of a daemon.
+type settingsDataset interface {
+	// versions are the versions of the dataset, the oldest first
+	versions() []DatasetVersion
+	// settings returns the settings of a version, the newest one for "",
+	// and the version they are of
+	settings(version string) ([]ElasticsearchSetting, string, bool, error)
+}
+
+// fileDataset is the dataset of the extraction files given to serve.
+type fileDataset []versionedExtraction
+
+func (d fileDataset) versions() []DatasetVersion {
+	versions := []DatasetVersion{}
+	for _, e := range d {
+		versions = append(versions, DatasetVersion{
+			Version:      e.Version,
+			SourceCommit: e.Document.SourceCommit,
+			ExtractedAt:  e.Document.ExtractedAt,
+			Settings:     len(e.Settings),
+		})
+	}
+	return versions
+}
+
+func (d fileDataset) settings(version string) ([]ElasticsearchSetting, string, bool, error) {
+	if version == "" && len(d) > 0 {
+		return d[len(d)-1].Settings, d[len(d)-1].Version, true, nil
+	}
+	for _, e := range d {
+		if e.Version == version {
+			return e.Settings, e.Version, true, nil
+		}
+	}
+	return nil, "", false, nil
+}
+
+// settingsAPI is the REST API over a dataset:
+//
+//	/api/versions         the versions of the dataset
+//	/api/settings         the settings of a version, filtered, searched,
+//	                      sorted and paged
+//	/api/settings/<name>  a setting, or the affix setting a key is one of
+//	/openapi.json         the OpenAPI document of the API
+//
+// Settings are of the newest version unless ?version= names another.
+type settingsAPI struct {
+	dataset settingsDataset
+}
+
+// register adds the routes of the API to a mux.
+func (api *settingsAPI) register(mux *http.ServeMux) {
+	mux.HandleFunc("/api/versions", api.handleVersions)
+	mux.HandleFunc("/api/settings", api.handleSettings)
+	mux.HandleFunc("/api/settings/", api.handleSetting)
+	mux.HandleFunc("/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(openAPISpec)
+	})
+	mux.HandleFunc(grpcService, api.handleGRPC)
+	mux.HandleFunc("/graphql", api.handleGraphQL)
+	mux.HandleFunc("/graphql/schema.graphql", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(graphQLSchema))
+	})
+}
+
+func writeHTTPError(w http.ResponseWriter, status int, message string) {
+	b, _ := json.Marshal(map[string]string{"error": message})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+// versionSettings returns the settings of the version a request asks for,
+// answering it with an error when they can't be had.
+func (api *settingsAPI) versionSettings(w http.ResponseWriter, r *http.Request) ([]ElasticsearchSetting, string, bool) {
+	if r.Method != http.MethodGet {
+		writeHTTPError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return nil, "", false
+	}
+	settings, version, ok, err := api.dataset.settings(r.URL.Query().Get("version"))
+	if err != nil {
+		writeHTTPError(w, http.StatusInternalServerError, err.Error())
+		return nil, "", false
+	}
+	if !ok {
+		writeHTTPError(w, http.StatusNotFound, "no such version")
+		return nil, "", false
+	}
+	return settings, version, true
+}
+
+func (api *settingsAPI) handleVersions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeHTTPError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	writeHTTPJSON(w, map[string]interface{}{"versions": api.dataset.versions()})
+}
+
+// settingsFilter is what /api/settings is filtered by: q is searched for in
+// the names and defaults, namespace covers whole segments of the names,
+// the others have to match exactly. Dynamic and deprecated are nil when
+// not filtered by.
+type settingsFilter struct {
+	q, scope, property, module, namespace string
+	dynamic, deprecated                   *bool
+}
+
+func (f settingsFilter) matches(s ElasticsearchSetting) bool {
+	q := strings.ToLower(f.q)
+	deprecated := hasProperty(s, "Deprecated") || hasProperty(s, "DeprecatedWarning")
+	switch {
+	case q != "" && !strings.Contains(strings.ToLower(s.Name), q) && !strings.Contains(strings.ToLower(s.DefaultArg), q):
+		return false
+	case f.scope != "" && s.Scope() != f.scope:
+		return false
+	case f.property != "" && !hasProperty(s, f.property):
+		return false
+	case f.module != "" && moduleOf(s.CodeFile) != f.module:
+		return false
+	case f.namespace != "" && !inNamespace(s.Name, f.namespace):
+		return false
+	case f.dynamic != nil && (updateBadge(s) == "dynamic") != *f.dynamic:
+		return false
+	case f.deprecated != nil && deprecated != *f.deprecated:
+		return false
+	}
+	return true
+}
+
+// settingsOrders are the orders /api/settings can sort by, ties broken by
+// name. Settings without a first seen version sort as the newest.
+var settingsOrders = map[string]func(a, b ElasticsearchSetting) int{
+	"name": func(a, b ElasticsearchSetting) int {
+		return strings.Compare(a.Name, b.Name)
+	},
+	"version": func(a, b ElasticsearchSetting) int {
+		switch {
+		case a.FirstSeenVersion == b.FirstSeenVersion:
+			return 0
+		case a.FirstSeenVersion == "":
+			return 1
+		case b.FirstSeenVersion == "":
+			return -1
+		}
+		return compareVersions(a.FirstSeenVersion, b.FirstSeenVersion)
+	},
+	"file": func(a, b ElasticsearchSetting) int {
+		if a.CodeFile != b.CodeFile {
+			return strings.Compare(a.CodeFile, b.CodeFile)
+		}
+		return int(a.CodeLine) - int(b.CodeLine)
+	},
+}
+
+// settingsQuery is a query of /api/settings: its filter, order and page.
+type settingsQuery struct {
+	filter     settingsFilter
+	order      string
+	descending bool
+	limit      int
+	offset     int
+}
+
+// parseSettingsQuery parses the query parameters of /api/settings, for
+// settings of a version.
+func parseSettingsQuery(params url.Values, version string) (settingsQuery, error) {
+	query := settingsQuery{
+		filter: settingsFilter{
+			q:         params.Get("q"),
+			scope:     params.Get("scope"),
+			property:  params.Get("property"),
+			module:    params.Get("module"),
+			namespace: params.Get("namespace"),
+		},
+		order: params.Get("sort"),
+	}
+	for name, filter := range map[string]**bool{"dynamic": &query.filter.dynamic, "deprecated": &query.filter.deprecated} {
+		if value := params.Get(name); value != "" {
+			b, err := strconv.ParseBool(value)
+			if err != nil {
+				return query, fmt.Errorf("%s has to be true or false", name)
+			}
+			*filter = &b
+		}
+	}
+
+	query.descending = strings.HasPrefix(query.order, "-")
+	query.order = strings.TrimPrefix(query.order, "-")
+	if query.order == "" {
+		query.order = "name"
+	}
+	if settingsOrders[query.order] == nil {
+		return query, errors.New("sort has to be name, version or file, prefixed with - to sort descending")
+	}
+
+	if value := params.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 {
+			return query, errors.New("limit has to be a positive number")
+		}
+		query.limit = limit
+	}
+	if cursor := params.Get("cursor"); cursor != "" {
+		offset, ok := query.decodeCursor(cursor, version)
+		if !ok {
+			return query, errors.New("invalid cursor, it has to come from a query with the same filters and sort")
+		}
+		query.offset = offset
+	}
+	return query, nil
+}
+
+// key identifies the settings the query returns the pages of, for a cursor
+// to only be used with the query it comes from.
+func (q settingsQuery) key(version string) string {
+	f := q.filter
+	return strings.Join([]string{version, f.q, f.scope, f.property, f.module, f.namespace,
+		optionalBool(f.dynamic), optionalBool(f.deprecated), q.order, strconv.FormatBool(q.descending)}, "\x00")
+}
+
+func optionalBool(b *bool) string {
+	if b == nil {
+		return ""
+	}
+	return strconv.FormatBool(*b)
+}
+
+// cursor is the opaque cursor of the page starting at offset.
+func (q settingsQuery) cursor(version string, offset int) string {
+	h := fnv.New64a()
+	h.Write([]byte(q.key(version)))
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%x:%d", h.Sum64(), offset)))
+}
+
+func (q settingsQuery) decodeCursor(cursor, version string) (int, bool) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, false
+	}
+	i := strings.LastIndex(string(b), ":")
+	offset, err := strconv.Atoi(string(b[i+1:]))
+	if i < 0 || err != nil || offset < 0 || q.cursor(version, offset) != cursor {
+		return 0, false
+	}
+	return offset, true
+}
+
+// run returns the page of the settings of a version the query asks for,
+// how many settings match and the cursor of the next page, empty on the
+// last one.
+func (q settingsQuery) run(settings []ElasticsearchSetting, version string) ([]ElasticsearchSetting, int, string) {
+	matching := []ElasticsearchSetting{}
+	for _, s := range settings {
+		if q.filter.matches(s) {
+			matching = append(matching, s)
+		}
+	}
+	compare := settingsOrders[q.order]
+	sort.SliceStable(matching, func(i, j int) bool {
+		c := compare(matching[i], matching[j])
+		if q.descending {
+			c = -c
+		}
+		if c == 0 {
+			return matching[i].Name < matching[j].Name
+		}
+		return c < 0
+	})
+
+	page := matching
+	if q.offset < len(page) {
+		page = page[q.offset:]
+	} else {
+		page = page[:0]
+	}
+	if q.limit > 0 && len(page) > q.limit {
+		return page[:q.limit], len(matching), q.cursor(version, q.offset+q.limit)
+	}
+	return page, len(matching), ""
+}
+
+func (api *settingsAPI) handleSettings(w http.ResponseWriter, r *http.Request) {
+	settings, version, ok := api.versionSettings(w, r)
+	if !ok {
+		return
+	}
+	query, err := parseSettingsQuery(r.URL.Query(), version)
+	if err != nil {
+		writeHTTPError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	page, total, next := query.run(settings, version)
+	res := map[string]interface{}{"version": version, "total": total, "settings": page}
+	if next != "" {
+		res["next_cursor"] = next
+	}
+	writeHTTPJSON(w, res)
+}
+
+func (api *settingsAPI) handleSetting(w http.ResponseWriter, r *http.Request) {
+	settings, version, ok := api.versionSettings(w, r)
+	if !ok {
+		return
+	}
+	name := strings.TrimPrefix(r.URL.Path, "/api/settings/")
+	if setting, ok := settingsByName(settings)[name]; ok {
+		writeHTTPJSON(w, map[string]interface{}{"version": version, "setting": setting})
+		return
+	}
+	if setting, ok := affixSettingOf(settings, name); ok {
+		writeHTTPJSON(w, map[string]interface{}{"version": version, "setting": setting})
+		return
+	}
+	writeHTTPError(w, http.StatusNotFound, "no such setting")
+}
+
+// readDataset reads the extractions given to serve: version=file arguments,
+// or a single file named after itself.
+func readDataset(args []string) (fileDataset, error) {
+	if len(args) == 1 && !strings.Contains(args[0], "=") {
+		name := strings.TrimSuffix(filepath.Base(args[0]), ".gz")
+		args = []string{strings.TrimSuffix(name, filepath.Ext(name)) + "=" + args[0]}
+	}
+	extractions, err := readVersionedExtractions(args)
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range extractions {
+		sortSettings(e.Settings)
+	}
+	return fileDataset(extractions), nil
+}
+
+func runServe(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "address to serve the API on")
+	server := addServerFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh serve [-addr host:port] [-user name] [-api-keys-file keys] [-tls-cert cert -tls-key key] <version=file>... | <settings.json>")
+		fmt.Fprintln(os.Stderr, "Serves extracted settings over a REST API: /api/versions, /api/settings?q=&scope=&property=&module=&namespace=&dynamic=&deprecated=&sort=&limit=&cursor=&version= and /api/settings/<name>, described by /openapi.json, GraphQL queries at /graphql and the gRPC service of settings_service.proto.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	dataset, err := readDataset(flags.Args())
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	mux := http.NewServeMux()
+	(&settingsAPI{dataset: dataset}).register(mux)
+	handler, err := server.handler(mux)
+	if err != nil {
+		exitWith(exitUsageError, err)
+	}
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		exitWith(exitUsageError, fmt.Errorf("-addr: %v", err))
+	}
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "serving %d versions on %s://%s/api/settings\n", len(dataset), server.scheme(), listener.Addr())
+	}
+	if err := server.serve(listener, handler); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// serverOptions are the flags securing what serve and daemon -addr serve.
+// Secrets are read from the environment or a file rather than flags so
+// they don't show up in the process list.
+type serverOptions struct {
+	user        string
+	apiKeysFile string
+	tlsCert     string
+	tlsKey      string
+}
+
+func addServerFlags(flags *flag.FlagSet) *serverOptions {
+	o := &serverOptions{}
+	flags.StringVar(&o.user, "user", "", "require basic authentication as this user, the password is read from ELASTICSEARCH_BBLFSH_PASSWORD")
+	flags.StringVar(&o.apiKeysFile, "api-keys-file", "", "require one of the API keys of this file, one per line, in an Authorization: ApiKey <key> header. ELASTICSEARCH_BBLFSH_API_KEY adds one more")
+	flags.StringVar(&o.tlsCert, "tls-cert", "", "serve over HTTPS with this PEM certificate, and -tls-key")
+	flags.StringVar(&o.tlsKey, "tls-key", "", "PEM private key of -tls-cert")
+	return o
+}
+
+// apiAuth requires requests to carry the password of the user or one of
+// the API keys, either will do when both are set.
+type apiAuth struct {
+	user, password string
+	apiKeys        []string
+	handler        http.Handler
+}
+
+func constantTimeEqual(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+func (a *apiAuth) authorized(r *http.Request) bool {
+	if user, password, ok := r.BasicAuth(); ok && a.user != "" {
+		return constantTimeEqual(user, a.user) && constantTimeEqual(password, a.password)
+	}
+	header := r.Header.Get("Authorization")
+	for _, scheme := range []string{"ApiKey ", "Bearer "} {
+		if !strings.HasPrefix(header, scheme) {
+			continue
+		}
+		authorized := false
+		for _, key := range a.apiKeys {
+			// Every key is compared, not to tell by the time taken how
+			// far down the list a key is
+			if constantTimeEqual(strings.TrimPrefix(header, scheme), key) {
+				authorized = true
+			}
+		}
+		return authorized
+	}
+	return false
+}
+
+func (a *apiAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !a.authorized(r) {
+		if a.user != "" {
+			w.Header().Set("WWW-Authenticate", `Basic realm="elasticsearch-bblfsh"`)
+		}
+		writeHTTPError(w, http.StatusUnauthorized, "authentication required")
+		return
+	}
+	a.handler.ServeHTTP(w, r)
+}
+
+// handler returns the handler answering only authenticated requests, when
+// authentication is set up.
+func (o *serverOptions) handler(h http.Handler) (http.Handler, error) {
+	if (o.tlsCert == "") != (o.tlsKey == "") {
+		return nil, errors.New("-tls-cert and -tls-key go together")
+	}
+	if o.tlsCert != "" {
+		if _, err := tls.LoadX509KeyPair(o.tlsCert, o.tlsKey); err != nil {
+			return nil, err
+		}
+	}
+
+	auth := &apiAuth{user: o.user, handler: h}
+	if o.user != "" {
+		auth.password = os.Getenv("ELASTICSEARCH_BBLFSH_PASSWORD")
+		if auth.password == "" {
+			return nil, errors.New("-user needs the password in ELASTICSEARCH_BBLFSH_PASSWORD")
+		}
+	}
+	if o.apiKeysFile != "" {
+		b, err := ioutil.ReadFile(o.apiKeysFile)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(string(b), "\n") {
+			if key := strings.TrimSpace(line); key != "" && !strings.HasPrefix(key, "#") {
+				auth.apiKeys = append(auth.apiKeys, key)
+			}
+		}
+		if len(auth.apiKeys) == 0 {
+			return nil, errors.New("no API keys in -api-keys-file")
+		}
+	}
+	if key := os.Getenv("ELASTICSEARCH_BBLFSH_API_KEY"); key != "" {
+		auth.apiKeys = append(auth.apiKeys, key)
+	}
+
+	if auth.user == "" && len(auth.apiKeys) == 0 {
+		return h, nil
+	}
+	return auth, nil
+}
+
+// scheme is the scheme of the URLs served.
+func (o *serverOptions) scheme() string {
+	if o.tlsCert != "" {
+		return "https"
+	}
+	return "http"
+}
+
+// serve serves a handler on a listener, over TLS with a certificate, and
+// over HTTP/2 as well as HTTP/1.1 for gRPC. It warns about credentials going
+// in the clear to other hosts.
+func (o *serverOptions) serve(listener net.Listener, h http.Handler) error {
+	if _, ok := h.(*apiAuth); ok && o.tlsCert == "" {
+		if addr, ok := listener.Addr().(*net.TCPAddr); ok && !addr.IP.IsLoopback() {
+			logger.Warn("credentials are sent in the clear, give -tls-cert and -tls-key to serve over HTTPS", "addr", listener.Addr().String())
+		}
+	}
+	server := &http.Server{Handler: h}
+	if o.tlsCert != "" {
+		return server.ServeTLS(listener, o.tlsCert, o.tlsKey)
+	}
+	// gRPC clients speak HTTP/2 without TLS, when the build supports it
+	allowCleartextHTTP2(server)
+	return server.Serve(listener)
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	javaextractor "github.com/nickcanz/elasticsearch-bblfsh/extractor"
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// argumentsOf returns the arguments of a method invocation or class
+// instance creation node.
+func argumentsOf(node *uast.Node) []*uast.Node {
+	var arguments []*uast.Node
+	for _, child := range node.Children {
+		if child.Properties["internalRole"] == "arguments" {
+			arguments = append(arguments, child)
+		}
+	}
+	return arguments
+}
+
+func getSettings(rootNode *uast.Node, fileName string) []ElasticsearchSetting {
+	declared, skipped := javaextractor.Declarations(rootNode)
+	if followWrappers || extractorEnabled("wrappers") {
+		declared, skipped = detectWrapperHelpers(rootNode, fileName, declared, skipped)
+	}
+	recordFactories(fileName, declared, skipped)
+	declared = append(declared, javaextractor.AffixSettings(rootNode)...)
+	logger.Debug("settings query hits", "file", relativePath(fileName), "declarations", len(declared)+len(skipped), "extracted", len(declared), "skipped", len(skipped))
+	for _, s := range declared {
+		logger.Debug("setting declaration", "file", relativePath(fileName), "line", s.CodeLine, "field", s.RawName, "name", s.Name, "type", s.JavaType)
+	}
+	for _, s := range skipped {
+		settingsSkipped++
+		logger.Warn("skipped a setting that isn't declared as Setting.xSetting(name, default, properties...)", "field", s.RawName, "file", relativePath(fileName), "line", s.CodeLine)
+	}
+
+	className := ""
+	if classes, _ := tools.Filter(rootNode, "//TypeDeclaration"); len(classes) > 0 {
+		className = nameOf(classes[0])
+	}
+
+	var settings []ElasticsearchSetting
+	for _, s := range declared {
+		setting := ElasticsearchSetting{
+			Name:       s.Name,
+			RawName:    s.RawName,
+			JavaType:   s.JavaType,
+			Properties: s.Properties,
+			DefaultArg: s.DefaultArg,
+			Parser:     s.Parser,
+			MinArg:     s.MinArg,
+			MaxArg:     s.MaxArg,
+			CodeLine:   s.CodeLine,
+			CodeFile:   relativePath(fileName),
+		}
+		if s.NameConstant != "" || s.DefaultConstant != "" {
+			setting.nameConstant, setting.defaultConstant, setting.constantClass = s.NameConstant, s.DefaultConstant, className
+		}
+		if s.DefaultEnumMethod == "toString" {
+			setting.defaultEnum = s.DefaultEnum
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// incremental is set by -incremental to reuse the settings extracted from
+// files whose content didn't change since a previous run, from the
+// -uast-cache, rather than parsing and extracting them again.
+var incremental bool
+
+// parsedPartially is set while extracting from a file the driver only
+// partially parsed. Like its tree, its settings aren't cached so a fixed
+// driver gets another go at it.
+var parsedPartially bool
+
+// cachedSetting is a setting as the settings extractor found it, before
+// its constants are resolved, so they're resolved against the index of the
+// run reusing it.
+type cachedSetting struct {
+	ElasticsearchSetting
+	NameConstant    string `json:"name_constant,omitempty"`
+	DefaultConstant string `json:"default_constant,omitempty"`
+	ConstantClass   string `json:"constant_class,omitempty"`
+	DefaultEnum     string `json:"default_enum,omitempty"`
+}
+
+func newCachedSetting(s ElasticsearchSetting) cachedSetting {
+	return cachedSetting{
+		ElasticsearchSetting: s,
+		NameConstant:         s.nameConstant,
+		DefaultConstant:      s.defaultConstant,
+		ConstantClass:        s.constantClass,
+		DefaultEnum:          s.defaultEnum,
+	}
+}
+
+func (c cachedSetting) setting() ElasticsearchSetting {
+	s := c.ElasticsearchSetting
+	s.nameConstant, s.defaultConstant, s.constantClass, s.defaultEnum = c.NameConstant, c.DefaultConstant, c.ConstantClass, c.DefaultEnum
+	return s
+}
+
+// cachedSettings are the settings extracted from a file.
+type cachedSettings struct {
+	Settings []cachedSetting `json:"settings"`
+	Skipped  int             `json:"skipped"`
+}
+
+// settingsCacheUsable tells whether the settings of a file can come from the
+// cache. Only the settings and constants extractors have their results
+// cached, any other one needs the tree of every file.
+func settingsCacheUsable() bool {
+	if !incremental || uastCacheDir == "" {
+		return false
+	}
+	for _, e := range enabledExtractors {
+		if e.name != "settings" && e.name != "constants" {
+			return false
+		}
+	}
+	return true
+}
+
+// settingsCachePath is where the settings of a file with the given content
+// hash are cached. Entries are keyed by everything that changes what's
+// extracted from the same content too: the tool, the rules, the driver and
+// -follow-wrappers.
+func settingsCachePath(hash string) string {
+	info := buildInfo()
+	sum := sha256.Sum256([]byte(info.ToolVersion + "\x00" + info.ToolCommit + "\x00" + rulesVersion + "\x00" + runManifest.DriverVersion + "\x00" + strconv.FormatBool(followWrappers)))
+	return filepath.Join(uastCacheDir, "settings", hex.EncodeToString(sum[:6]), hash[:2], hash+".json")
+}
+
+// readCachedSettings returns the settings extracted from a file by a
+// previous run, when its content didn't change since. The constants of the
+// file have to be in the index loaded from the cache, they aren't indexed
+// again either.
+func readCachedSettings(filePath string) ([]ElasticsearchSetting, int, bool) {
+	hash := fileHash(filePath)
+	if hash == "" {
+		return nil, 0, false
+	}
+	if entry, ok := indexedFiles[relativePath(filePath)]; !ok || entry.Hash != hash {
+		return nil, 0, false
+	}
+
+	cachePath := settingsCachePath(hash)
+	b, err := ioutil.ReadFile(cachePath)
+	if err != nil {
+		return nil, 0, false
+	}
+	var cached cachedSettings
+	if err := json.Unmarshal(b, &cached); err != nil {
+		logger.Warn("ignoring corrupt cached settings", "path", cachePath, "error", err)
+		return nil, 0, false
+	}
+	now := time.Now()
+	os.Chtimes(cachePath, now, now)
+
+	settings := make([]ElasticsearchSetting, len(cached.Settings))
+	for i, c := range cached.Settings {
+		settings[i] = c.setting()
+		settings[i].CodeFile = relativePath(filePath)
+	}
+	return settings, cached.Skipped, true
+}
+
+// writeCachedSettings keeps the settings extracted from a file for the next
+// -incremental run. Like trees, they're an optimization, failures are only
+// logged.
+func writeCachedSettings(filePath string, settings []ElasticsearchSetting, skipped int) {
+	hash := fileHash(filePath)
+	if hash == "" {
+		return
+	}
+
+	cached := cachedSettings{Settings: make([]cachedSetting, len(settings)), Skipped: skipped}
+	for i, s := range settings {
+		cached.Settings[i] = newCachedSetting(s)
+	}
+	b, err := json.Marshal(cached)
+	if err == nil {
+		cachePath := settingsCachePath(hash)
+		if err = os.MkdirAll(filepath.Dir(cachePath), 0755); err == nil {
+			if err = ioutil.WriteFile(cachePath+".tmp", b, 0644); err == nil {
+				err = os.Rename(cachePath+".tmp", cachePath)
+			}
+		}
+	}
+	if err != nil {
+		logger.Warn("failed to cache the settings", "file", relativePath(filePath), "error", err)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+)
+
+// errInterrupted stops the walk once the run is asked to shut down.
+var errInterrupted = errors.New("interrupted")
+
+// shuttingDown is set once SIGINT or SIGTERM is received, and shutdown is
+// closed then for what waits rather than checks.
+var (
+	shuttingDown int32
+	shutdown     = make(chan struct{})
+)
+
+// handleShutdownSignals makes the first SIGINT or SIGTERM stop the walk
+// once the file being processed is done, so what was extracted so far is
+// still written, marked partial, instead of lost. A second one exits right
+// away. doing tells what happens until then.
+func handleShutdownSignals(doing string) {
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-signals
+		atomic.StoreInt32(&shuttingDown, 1)
+		close(shutdown)
+		if !quiet {
+			fmt.Fprintf(os.Stderr, "\n%v received, %s, again to exit right away\n", sig, doing)
+		}
+		<-signals
+		exitWith(exitInterrupted, errors.New("interrupted"))
+	}()
+}
+
+func shutdownRequested() bool {
+	return atomic.LoadInt32(&shuttingDown) == 1
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// moduleOf is the Elasticsearch module, plugin or x-pack plugin a file
+// belongs to, i.e. "modules/repository-s3", or "server".
+func moduleOf(codeFile string) string {
+	parts := strings.Split(codeFile, "/")
+	switch {
+	case len(parts) > 3 && parts[0] == "x-pack" && parts[1] == "plugin":
+		return strings.Join(parts[:3], "/")
+	case len(parts) > 2 && (parts[0] == "modules" || parts[0] == "plugins"):
+		return strings.Join(parts[:2], "/")
+	case len(parts) > 1:
+		return parts[0]
+	}
+	return ""
+}
+
+type siteRow struct {
+	ElasticsearchSetting
+}
+
+func (r siteRow) DisplayName() string {
+	return displayName(r.ElasticsearchSetting)
+}
+
+func (r siteRow) Updates() string {
+	return updateBadge(r.ElasticsearchSetting)
+}
+
+func (r siteRow) Deprecated() bool {
+	return hasProperty(r.ElasticsearchSetting, "Deprecated") || hasProperty(r.ElasticsearchSetting, "DeprecatedWarning")
+}
+
+func (r siteRow) Module() string {
+	return moduleOf(r.CodeFile)
+}
+
+func (r siteRow) Anchor() string {
+	return asciidocAnchor(r.DisplayName())
+}
+
+var siteTemplate = template.Must(template.New("site").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Elasticsearch settings</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; margin: 2em; color: #222; }
+table { border-collapse: collapse; width: 100%; font-size: 14px; }
+th, td { border-bottom: 1px solid #ddd; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f5f5f5; position: sticky; top: 0; }
+code { font-size: 13px; }
+tr:target { background: #fffbdd; }
+.badge { border-radius: 3px; padding: 0 4px; font-size: 12px; }
+.dynamic { background: #e6ffed; }
+.static { background: #f1f8ff; }
+.deprecated { background: #ffeef0; }
+.meta { color: #666; font-size: 13px; }
+#filters { margin-bottom: 1em; }
+#filters label { margin-right: 1.5em; }
+</style>
+</head>
+<body>
+<h1>Elasticsearch settings</h1>
+<p class="meta">{{len .Rows}} settings{{if .Document.SourceCommit}} from <code>{{.Document.SourceCommit}}</code>{{end}}, extracted {{.Document.ExtractedAt.Format "2006-01-02"}} by elasticsearch-bblfsh {{.Document.ToolVersion}}. <a href="settings.json">Download as JSON</a></p>
+<div id="filters">
+<label>search <input type="search" id="search" placeholder="name, type, default or file" autofocus></label>
+<label>scope
+<select id="scope">
+<option value="">any</option>
+{{range .Scopes}}<option value="{{.}}">{{.}}</option>
+{{end}}</select>
+</label>
+<label>updates
+<select id="updates">
+<option value="">any</option>
+<option value="dynamic">dynamic</option>
+<option value="static">static</option>
+</select>
+</label>
+<label><input type="checkbox" id="deprecated"> deprecated only</label>
+<label>module
+<select id="module">
+<option value="">any</option>
+{{range .Modules}}<option value="{{.}}">{{.}}</option>
+{{end}}</select>
+</label>
+<span id="count" class="meta"></span>
+</div>
+<table>
+<thead>
+<tr><th>name</th><th>type</th><th>default</th><th>scope</th><th>updates</th><th>module</th><th>declared in</th></tr>
+</thead>
+<tbody>
+{{range .Rows}}<tr id="{{.Anchor}}" data-scope="{{.Scope}}" data-updates="{{.Updates}}" data-deprecated="{{.Deprecated}}" data-module="{{.Module}}" data-text="{{.DisplayName}} {{.JavaType}} {{.DefaultArg}} {{.CodeFile}}">
+<td><a href="#{{.Anchor}}"><code>{{.DisplayName}}</code></a>{{if .Deprecated}} <span class="badge deprecated">deprecated</span>{{end}}{{if .FirstSeenVersion}}<div class="meta">since {{.FirstSeenVersion}}</div>{{end}}</td>
+<td>{{.JavaType}}</td>
+<td><code>{{.DefaultArg}}</code></td>
+<td>{{.Scope}}</td>
+<td><span class="badge {{.Updates}}">{{.Updates}}</span></td>
+<td>{{.Module}}</td>
+<td><code>{{.CodeFile}}:{{.CodeLine}}</code>{{if .Owners}}<div class="meta">{{range .Owners}}{{.}} {{end}}</div>{{end}}</td>
+</tr>
+{{end}}</tbody>
+</table>
+<script>
+(function() {
+  var rows = document.querySelectorAll("tbody tr");
+  var search = document.getElementById("search");
+  var scope = document.getElementById("scope");
+  var updates = document.getElementById("updates");
+  var deprecated = document.getElementById("deprecated");
+  var module = document.getElementById("module");
+  var count = document.getElementById("count");
+
+  function apply() {
+    var terms = search.value.toLowerCase().split(/\s+/).filter(function(t) { return t !== ""; });
+    var shown = 0;
+    rows.forEach(function(row) {
+      var text = row.dataset.text.toLowerCase();
+      var visible = (scope.value === "" || row.dataset.scope === scope.value) &&
+        (updates.value === "" || row.dataset.updates === updates.value) &&
+        (!deprecated.checked || row.dataset.deprecated === "true") &&
+        (module.value === "" || row.dataset.module === module.value) &&
+        terms.every(function(t) { return text.indexOf(t) >= 0; });
+      row.style.display = visible ? "" : "none";
+      if (visible) { shown++; }
+    });
+    count.textContent = shown + " shown";
+  }
+
+  [search, scope, updates, deprecated, module].forEach(function(input) {
+    input.addEventListener("input", apply);
+    input.addEventListener("change", apply);
+  });
+  apply();
+})();
+</script>
+</body>
+</html>
+`))
+
+func writeSite(w io.Writer, doc SettingsDocument) error {
+	sortSettings(doc.Settings)
+
+	var rows []siteRow
+	scopes := map[string]bool{}
+	modules := map[string]bool{}
+	for _, s := range doc.Settings {
+		row := siteRow{s}
+		rows = append(rows, row)
+		if scope := row.Scope(); scope != "" {
+			scopes[scope] = true
+		}
+		if module := row.Module(); module != "" {
+			modules[module] = true
+		}
+	}
+
+	return siteTemplate.Execute(w, struct {
+		Document SettingsDocument
+		Rows     []siteRow
+		Scopes   []string
+		Modules  []string
+	}{doc, rows, sortedKeys(scopes), sortedKeys(modules)})
+}
+
+func runSite(args []string) {
+	flags := flag.NewFlagSet("site", flag.ExitOnError)
+	out := flags.String("out", "site", "directory to write the site to")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh site [-out dir] <settings.json>")
+		fmt.Fprintln(os.Stderr, "Renders previously extracted settings as a static site with search and filters, that can be served by any web server or opened from disk.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	doc, err := readSettingsDocument(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	if err := os.MkdirAll(*out, 0755); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	f, err := os.Create(filepath.Join(*out, "index.html"))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	defer f.Close()
+	if err := writeSite(f, doc); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+
+	if err := writeSettingsDocument(filepath.Join(*out, "settings.json"), doc); err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// SplitIndex is the index.json of a split output directory, listing the
+// file of every group so consumers only read the ones they need.
+type SplitIndex struct {
+	BuildInfo
+	SplitBy string       `json:"split_by"`
+	Groups  []SplitGroup `json:"groups"`
+}
+
+// SplitGroup is a package or module of a split output and its files.
+type SplitGroup struct {
+	Name     string   `json:"name"`
+	Files    []string `json:"files"`
+	Settings int      `json:"settings"`
+}
+
+// settingGroup returns the Java package or the Gradle project a setting is
+// declared in, i.e. org.elasticsearch.cluster.routing or modules/reindex.
+func settingGroup(kind, codeFile string) string {
+	dir := path.Dir(codeFile)
+	src := strings.Index("/"+dir+"/", "/src/")
+
+	if kind == "module" {
+		if src < 0 {
+			return dir
+		}
+		if src == 0 {
+			return "."
+		}
+		return dir[:src-1]
+	}
+
+	// The package is the directory below the source set, i.e. below
+	// src/main/java
+	if src >= 0 {
+		parts := strings.SplitN(dir[src:], "/", 4)
+		if len(parts) == 4 {
+			return strings.Replace(parts[3], "/", ".", -1)
+		}
+	}
+	return strings.Replace(dir, "/", ".", -1)
+}
+
+// splitFileName is the file name of a group, without extension.
+func splitFileName(group string) string {
+	if group == "." {
+		return "root"
+	}
+	return strings.Replace(group, "/", "-", -1)
+}
+
+// splitDocument splits the settings of a document by group, every part
+// keeping the provenance of the whole document.
+func splitDocument(doc SettingsDocument, kind string) ([]string, map[string]SettingsDocument) {
+	parts := map[string]SettingsDocument{}
+	for _, s := range doc.Settings {
+		group := settingGroup(kind, s.CodeFile)
+		part, ok := parts[group]
+		if !ok {
+			part = doc
+			part.Settings = nil
+		}
+		part.Settings = append(part.Settings, s)
+		parts[group] = part
+	}
+
+	groups := make([]string, 0, len(parts))
+	for group := range parts {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	return groups, parts
+}
+
+// writeSplitOutput writes a file per group and format into dir, which may be
+// an object store URL, and an index.json listing them.
+func writeSplitOutput(dir, kind string, formats []string, doc SettingsDocument) error {
+	if !isObjectURL(dir) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+
+	groups, parts := splitDocument(doc, kind)
+	index := SplitIndex{BuildInfo: buildInfo(), SplitBy: kind}
+
+	for _, group := range groups {
+		g := SplitGroup{Name: group, Settings: len(parts[group].Settings)}
+		for _, format := range formats {
+			e := encoders[format]
+			name := splitFileName(group) + e.Extension()
+			if gzipOutput {
+				name += ".gz"
+			}
+			if err := encodeOutput(e, joinOutputPath(dir, name), parts[group]); err != nil {
+				return fmt.Errorf("writing %s: %v", name, err)
+			}
+			g.Files = append(g.Files, name)
+		}
+		index.Groups = append(index.Groups, g)
+	}
+
+	if !isObjectURL(dir) {
+		return writeJSON(filepath.Join(dir, "index.json"), index)
+	}
+
+	tmp, err := ioutil.TempFile("", "elasticsearch-bblfsh-*.json")
+	if err != nil {
+		return err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	if err := writeJSON(tmp.Name(), index); err != nil {
+		return err
+	}
+	return uploadObject(joinOutputPath(dir, "index.json"), tmp.Name())
+}
+
+// joinOutputPath joins a file name to a directory or object store prefix.
+func joinOutputPath(dir, name string) string {
+	if isObjectURL(dir) {
+		return strings.TrimSuffix(dir, "/") + "/" + name
+	}
+	return filepath.Join(dir, name)
+}
@@ -0,0 +1,110 @@
+//go:build cgo
+
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// sqliteSchema normalizes the settings document. Every run adds a row to
+// versions, so a single database can hold the extractions of several
+// Elasticsearch versions and be queried across them.
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS versions (
+		id INTEGER PRIMARY KEY,
+		source_root TEXT NOT NULL,
+		source_commit TEXT,
+		extracted_at TEXT NOT NULL,
+		tool_version TEXT NOT NULL,
+		schema_version INTEGER NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS settings (
+		id INTEGER PRIMARY KEY,
+		version_id INTEGER NOT NULL REFERENCES versions(id),
+		name TEXT NOT NULL,
+		raw_name TEXT NOT NULL,
+		java_type TEXT NOT NULL,
+		default_arg TEXT NOT NULL,
+		scope TEXT,
+		code_file TEXT NOT NULL,
+		code_line INTEGER NOT NULL,
+		first_seen_version TEXT,
+		removed_in_version TEXT
+	)`,
+	`CREATE INDEX IF NOT EXISTS settings_name ON settings (name)`,
+	`CREATE TABLE IF NOT EXISTS properties (
+		setting_id INTEGER NOT NULL REFERENCES settings(id),
+		property TEXT NOT NULL,
+		PRIMARY KEY (setting_id, property)
+	)`,
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// writeSettingsSQLite adds the document to the database in fileName,
+// creating it if needed.
+func writeSettingsSQLite(fileName string, doc SettingsDocument) error {
+	db, err := sql.Open("sqlite3", fileName)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	// Rolling back a committed transaction is a no-op
+	defer tx.Rollback()
+
+	for _, statement := range sqliteSchema {
+		if _, err := tx.Exec(statement); err != nil {
+			return err
+		}
+	}
+
+	res, err := tx.Exec(`INSERT INTO versions (source_root, source_commit, extracted_at, tool_version, schema_version) VALUES (?, ?, ?, ?, ?)`,
+		doc.SourceRoot, nullString(doc.SourceCommit), doc.ExtractedAt.Format(time.RFC3339), doc.ToolVersion, doc.SchemaVersion)
+	if err != nil {
+		return err
+	}
+	versionID, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	insertSetting, err := tx.Prepare(`INSERT INTO settings (version_id, name, raw_name, java_type, default_arg, scope, code_file, code_line, first_seen_version, removed_in_version) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertSetting.Close()
+	insertProperty, err := tx.Prepare(`INSERT OR IGNORE INTO properties (setting_id, property) VALUES (?, ?)`)
+	if err != nil {
+		return err
+	}
+	defer insertProperty.Close()
+
+	for _, s := range doc.Settings {
+		res, err := insertSetting.Exec(versionID, s.Name, s.RawName, s.JavaType, s.DefaultArg, nullString(s.Scope()),
+			s.CodeFile, s.CodeLine, nullString(s.FirstSeenVersion), nullString(s.RemovedInVersion))
+		if err != nil {
+			return err
+		}
+		settingID, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		for _, p := range s.Properties {
+			if _, err := insertProperty.Exec(settingID, p); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,11 @@
+//go:build !cgo
+
+package main
+
+import "errors"
+
+// writeSettingsSQLite stands in for the SQLite encoder in static builds,
+// go-sqlite3 needs cgo.
+func writeSettingsSQLite(fileName string, doc SettingsDocument) error {
+	return errors.New("-format sqlite needs a build with cgo, static release builds leave it out. Use -format parquet, or build with CGO_ENABLED=1")
+}
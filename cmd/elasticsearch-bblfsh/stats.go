@@ -0,0 +1,160 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// StatsField is a field emitted by the toXContent method of a stats class,
+// i.e. the fields of node stats and cluster stats responses that monitoring
+// pipelines depend on.
+type StatsField struct {
+	Class string `json:"class"`
+	// Path is the field prefixed with the objects opened before it in the
+	// same toXContent method, i.e. "docs.count"
+	Path string `json:"path"`
+
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// StatsFieldsDocument is the output of the stats fields extraction.
+type StatsFieldsDocument struct {
+	BuildInfo
+	Fields []StatsField `json:"fields"`
+}
+
+var statsFields []StatsField
+
+// xContentFieldMethods are the XContentBuilder methods that emit fields,
+// mapped to how many of their leading arguments are field names.
+var xContentFieldMethods = map[string]int{
+	"field":              1,
+	"array":              1,
+	"timeField":          2,
+	"humanReadableField": 2,
+	"byteSizeField":      2,
+	"percentageField":    2,
+	"startObject":        1,
+	"startArray":         1,
+}
+
+func getStatsFields(rootNode *uast.Node, fileName string) []StatsField {
+	// Constants like Fields.DOCS are declared in a nested Fields class of
+	// nearly every stats class, so they're resolved within the file first
+	local := fileStringConstants(rootNode)
+
+	classes, _ := tools.Filter(rootNode, "//TypeDeclaration")
+
+	var fields []StatsField
+	for _, class := range classes {
+		className := nameOf(class)
+		if !strings.HasSuffix(className, "Stats") {
+			continue
+		}
+
+		for _, method := range class.Children {
+			if method.InternalType != "MethodDeclaration" || nameOf(method) != "toXContent" {
+				continue
+			}
+
+			invocations, _ := tools.Filter(method, "//MethodInvocation")
+			sort.SliceStable(invocations, func(i, j int) bool {
+				return invocations[i].StartPosition.Offset < invocations[j].StartPosition.Offset
+			})
+
+			var objects []string
+			for _, n := range invocations {
+				name := nameOf(n)
+				switch name {
+				case "endObject", "endArray":
+					if len(objects) > 0 {
+						objects = objects[:len(objects)-1]
+					}
+					continue
+				}
+
+				count, ok := xContentFieldMethods[name]
+				if !ok {
+					continue
+				}
+				arguments := argumentsOf(n)
+				if len(arguments) < count {
+					// startObject() without a name opens the root object
+					if name == "startObject" || name == "startArray" {
+						objects = append(objects, "")
+					}
+					continue
+				}
+
+				for _, argument := range arguments[:count] {
+					field, ok := resolveLocalString(argument, className, local)
+					if !ok {
+						field = expressionString(argument)
+					}
+					path := strings.Trim(strings.Join(append(append([]string{}, objects...), field), "."), ".")
+					fields = append(fields, StatsField{
+						Class:    className,
+						Path:     path,
+						CodeLine: n.StartPosition.Line,
+						CodeFile: relativePath(fileName),
+					})
+				}
+
+				if name == "startObject" || name == "startArray" {
+					field, _ := resolveLocalString(arguments[0], className, local)
+					objects = append(objects, field)
+				}
+			}
+		}
+	}
+
+	return fields
+}
+
+// resolveLocalString resolves a field name against the constants of its own
+// file before falling back to every scanned file.
+func resolveLocalString(node *uast.Node, className string, local map[string]string) (string, bool) {
+	switch node.InternalType {
+	case "SimpleName":
+		if value, ok := local[className+"."+node.Token]; ok {
+			return value, true
+		}
+		// Otherwise a constant of another class in the file, i.e. the
+		// nested Fields class. Keys are sorted so the pick is stable.
+		var keys []string
+		for key := range local {
+			if strings.HasSuffix(key, "."+node.Token) {
+				keys = append(keys, key)
+			}
+		}
+		if len(keys) > 0 {
+			sort.Strings(keys)
+			return local[keys[0]], true
+		}
+	case "QualifiedName":
+		var parts []string
+		for _, child := range node.Children {
+			parts = append(parts, child.Token)
+		}
+		if len(parts) >= 2 {
+			if value, ok := local[strings.Join(parts[len(parts)-2:], ".")]; ok {
+				return value, true
+			}
+		}
+	}
+	return resolveString(node, className)
+}
+
+func sortStatsFields(fields []StatsField) []StatsField {
+	sort.SliceStable(fields, func(i, j int) bool {
+		if fields[i].Class != fields[j].Class {
+			return fields[i].Class < fields[j].Class
+		}
+		return fields[i].Path < fields[j].Path
+	})
+	return fields
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// filesSkipped and dirsSkipped count what the walk left out, for the
+// summary.
+var filesSkipped, dirsSkipped int
+
+// settingsSkipped counts the Setting fields the extractor couldn't make
+// sense of.
+var settingsSkipped int
+
+// outputsWritten are the files, directories and sinks the run wrote to.
+var outputsWritten []string
+
+// RunSummary are the totals of a run. They're kept in the manifest so the
+// next run can tell whether coverage regressed.
+type RunSummary struct {
+	FilesScanned      int   `json:"files_scanned"`
+	FilesParsed       int   `json:"files_parsed"`
+	FilesFailed       int   `json:"files_failed"`
+	FilesPartial      int   `json:"files_partial"`
+	FilesCached       int   `json:"files_cached"`
+	FilesSkipped      int   `json:"files_skipped"`
+	FilesSampledOut   int   `json:"files_sampled_out,omitempty"`
+	FilesQuarantined  int   `json:"files_quarantined,omitempty"`
+	DirsSkipped       int   `json:"dirs_skipped"`
+	SettingsExtracted int   `json:"settings_extracted"`
+	SettingsSkipped   int   `json:"settings_skipped"`
+	SettingsCached    int   `json:"settings_cached"`
+	SettingsDropped   int   `json:"settings_dropped,omitempty"`
+	FilesUnchanged    int   `json:"files_unchanged,omitempty"`
+	SettingsUnchanged int   `json:"settings_unchanged,omitempty"`
+	DurationMs        int64 `json:"duration_ms"`
+}
+
+// previousSummary is the summary of the run whose manifest this run
+// overwrites, if there's one.
+var previousSummary *RunSummary
+
+// readPreviousSummary reads the summary of the manifest a run is about to
+// replace. Manifests from before summaries, or none at all, leave it nil.
+func readPreviousSummary(fileName string) {
+	b, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return
+	}
+	var previous struct {
+		Summary *RunSummary `json:"summary"`
+	}
+	if json.Unmarshal(b, &previous) == nil {
+		previousSummary = previous.Summary
+	}
+}
+
+func runSummary() RunSummary {
+	summary := RunSummary{
+		FilesScanned:      len(runManifest.Files) + filesSkipped,
+		FilesPartial:      filesPartial,
+		FilesSkipped:      filesSkipped,
+		FilesSampledOut:   filesSampledOut,
+		FilesQuarantined:  filesQuarantined,
+		DirsSkipped:       dirsSkipped,
+		SettingsExtracted: settingsExtracted,
+		SettingsSkipped:   settingsSkipped,
+		SettingsDropped:   settingsDropped,
+		DurationMs:        time.Since(runManifest.StartedAt).Nanoseconds() / int64(time.Millisecond),
+	}
+	for _, f := range runManifest.Files {
+		if f.Status == "failed" {
+			summary.FilesFailed++
+		} else {
+			summary.FilesParsed++
+		}
+		if f.Unchanged {
+			summary.FilesUnchanged++
+			summary.SettingsUnchanged += f.Settings
+		} else if f.Cached {
+			summary.FilesCached++
+			summary.SettingsCached += f.Settings
+		}
+	}
+	return summary
+}
+
+// colorizeCount colors a count of problems when there are any.
+func colorizeCount(color string, count int, what string) string {
+	s := fmt.Sprintf("%d %s", count, what)
+	if count == 0 {
+		return s
+	}
+	return colorize(color, s)
+}
+
+// sinceLastRun describes how a count changed since the previous run, in red
+// when it dropped.
+func sinceLastRun(current, previous int) string {
+	switch {
+	case current < previous:
+		return " " + colorize(ansiRed, fmt.Sprintf("(%d since the last run)", current-previous))
+	case current > previous:
+		return fmt.Sprintf(" (+%d since the last run)", current-previous)
+	}
+	return ""
+}
+
+func recordOutput(location string) {
+	if location == "-" {
+		location = "stdout"
+	}
+	outputsWritten = append(outputsWritten, location)
+}
+
+// printRunSummary prints what the run did, so it doesn't finish silently
+// with no way to tell whether it worked short of opening the manifest, and
+// a drop in coverage shows right away.
+func printRunSummary(w io.Writer) {
+	if quiet {
+		return
+	}
+	s := runSummary()
+
+	finished := "finished"
+	if runManifest.Interrupted {
+		finished = "was interrupted"
+	}
+	fmt.Fprintf(w, "elasticsearch-bblfsh %s in %s\n", finished, (time.Duration(s.DurationMs) * time.Millisecond).Round(100*time.Millisecond))
+
+	files := fmt.Sprintf("%d scanned, %d parsed", s.FilesScanned, s.FilesParsed)
+	if previousSummary != nil {
+		files += sinceLastRun(s.FilesParsed, previousSummary.FilesParsed)
+	}
+	files += ", " + colorizeCount(ansiRed, s.FilesFailed, "failed")
+	if s.FilesPartial > 0 {
+		files += ", " + colorizeCount(ansiYellow, s.FilesPartial, "partially parsed")
+	}
+	if s.FilesQuarantined > 0 {
+		files += ", " + colorizeCount(ansiYellow, s.FilesQuarantined, "quarantined")
+	}
+	fmt.Fprintf(w, "  files:    %s, %d skipped as not Java, %d test source directories skipped\n", files, s.FilesSkipped, s.DirsSkipped)
+	if sampledRun() {
+		sample := fmt.Sprintf("%d files left out of the -sample", s.FilesSampledOut)
+		if limitReached() {
+			sample += fmt.Sprintf(", stopped at the -limit of %d", fileLimit)
+		}
+		fmt.Fprintf(w, "  sample:   %s\n", sample)
+	}
+
+	if extractorEnabled("settings") {
+		settings := fmt.Sprintf("%d extracted", s.SettingsExtracted)
+		if previousSummary != nil {
+			settings += sinceLastRun(s.SettingsExtracted, previousSummary.SettingsExtracted)
+		}
+		settings += ", " + colorizeCount(ansiYellow, s.SettingsSkipped, "skipped by the argument count check")
+		if settingsScript != nil {
+			settings += fmt.Sprintf(", %d dropped by the script", s.SettingsDropped)
+		}
+		if uastCacheDir != "" {
+			settings += fmt.Sprintf(", %d of them from the %d files read from the UAST cache", s.SettingsCached, s.FilesCached)
+		}
+		if incremental {
+			settings += fmt.Sprintf(", %d reused from the %d files unchanged since a previous run", s.SettingsUnchanged, s.FilesUnchanged)
+		}
+		fmt.Fprintf(w, "  settings: %s\n", settings)
+	}
+	if len(outputsWritten) > 0 {
+		fmt.Fprintf(w, "  output:   %s\n", strings.Join(outputsWritten, ", "))
+	}
+	if slowFilesReport {
+		printSlowFiles(w)
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"sort"
+
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// SystemIndex is a SystemIndexDescriptor registration, which tells apart
+// system indices from user indices.
+type SystemIndex struct {
+	IndexPattern string `json:"index_pattern"`
+	Description  string `json:"description,omitempty"`
+	PrimaryIndex string `json:"primary_index,omitempty"`
+	Origin       string `json:"origin,omitempty"`
+	// Type is the SystemIndexDescriptor.Type, i.e. INTERNAL_MANAGED
+	Type string `json:"type,omitempty"`
+	// Managed is true when the descriptor provides the mappings, so
+	// Elasticsearch creates and upgrades the index itself
+	Managed            bool   `json:"managed"`
+	VersionMetaKey     string `json:"version_meta_key,omitempty"`
+	MinimumNodeVersion string `json:"minimum_node_version,omitempty"`
+
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// SystemIndicesDocument is the output of the system indices extraction.
+type SystemIndicesDocument struct {
+	BuildInfo
+	SystemIndices []SystemIndex `json:"system_indices"`
+}
+
+// systemIndexRegistration is a descriptor found in a file. Its arguments are
+// often constants, which can only be resolved once every file is scanned.
+type systemIndexRegistration struct {
+	index     SystemIndex
+	arguments map[string]*uast.Node
+	className string
+}
+
+var systemIndexRegistrations []systemIndexRegistration
+
+// methodChain flattens a chain of invocations like
+// SystemIndexDescriptor.builder().setIndexPattern(".tasks*").build()
+// into the first argument of every invocation by method name.
+func methodChain(node *uast.Node) map[string]*uast.Node {
+	chain := map[string]*uast.Node{}
+	for node != nil && node.InternalType == "MethodInvocation" {
+		var next *uast.Node
+		if arguments := argumentsOf(node); len(arguments) > 0 {
+			chain[nameOf(node)] = arguments[0]
+		} else {
+			chain[nameOf(node)] = nil
+		}
+		for _, child := range node.Children {
+			if child.Properties["internalRole"] == "expression" {
+				next = child
+			}
+		}
+		node = next
+	}
+	return chain
+}
+
+func getSystemIndexRegistrations(rootNode *uast.Node, fileName string) []systemIndexRegistration {
+	var registrations []systemIndexRegistration
+
+	classes, _ := tools.Filter(rootNode, "//TypeDeclaration")
+	var className string
+	if len(classes) > 0 {
+		className = nameOf(classes[0])
+	}
+
+	// i.e. new SystemIndexDescriptor(".tasks*", "Task Result Index")
+	constructors, _ := tools.Filter(rootNode, "//ClassInstanceCreation/SimpleType/SimpleName[@token='SystemIndexDescriptor']/../..")
+	for _, n := range constructors {
+		arguments := argumentsOf(n)
+		if len(arguments) == 0 {
+			continue
+		}
+		r := systemIndexRegistration{
+			index:     SystemIndex{CodeLine: n.StartPosition.Line, CodeFile: relativePath(fileName)},
+			arguments: map[string]*uast.Node{"setIndexPattern": arguments[0]},
+			className: className,
+		}
+		if len(arguments) > 1 {
+			r.arguments["setDescription"] = arguments[1]
+		}
+		registrations = append(registrations, r)
+	}
+
+	// i.e. SystemIndexDescriptor.builder().setIndexPattern(".tasks*").setPrimaryIndex(".tasks").build()
+	builds, _ := tools.Filter(rootNode, "//MethodInvocation[SimpleName[@internalRole='name'][@token='build']]")
+	for _, n := range builds {
+		chain := methodChain(n)
+		if _, ok := chain["setIndexPattern"]; !ok {
+			continue
+		}
+		registrations = append(registrations, systemIndexRegistration{
+			index:     SystemIndex{CodeLine: n.StartPosition.Line, CodeFile: relativePath(fileName)},
+			arguments: chain,
+			className: className,
+		})
+	}
+
+	return registrations
+}
+
+func resolveSystemIndices(registrations []systemIndexRegistration) []SystemIndex {
+	var indices []SystemIndex
+
+	for _, r := range registrations {
+		index := r.index
+		resolve := func(method string) string {
+			node := r.arguments[method]
+			if node == nil {
+				return ""
+			}
+			if value, ok := resolveString(node, r.className); ok {
+				return value
+			}
+			return expressionString(node)
+		}
+
+		index.IndexPattern = resolve("setIndexPattern")
+		index.Description = resolve("setDescription")
+		index.PrimaryIndex = resolve("setPrimaryIndex")
+		index.Origin = resolve("setOrigin")
+		index.VersionMetaKey = resolve("setVersionMetaKey")
+		index.MinimumNodeVersion = resolve("setMinimumNodeVersion")
+		if node := r.arguments["setType"]; node != nil {
+			// Only the enum constant matters, not how it's qualified
+			if node.InternalType == "QualifiedName" && len(node.Children) > 0 {
+				index.Type = node.Children[len(node.Children)-1].Token
+			} else {
+				index.Type = expressionString(node)
+			}
+		}
+		_, hasMappings := r.arguments["setMappings"]
+		index.Managed = hasMappings
+
+		indices = append(indices, index)
+	}
+
+	sort.Slice(indices, func(i, j int) bool { return indices[i].IndexPattern < indices[j].IndexPattern })
+
+	return indices
+}
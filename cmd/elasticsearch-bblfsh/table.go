@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+// maxTableDefault is how much of a default fits in a table cell, the rest
+// of long expressions is cut.
+const maxTableDefault = 48
+
+// isTerminal tells whether f is a terminal rather than a file or a pipe.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// tableDefault is the default of a setting as shown in a table.
+func tableDefault(s ElasticsearchSetting) string {
+	if s.NormalizedDefault != nil {
+		return s.NormalizedDefault.Display
+	}
+	d := strings.Join(strings.Fields(s.DefaultArg), " ")
+	if len(d) > maxTableDefault {
+		d = d[:maxTableDefault-3] + "..."
+	}
+	return d
+}
+
+// writeSettingsTable writes the settings as an aligned table for reading
+// in a terminal.
+func writeSettingsTable(out io.Writer, doc SettingsDocument) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "SETTING\tTYPE\tSCOPE\tUPDATES\tDEFAULT")
+	for _, s := range doc.Settings {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", s.Name, s.JavaType, s.Scope(), updateBadge(s), tableDefault(s))
+	}
+	return w.Flush()
+}
+
+func init() {
+	registerEncoder("table", streamEncoder{".txt", writeSettingsTable})
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+// outputTemplateFuncs are the functions available to -output-template
+// templates on top of the text/template builtins.
+var outputTemplateFuncs = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"json": func(v interface{}) (string, error) {
+		b, err := json.Marshal(v)
+		return string(b), err
+	},
+}
+
+func loadOutputTemplate(fileName string) (*template.Template, error) {
+	return template.New(filepath.Base(fileName)).Funcs(outputTemplateFuncs).ParseFiles(fileName)
+}
+
+// outputTemplateExtension returns the extension of what a template renders,
+// i.e. .md for settings.md.tmpl, for the default output file name.
+func outputTemplateExtension(fileName string) string {
+	if ext := filepath.Ext(strings.TrimSuffix(filepath.Base(fileName), ".tmpl")); ext != "" {
+		return ext
+	}
+	return ".txt"
+}
+
+// writeSettingsTemplate renders the document through a template. When the
+// template defines a "setting" template, it renders every setting through
+// that one instead, one after the other.
+func writeSettingsTemplate(w io.Writer, t *template.Template, doc SettingsDocument) error {
+	setting := t.Lookup("setting")
+	if setting == nil {
+		return t.Execute(w, doc)
+	}
+	for _, s := range doc.Settings {
+		if err := setting.Execute(w, s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
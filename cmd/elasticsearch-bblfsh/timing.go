@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// slowFilesCount is how many files the slow file report lists.
+const slowFilesCount = 20
+
+// slowFilesReport is set by -slow-files to print the slowest files after
+// the summary.
+var slowFilesReport bool
+
+// timingsHeader are the columns of the -timings CSV.
+var timingsHeader = []string{"file", "status", "cached", "size", "settings", "parse_ms", "extract_ms", "duration_ms"}
+
+// slowestFiles returns the n files that took the longest to parse and
+// extract, slowest first.
+func slowestFiles(n int) []FileOutcome {
+	files := make([]FileOutcome, len(runManifest.Files))
+	copy(files, runManifest.Files)
+	sort.SliceStable(files, func(i, j int) bool {
+		return files[i].DurationMs > files[j].DurationMs
+	})
+	if len(files) > n {
+		files = files[:n]
+	}
+	return files
+}
+
+// printSlowFiles prints the slowest files with the time split between
+// bblfshd and the extractors, to tell a file the driver struggles with from
+// a query that's too expensive.
+func printSlowFiles(out io.Writer) {
+	files := slowestFiles(slowFilesCount)
+	if len(files) == 0 {
+		return
+	}
+
+	fmt.Fprintf(out, "slowest %d files:\n", len(files))
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "  TOTAL\tPARSE\tEXTRACT\tSIZE\tSETTINGS\t")
+	for _, f := range files {
+		parse := formatMs(f.ParseMs)
+		if f.Cached {
+			parse += " (cached)"
+		}
+		fmt.Fprintf(w, "  %s\t%s\t%s\t%s\t%d\t  %s\n", formatMs(f.DurationMs), parse, formatMs(f.ExtractMs), formatBytes(f.Size), f.Settings, f.File)
+	}
+	w.Flush()
+}
+
+func formatMs(ms int64) string {
+	return (time.Duration(ms) * time.Millisecond).String()
+}
+
+// writeTimingsCSV writes the timing of every file, for digging into
+// throughput with a spreadsheet or pandas.
+func writeTimingsCSV(fileName string) error {
+	f, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.Write(timingsHeader); err != nil {
+		return err
+	}
+	for _, file := range runManifest.Files {
+		record := []string{
+			file.File,
+			file.Status,
+			strconv.FormatBool(file.Cached),
+			strconv.FormatInt(file.Size, 10),
+			strconv.Itoa(file.Settings),
+			strconv.FormatInt(file.ParseMs, 10),
+			strconv.FormatInt(file.ExtractMs, 10),
+			strconv.FormatInt(file.DurationMs, 10),
+		}
+		if err := w.Write(record); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return f.Close()
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// TransportAction is a registered transport action, the names that show up
+// in the tasks API and in audit logs, i.e. "cluster:monitor/health".
+type TransportAction struct {
+	Name           string `json:"name"`
+	ActionClass    string `json:"action_class"`
+	TransportClass string `json:"transport_class,omitempty"`
+	RequestClass   string `json:"request_class,omitempty"`
+
+	CodeLine uint32 `json:"code_line"`
+	CodeFile string `json:"code_file"`
+}
+
+// TransportActionsDocument is the output of the transport actions extraction.
+type TransportActionsDocument struct {
+	BuildInfo
+	Actions []TransportAction `json:"actions"`
+}
+
+// actionDeclaration is where an action is declared, either as a subclass of
+// ActionType with a NAME constant or as an ActionType instance.
+type actionDeclaration struct {
+	action TransportAction
+	// key is how registrations refer to the action, the class name for
+	// subclasses and Class.FIELD for instances
+	key      string
+	nameNode *uast.Node
+}
+
+var actionDeclarations []actionDeclaration
+
+// actionTransportClasses maps action keys to the transport action class
+// they're registered with.
+var actionTransportClasses = map[string]string{}
+
+// transportRequestClasses maps transport action classes to their request
+// class, the first type argument of their superclass.
+var transportRequestClasses = map[string]string{}
+
+// typeName returns the simple name of a type node, without qualifier or
+// type arguments.
+func typeName(node *uast.Node) string {
+	switch node.InternalType {
+	case "ParameterizedType":
+		for _, child := range node.Children {
+			if child.Properties["internalRole"] == "type" {
+				return typeName(child)
+			}
+		}
+	case "SimpleType", "QualifiedType", "QualifiedName":
+		// The simple name is the last child, i.e. for org.elasticsearch.Foo
+		if len(node.Children) > 0 {
+			return typeName(node.Children[len(node.Children)-1])
+		}
+	}
+	return node.Token
+}
+
+func typeArguments(node *uast.Node) []*uast.Node {
+	var arguments []*uast.Node
+	for _, child := range node.Children {
+		if child.Properties["internalRole"] == "typeArguments" {
+			arguments = append(arguments, child)
+		}
+	}
+	return arguments
+}
+
+func superclassOf(class *uast.Node) *uast.Node {
+	for _, child := range class.Children {
+		if child.Properties["internalRole"] == "superclassType" {
+			return child
+		}
+	}
+	return nil
+}
+
+// isActionType reports whether a superclass name is one of the base classes
+// actions are declared with across versions.
+func isActionType(name string) bool {
+	return name == "Action" || strings.HasSuffix(name, "ActionType") || strings.HasSuffix(name, "ResponseAction")
+}
+
+func getTransportActions(rootNode *uast.Node, fileName string) {
+	classes, _ := tools.Filter(rootNode, "//TypeDeclaration")
+
+	for _, class := range classes {
+		className := nameOf(class)
+		superclass := superclassOf(class)
+		if superclass == nil {
+			continue
+		}
+
+		// i.e. public class ClusterHealthAction extends ActionType<ClusterHealthResponse> {
+		//     public static final String NAME = "cluster:monitor/health";
+		if isActionType(typeName(superclass)) {
+			actionDeclarations = append(actionDeclarations, actionDeclaration{
+				action: TransportAction{
+					ActionClass: className,
+					CodeLine:    class.StartPosition.Line,
+					CodeFile:    relativePath(fileName),
+				},
+				key: className,
+			})
+			continue
+		}
+
+		// i.e. public class TransportClusterHealthAction extends TransportMasterNodeReadAction<ClusterHealthRequest, ClusterHealthResponse>
+		if strings.HasPrefix(className, "Transport") {
+			if arguments := typeArguments(superclass); len(arguments) > 0 {
+				transportRequestClasses[className] = typeName(arguments[0])
+			}
+		}
+	}
+
+	// i.e. public static final ActionType<GetResponse> TYPE = new ActionType<>("indices:data/read/get");
+	fragments, _ := tools.Filter(rootNode, "//FieldDeclaration/VariableDeclarationFragment[ClassInstanceCreation/ParameterizedType/SimpleType/SimpleName[@token='ActionType']]")
+	var className string
+	if len(classes) > 0 {
+		className = nameOf(classes[0])
+	}
+	for _, fragment := range fragments {
+		for _, n := range fragment.Children {
+			if n.InternalType != "ClassInstanceCreation" {
+				continue
+			}
+			arguments := argumentsOf(n)
+			if len(arguments) == 0 {
+				continue
+			}
+			key := className + "." + nameOf(fragment)
+			actionDeclarations = append(actionDeclarations, actionDeclaration{
+				action: TransportAction{
+					ActionClass: key,
+					CodeLine:    n.StartPosition.Line,
+					CodeFile:    relativePath(fileName),
+				},
+				key:      key,
+				nameNode: arguments[0],
+			})
+		}
+	}
+
+	// i.e. actions.register(ClusterHealthAction.INSTANCE, TransportClusterHealthAction.class);
+	// or new ActionHandler<>(GetAction.TYPE, TransportGetAction.class)
+	registrations, _ := tools.Filter(rootNode, "//MethodInvocation[SimpleName[@internalRole='name'][@token='register']]")
+	handlers, _ := tools.Filter(rootNode, "//ClassInstanceCreation/ParameterizedType/SimpleType/SimpleName[@token='ActionHandler']/../../..")
+	for _, n := range append(registrations, handlers...) {
+		arguments := argumentsOf(n)
+		if len(arguments) < 2 || arguments[1].InternalType != "TypeLiteral" || arguments[0].InternalType != "QualifiedName" {
+			continue
+		}
+		var parts []string
+		for _, child := range arguments[0].Children {
+			parts = append(parts, child.Token)
+		}
+		transportClass := typeName(arguments[1].Children[0])
+		// Subclasses are registered through their INSTANCE, instances by
+		// their own field
+		actionTransportClasses[parts[len(parts)-2]] = transportClass
+		actionTransportClasses[strings.Join(parts[len(parts)-2:], ".")] = transportClass
+	}
+}
+
+func resolveTransportActions(declarations []actionDeclaration) []TransportAction {
+	var actions []TransportAction
+
+	for _, d := range declarations {
+		a := d.action
+		if d.nameNode != nil {
+			a.Name, _ = resolveString(d.nameNode, strings.Split(d.key, ".")[0])
+		} else {
+			a.Name = stringConstants[d.key+".NAME"]
+		}
+		if a.Name == "" {
+			// Abstract base classes and the like declare no name
+			continue
+		}
+		a.TransportClass = actionTransportClasses[d.key]
+		a.RequestClass = transportRequestClasses[a.TransportClass]
+		actions = append(actions, a)
+	}
+
+	sort.Slice(actions, func(i, j int) bool { return actions[i].Name < actions[j].Name })
+
+	return actions
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"gopkg.in/bblfsh/sdk.v1/protocol"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// uastCacheDir is where parsed UASTs are kept between runs, empty to always
+// ask bblfsh. Enabling another extractor on an already scanned tree then only
+// reruns the queries.
+var uastCacheDir string
+
+// uastCachePath is where the UAST of a file with the given content is cached.
+// Trees are keyed by the hash of the content rather than the path, so a
+// checkout switched to another version reuses every file that didn't change,
+// and by driver version since another driver may produce another tree.
+func uastCachePath(content []byte) string {
+	sum := sha256.Sum256(content)
+	key := hex.EncodeToString(sum[:])
+
+	driver := runManifest.DriverVersion
+	if driver == "" {
+		driver = "unknown"
+	}
+	return filepath.Join(uastCacheDir, driver, key[:2], key+".uast.zst")
+}
+
+// Cache entries are the SHA-256 of the serialized tree followed by the tree
+// compressed with zstd. The checksum catches entries damaged on disk, which
+// are parsed again rather than fed to the extractors.
+var (
+	uastEncoder, _ = zstd.NewWriter(nil)
+	uastDecoder, _ = zstd.NewReader(nil)
+)
+
+func readCachedUAST(cachePath string) (*uast.Node, bool) {
+	b, err := ioutil.ReadFile(cachePath)
+	if err != nil || len(b) < sha256.Size {
+		return nil, false
+	}
+
+	serialized, err := uastDecoder.DecodeAll(b[sha256.Size:], nil)
+	if err == nil {
+		if sum := sha256.Sum256(serialized); !bytes.Equal(sum[:], b[:sha256.Size]) {
+			err = errors.New("checksum mismatch")
+		}
+	}
+	node := &uast.Node{}
+	if err == nil {
+		err = node.Unmarshal(serialized)
+	}
+	if err != nil {
+		// A corrupt entry is parsed again and overwritten
+		logger.Warn("ignoring corrupt cached UAST", "path", cachePath, "error", err)
+		return nil, false
+	}
+
+	// The modification time doubles as the last access time for pruning,
+	// access times are often not updated
+	now := time.Now()
+	os.Chtimes(cachePath, now, now)
+
+	return node, true
+}
+
+func writeCachedUAST(cachePath string, node *uast.Node) error {
+	serialized, err := node.Marshal()
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(serialized)
+	b := uastEncoder.EncodeAll(serialized, sum[:])
+
+	if err := os.MkdirAll(filepath.Dir(cachePath), 0755); err != nil {
+		return err
+	}
+	// Write then rename so an interrupted run never leaves a truncated tree
+	tmp := cachePath + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, cachePath)
+}
+
+// parseJava returns the UAST of a Java file, from the cache or the store
+// when it has already been parsed, and reports whether it came from either.
+func parseJava(filePath string) (*uast.Node, bool, error) {
+	if uastCacheDir == "" && uastStore == nil {
+		res, err := bblfshClient.NewParseRequest().ReadFile(filePath).Do()
+		if err != nil {
+			err = driverError{err}
+		}
+		node, _, err := parseResult(filePath, res, err)
+		return node, false, err
+	}
+
+	content, err := ioutil.ReadFile(filePath)
+	if err != nil {
+		return nil, false, err
+	}
+	var cachePath string
+	if uastCacheDir != "" {
+		cachePath = uastCachePath(content)
+		if node, ok := readCachedUAST(cachePath); ok {
+			return node, true, nil
+		}
+	}
+
+	res, stored, err := requestParse(filePath, content)
+	node, partial, err := parseResult(filePath, res, err)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// The cache is an optimization, a full disk shouldn't fail the run.
+	// Partial trees aren't cached so a fixed driver gets another go at them
+	if cachePath != "" && !partial {
+		if err := writeCachedUAST(cachePath, node); err != nil {
+			logger.Warn("failed to cache the UAST", "file", relativePath(filePath), "error", err)
+		}
+	}
+	return node, stored, nil
+}
+
+// filesPartial counts the files the driver only partially parsed.
+var filesPartial int
+
+// parseResult returns the UAST of a parse response. Files the driver
+// reports errors for but still returns a tree of are used with a warning,
+// as most of their settings are usually there, and only fatal errors fail
+// the file.
+func parseResult(filePath string, res *protocol.ParseResponse, err error) (*uast.Node, bool, error) {
+	if err != nil {
+		return nil, false, err
+	}
+	switch {
+	case res.Status == protocol.Ok:
+		return res.UAST, false, nil
+	case res.Status == protocol.Error && res.UAST != nil:
+		filesPartial++
+		runMetrics.observePartialParse()
+		logger.Warn("only partially parsed, settings may be missing", "file", relativePath(filePath), "errors", strings.Join(res.Errors, "; "))
+		return res.UAST, true, nil
+	}
+	return nil, false, errors.New(strings.Join(res.Errors, "; "))
+}
+
+// pruneUASTCache removes the least recently used cached trees until the
+// cache is no larger than maxSize bytes.
+func pruneUASTCache(dir string, maxSize int64) error {
+	type entry struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var entries []entry
+	var total int64
+
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		return nil
+	}
+	err := filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// The constant index is small and needed by every run
+		if !info.IsDir() && filePath != constantIndexPath() {
+			entries = append(entries, entry{filePath, info.Size(), info.ModTime()})
+			total += info.Size()
+		}
+		return nil
+	})
+	if err != nil || total <= maxSize {
+		return err
+	}
+
+	sort.Slice(entries, func(i, j int) bool { return entries[i].modTime.Before(entries[j].modTime) })
+	for _, e := range entries {
+		if total <= maxSize {
+			break
+		}
+		if err := os.Remove(e.path); err != nil {
+			return err
+		}
+		total -= e.size
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+	"gopkg.in/bblfsh/sdk.v1/protocol"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// uastStore is the -uast-store database of bblfshd responses, nil without
+// one. Unlike the -uast-cache it keeps failed and partial responses too, as
+// they were returned, so a run over the store behaves like the run that
+// filled it, and with -offline doesn't need bblfshd at all.
+var uastStore *bolt.DB
+
+// offline is set by -offline to parse files only from the -uast-store.
+var offline bool
+
+// Responses are kept in a bucket per driver version, keyed by the SHA-256
+// of the content. The meta bucket has the versions of the last run that
+// reached bblfshd, for -offline runs to record in their manifest.
+var (
+	storeResponsesBucket = []byte("responses")
+	storeMetaBucket      = []byte("meta")
+	storeBblfshdKey      = []byte("bblfshd_version")
+	storeDriverKey       = []byte("driver_version")
+)
+
+// storedResponse is a parse response as it's kept in the store, the UAST
+// serialized.
+type storedResponse struct {
+	Status protocol.Status `json:"status"`
+	Errors []string        `json:"errors,omitempty"`
+	UAST   []byte          `json:"uast,omitempty"`
+}
+
+// openUASTStore opens or creates the store. A store is used by one run at
+// a time, another run waits a little for it then gives up.
+func openUASTStore(fileName string) error {
+	db, err := bolt.Open(fileName, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err == bolt.ErrTimeout {
+		return fmt.Errorf("-uast-store %s is used by another run", fileName)
+	}
+	if err != nil {
+		return fmt.Errorf("-uast-store: %v", err)
+	}
+	uastStore = db
+	return nil
+}
+
+func closeUASTStore() {
+	if uastStore == nil {
+		return
+	}
+	if err := uastStore.Close(); err != nil {
+		logger.Error("closing the UAST store failed", "error", err)
+	}
+	uastStore = nil
+}
+
+// recordStoreVersions keeps the versions bblfshd reported.
+func recordStoreVersions() error {
+	return uastStore.Update(func(tx *bolt.Tx) error {
+		meta, err := tx.CreateBucketIfNotExists(storeMetaBucket)
+		if err != nil {
+			return err
+		}
+		if err := meta.Put(storeBblfshdKey, []byte(runManifest.BblfshdVersion)); err != nil {
+			return err
+		}
+		return meta.Put(storeDriverKey, []byte(runManifest.DriverVersion))
+	})
+}
+
+// storedVersions returns the versions of bblfshd and the driver the store
+// was last filled with.
+func storedVersions() (bblfshd, driver string) {
+	uastStore.View(func(tx *bolt.Tx) error {
+		if meta := tx.Bucket(storeMetaBucket); meta != nil {
+			bblfshd, driver = string(meta.Get(storeBblfshdKey)), string(meta.Get(storeDriverKey))
+		}
+		return nil
+	})
+	return bblfshd, driver
+}
+
+func storeDriverBucket() []byte {
+	driver := runManifest.DriverVersion
+	if driver == "" {
+		driver = "unknown"
+	}
+	return []byte(driver)
+}
+
+// readStoredResponse returns the response bblfshd gave for a file with the
+// given content.
+func readStoredResponse(content []byte) (*protocol.ParseResponse, bool) {
+	key := sha256.Sum256(content)
+	var b []byte
+	uastStore.View(func(tx *bolt.Tx) error {
+		responses := tx.Bucket(storeResponsesBucket)
+		if responses == nil {
+			return nil
+		}
+		if driver := responses.Bucket(storeDriverBucket()); driver != nil {
+			// Values are only valid for the transaction
+			b = append([]byte(nil), driver.Get(key[:])...)
+		}
+		return nil
+	})
+	if len(b) == 0 {
+		return nil, false
+	}
+
+	var stored storedResponse
+	serialized, err := uastDecoder.DecodeAll(b, nil)
+	if err == nil {
+		err = json.Unmarshal(serialized, &stored)
+	}
+	res := &protocol.ParseResponse{Response: protocol.Response{Status: stored.Status, Errors: stored.Errors}}
+	if err == nil && stored.UAST != nil {
+		res.UAST = &uast.Node{}
+		err = res.UAST.Unmarshal(stored.UAST)
+	}
+	if err != nil {
+		logger.Warn("ignoring a corrupt stored response", "error", err)
+		return nil, false
+	}
+	return res, true
+}
+
+func writeStoredResponse(content []byte, res *protocol.ParseResponse) error {
+	stored := storedResponse{Status: res.Status, Errors: res.Errors}
+	if res.UAST != nil {
+		serialized, err := res.UAST.Marshal()
+		if err != nil {
+			return err
+		}
+		stored.UAST = serialized
+	}
+	serialized, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+	b := uastEncoder.EncodeAll(serialized, nil)
+
+	key := sha256.Sum256(content)
+	return uastStore.Update(func(tx *bolt.Tx) error {
+		responses, err := tx.CreateBucketIfNotExists(storeResponsesBucket)
+		if err != nil {
+			return err
+		}
+		driver, err := responses.CreateBucketIfNotExists(storeDriverBucket())
+		if err != nil {
+			return err
+		}
+		return driver.Put(key[:], b)
+	})
+}
+
+// requestParse returns the response to parsing a file, from the store when
+// it has it and from bblfshd otherwise, and reports whether it came from
+// the store.
+func requestParse(filePath string, content []byte) (*protocol.ParseResponse, bool, error) {
+	if uastStore != nil {
+		if res, ok := readStoredResponse(content); ok {
+			return res, true, nil
+		}
+		if offline {
+			return nil, false, errors.New("not in the -uast-store, and -offline")
+		}
+	}
+
+	res, err := bblfshClient.NewParseRequest().Content(string(content)).Filename(filePath).Do()
+	if err != nil {
+		return nil, false, driverError{err}
+	}
+	// Only what bblfshd answered is kept, not the errors reaching it
+	if uastStore != nil {
+		if err := writeStoredResponse(content, res); err != nil {
+			logger.Warn("failed to store the parse response", "file", relativePath(filePath), "error", err)
+		}
+	}
+	return res, false, err
+}
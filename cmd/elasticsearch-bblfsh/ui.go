@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+)
+
+// quiet is set by -quiet, leaving only errors on stderr.
+var quiet bool
+
+// colorOutput colors warnings and errors, unless -no-color or NO_COLOR say
+// otherwise or stderr isn't a terminal, i.e. in CI logs.
+var colorOutput = os.Getenv("NO_COLOR") == "" && os.Getenv("TERM") != "dumb" && isTerminal(os.Stderr)
+
+const (
+	ansiReset  = "\x1b[0m"
+	ansiDim    = "\x1b[2m"
+	ansiRed    = "\x1b[31m"
+	ansiYellow = "\x1b[33m"
+)
+
+func colorize(color, s string) string {
+	if !colorOutput {
+		return s
+	}
+	return color + s + ansiReset
+}
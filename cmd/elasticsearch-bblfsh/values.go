@@ -0,0 +1,255 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Kinds of setting values that can be compared.
+const (
+	valueRatio    = "ratio"
+	valueBytes    = "bytes"
+	valueDuration = "duration"
+	valueNumber   = "number"
+	valueBoolean  = "boolean"
+)
+
+// settingValue is a setting value reduced to a number that can be compared:
+// ratios between 0 and 1, bytes, milliseconds, numbers, and 1 or 0 for
+// booleans.
+type settingValue struct {
+	Kind   string
+	Number float64
+}
+
+// byteUnits are the units ByteSizeValue parses, single letters included:
+// "512m" is 512mb for a byte size, only a duration takes m for minutes.
+var byteUnits = map[string]float64{
+	"b": 1, "kb": 1 << 10, "mb": 1 << 20, "gb": 1 << 30, "tb": 1 << 40, "pb": 1 << 50,
+	"k": 1 << 10, "m": 1 << 20, "g": 1 << 30, "t": 1 << 40, "p": 1 << 50,
+}
+
+var durationUnits = map[string]float64{
+	"nanos": 1e-6, "micros": 1e-3, "ms": 1, "s": 1000, "m": 60 * 1000, "h": 60 * 60 * 1000, "d": 24 * 60 * 60 * 1000,
+}
+
+var valueWithUnit = regexp.MustCompile(`^(-?[0-9.]+)\s*([a-z]*)$`)
+
+// checkableType reports whether values of a Java type can be parsed.
+func checkableType(javaType string) bool {
+	switch javaType {
+	case "Boolean", "Integer", "Long", "Double", "Float", "ByteSizeValue", "TimeValue":
+		return true
+	}
+	return false
+}
+
+// parseSettingValue parses a value written the way Elasticsearch accepts it
+// in elasticsearch.yml or the cluster settings API, i.e. "60%", "512mb" or
+// "30s", according to the Java type of the setting.
+func parseSettingValue(javaType, value string) (settingValue, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	switch javaType {
+	case "Boolean":
+		switch value {
+		case "true":
+			return settingValue{valueBoolean, 1}, nil
+		case "false":
+			return settingValue{valueBoolean, 0}, nil
+		}
+		return settingValue{}, fmt.Errorf("%q isn't a boolean, expected true or false", value)
+	case "Integer", "Long", "Double", "Float":
+		number, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return settingValue{}, fmt.Errorf("%q isn't a number", value)
+		}
+		if javaType == "Integer" && (number != math.Trunc(number) || number > math.MaxInt32 || number < math.MinInt32) {
+			return settingValue{}, fmt.Errorf("%q isn't an integer", value)
+		}
+		if javaType == "Long" && number != math.Trunc(number) {
+			return settingValue{}, fmt.Errorf("%q isn't an integer", value)
+		}
+		return settingValue{valueNumber, number}, nil
+	case "ByteSizeValue":
+		if strings.HasSuffix(value, "%") {
+			percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+			if err != nil || percent < 0 || percent > 100 {
+				return settingValue{}, fmt.Errorf("%q isn't a percentage between 0%% and 100%%", value)
+			}
+			return settingValue{valueRatio, percent / 100}, nil
+		}
+		return parseWithUnit(value, valueBytes, byteUnits, "byte size", "512mb")
+	case "TimeValue":
+		return parseWithUnit(value, valueDuration, durationUnits, "duration", "30s")
+	}
+
+	return settingValue{}, fmt.Errorf("values of type %q can't be checked", javaType)
+}
+
+// parseWithUnit parses a number followed by one of units. -1, commonly
+// meaning unbounded or disabled, and 0 are accepted without a unit.
+func parseWithUnit(value, kind string, units map[string]float64, description, example string) (settingValue, error) {
+	if value == "-1" || value == "0" {
+		number, _ := strconv.ParseFloat(value, 64)
+		return settingValue{kind, number}, nil
+	}
+
+	m := valueWithUnit.FindStringSubmatch(value)
+	if m == nil || units[m[2]] == 0 {
+		return settingValue{}, fmt.Errorf("%q isn't a %s, expected a number followed by a unit like %s", value, description, example)
+	}
+	number, err := strconv.ParseFloat(m[1], 64)
+	if err != nil || number < 0 {
+		return settingValue{}, fmt.Errorf("%q isn't a valid %s", value, description)
+	}
+	return settingValue{kind, number * units[m[2]]}, nil
+}
+
+var (
+	javaByteSizeDefault  = regexp.MustCompile(`^([0-9.]+)->ByteSizeUnit\.([A-Z]+)$`)
+	javaTimeUnitDefault  = regexp.MustCompile(`^([0-9.]+)->TimeUnit\.([A-Z]+)$`)
+	javaTimeValueDefault = regexp.MustCompile(`^(?:TimeValue->)?timeValue([A-Za-z]+)->([0-9.]+)$`)
+)
+
+var javaTimeUnits = map[string]string{
+	"NANOSECONDS": "nanos", "MICROSECONDS": "micros", "MILLISECONDS": "ms", "SECONDS": "s", "MINUTES": "m", "HOURS": "h", "DAYS": "d",
+	"Nanos": "nanos", "Micros": "micros", "Millis": "ms", "Seconds": "s", "Minutes": "m", "Hours": "h", "Days": "d",
+}
+
+// parseDefaultArg parses the default of a setting as extracted from the Java
+// code, i.e. "100->ByteSizeUnit.MB" or "TimeValue->timeValueSeconds->30".
+// Defaults computed at runtime can't be parsed.
+func parseDefaultArg(javaType, defaultArg string) (settingValue, bool) {
+	value := strings.Trim(strings.TrimSpace(defaultArg), `"`)
+	if value == "" {
+		return settingValue{}, false
+	}
+
+	switch javaType {
+	case "Double", "Float", "Long":
+		value = strings.TrimRight(value, "dDfFlL")
+	case "ByteSizeValue":
+		if m := javaByteSizeDefault.FindStringSubmatch(value); m != nil {
+			value = m[1] + strings.ToLower(m[2])
+		}
+	case "TimeValue":
+		if m := javaTimeUnitDefault.FindStringSubmatch(value); m != nil {
+			value = m[1] + javaTimeUnits[m[2]]
+		} else if m := javaTimeValueDefault.FindStringSubmatch(value); m != nil {
+			value = m[2] + javaTimeUnits[m[1]]
+		}
+	}
+
+	v, err := parseSettingValue(javaType, value)
+	return v, err == nil
+}
+
+// formatSettingValue formats a value back the way Elasticsearch would
+// display it.
+func formatSettingValue(v settingValue) string {
+	switch v.Kind {
+	case valueRatio:
+		return strconv.FormatFloat(v.Number*100, 'f', -1, 64) + "%"
+	case valueBytes:
+		if v.Number < 0 {
+			return "-1"
+		}
+		return formatBytes(int64(v.Number))
+	case valueDuration:
+		if v.Number < 0 {
+			return "-1"
+		}
+		return formatDuration(v.Number)
+	case valueBoolean:
+		return strconv.FormatBool(v.Number != 0)
+	}
+	return strconv.FormatFloat(v.Number, 'f', -1, 64)
+}
+
+// formatDuration formats milliseconds with the largest unit that keeps them
+// whole, i.e. "90s" rather than "1.5m".
+func formatDuration(ms float64) string {
+	for _, unit := range []string{"d", "h", "m", "s"} {
+		if ms >= durationUnits[unit] && math.Mod(ms, durationUnits[unit]) == 0 {
+			return strconv.FormatFloat(ms/durationUnits[unit], 'f', -1, 64) + unit
+		}
+	}
+	return strconv.FormatFloat(ms, 'f', -1, 64) + "ms"
+}
+
+// NormalizedValue is a default reduced to a number in a fixed unit, so
+// consumers compare "30s" and "1m" or "512mb" and "1gb" without parsing
+// them. Display is the value formatted back the way Elasticsearch would.
+type NormalizedValue struct {
+	Value   float64 `json:"value"`
+	Unit    string  `json:"unit"`
+	Display string  `json:"display"`
+}
+
+// normalizedUnits are the units of the normalized values of each kind.
+var normalizedUnits = map[string]string{
+	valueRatio:    "ratio",
+	valueBytes:    "bytes",
+	valueDuration: "duration_ms",
+	valueNumber:   "number",
+	valueBoolean:  "boolean",
+}
+
+// normalizeDefault normalizes the default of a setting. Percentages, sizes
+// and durations in String settings, i.e. the "85%" of the disk watermarks,
+// are normalized too. It returns nil for defaults computed at runtime.
+func normalizeDefault(s ElasticsearchSetting) *NormalizedValue {
+	return normalizeValue(s.JavaType, s.DefaultArg)
+}
+
+// normalizeValue normalizes a default or a bound of a setting of a Java
+// type, written like DefaultArg. It returns nil for empty values and the
+// ones computed at runtime.
+func normalizeValue(javaType, value string) *NormalizedValue {
+	if value == "" {
+		return nil
+	}
+	v, ok := parseDefaultArg(javaType, value)
+	if !ok && javaType == "String" {
+		v, ok = parseStringValue(value)
+	}
+	if !ok {
+		return nil
+	}
+	return &NormalizedValue{Value: v.Number, Unit: normalizedUnits[v.Kind], Display: formatSettingValue(v)}
+}
+
+func (n NormalizedValue) settingValue() settingValue {
+	for kind, unit := range normalizedUnits {
+		if unit == n.Unit {
+			return settingValue{kind, n.Value}
+		}
+	}
+	return settingValue{Number: n.Value}
+}
+
+// parseStringValue parses a String value that has a unit, trying it as a
+// percentage, a byte size and a duration in turn. Numbers alone are left
+// alone, their unit can't be told, and so are values in m, which is
+// megabytes for a byte size but minutes for a duration: without the Java
+// type of a ByteSizeValue or TimeValue there's no telling which.
+func parseStringValue(value string) (settingValue, bool) {
+	value = strings.ToLower(strings.Trim(strings.TrimSpace(value), `"`))
+	m := valueWithUnit.FindStringSubmatch(value)
+	if !strings.HasSuffix(value, "%") && (m == nil || m[2] == "") {
+		return settingValue{}, false
+	}
+	if m != nil && byteUnits[m[2]] != 0 && durationUnits[m[2]] != 0 {
+		return settingValue{}, false
+	}
+	for _, javaType := range []string{"ByteSizeValue", "TimeValue"} {
+		if v, err := parseSettingValue(javaType, value); err == nil {
+			return v, true
+		}
+	}
+	return settingValue{}, false
+}
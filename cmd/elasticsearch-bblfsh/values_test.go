@@ -0,0 +1,106 @@
+package main
+
+import "testing"
+
+func TestParseSettingValue(t *testing.T) {
+	for _, tc := range []struct {
+		javaType, value string
+		want            settingValue
+	}{
+		{"Boolean", "true", settingValue{valueBoolean, 1}},
+		{"Integer", "42", settingValue{valueNumber, 42}},
+		{"ByteSizeValue", "512mb", settingValue{valueBytes, 512 << 20}},
+		// Single letter units are byte units for a ByteSizeValue
+		{"ByteSizeValue", "512m", settingValue{valueBytes, 512 << 20}},
+		{"ByteSizeValue", "1g", settingValue{valueBytes, 1 << 30}},
+		{"ByteSizeValue", "10k", settingValue{valueBytes, 10 << 10}},
+		{"ByteSizeValue", "85%", settingValue{valueRatio, 0.85}},
+		{"ByteSizeValue", "-1", settingValue{valueBytes, -1}},
+		// and minutes for a TimeValue
+		{"TimeValue", "30m", settingValue{valueDuration, 30 * 60 * 1000}},
+		{"TimeValue", "30s", settingValue{valueDuration, 30 * 1000}},
+		{"TimeValue", "500ms", settingValue{valueDuration, 500}},
+	} {
+		got, err := parseSettingValue(tc.javaType, tc.value)
+		if err != nil || got != tc.want {
+			t.Errorf("parseSettingValue(%s, %q) = %v, %v, want %v", tc.javaType, tc.value, got, err, tc.want)
+		}
+	}
+
+	for _, tc := range []struct{ javaType, value string }{
+		{"Boolean", "yes"},
+		{"Integer", "1.5"},
+		{"Integer", "3000000000"},
+		{"ByteSizeValue", "512x"},
+		{"ByteSizeValue", "120%"},
+		{"TimeValue", "30"},
+		{"TimeValue", "30mb"},
+		{"String", "x"},
+	} {
+		if v, err := parseSettingValue(tc.javaType, tc.value); err == nil {
+			t.Errorf("parseSettingValue(%s, %q) = %v, want an error", tc.javaType, tc.value, v)
+		}
+	}
+}
+
+func TestParseDefaultArg(t *testing.T) {
+	for _, tc := range []struct {
+		javaType, defaultArg string
+		want                 settingValue
+	}{
+		{"ByteSizeValue", "100->ByteSizeUnit.MB", settingValue{valueBytes, 100 << 20}},
+		{"TimeValue", "TimeValue->timeValueSeconds->30", settingValue{valueDuration, 30 * 1000}},
+		{"TimeValue", "5->TimeUnit.MINUTES", settingValue{valueDuration, 5 * 60 * 1000}},
+		{"Long", "10L", settingValue{valueNumber, 10}},
+		{"ByteSizeValue", `"512m"`, settingValue{valueBytes, 512 << 20}},
+	} {
+		got, ok := parseDefaultArg(tc.javaType, tc.defaultArg)
+		if !ok || got != tc.want {
+			t.Errorf("parseDefaultArg(%s, %q) = %v, %v, want %v", tc.javaType, tc.defaultArg, got, ok, tc.want)
+		}
+	}
+	if v, ok := parseDefaultArg("TimeValue", "computeDefault->settings"); ok {
+		t.Errorf("a default computed at runtime parsed as %v", v)
+	}
+}
+
+func TestNormalizeDefault(t *testing.T) {
+	for _, tc := range []struct {
+		setting ElasticsearchSetting
+		want    *NormalizedValue
+	}{
+		{ElasticsearchSetting{JavaType: "ByteSizeValue", DefaultArg: `"512m"`}, &NormalizedValue{512 << 20, "bytes", "512mb"}},
+		{ElasticsearchSetting{JavaType: "TimeValue", DefaultArg: `"90s"`}, &NormalizedValue{90000, "duration_ms", "90s"}},
+		{ElasticsearchSetting{JavaType: "String", DefaultArg: `"85%"`}, &NormalizedValue{0.85, "ratio", "85%"}},
+		{ElasticsearchSetting{JavaType: "String", DefaultArg: `"1g"`}, &NormalizedValue{1 << 30, "bytes", "1gb"}},
+		// m is megabytes or minutes, a String setting doesn't tell which
+		{ElasticsearchSetting{JavaType: "String", DefaultArg: `"512m"`}, nil},
+		{ElasticsearchSetting{JavaType: "String", DefaultArg: `"10"`}, nil},
+	} {
+		got := normalizeDefault(tc.setting)
+		if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+			t.Errorf("normalizeDefault(%s %s) = %v, want %v", tc.setting.JavaType, tc.setting.DefaultArg, got, tc.want)
+		}
+	}
+}
+
+func TestNormalizeBounds(t *testing.T) {
+	for _, tc := range []struct {
+		javaType, bound string
+		want            *NormalizedValue
+	}{
+		{"Integer", "1", &NormalizedValue{1, "number", "1"}},
+		{"ByteSizeValue", "1->ByteSizeUnit.KB", &NormalizedValue{1 << 10, "bytes", "1kb"}},
+		{"ByteSizeValue", "512m", &NormalizedValue{512 << 20, "bytes", "512mb"}},
+		{"TimeValue", "TimeValue->timeValueMillis->100", &NormalizedValue{100, "duration_ms", "100ms"}},
+		// Setting.positiveTimeSetting
+		{"TimeValue", "0", &NormalizedValue{0, "duration_ms", "0ms"}},
+		{"Integer", "", nil},
+		{"Integer", "Integer.MAX_VALUE", nil},
+	} {
+		got := normalizeValue(tc.javaType, tc.bound)
+		if (got == nil) != (tc.want == nil) || (got != nil && *got != *tc.want) {
+			t.Errorf("normalizeValue(%s, %q) = %v, want %v", tc.javaType, tc.bound, got, tc.want)
+		}
+	}
+}
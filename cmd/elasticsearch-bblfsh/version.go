@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// These are injected at build time, i.e.
+//
+//	go build -ldflags "-X main.version=1.2.0 -X main.commit=$(git rev-parse HEAD) -X main.buildDate=$(date -u +%FT%TZ)"
+var (
+	version   = "dev"
+	commit    = ""
+	buildDate = ""
+)
+
+// BuildInfo identifies the build of the tool that wrote an output file.
+type BuildInfo struct {
+	ToolVersion   string `json:"tool_version"`
+	ToolCommit    string `json:"tool_commit,omitempty"`
+	ToolBuildDate string `json:"tool_build_date,omitempty"`
+}
+
+func buildInfo() BuildInfo {
+	info := BuildInfo{ToolVersion: version, ToolCommit: commit, ToolBuildDate: buildDate}
+
+	// Plain go build records the VCS state in the binary, use it when
+	// nothing was injected
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range bi.Settings {
+			switch {
+			case setting.Key == "vcs.revision" && info.ToolCommit == "":
+				info.ToolCommit = setting.Value
+			case setting.Key == "vcs.time" && info.ToolBuildDate == "":
+				info.ToolBuildDate = setting.Value
+			}
+		}
+	}
+
+	return info
+}
+
+func (b BuildInfo) String() string {
+	s := "elasticsearch-bblfsh " + b.ToolVersion
+	if b.ToolCommit != "" {
+		s += fmt.Sprintf(" (commit %s)", b.ToolCommit)
+	}
+	if b.ToolBuildDate != "" {
+		s += fmt.Sprintf(" built %s", b.ToolBuildDate)
+	}
+	return s
+}
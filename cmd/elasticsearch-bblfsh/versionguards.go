@@ -0,0 +1,208 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	javaextractor "github.com/nickcanz/elasticsearch-bblfsh/extractor"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// versionConstant matches the Version and IndexVersions constants, i.e.
+// Version.V_7_0_0, capturing the version they stand for.
+var versionConstant = regexp.MustCompile(`^V_(\d+)_(\d+)_(\d+)$`)
+
+// versionGuard is a comparison of the version an index was created with
+// against a version constant, i.e.
+// IndexMetadata.SETTING_INDEX_VERSION_CREATED.get(settings).onOrAfter(Version.V_7_0_0)
+type versionGuard struct {
+	version string
+	// onOrAfter is true when the comparison holds for indices created on or
+	// after version, false when it holds for older indices
+	onOrAfter bool
+}
+
+func walkNodes(node *uast.Node, visit func(*uast.Node)) {
+	visit(node)
+	for _, child := range node.Children {
+		walkNodes(child, visit)
+	}
+}
+
+func childWithRole(node *uast.Node, role string) *uast.Node {
+	for _, child := range node.Children {
+		if child.Properties["internalRole"] == role {
+			return child
+		}
+	}
+	return nil
+}
+
+// isIndexCreatedVersion reports whether an expression is the version an
+// index was created with, going by the names the Elasticsearch sources
+// use for it: SETTING_INDEX_VERSION_CREATED, getIndexVersionCreated(),
+// getCreationVersion(), a local indexCreatedVersion and so on.
+func isIndexCreatedVersion(node *uast.Node) bool {
+	found := false
+	walkNodes(node, func(n *uast.Node) {
+		token := strings.ToLower(n.Token)
+		if strings.Contains(token, "version") && (strings.Contains(token, "created") || strings.Contains(token, "creation")) {
+			found = true
+		}
+	})
+	return found
+}
+
+// versionOf returns the version a Version.V_X_Y_Z constant stands for.
+func versionOf(node *uast.Node) string {
+	if node.InternalType == "QualifiedName" && len(node.Children) > 0 {
+		node = node.Children[len(node.Children)-1]
+	}
+	m := versionConstant.FindStringSubmatch(node.Token)
+	if m == nil {
+		return ""
+	}
+	return strings.Join(m[1:], ".")
+}
+
+// conditionGuards returns the index created version comparisons a condition
+// requires to hold. It only looks through negations and conjunctions, a
+// comparison in a disjunction doesn't tell anything about the branches.
+func conditionGuards(node *uast.Node, negated bool) []versionGuard {
+	switch node.InternalType {
+	case "ParenthesizedExpression":
+		if len(node.Children) > 0 {
+			return conditionGuards(node.Children[0], negated)
+		}
+	case "PrefixExpression":
+		if node.Properties["operator"] == "!" && len(node.Children) > 0 {
+			return conditionGuards(node.Children[len(node.Children)-1], !negated)
+		}
+	case "InfixExpression":
+		if node.Properties["operator"] != "&&" || negated {
+			return nil
+		}
+		var guards []versionGuard
+		for _, child := range node.Children {
+			guards = append(guards, conditionGuards(child, negated)...)
+		}
+		return guards
+	case "MethodInvocation":
+		var onOrAfter bool
+		switch nameOf(node) {
+		case "onOrAfter":
+			onOrAfter = true
+		case "before":
+			onOrAfter = false
+		default:
+			return nil
+		}
+		receiver := childWithRole(node, "expression")
+		arguments := argumentsOf(node)
+		if receiver == nil || len(arguments) != 1 || !isIndexCreatedVersion(receiver) {
+			return nil
+		}
+		if version := versionOf(arguments[0]); version != "" {
+			return []versionGuard{{version: version, onOrAfter: onOrAfter != negated}}
+		}
+	}
+	return nil
+}
+
+func containsThrow(node *uast.Node) bool {
+	found := false
+	walkNodes(node, func(n *uast.Node) {
+		if n.InternalType == "ThrowStatement" {
+			found = true
+		}
+	})
+	return found
+}
+
+// referencedSettings returns the raw names of the given settings a node
+// refers to, either by their field name or qualified with their class.
+func referencedSettings(node *uast.Node, rawNames map[string]bool) []string {
+	var names []string
+	walkNodes(node, func(n *uast.Node) {
+		if n.InternalType == "SimpleName" && rawNames[n.Token] {
+			names = append(names, n.Token)
+		}
+	})
+	return names
+}
+
+// minIndexCreatedVersions finds the settings of a file that are only read or
+// accepted for indices created on or after some version. A setting is
+// guarded when it's used in a branch only taken for those indices, i.e.
+//
+//	if (indexSettings.getIndexVersionCreated().onOrAfter(Version.V_7_0_0)) {
+//	    this.maxRegexLength = scopedSettings.get(MAX_REGEX_LENGTH_SETTING);
+//
+// or when its declaration rejects values for older indices, i.e. in a
+// validator
+//
+//	if (IndexMetadata.SETTING_INDEX_VERSION_CREATED.get(settings).before(Version.V_7_0_0)) {
+//	    throw new IllegalArgumentException(...)
+//
+// Only the file the settings are declared in is looked at.
+func minIndexCreatedVersions(rootNode *uast.Node, settings []ElasticsearchSetting) map[string]string {
+	rawNames := map[string]bool{}
+	for _, s := range settings {
+		if s.Scope() == "index" {
+			rawNames[s.RawName] = true
+		}
+	}
+	if len(rawNames) == 0 {
+		return nil
+	}
+
+	versions := map[string]string{}
+	guard := func(rawName, version string) {
+		if current, ok := versions[rawName]; !ok || compareVersions(version, current) > 0 {
+			versions[rawName] = version
+		}
+	}
+
+	walkNodes(rootNode, func(n *uast.Node) {
+		switch n.InternalType {
+		case "FieldDeclaration":
+			rawName := javaextractor.RawName(n)
+			if !rawNames[rawName] {
+				return
+			}
+			walkNodes(n, func(statement *uast.Node) {
+				if statement.InternalType != "IfStatement" {
+					return
+				}
+				then := childWithRole(statement, "thenStatement")
+				if then == nil || !containsThrow(then) {
+					return
+				}
+				for _, g := range conditionGuards(childWithRole(statement, "expression"), false) {
+					if !g.onOrAfter {
+						guard(rawName, g.version)
+					}
+				}
+			})
+		case "IfStatement":
+			condition := childWithRole(n, "expression")
+			if condition == nil {
+				return
+			}
+			for _, g := range conditionGuards(condition, false) {
+				branch := childWithRole(n, "thenStatement")
+				if !g.onOrAfter {
+					branch = childWithRole(n, "elseStatement")
+				}
+				if branch == nil {
+					continue
+				}
+				for _, rawName := range referencedSettings(branch, rawNames) {
+					guard(rawName, g.version)
+				}
+			}
+		}
+	})
+
+	return versions
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+)
+
+// compareVersions orders Elasticsearch version strings like "6.8.0",
+// "v7.10.2" or "8.0.0-alpha1". Pre-release versions sort before the release
+// they lead up to.
+func compareVersions(a, b string) int {
+	aCore, aPre := splitVersion(a)
+	bCore, bPre := splitVersion(b)
+
+	for i := 0; i < len(aCore) || i < len(bCore); i++ {
+		var x, y int
+		if i < len(aCore) {
+			x = aCore[i]
+		}
+		if i < len(bCore) {
+			y = bCore[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return comparePrerelease(aPre, bPre)
+}
+
+// comparePrerelease orders pre-release suffixes like semver does, identifier
+// by identifier, numbers numerically. The identifiers Elasticsearch uses
+// run a number on a word, i.e. alpha2 or rc10, which are ordered by the
+// word then numerically by the number, for rc10 to come after rc2.
+func comparePrerelease(a, b string) int {
+	aIDs, bIDs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aIDs) && i < len(bIDs); i++ {
+		aWord, aNumber, aNumeric := splitIdentifier(aIDs[i])
+		bWord, bNumber, bNumeric := splitIdentifier(bIDs[i])
+		switch {
+		case aWord != bWord:
+			// Numeric identifiers, without a word, come first
+			if aWord < bWord {
+				return -1
+			}
+			return 1
+		case aNumeric != bNumeric:
+			if !aNumeric {
+				return -1
+			}
+			return 1
+		case aNumber != bNumber:
+			if aNumber < bNumber {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case len(aIDs) < len(bIDs):
+		return -1
+	case len(aIDs) > len(bIDs):
+		return 1
+	}
+	return 0
+}
+
+// splitIdentifier splits a pre-release identifier into the word and the
+// number it ends with, if it ends with one.
+func splitIdentifier(id string) (string, int, bool) {
+	i := len(id)
+	for i > 0 && id[i-1] >= '0' && id[i-1] <= '9' {
+		i--
+	}
+	number, err := strconv.Atoi(id[i:])
+	if err != nil {
+		return id, 0, false
+	}
+	return id[:i], number, true
+}
+
+func splitVersion(version string) ([]int, string) {
+	version = strings.TrimPrefix(version, "v")
+
+	var pre string
+	if i := strings.IndexAny(version, "-+"); i >= 0 {
+		version, pre = version[:i], version[i+1:]
+	}
+
+	var core []int
+	for _, part := range strings.Split(version, ".") {
+		n, _ := strconv.Atoi(part)
+		core = append(core, n)
+	}
+
+	return core, pre
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"sort"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"6.8.0", "7.0.0", -1},
+		{"v7.10.2", "7.9.3", 1},
+		{"7.10", "7.10.0", 0},
+		{"8.0.0-alpha1", "8.0.0", -1},
+		{"8.0.0", "8.0.0-rc1", 1},
+		{"8.0.0-alpha2", "8.0.0-beta1", -1},
+		{"8.0.0-rc2", "8.0.0-rc10", -1},
+		{"8.0.0-rc10", "8.0.0-rc2", 1},
+		{"8.0.0-rc", "8.0.0-rc1", -1},
+		{"1.0.0-alpha.1", "1.0.0-alpha.beta", -1},
+		{"1.0.0-alpha.2", "1.0.0-alpha.10", -1},
+		{"1.0.0-alpha", "1.0.0-alpha.1", -1},
+		{"8.0.0-rc2", "8.0.0-rc2", 0},
+	} {
+		if got := compareVersions(tc.a, tc.b); got != tc.want {
+			t.Errorf("compareVersions(%s, %s) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+	}
+
+	versions := []string{"8.0.0", "8.0.0-rc10", "7.17.0", "8.0.0-alpha1", "8.0.0-rc2", "8.0.0-beta1"}
+	sort.Slice(versions, func(i, j int) bool { return compareVersions(versions[i], versions[j]) < 0 })
+	want := []string{"7.17.0", "8.0.0-alpha1", "8.0.0-beta1", "8.0.0-rc2", "8.0.0-rc10", "8.0.0"}
+	for i := range want {
+		if versions[i] != want[i] {
+			t.Fatalf("sorted %v, want %v", versions, want)
+		}
+	}
+}
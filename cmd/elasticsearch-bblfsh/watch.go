@@ -0,0 +1,212 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDelay is how long the tree has to be quiet before changed files are
+// extracted again, so saving several files or switching branches triggers
+// a single rebuild.
+const watchDelay = 300 * time.Millisecond
+
+// watchSupported returns an error when the run writes its settings somewhere
+// -watch can't keep rewriting.
+func watchSupported(streaming bool, others map[string]bool) error {
+	if streaming {
+		return errors.New("-watch can't be used with -format ndjson, the settings are written as they're found")
+	}
+	for name, given := range others {
+		if given {
+			return fmt.Errorf("-watch can't be used with %s, it only rewrites the -format outputs", name)
+		}
+	}
+	if !extractorEnabled("settings") {
+		return errors.New("-watch needs the settings extractor, it's the settings it rewrites")
+	}
+	var unsupported []string
+	for _, e := range enabledExtractors {
+		if e.name != "settings" && e.name != "constants" {
+			unsupported = append(unsupported, e.name)
+		}
+	}
+	if len(unsupported) > 0 {
+		return fmt.Errorf("-watch only extracts settings again, not these extractors: %s", strings.Join(unsupported, ", "))
+	}
+	return nil
+}
+
+// settingsWatcher extracts the settings of the files that change under the
+// scanned directories again and writes the outputs anew with them.
+type settingsWatcher struct {
+	watcher *fsnotify.Watcher
+	// settings are the settings of every file as extracted, before their
+	// constants are resolved, so a changed constant is resolved again in
+	// the settings of every file using it
+	settings map[string][]ElasticsearchSetting
+	write    func([]ElasticsearchSetting) error
+}
+
+// newSettingsWatcher starts watching the scanned directories, with the
+// settings of the run that walked them.
+func newSettingsWatcher(dirs []string, settings []ElasticsearchSetting, write func([]ElasticsearchSetting) error) (*settingsWatcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	w := &settingsWatcher{watcher: watcher, settings: map[string][]ElasticsearchSetting{}, write: write}
+	for _, s := range settings {
+		w.settings[s.CodeFile] = append(w.settings[s.CodeFile], s)
+	}
+	for _, dir := range dirs {
+		if err := w.addDir(path.Join(rootDir, strings.TrimSpace(dir))); err != nil {
+			watcher.Close()
+			return nil, err
+		}
+	}
+	return w, nil
+}
+
+// addDir watches a directory and the ones under it, fsnotify doesn't watch
+// recursively.
+func (w *settingsWatcher) addDir(dir string) error {
+	return filepath.Walk(dir, func(filePath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if skipDir(filePath, info) {
+			return filepath.SkipDir
+		}
+		return w.watcher.Add(filePath)
+	})
+}
+
+// run waits for changes until the run is asked to shut down.
+func (w *settingsWatcher) run() error {
+	defer w.watcher.Close()
+	if !quiet {
+		fmt.Fprintln(os.Stderr, "watching for changes, Ctrl-C to stop")
+	}
+
+	pending := map[string]bool{}
+	var lastEvent time.Time
+	ticker := time.NewTicker(watchDelay)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-w.watcher.Events:
+			if event.Has(fsnotify.Create) {
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					// Files already in a directory moved into the tree
+					// don't get events of their own
+					if err := w.addDir(event.Name); err != nil {
+						logger.Warn("couldn't watch a new directory", "dir", relativePath(event.Name), "error", err)
+					}
+					filepath.Walk(event.Name, func(filePath string, info os.FileInfo, err error) error {
+						if err == nil && !info.IsDir() && path.Ext(filePath) == ".java" {
+							pending[filePath] = true
+						}
+						return nil
+					})
+				}
+			}
+			if path.Ext(event.Name) == ".java" && !event.Has(fsnotify.Chmod) {
+				pending[event.Name] = true
+			}
+			lastEvent = time.Now()
+		case err := <-w.watcher.Errors:
+			logger.Warn("watching the tree failed", "error", err)
+		case <-ticker.C:
+			if shutdownRequested() {
+				return nil
+			}
+			if len(pending) == 0 || time.Since(lastEvent) < watchDelay {
+				continue
+			}
+			err := w.rebuild(pending)
+			if err == errInterrupted {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			pending = map[string]bool{}
+		}
+	}
+}
+
+// rebuild extracts the settings of the changed files again and writes the
+// outputs with the settings of every file.
+func (w *settingsWatcher) rebuild(changed map[string]bool) error {
+	started := time.Now()
+	files := make([]string, 0, len(changed))
+	for filePath := range changed {
+		files = append(files, filePath)
+	}
+	sort.Strings(files)
+
+	for _, filePath := range files {
+		rel := relativePath(filePath)
+		info, err := os.Stat(filePath)
+		if os.IsNotExist(err) {
+			delete(w.settings, rel)
+			if extractorEnabled("constants") {
+				setFileConstants(rel, &fileConstants{})
+				delete(indexedFiles, rel)
+			}
+			continue
+		}
+		if err != nil {
+			logger.Warn("couldn't read a changed file", "file", rel, "error", err)
+			continue
+		}
+
+		elasticsearchSettings = nil
+		if err := processFile(filePath, info, nil); err != nil {
+			return err
+		}
+		// Example keys are only looked for by the full run, the affix
+		// settings that are still there keep theirs
+		for i, s := range elasticsearchSettings {
+			for _, previous := range w.settings[rel] {
+				if previous.Name == s.Name && len(previous.ExampleKeys) > 0 {
+					elasticsearchSettings[i].ExampleKeys = previous.ExampleKeys
+				}
+			}
+		}
+		w.settings[rel] = elasticsearchSettings
+	}
+
+	codeFiles := make([]string, 0, len(w.settings))
+	for codeFile := range w.settings {
+		codeFiles = append(codeFiles, codeFile)
+	}
+	sort.Strings(codeFiles)
+	var settings []ElasticsearchSetting
+	for _, codeFile := range codeFiles {
+		settings = append(settings, w.settings[codeFile]...)
+	}
+	settings, err := finishSettings(settings, true)
+	if err != nil {
+		return err
+	}
+	if err := w.write(settings); err != nil {
+		return err
+	}
+
+	if !quiet {
+		fmt.Fprintf(os.Stderr, "%s: %d files changed, %d settings written in %s\n", time.Now().Format("15:04:05"), len(files), len(settings), time.Since(started).Round(time.Millisecond))
+	}
+	return nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// stringsFlag is a flag that can be given several times.
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
+
+// WhatIfChange is the review of a single proposed setting change.
+type WhatIfChange struct {
+	Name     string   `json:"name"`
+	Value    string   `json:"value"`
+	Known    bool     `json:"known"`
+	JavaType string   `json:"java_type,omitempty"`
+	Scope    string   `json:"scope,omitempty"`
+	Dynamic  bool     `json:"dynamic"`
+	Default  string   `json:"default,omitempty"`
+	Problems []string `json:"problems,omitempty"`
+	Delta    string   `json:"delta,omitempty"`
+	// Affected are the settings that fall back to this one and change
+	// along with it unless they're set themselves
+	Affected []string `json:"affected,omitempty"`
+	Notes    []string `json:"notes,omitempty"`
+}
+
+// WhatIfReport is the output of the what-if subcommand.
+type WhatIfReport struct {
+	BuildInfo
+	Changes []WhatIfChange `json:"changes"`
+}
+
+// fallbackSettings returns the settings whose default is the value of
+// setting, directly or through another fallback, leaving out the ones in
+// exclude.
+func fallbackSettings(settings []ElasticsearchSetting, setting ElasticsearchSetting, exclude map[string]bool) []string {
+	var affected []string
+	seen := map[string]bool{setting.Name: true}
+	queue := []ElasticsearchSetting{setting}
+
+	for len(queue) > 0 {
+		current := queue[0]
+		queue = queue[1:]
+		if current.RawName == "" {
+			continue
+		}
+		for _, s := range settings {
+			if seen[s.Name] || exclude[s.Name] {
+				continue
+			}
+			if s.DefaultArg == current.RawName || strings.HasSuffix(s.DefaultArg, "."+current.RawName) {
+				seen[s.Name] = true
+				affected = append(affected, s.Name)
+				queue = append(queue, s)
+			}
+		}
+	}
+
+	return affected
+}
+
+// fallbackOf returns the setting whose value is the default of setting.
+func fallbackOf(settings []ElasticsearchSetting, setting ElasticsearchSetting) (ElasticsearchSetting, bool) {
+	for _, s := range settings {
+		if s.RawName != "" && s.Name != setting.Name && (setting.DefaultArg == s.RawName || strings.HasSuffix(setting.DefaultArg, "."+s.RawName)) {
+			return s, true
+		}
+	}
+	return ElasticsearchSetting{}, false
+}
+
+// valueDelta describes how much a value moves away from the default.
+func valueDelta(from, to settingValue, heap int64) string {
+	if from.Kind != to.Kind {
+		return ""
+	}
+	diff := to.Number - from.Number
+	sign := "+"
+	if diff < 0 {
+		sign = "-"
+		diff = -diff
+	}
+
+	switch to.Kind {
+	case valueBoolean:
+		return fmt.Sprintf("%s -> %s", formatSettingValue(from), formatSettingValue(to))
+	case valueRatio:
+		// Round away the float noise of i.e. 0.7 - 0.6
+		points := math.Round(diff*100*1e6) / 1e6
+		delta := fmt.Sprintf("%s%s points", sign, strconv.FormatFloat(points, 'f', -1, 64))
+		if heap > 0 {
+			delta += fmt.Sprintf(", %s%s of a %s heap", sign, formatBytes(int64(diff*float64(heap))), formatBytes(heap))
+		}
+		return delta
+	}
+	return sign + formatSettingValue(settingValue{to.Kind, diff})
+}
+
+func reviewChange(settings []ElasticsearchSetting, byName map[string]ElasticsearchSetting, name, value string, changed map[string]bool, heap int64) WhatIfChange {
+	change := WhatIfChange{Name: name, Value: value}
+
+	setting, ok := byName[name]
+	if !ok {
+		setting, ok = affixSettingOf(settings, name)
+	}
+	if !ok {
+		change.Problems = append(change.Problems, "unknown setting, it may be misspelled or come from a plugin that wasn't scanned")
+		return change
+	}
+	change.Known = true
+	change.JavaType = setting.JavaType
+	change.Scope = setting.Scope()
+	change.Dynamic = updateBadge(setting) == "dynamic"
+	change.Default = setting.DefaultArg
+	if fallback, ok := fallbackOf(settings, setting); ok {
+		change.Default = "the value of " + fallback.Name
+	}
+
+	if !checkableType(setting.JavaType) {
+		change.Notes = append(change.Notes, fmt.Sprintf("values of type %q aren't checked", setting.JavaType))
+	} else if proposed, err := parseSettingValue(setting.JavaType, value); err != nil {
+		change.Problems = append(change.Problems, err.Error())
+	} else if current := setting.NormalizedDefault; current != nil {
+		change.Default = current.Display
+		change.Delta = valueDelta(current.settingValue(), proposed, heap)
+	}
+
+	switch {
+	case change.Dynamic && change.Scope == "index":
+		change.Notes = append(change.Notes, "dynamic, takes effect with PUT <index>/_settings")
+	case change.Dynamic:
+		change.Notes = append(change.Notes, "dynamic, takes effect with PUT _cluster/settings")
+	case change.Scope == "index":
+		change.Notes = append(change.Notes, "static, can only be set when creating the index or on a closed index")
+	default:
+		change.Notes = append(change.Notes, "static, has to be set in elasticsearch.yml and needs a rolling restart")
+	}
+
+	change.Affected = fallbackSettings(settings, setting, changed)
+	return change
+}
+
+func runWhatIf(args []string) {
+	flags := flag.NewFlagSet("what-if", flag.ExitOnError)
+	var sets stringsFlag
+	flags.Var(&sets, "set", "proposed change as name=value, can be given several times")
+	heapFlag := flags.String("heap", "", "heap size of the nodes, i.e. 32g, to show percentage changes in bytes")
+	asJSON := flags.Bool("json", false, "write the review as JSON")
+	flags.BoolVar(&prettyJSON, "pretty", false, "indent the JSON output")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: elasticsearch-bblfsh what-if -set name=value [-set name=value...] <settings.json>")
+		fmt.Fprintln(os.Stderr, "Reviews proposed setting changes: whether they're valid and dynamic, how far they move from the default and which settings fall back to them.")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 1 || len(sets) == 0 {
+		flags.Usage()
+		exitWith(exitUsageError, nil)
+	}
+
+	var heap int64
+	if *heapFlag != "" {
+		var err error
+		if heap, err = parseSize(*heapFlag); err != nil {
+			exitWith(exitUsageError, err)
+		}
+	}
+
+	type proposal struct{ name, value string }
+	var proposals []proposal
+	changed := map[string]bool{}
+	for _, set := range sets {
+		parts := strings.SplitN(set, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			exitWith(exitUsageError, fmt.Errorf("expected name=value, got %q", set))
+		}
+		proposals = append(proposals, proposal{strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])})
+		changed[strings.TrimSpace(parts[0])] = true
+	}
+
+	settings, err := readSettings(flags.Arg(0))
+	if err != nil {
+		exitWith(exitRuntimeError, err)
+	}
+	byName := settingsByName(settings)
+
+	report := WhatIfReport{BuildInfo: buildInfo()}
+	invalid := false
+	for _, p := range proposals {
+		change := reviewChange(settings, byName, p.name, p.value, changed, heap)
+		if len(change.Problems) > 0 {
+			invalid = true
+		}
+		report.Changes = append(report.Changes, change)
+	}
+
+	if *asJSON {
+		if err := writeJSON("-", report); err != nil {
+			exitWith(exitRuntimeError, err)
+		}
+	} else {
+		for i, c := range report.Changes {
+			if i > 0 {
+				fmt.Println()
+			}
+			fmt.Printf("%s: %s -> %s\n", c.Name, c.Default, c.Value)
+			if c.Known {
+				fmt.Printf("  type %s, %s scope\n", c.JavaType, c.Scope)
+			}
+			if c.Delta != "" {
+				fmt.Printf("  delta %s\n", c.Delta)
+			}
+			for _, n := range c.Notes {
+				fmt.Printf("  %s\n", n)
+			}
+			for _, p := range c.Problems {
+				fmt.Printf("  invalid: %s\n", p)
+			}
+			if len(c.Affected) > 0 {
+				fmt.Printf("  also changes the settings falling back to it: %s\n", strings.Join(c.Affected, ", "))
+			}
+		}
+	}
+
+	if invalid {
+		exitWith(exitLintFindings, nil)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	javaextractor "github.com/nickcanz/elasticsearch-bblfsh/extractor"
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+// followWrappers is set by -follow-wrappers to read settings declared
+// through a helper from the Setting factory call the helper returns.
+var followWrappers bool
+
+// maxWrapperExamples is how many call sites are kept per helper.
+const maxWrapperExamples = 5
+
+// WrapperHelper is a method Setting fields are declared through instead of
+// a Setting factory, i.e. MonitoringField.defineBool("enabled", true).
+type WrapperHelper struct {
+	// Helper is the method as it's called
+	Helper string `json:"helper"`
+	// DeclaredIn is where the helper is declared, when it's in the file
+	// calling it, and Wraps the Setting factory it returns
+	DeclaredIn string `json:"declared_in,omitempty"`
+	Wraps      string `json:"wraps,omitempty"`
+	Calls      int    `json:"calls"`
+	// Followed counts the calls -follow-wrappers extracted a setting from
+	Followed int      `json:"followed"`
+	Examples []string `json:"examples"`
+}
+
+// WrappersDocument is the output of the wrappers extractor.
+type WrappersDocument struct {
+	BuildInfo
+	Helpers []WrapperHelper `json:"helpers"`
+}
+
+var wrapperHelpers = map[string]*WrapperHelper{}
+
+// settingHelper is a method of the file returning a Setting factory call,
+// i.e.
+//
+//	static Setting<Boolean> defineBool(String key, boolean defaultValue) {
+//	    return Setting.boolSetting("xpack.monitoring." + key, defaultValue, Property.NodeScope);
+//	}
+type settingHelper struct {
+	line       uint32
+	parameters []string
+	call       *uast.Node
+}
+
+// factory renders the Setting factory call of a helper like Factory of the
+// extractor package does for fields, i.e. Setting.boolSetting.
+func (helper settingHelper) factory() string {
+	if helper.call.InternalType == "ClassInstanceCreation" {
+		if t := childWithRole(helper.call, "type"); t != nil {
+			return "new " + typeName(t) + "<>"
+		}
+		return "new"
+	}
+	return expressionString(childWithRole(helper.call, "expression")) + "." + nameOf(helper.call)
+}
+
+// isSettingFactory tells whether a receiver is one of the Setting classes,
+// i.e. Setting or SecureSetting, rather than a class of helpers.
+func isSettingFactory(receiver *uast.Node) bool {
+	return strings.HasSuffix(typeName(receiver), "Setting")
+}
+
+// startsWithLiteral tells whether an expression is a string literal or a
+// concatenation starting with one, the way setting keys are passed.
+func startsWithLiteral(node *uast.Node) bool {
+	if node.InternalType == "InfixExpression" && len(node.Children) > 0 {
+		return startsWithLiteral(node.Children[0])
+	}
+	return node.InternalType == "StringLiteral"
+}
+
+// fileSettingHelpers returns the methods of a file that return a single
+// Setting factory call, by name.
+func fileSettingHelpers(rootNode *uast.Node) map[string]settingHelper {
+	helpers := map[string]settingHelper{}
+	methods, _ := tools.Filter(rootNode, "//MethodDeclaration")
+
+	for _, method := range methods {
+		returnType := childWithRole(method, "returnType2")
+		body := childWithRole(method, "body")
+		if returnType == nil || body == nil || typeName(returnType) != "Setting" {
+			continue
+		}
+
+		var returns []*uast.Node
+		walkNodes(body, func(n *uast.Node) {
+			if n.InternalType == "ReturnStatement" {
+				returns = append(returns, n)
+			}
+		})
+		if len(returns) != 1 || len(returns[0].Children) == 0 {
+			continue
+		}
+		call := returns[0].Children[0]
+		switch call.InternalType {
+		case "MethodInvocation":
+			if receiver := childWithRole(call, "expression"); receiver == nil || !isSettingFactory(receiver) {
+				continue
+			}
+		case "ClassInstanceCreation":
+		default:
+			continue
+		}
+
+		helper := settingHelper{line: method.StartPosition.Line, call: call}
+		for _, child := range method.Children {
+			if child.Properties["internalRole"] == "parameters" {
+				helper.parameters = append(helper.parameters, nameOf(child))
+			}
+		}
+		helpers[nameOf(method)] = helper
+	}
+	return helpers
+}
+
+// substituteParameters copies an expression of a helper with its parameters
+// replaced by the arguments of a call. Arguments take the role of the
+// parameter they replace, so the call still has all its arguments.
+func substituteParameters(node *uast.Node, values map[string]*uast.Node) *uast.Node {
+	if node.InternalType == "SimpleName" {
+		if value, ok := values[node.Token]; ok {
+			substituted := *value
+			substituted.Properties = map[string]string{}
+			for k, v := range value.Properties {
+				substituted.Properties[k] = v
+			}
+			substituted.Properties["internalRole"] = node.Properties["internalRole"]
+			return &substituted
+		}
+	}
+	// Qualified names are constants and enums, i.e. Property.NodeScope,
+	// never parameters
+	if node.InternalType == "QualifiedName" {
+		return node
+	}
+
+	copied := *node
+	copied.Children = make([]*uast.Node, len(node.Children))
+	for i, child := range node.Children {
+		copied.Children[i] = substituteParameters(child, values)
+	}
+	return &copied
+}
+
+// followHelper extracts the setting a helper call declares, from the
+// factory call the helper returns with the arguments of the call.
+func followHelper(helper settingHelper, arguments []*uast.Node, className string) (name, defaultArg string, properties []string, ok bool) {
+	if len(arguments) != len(helper.parameters) {
+		return "", "", nil, false
+	}
+	values := map[string]*uast.Node{}
+	for i, parameter := range helper.parameters {
+		values[parameter] = arguments[i]
+	}
+
+	followed := argumentsOf(substituteParameters(helper.call, values))
+	if len(followed) < 2 {
+		return "", "", nil, false
+	}
+	if name, ok = resolveConcatenation(followed[0], className); !ok {
+		return "", "", nil, false
+	}
+	_, defaultArg, properties = javaextractor.FromArguments(followed)
+	return name, defaultArg, properties, true
+}
+
+// detectWrapperHelpers finds the Setting fields of a file declared through a
+// helper called with a string literal key, records the helpers and, with
+// -follow-wrappers, replaces what the extractor made of those declarations
+// with the setting the helper creates.
+func detectWrapperHelpers(rootNode *uast.Node, fileName string, declared []javaextractor.Setting, skipped []javaextractor.Skipped) ([]javaextractor.Setting, []javaextractor.Skipped) {
+	fields, _ := tools.Filter(rootNode, "//FieldDeclaration/ParameterizedType/SimpleType/SimpleName[@token='Setting']/../../..")
+	if len(fields) == 0 {
+		return declared, skipped
+	}
+
+	className := ""
+	if classes, _ := tools.Filter(rootNode, "//TypeDeclaration"); len(classes) > 0 {
+		className = nameOf(classes[0])
+	}
+	helpers := fileSettingHelpers(rootNode)
+
+	followed := map[uint32]javaextractor.Setting{}
+	for _, field := range fields {
+		var call *uast.Node
+		for _, fragment := range field.Children {
+			if fragment.InternalType == "VariableDeclarationFragment" {
+				call = childWithRole(fragment, "initializer")
+			}
+		}
+		if call == nil || call.InternalType != "MethodInvocation" {
+			continue
+		}
+		receiver := childWithRole(call, "expression")
+		arguments := argumentsOf(call)
+		if (receiver != nil && isSettingFactory(receiver)) || len(arguments) == 0 || !startsWithLiteral(arguments[0]) {
+			continue
+		}
+
+		name := nameOf(call)
+		if receiver != nil {
+			name = expressionString(receiver) + "." + name
+		}
+		line := field.StartPosition.Line
+		wrapper, ok := wrapperHelpers[name]
+		if !ok {
+			wrapper = &WrapperHelper{Helper: name}
+			wrapperHelpers[name] = wrapper
+		}
+		wrapper.Calls++
+		if len(wrapper.Examples) < maxWrapperExamples {
+			wrapper.Examples = append(wrapper.Examples, fmt.Sprintf("%s:%d", relativePath(fileName), line))
+		}
+
+		helper, ok := helpers[nameOf(call)]
+		if !ok {
+			logger.Debug("setting declared through a helper declared elsewhere", "helper", name, "file", relativePath(fileName), "line", line)
+			continue
+		}
+		wrapper.DeclaredIn = fmt.Sprintf("%s:%d", relativePath(fileName), helper.line)
+		wrapper.Wraps = helper.factory()
+		if !followWrappers {
+			continue
+		}
+
+		settingName, defaultArg, properties, ok := followHelper(helper, arguments, className)
+		if !ok {
+			logger.Warn("couldn't follow a setting helper", "helper", name, "file", relativePath(fileName), "line", line)
+			continue
+		}
+		wrapper.Followed++
+		followed[line] = javaextractor.Setting{
+			Name:       settingName,
+			DefaultArg: defaultArg,
+			Properties: properties,
+			CodeLine:   line,
+			Factory:    name,
+			Arguments:  len(arguments),
+		}
+	}
+	if len(followed) == 0 {
+		return declared, skipped
+	}
+
+	// The followed settings replace the extractor's reading of the call,
+	// which took the helper's arguments for the factory's
+	var settings []javaextractor.Setting
+	for _, s := range declared {
+		if f, ok := followed[s.CodeLine]; ok {
+			f.RawName, f.JavaType = s.RawName, s.JavaType
+			s = f
+		}
+		settings = append(settings, s)
+	}
+	var stillSkipped []javaextractor.Skipped
+	for _, s := range skipped {
+		f, ok := followed[s.CodeLine]
+		if !ok {
+			stillSkipped = append(stillSkipped, s)
+			continue
+		}
+		f.RawName, f.JavaType = s.RawName, s.JavaType
+		settings = append(settings, f)
+	}
+	return settings, stillSkipped
+}
+
+// sortedWrapperHelpers returns the helpers found, most called first.
+func sortedWrapperHelpers() []WrapperHelper {
+	helpers := make([]WrapperHelper, 0, len(wrapperHelpers))
+	for _, helper := range wrapperHelpers {
+		helpers = append(helpers, *helper)
+	}
+	sort.Slice(helpers, func(i, j int) bool {
+		if helpers[i].Calls != helpers[j].Calls {
+			return helpers[i].Calls > helpers[j].Calls
+		}
+		return helpers[i].Helper < helpers[j].Helper
+	})
+	return helpers
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// There's no YAML encoder in the standard library, and every document we
+// write already has a JSON encoding, so YAML is produced from that. JSON
+// strings are valid double quoted YAML scalars, which keeps quoting simple.
+
+// yamlMap is a decoded JSON object that keeps the order of its keys, so the
+// YAML has the same field order as the JSON.
+type yamlMap struct {
+	keys   []string
+	values []interface{}
+}
+
+var yamlPlainScalar = regexp.MustCompile(`^[A-Za-z_/][A-Za-z0-9_./<>-]*( [A-Za-z0-9_./<>-]+)*$`)
+
+// yamlReserved are plain scalars YAML 1.1 parsers read as something other
+// than a string.
+var yamlReserved = map[string]bool{
+	"true": true, "false": true, "yes": true, "no": true, "on": true, "off": true,
+	"y": true, "n": true, "null": true, "~": true,
+}
+
+func decodeOrdered(dec *json.Decoder) (interface{}, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch tok {
+	case json.Delim('{'):
+		m := &yamlMap{}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			m.keys = append(m.keys, key.(string))
+			m.values = append(m.values, value)
+		}
+		_, err = dec.Token()
+		return m, err
+	case json.Delim('['):
+		list := []interface{}{}
+		for dec.More() {
+			value, err := decodeOrdered(dec)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		_, err = dec.Token()
+		return list, err
+	}
+
+	return tok, nil
+}
+
+func yamlScalar(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		if s {
+			return "true"
+		}
+		return "false"
+	case json.Number:
+		return s.String()
+	case string:
+		if yamlPlainScalar.MatchString(s) && !yamlReserved[strings.ToLower(s)] {
+			return s
+		}
+		b, _ := json.Marshal(s)
+		return string(b)
+	}
+	return ""
+}
+
+func writeYAMLValue(buf *bytes.Buffer, v interface{}, indent int) {
+	prefix := strings.Repeat(" ", indent)
+
+	switch value := v.(type) {
+	case *yamlMap:
+		for i, key := range value.keys {
+			buf.WriteString(prefix + yamlScalar(key) + ":")
+			writeYAMLChild(buf, value.values[i], indent+2)
+		}
+	case []interface{}:
+		for _, item := range value {
+			if isYAMLCollection(item) {
+				// Render the item one level in, then put the dash in
+				// place of the indentation of its first line
+				var child bytes.Buffer
+				writeYAMLValue(&child, item, indent+2)
+				buf.WriteString(prefix + "- ")
+				buf.Write(child.Bytes()[indent+2:])
+				continue
+			}
+			buf.WriteString(prefix + "- ")
+			writeYAMLChild(buf, item, indent+2)
+		}
+	default:
+		buf.WriteString(prefix + yamlScalar(v) + "\n")
+	}
+}
+
+// writeYAMLChild writes a value following a key or a dash, on the same line
+// if it's a scalar or an empty collection.
+func writeYAMLChild(buf *bytes.Buffer, v interface{}, indent int) {
+	inline := ""
+	switch value := v.(type) {
+	case *yamlMap:
+		if len(value.keys) > 0 {
+			buf.WriteString("\n")
+			writeYAMLValue(buf, v, indent)
+			return
+		}
+		inline = "{}"
+	case []interface{}:
+		if len(value) > 0 {
+			buf.WriteString("\n")
+			writeYAMLValue(buf, v, indent)
+			return
+		}
+		inline = "[]"
+	default:
+		inline = yamlScalar(v)
+	}
+	// A dash is already followed by a space, a key isn't
+	if buf.Len() > 0 && buf.Bytes()[buf.Len()-1] != ' ' {
+		buf.WriteString(" ")
+	}
+	buf.WriteString(inline + "\n")
+}
+
+func isYAMLCollection(v interface{}) bool {
+	switch value := v.(type) {
+	case *yamlMap:
+		return len(value.keys) > 0
+	case []interface{}:
+		return len(value) > 0
+	}
+	return false
+}
+
+func marshalYAML(v interface{}) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	decoded, err := decodeOrdered(dec)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if isYAMLCollection(decoded) {
+		buf.WriteString("---\n")
+		writeYAMLValue(&buf, decoded, 0)
+	} else {
+		// On the line of the document start, i.e. --- []
+		buf.WriteString("---")
+		writeYAMLChild(&buf, decoded, 0)
+	}
+	return buf.Bytes(), nil
+}
+
+func writeYAML(fileName string, v interface{}) error {
+	b, err := marshalYAML(v)
+	if err != nil {
+		return err
+	}
+	if fileName == "-" {
+		_, err = os.Stdout.Write(b)
+		return err
+	}
+	return ioutil.WriteFile(fileName, b, 0644)
+}
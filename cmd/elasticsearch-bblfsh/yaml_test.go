@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMarshalYAML(t *testing.T) {
+	for _, tc := range []struct {
+		json, want string
+	}{
+		{`5`, "--- 5\n"},
+		{`"plain text"`, "--- plain text\n"},
+		{`{}`, "--- {}\n"},
+		{`[]`, "--- []\n"},
+		{
+			`{"name": "cluster.routing.allocation.enable", "default_arg": "all", "code_line": 42, "properties": ["NodeScope", "Dynamic"]}`,
+			"---\nname: cluster.routing.allocation.enable\ndefault_arg: all\ncode_line: 42\nproperties:\n  - NodeScope\n  - Dynamic\n",
+		},
+		{
+			// The order of the keys is kept, y and n are YAML 1.1 booleans
+			`{"z": 1, "a": {"y": true, "b": null}, "m": [], "n": {}}`,
+			"---\nz: 1\na:\n  \"y\": true\n  b: null\nm: []\n\"n\": {}\n",
+		},
+		{
+			`[{"name": "a", "tags": ["x"]}, {"name": "b"}]`,
+			"---\n- name: a\n  tags:\n    - x\n- name: b\n",
+		},
+		{`[[1, 2], [3], []]`, "---\n- - 1\n  - 2\n- - 3\n- []\n"},
+		{
+			// Strings YAML would read as something else are quoted
+			`["", "true", "No", "off", "~", "7.0", "-1", "30s", "a: b", "- x", "#c", "a #b", "x\ny", "${PORT}", "é", " x", "org.elasticsearch.Foo<T>", "/var/lib"]`,
+			"---\n- \"\"\n- \"true\"\n- \"No\"\n- \"off\"\n- \"~\"\n- \"7.0\"\n- \"-1\"\n- \"30s\"\n- \"a: b\"\n- \"- x\"\n- \"#c\"\n- \"a #b\"\n- \"x\\ny\"\n- \"${PORT}\"\n- \"é\"\n- \" x\"\n- org.elasticsearch.Foo<T>\n- /var/lib\n",
+		},
+		{`[1.5, -2, 1e+21, false]`, "---\n- 1.5\n- -2\n- 1e+21\n- false\n"},
+	} {
+		var v interface{}
+		if err := json.Unmarshal([]byte(tc.json), &v); err != nil {
+			t.Fatalf("%s: %v", tc.json, err)
+		}
+		// Maps are marshalled with sorted keys, a raw message keeps them
+		got, err := marshalYAML(json.RawMessage(tc.json))
+		if err != nil {
+			t.Errorf("%s: %v", tc.json, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s\n got %q\nwant %q", tc.json, got, tc.want)
+		}
+	}
+}
+
+func TestMarshalYAMLSetting(t *testing.T) {
+	got, err := marshalYAML([]ElasticsearchSetting{{Name: "a", RawName: "A", JavaType: "Boolean", DefaultArg: "false", CodeLine: 3, CodeFile: "A.java"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "---\n- name: a\n  raw_name: A\n  java_type: Boolean\n  properties: null\n  default_arg: \"false\"\n  code_line: 3\n  code_file: A.java\n"
+	if string(got) != want {
+		t.Errorf("got %q\nwant %q", got, want)
+	}
+}
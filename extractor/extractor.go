@@ -0,0 +1,675 @@
+// Package extractor finds the settings declared in Elasticsearch Java
+// sources, through the UAST of the Babelfish Java driver.
+package extractor
+
+import (
+	"context"
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+	"sync"
+
+	"gopkg.in/bblfsh/client-go.v2"
+	"gopkg.in/bblfsh/client-go.v2/tools"
+	"gopkg.in/bblfsh/sdk.v1/protocol"
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+//go:embed extractor.go
+var source []byte
+
+// RulesHash is a hash of the UAST queries of the package and of the code
+// reading their hits, which changes whenever an extraction rule does.
+func RulesHash() string {
+	sum := sha256.Sum256(source)
+	return hex.EncodeToString(sum[:])
+}
+
+// Setting is a Setting<T> field declaration.
+type Setting struct {
+	Name       string   `json:"name"`
+	RawName    string   `json:"raw_name"`
+	JavaType   string   `json:"java_type"`
+	Properties []string `json:"properties"`
+	DefaultArg string   `json:"default_arg"`
+	CodeLine   uint32   `json:"code_line"`
+	// Factory is how the setting is created, i.e. Setting.boolSetting or
+	// new Setting<>, and Arguments how many arguments it's given
+	Factory   string `json:"factory"`
+	Arguments int    `json:"arguments"`
+	// NameConstant and DefaultConstant are the constants the name and the
+	// default are given as, i.e. IndexMetadata.SETTING_NUMBER_OF_SHARDS,
+	// for callers that can look up their value. Name and DefaultArg are
+	// then the constant as written, or empty when it's qualified
+	NameConstant    string `json:"name_constant,omitempty"`
+	DefaultConstant string `json:"default_constant,omitempty"`
+	// DefaultEnum is the enum constant the default is the name of, i.e.
+	// Translog.Durability.REQUEST for Translog.Durability.REQUEST.name(),
+	// and DefaultEnumMethod the method giving it, name or toString. The
+	// default is then the constant's name, with the case of a trailing
+	// toLowerCase or toUpperCase applied
+	DefaultEnum       string `json:"default_enum,omitempty"`
+	DefaultEnumMethod string `json:"default_enum_method,omitempty"`
+	// Parser is the function the setting parses its values with, when
+	// it's given one, i.e. TimeValue.parseTimeValue
+	Parser string `json:"parser,omitempty"`
+	// MinArg and MaxArg are the bounds of a numeric, byte size or time
+	// setting, written like DefaultArg, i.e. 1 and 1024 for
+	// Setting.intSetting(name, 5, 1, 1024, Property.NodeScope)
+	MinArg string `json:"min_arg,omitempty"`
+	MaxArg string `json:"max_arg,omitempty"`
+}
+
+// RawName returns the name of the field a FieldDeclaration node declares.
+func RawName(node *uast.Node) string {
+	nameQuery := "//FieldDeclaration/VariableDeclarationFragment/SimpleName"
+	nameNode, _ := tools.Filter(node, nameQuery)
+
+	if len(nameNode) > 0 {
+		return nameNode[0].Token
+	} else {
+		return ""
+	}
+}
+
+func getType(node *uast.Node) string {
+	typeQuery := "//FieldDeclaration/ParameterizedType/SimpleType[@internalRole='typeArguments']/SimpleName"
+	nestedTypeQuery := "//FieldDeclaration/ParameterizedType/ParameterizedType[@internalRole='typeArguments']/*"
+
+	typeNode, _ := tools.Filter(node, typeQuery)
+	if len(typeNode) > 0 {
+		return typeNode[0].Token
+	} else {
+		nestedTypeNodes, _ := tools.Filter(node, nestedTypeQuery)
+
+		var nestedTypes []string
+		for _, nestedNode := range nestedTypeNodes {
+			nestedTypes = append(nestedTypes, nestedNode.Children[0].Token)
+		}
+
+		return strings.Join(nestedTypes, " of ")
+	}
+}
+
+func getArguments(node *uast.Node) []*uast.Node {
+	// Sometimes settings are created from a helper method, so they're considered a method
+	// i.e. Setting.boolSetting("indices.query.query_string.allowLeadingWildcard", true, Property.NodeScope);
+	// So the arguments are method arguments
+	// But sometimes they are constructed new
+	// i.e new Setting<>("index.translog.durability", Translog.Durability.REQUEST.name(),
+	// So the arguments are part of the class construction
+
+	methodArgumentsQuery := "//FieldDeclaration/VariableDeclarationFragment/MethodInvocation/*[@internalRole='arguments']"
+	classArgumentsQuery := "//FieldDeclaration/VariableDeclarationFragment/ClassInstanceCreation/*[@internalRole='arguments']"
+
+	methodArgumentNodes, _ := tools.Filter(node, methodArgumentsQuery)
+
+	if len(methodArgumentNodes) > 0 {
+		return methodArgumentNodes
+	} else {
+		classArguementNodes, _ := tools.Filter(node, classArgumentsQuery)
+		return classArguementNodes
+	}
+}
+
+func getSettingProperties(nodes []*uast.Node) []string {
+	// Sometimes, settings are defined as "Setting.Property.Dynamic"
+	// And sometimes as just "Property.Dynamic"
+	// We're trying to pull out just the "Dynamic" part, so we we have two different queries
+	// to try the fully qualified "long" way vs the shorter definition
+	shortSettingPropertiesQuery := "//QualifiedName/SimpleName[@token='Property']/../SimpleName[@internalRole='name']"
+	longSettingPropertiesQuery := "//QualifiedName/QualifiedName/SimpleName[@token='Property']/../../SimpleName[@internalRole='name']"
+
+	var props []string
+
+	for _, propNode := range nodes {
+		longSettingPropertyNodes, _ := tools.Filter(propNode, longSettingPropertiesQuery)
+
+		if len(longSettingPropertyNodes) > 0 {
+			for _, prop := range longSettingPropertyNodes {
+				props = append(props, prop.Token)
+			}
+		} else {
+			shortSettingPropertyNodes, _ := tools.Filter(propNode, shortSettingPropertiesQuery)
+
+			if len(shortSettingPropertyNodes) > 0 {
+				for _, prop := range shortSettingPropertyNodes {
+					props = append(props, prop.Token)
+				}
+			}
+		}
+	}
+
+	return props
+}
+
+func getDefaultArg(node *uast.Node) string {
+	if _, _, value, ok := EnumDefault(node); ok {
+		return value
+	}
+
+	var defaultArg string
+
+	switch node.InternalType {
+	case "NumberLiteral":
+		defaultArg = fmt.Sprintf("%v", node.Properties["token"])
+	case "BooleanLiteral":
+		defaultArg = fmt.Sprintf("%v", node.Properties["booleanValue"])
+	case "MethodInvocation":
+		var arguments []string
+		for _, child := range node.Children {
+			switch child.InternalType {
+			case "NumberLiteral":
+				arguments = append(arguments, child.Properties["token"])
+			default:
+				arguments = append(arguments, child.Token)
+			}
+		}
+		defaultArg = strings.Join(arguments, "->")
+	case "ClassInstanceCreation":
+		var arguments []string
+		for _, child := range node.Children {
+			switch child.InternalType {
+			case "NumberLiteral":
+				arguments = append(arguments, child.Properties["token"])
+			case "QualifiedName":
+				var subArgs []string
+				for _, subChild := range child.Children {
+					subArgs = append(subArgs, subChild.Token)
+				}
+				arguments = append(arguments, strings.Join(subArgs, "."))
+			}
+		}
+		defaultArg = strings.Join(arguments, "->")
+	default:
+		defaultArg = node.Token
+	}
+
+	return defaultArg
+}
+
+// Factory returns how a FieldDeclaration node creates its setting: the
+// method it calls, i.e. Setting.boolSetting, the class it instantiates, i.e.
+// new Setting<>, or the kind of its initializer for anything else. It's
+// empty for fields without an initializer.
+func Factory(node *uast.Node) string {
+	calls, _ := tools.Filter(node, "//FieldDeclaration/VariableDeclarationFragment/MethodInvocation")
+	if len(calls) > 0 {
+		var receiver, method string
+		for _, child := range calls[0].Children {
+			switch child.Properties["internalRole"] {
+			case "expression":
+				receiver = writtenName(child)
+			case "name":
+				method = child.Token
+			}
+		}
+		if receiver == "" {
+			return method
+		}
+		return receiver + "." + method
+	}
+
+	creations, _ := tools.Filter(node, "//FieldDeclaration/VariableDeclarationFragment/ClassInstanceCreation")
+	if len(creations) > 0 {
+		for _, child := range creations[0].Children {
+			if child.Properties["internalRole"] == "type" {
+				return "new " + writtenName(child)
+			}
+		}
+		return "new"
+	}
+
+	initializers, _ := tools.Filter(node, "//FieldDeclaration/VariableDeclarationFragment/*[@internalRole='initializer']")
+	if len(initializers) > 0 {
+		return initializers[0].InternalType
+	}
+	return ""
+}
+
+// writtenName renders a name or a type the way it's written, i.e.
+// Setting.Property or Setting<> for a parameterized type.
+func writtenName(node *uast.Node) string {
+	if node.InternalType == "ParameterizedType" {
+		for _, child := range node.Children {
+			if child.Properties["internalRole"] == "type" {
+				return writtenName(child) + "<>"
+			}
+		}
+	}
+	if node.Token != "" {
+		return node.Token
+	}
+
+	var parts []string
+	for _, child := range node.Children {
+		if part := writtenName(child); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return strings.Join(parts, ".")
+}
+
+// isEnumConstantName tells whether a name is written like an enum constant,
+// i.e. REQUEST or READ_ONLY.
+func isEnumConstantName(name string) bool {
+	if name == "" || name[0] < 'A' || name[0] > 'Z' {
+		return false
+	}
+	for _, r := range name {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// invocation returns the receiver and the method name of a MethodInvocation.
+func invocation(node *uast.Node) (receiver *uast.Node, method string) {
+	for _, child := range node.Children {
+		switch child.Properties["internalRole"] {
+		case "expression":
+			receiver = child
+		case "name":
+			method = child.Token
+		}
+	}
+	return receiver, method
+}
+
+// EnumDefault reads a default given as the name of an enum constant, i.e.
+// Translog.Durability.REQUEST.name() or
+// Translog.Durability.REQUEST.toString().toLowerCase(Locale.ROOT). It returns
+// the constant as written, the method giving its name and the resulting
+// value, i.e. "request" for the latter.
+func EnumDefault(node *uast.Node) (constant, method, value string, ok bool) {
+	if node.InternalType != "MethodInvocation" {
+		return "", "", "", false
+	}
+	receiver, name := invocation(node)
+	if receiver == nil {
+		return "", "", "", false
+	}
+
+	switch name {
+	case "toLowerCase", "toUpperCase":
+		constant, method, value, ok = EnumDefault(receiver)
+		if !ok {
+			return "", "", "", false
+		}
+		if name == "toLowerCase" {
+			return constant, method, strings.ToLower(value), true
+		}
+		return constant, method, strings.ToUpper(value), true
+	case "name", "toString":
+		if receiver.InternalType != "QualifiedName" {
+			return "", "", "", false
+		}
+		constant = writtenName(receiver)
+		value = constant[strings.LastIndex(constant, ".")+1:]
+		if !isEnumConstantName(value) {
+			return "", "", "", false
+		}
+		return constant, name, value, true
+	}
+	return "", "", "", false
+}
+
+// Parser returns the function a factory call is given to parse the value
+// with, after the name and the default, i.e. Durability.valueOf for
+// Durability::valueOf or TimeValue.parseTimeValue for
+// s -> TimeValue.parseTimeValue(s, key). Lambdas are named after the first
+// method they call. It's empty when there's no parser argument.
+func Parser(arguments []*uast.Node) string {
+	if len(arguments) < 3 {
+		return ""
+	}
+	for _, argument := range arguments[2:] {
+		switch argument.InternalType {
+		case "ExpressionMethodReference", "TypeMethodReference":
+			var receiver, method string
+			for _, child := range argument.Children {
+				switch child.Properties["internalRole"] {
+				case "expression", "type":
+					receiver = writtenName(child)
+				case "name":
+					method = child.Token
+				}
+			}
+			return receiver + "." + method
+		case "LambdaExpression":
+			calls, _ := tools.Filter(argument, "//MethodInvocation")
+			if len(calls) == 0 {
+				return "lambda"
+			}
+			receiver, method := invocation(calls[0])
+			if receiver == nil {
+				return method
+			}
+			return writtenName(receiver) + "." + method
+		}
+	}
+	return ""
+}
+
+// ConstantReference returns the constant an argument refers to, i.e. NAME
+// or IndexMetadata.SETTING_NUMBER_OF_SHARDS, or an empty string when it's
+// anything else.
+func ConstantReference(node *uast.Node) string {
+	switch node.InternalType {
+	case "SimpleName", "QualifiedName":
+		return writtenName(node)
+	}
+	return ""
+}
+
+// Skipped is a Setting<T> field declared in a way the extractor doesn't
+// understand, i.e. through a helper method with fewer than three arguments.
+type Skipped struct {
+	RawName   string `json:"raw_name"`
+	JavaType  string `json:"java_type"`
+	CodeLine  uint32 `json:"code_line"`
+	Factory   string `json:"factory"`
+	Arguments int    `json:"arguments"`
+}
+
+// FromArguments reads the name, default and properties of a setting from
+// the arguments of the factory call creating it, i.e.
+// ("indices.query.query_string.allowLeadingWildcard", true, Property.NodeScope).
+// It needs at least the name and the default.
+func FromArguments(arguments []*uast.Node) (name, defaultArg string, properties []string) {
+	name = strings.Trim(arguments[0].Token, "\"")
+	defaultArg = strings.Trim(getDefaultArg(arguments[1]), "\"")
+	return name, defaultArg, getSettingProperties(arguments)
+}
+
+// boundedFactories are the factories taking a minimum and an optional
+// maximum after the default, before the properties.
+var boundedFactories = []string{"intSetting", "longSetting", "floatSetting", "doubleSetting", "byteSizeSetting", "timeSetting"}
+
+// Bounds returns the minimum and the maximum a factory call gives its
+// setting, empty when it gives none. Setting.positiveTimeSetting has a
+// minimum of 0.
+func Bounds(factory string, arguments []*uast.Node) (min, max string) {
+	if strings.HasSuffix(factory, "positiveTimeSetting") {
+		return "0", ""
+	}
+	bounded := false
+	for _, f := range boundedFactories {
+		bounded = bounded || strings.HasSuffix(factory, f)
+	}
+	if !bounded {
+		return "", ""
+	}
+	var bounds []string
+	for _, argument := range arguments[2:] {
+		if len(bounds) == 2 || len(getSettingProperties([]*uast.Node{argument})) > 0 {
+			break
+		}
+		bounds = append(bounds, strings.Trim(getDefaultArg(argument), "\""))
+	}
+	bounds = append(bounds, "", "")
+	return bounds[0], bounds[1]
+}
+
+// AffixSettings returns the AffixSetting<T> fields declared in the UAST of a
+// Java file, i.e.
+// Setting.affixKeySetting("cluster.remote.", "seeds", key -> Setting.listSetting(key, ...))
+// or Setting.prefixKeySetting("logger.", key -> ...). Their name is the key
+// with a * for the namespace, i.e. cluster.remote.*.seeds or logger.*, and
+// their default and properties are the ones of the setting the lambda
+// creates for each namespace.
+func AffixSettings(rootNode *uast.Node) []Setting {
+	var nodes []*uast.Node
+	for _, query := range []string{
+		"//FieldDeclaration/ParameterizedType/SimpleType/SimpleName[@token='AffixSetting']/../../..",
+		"//FieldDeclaration/ParameterizedType/SimpleType/QualifiedName/SimpleName[@token='AffixSetting']/../../../..",
+	} {
+		found, _ := tools.Filter(rootNode, query)
+		nodes = append(nodes, found...)
+	}
+
+	var settings []Setting
+	for _, n := range nodes {
+		arguments := getArguments(n)
+		factory := Factory(n)
+
+		var name string
+		var delegate *uast.Node
+		switch {
+		case strings.HasSuffix(factory, "affixKeySetting") && len(arguments) >= 3:
+			name = strings.Trim(writtenName(arguments[0]), "\"") + "*." + strings.Trim(writtenName(arguments[1]), "\"")
+			delegate = arguments[2]
+		case strings.HasSuffix(factory, "prefixKeySetting") && len(arguments) >= 2:
+			name = strings.Trim(writtenName(arguments[0]), "\"") + "*"
+			delegate = arguments[1]
+		default:
+			continue
+		}
+
+		setting := Setting{
+			Name:      name,
+			RawName:   RawName(n),
+			JavaType:  getType(n),
+			CodeLine:  n.StartPosition.Line,
+			Factory:   factory,
+			Arguments: len(arguments),
+		}
+		// The setting of each namespace, i.e. Setting.listSetting(key, ...)
+		if delegate.InternalType == "LambdaExpression" {
+			calls, _ := tools.Filter(delegate, "//MethodInvocation")
+			if len(calls) > 0 {
+				var inner []*uast.Node
+				for _, child := range calls[0].Children {
+					if child.Properties["internalRole"] == "arguments" {
+						inner = append(inner, child)
+					}
+				}
+				if len(inner) >= 2 {
+					_, setting.DefaultArg, setting.Properties = FromArguments(inner)
+					setting.Parser = Parser(inner)
+					_, method := invocation(calls[0])
+					setting.MinArg, setting.MaxArg = Bounds(method, inner)
+				}
+			}
+		}
+		settings = append(settings, setting)
+	}
+	return settings
+}
+
+// Settings returns the Setting<T> fields declared in the UAST of a Java file.
+func Settings(rootNode *uast.Node) []Setting {
+	settings, _ := Declarations(rootNode)
+	return settings
+}
+
+// Declarations returns the Setting<T> fields declared in the UAST of a Java
+// file, and the ones it couldn't extract.
+func Declarations(rootNode *uast.Node) ([]Setting, []Skipped) {
+	query := "//FieldDeclaration/ParameterizedType/SimpleType/SimpleName[@token='Setting']/../../.."
+	nodes, _ := tools.Filter(rootNode, query)
+
+	var settings []Setting
+	var skipped []Skipped
+
+	for _, n := range nodes {
+		rawSettingName := RawName(n)
+		settingType := getType(n)
+
+		argumentNodes := getArguments(n)
+		factory := Factory(n)
+
+		if len(argumentNodes) > 2 {
+			settingName, defaultArg, settingProperties := FromArguments(argumentNodes)
+
+			setting := Setting{
+				Name:       settingName,
+				RawName:    rawSettingName,
+				JavaType:   settingType,
+				Properties: settingProperties,
+				DefaultArg: defaultArg,
+				CodeLine:   n.StartPosition.Line,
+				Factory:    factory,
+				Arguments:  len(argumentNodes),
+
+				NameConstant:    ConstantReference(argumentNodes[0]),
+				DefaultConstant: ConstantReference(argumentNodes[1])}
+			setting.DefaultEnum, setting.DefaultEnumMethod, _, _ = EnumDefault(argumentNodes[1])
+			setting.Parser = Parser(argumentNodes)
+			setting.MinArg, setting.MaxArg = Bounds(factory, argumentNodes)
+
+			settings = append(settings, setting)
+		} else {
+			skipped = append(skipped, Skipped{RawName: rawSettingName, JavaType: settingType, CodeLine: n.StartPosition.Line, Factory: factory, Arguments: len(argumentNodes)})
+		}
+	}
+
+	return settings, skipped
+}
+
+// Endpoint is the address of the Babelfish server ExtractSource parses
+// with.
+var Endpoint = "localhost:9432"
+
+var (
+	clientMu sync.Mutex
+	client   *bblfsh.Client
+)
+
+// connect returns the client of Endpoint, connecting on first use.
+func connect() (*bblfsh.Client, error) {
+	clientMu.Lock()
+	defer clientMu.Unlock()
+
+	if client == nil {
+		c, err := bblfsh.NewClient(Endpoint)
+		if err != nil {
+			return nil, err
+		}
+		client = c
+	}
+	return client, nil
+}
+
+// Constants returns the static final constants a file declares with a
+// String or number literal, keyed by "ClassName.FIELD".
+func Constants(rootNode *uast.Node) map[string]string {
+	constants := map[string]string{}
+	classes, _ := tools.Filter(rootNode, "//TypeDeclaration")
+	for _, class := range classes {
+		className := roleToken(class, "name")
+		for _, field := range class.Children {
+			if field.InternalType != "FieldDeclaration" || !hasModifier(field, "static") || !hasModifier(field, "final") {
+				continue
+			}
+			for _, fragment := range field.Children {
+				if fragment.InternalType != "VariableDeclarationFragment" {
+					continue
+				}
+				for _, initializer := range fragment.Children {
+					if initializer.Properties["internalRole"] != "initializer" {
+						continue
+					}
+					switch initializer.InternalType {
+					case "StringLiteral":
+						constants[className+"."+roleToken(fragment, "name")] = strings.Trim(initializer.Token, "\"")
+					case "NumberLiteral":
+						value := initializer.Token
+						if value == "" {
+							value = initializer.Properties["token"]
+						}
+						constants[className+"."+roleToken(fragment, "name")] = strings.TrimRight(value, "lLfFdD")
+					}
+				}
+			}
+		}
+	}
+	return constants
+}
+
+// ResolveConstants replaces the names and defaults settings are given as
+// constants with their value in constants, keyed like the ones of
+// Constants. Constants written without their class are looked up in
+// className. The NameConstant and DefaultConstant of the settings resolved
+// are cleared, the others are left as written.
+func ResolveConstants(settings []Setting, className string, constants map[string]string) {
+	lookup := func(reference string) (string, bool) {
+		parts := strings.Split(reference, ".")
+		if len(parts) == 1 {
+			parts = []string{className, reference}
+		}
+		value, ok := constants[strings.Join(parts[len(parts)-2:], ".")]
+		return value, ok
+	}
+	for i := range settings {
+		s := &settings[i]
+		if value, ok := lookup(s.NameConstant); ok && s.NameConstant != "" {
+			s.Name, s.NameConstant = value, ""
+		}
+		if value, ok := lookup(s.DefaultConstant); ok && s.DefaultConstant != "" {
+			s.DefaultArg, s.DefaultConstant = value, ""
+		}
+	}
+}
+
+func roleToken(node *uast.Node, role string) string {
+	for _, child := range node.Children {
+		if child.Properties["internalRole"] == role {
+			return child.Token
+		}
+	}
+	return ""
+}
+
+func hasModifier(node *uast.Node, modifier string) bool {
+	for _, child := range node.Children {
+		if child.InternalType == "Modifier" && (child.Token == modifier || child.Properties["keyword"] == modifier) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExtractSource returns the settings declared in Java source read from src,
+// i.e. a snippet typed in an editor, without touching the filesystem. The
+// filename is only passed on to the parser for its error messages, it
+// doesn't have to exist.
+//
+// Affix settings are included, and the constants the source declares with
+// a literal are resolved. What takes the whole checkout the command line
+// walks isn't: constants declared in other files or as concatenations,
+// settings declared through helper methods, and defaults given as the
+// toString of an enum, which are the constant's name.
+func ExtractSource(ctx context.Context, filename string, src io.Reader) ([]Setting, error) {
+	content, err := ioutil.ReadAll(src)
+	if err != nil {
+		return nil, err
+	}
+
+	c, err := connect()
+	if err != nil {
+		return nil, err
+	}
+
+	res, err := c.NewParseRequest().Language("java").Content(string(content)).Filename(filename).DoWithContext(ctx)
+	if err == nil && res.Status != protocol.Ok {
+		err = errors.New(strings.Join(res.Errors, "; "))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+
+	settings := append(Settings(res.UAST), AffixSettings(res.UAST)...)
+	className := ""
+	if classes, _ := tools.Filter(res.UAST, "//TypeDeclaration"); len(classes) > 0 {
+		className = roleToken(classes[0], "name")
+	}
+	ResolveConstants(settings, className, Constants(res.UAST))
+	return settings, nil
+}
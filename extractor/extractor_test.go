@@ -0,0 +1,55 @@
+package extractor
+
+import (
+	"testing"
+
+	"gopkg.in/bblfsh/sdk.v1/uast"
+)
+
+func number(token string) *uast.Node {
+	return &uast.Node{InternalType: "NumberLiteral", Properties: map[string]string{"token": token}}
+}
+
+func TestBounds(t *testing.T) {
+	name := &uast.Node{InternalType: "StringLiteral", Token: `"index.number_of_shards"`}
+	for _, tc := range []struct {
+		factory   string
+		arguments []*uast.Node
+		min, max  string
+	}{
+		{"Setting.intSetting", []*uast.Node{name, number("5"), number("1"), number("1024")}, "1", "1024"},
+		{"Setting.intSetting", []*uast.Node{name, number("5"), number("1")}, "1", ""},
+		{"Setting.longSetting", []*uast.Node{name, number("5L"), number("0L")}, "0L", ""},
+		{"Setting.positiveTimeSetting", []*uast.Node{name, number("5")}, "0", ""},
+		{"Setting.boolSetting", []*uast.Node{name, {InternalType: "BooleanLiteral", Properties: map[string]string{"booleanValue": "true"}}, number("1")}, "", ""},
+		{"Setting.byteSizeSetting", []*uast.Node{name, number("1")}, "", ""},
+	} {
+		min, max := Bounds(tc.factory, tc.arguments)
+		if min != tc.min || max != tc.max {
+			t.Errorf("Bounds(%s, %d arguments) = %q, %q, want %q, %q", tc.factory, len(tc.arguments), min, max, tc.min, tc.max)
+		}
+	}
+}
+
+func TestResolveConstants(t *testing.T) {
+	settings := []Setting{
+		{Name: "KEY", NameConstant: "KEY", DefaultArg: "DEFAULT", DefaultConstant: "DEFAULT"},
+		{NameConstant: "IndexMetadata.SETTING_NUMBER_OF_SHARDS", DefaultArg: "1"},
+		{Name: "OTHER", NameConstant: "Other.OTHER"},
+	}
+	ResolveConstants(settings, "Snippet", map[string]string{
+		"Snippet.KEY":                            "snippet.key",
+		"Snippet.DEFAULT":                        "30s",
+		"IndexMetadata.SETTING_NUMBER_OF_SHARDS": "index.number_of_shards",
+	})
+
+	if s := settings[0]; s.Name != "snippet.key" || s.DefaultArg != "30s" || s.NameConstant != "" || s.DefaultConstant != "" {
+		t.Errorf("constants of the class weren't resolved: %+v", s)
+	}
+	if s := settings[1]; s.Name != "index.number_of_shards" || s.DefaultArg != "1" {
+		t.Errorf("a qualified constant wasn't resolved: %+v", s)
+	}
+	if s := settings[2]; s.Name != "OTHER" || s.NameConstant != "Other.OTHER" {
+		t.Errorf("an unknown constant was resolved: %+v", s)
+	}
+}